@@ -0,0 +1,99 @@
+"""Checks this client's protocol handling against the fixtures the server
+exports with `-export-fixtures DIR`:
+
+    python -m client.check_fixtures DIR
+
+The generated code must match the server's proto descriptors, every fixture
+must parse and re-encode to exactly the bytes the server produced, and
+replaying the map and deltas into a GameStateManager must reproduce the
+server's state checksum. Exits non-zero on any mismatch."""
+import json
+import os
+import sys
+
+from google.protobuf import descriptor_pb2, json_format
+from gen.python import game_pb2
+
+from . import state
+
+# Fixtures replayed, in order, before the state_checksum fixture was taken
+REPLAYED = ("initial_map_data", "delta_players_joined",
+            "delta_player_moved", "delta_player_moved_partial")
+
+
+def _read(directory, name):
+    with open(os.path.join(directory, name), "rb") as f:
+        return f.read()
+
+
+def check_descriptors(directory, manifest):
+    """Compares the compiled game.proto with the server's."""
+    server_set = descriptor_pb2.FileDescriptorSet.FromString(
+        _read(directory, manifest["descriptors"]))
+    ours = descriptor_pb2.FileDescriptorProto.FromString(
+        game_pb2.DESCRIPTOR.serialized_pb)
+    for file_proto in server_set.file:
+        if file_proto.name == ours.name:
+            if file_proto != ours:
+                return ["generated code differs from the server's game.proto; regenerate gen/python"]
+            return []
+    return [f"server descriptors do not include {ours.name}"]
+
+
+def check_messages(directory, manifest):
+    """Parses and re-encodes every fixture, returning problems and the parsed
+    messages by fixture name."""
+    problems, parsed = [], {}
+    for fixture in manifest["fixtures"]:
+        name = fixture["name"]
+        message_class = getattr(game_pb2, fixture["message"].split(".")[-1], None)
+        if message_class is None:
+            problems.append(f"{name}: unknown message {fixture['message']}")
+            continue
+        data = _read(directory, fixture["file"])
+        message = message_class.FromString(data)
+        if message.SerializeToString(deterministic=True) != data:
+            problems.append(f"{name}: re-encoding does not reproduce the server's bytes")
+        from_json = json_format.Parse(
+            _read(directory, fixture["json"]).decode("utf-8"), message_class())
+        if from_json != message:
+            problems.append(f"{name}: JSON and binary fixtures disagree")
+        parsed[name] = message
+    return problems, parsed
+
+
+def check_checksum(parsed):
+    """Replays the fixtures into a GameStateManager and compares its
+    checksums with the server's."""
+    if "state_checksum" not in parsed or any(n not in parsed for n in REPLAYED):
+        return ["fixtures for the checksum replay are missing"]
+    manager = state.GameStateManager()
+    manager.set_initial_map_data(parsed["initial_map_data"].initial_map_data)
+    for name in REPLAYED[1:]:
+        manager.apply_delta_update(parsed[name].delta_update)
+    expected = parsed["state_checksum"].state_checksum
+    players, count, tiles = manager.checksums()
+    if (players, count, tiles) != (expected.players_checksum, expected.player_count, expected.tiles_checksum):
+        return [f"state checksum {players:08x}/{count}/{tiles:08x} does not match the server's "
+                f"{expected.players_checksum:08x}/{expected.player_count}/{expected.tiles_checksum:08x}"]
+    return []
+
+
+def main(directory):
+    with open(os.path.join(directory, "manifest.json")) as f:
+        manifest = json.load(f)
+    problems = check_descriptors(directory, manifest)
+    message_problems, parsed = check_messages(directory, manifest)
+    problems += message_problems + check_checksum(parsed)
+    for problem in problems:
+        print(f"FAIL {problem}")
+    print(f"{len(manifest['fixtures'])} fixtures from map {manifest['map']}: "
+          f"{'ok' if not problems else f'{len(problems)} problems'}")
+    return 1 if problems else 0
+
+
+if __name__ == "__main__":
+    if len(sys.argv) != 2:
+        print(__doc__)
+        sys.exit(2)
+    sys.exit(main(sys.argv[1]))
@@ -4,7 +4,23 @@ from .utils import resource_path  # Import from local utils module
 # Server/Network
 # Remember to change if server address changes
 SERVER_ADDRESS = "192.168.41.108:50051"
+REGISTRY_ADDRESS = "192.168.41.108:50050"  # Server registry --servers and --browse ask
+LAN_SERVICE_TYPE = "_grpcgame._tcp.local."  # mDNS service servers started with -lan advertise
+LAN_DISCOVERY_SECONDS = 2.0  # How long --lan listens for servers
 FPS = 60
+TIME_SYNC_INTERVAL = 10.0  # Seconds between clock sync requests
+PING_GOOD_MS = 80  # Round trips below this show green, below PING_POOR_MS yellow
+PING_POOR_MS = 200
+MAX_MESSAGE_BYTES = 32 * 1024 * 1024  # Largest server message accepted
+JOIN_RETRIES = 3  # Times a dropped game stream rejoins before giving up
+# Network faults a server started with -fault-metadata injects into our stream,
+# for testing interpolation and reconnects, e.g. [("fault-delay", "150ms"),
+# ("fault-jitter", "50ms"), ("fault-drop", "0.05"), ("fault-disconnect", "0.001")]
+SIMULATED_FAULTS = []
+JOIN_RETRY_DELAY = 1.0  # Seconds between rejoin attempts
+UDP_SNAPSHOTS = True  # Take position snapshots over UDP when the server offers them
+UDP_HELLO_INTERVAL = 2.0  # Seconds between UdpHello datagrams keeping them coming
+UDP_FRAME_HISTORY = 64  # Ticks of snapshots kept as baselines for the server's deltas
 
 # Screen
 SCREEN_WIDTH = 800
@@ -41,3 +57,19 @@ AVAILABLE_COLORS = [
     (255, 255, 0), (0, 255, 255), (255, 0, 255), (0, 255, 0),
     (255, 165, 0), (255, 255, 255)
 ]
+
+# Team colors, for team 1 onwards in rooms with teams
+TEAM_COLORS = [(230, 60, 60), (60, 110, 230), (60, 190, 90), (230, 200, 40)]
+
+# Color of non-player characters
+NPC_COLOR = (120, 200, 120)
+
+# Emote bubble text by EmoteKind
+EMOTE_TEXT = {1: "o/", 2: "~ dance ~", 3: "haha!"}
+
+# Announcement banner colors by AnnouncementSeverity
+ANNOUNCEMENT_COLORS = {0: (90, 160, 255), 1: (255, 180, 0), 2: (230, 40, 40)}
+
+# Item colors by ItemKind
+ITEM_COLORS = {1: (255, 215, 0), 2: (230, 40, 70), 3: (180, 180, 200),
+               4: (255, 255, 90), 5: (200, 200, 255), 6: (80, 220, 255)}
@@ -7,6 +7,7 @@ from . import (
     ui
 )
 from . import config
+import getpass
 import queue
 import traceback
 import time
@@ -22,6 +23,10 @@ except ModuleNotFoundError as e:
     game_pb2 = None  # Allow limited continuation if only used for type hints
     sys.exit(1)
 
+# Number keys for the emotes
+EMOTE_KEYS = {pygame.K_1: game_pb2.EMOTE_WAVE, pygame.K_2: game_pb2.EMOTE_DANCE,
+              pygame.K_3: game_pb2.EMOTE_LAUGH}
+
 
 class GameClient:
     """Main game client class orchestrating all components."""
@@ -38,6 +43,30 @@ class GameClient:
         self.server_message_queue = queue.Queue()  # Queue for messages from network thread
         self.network_handler = network.NetworkHandler(
             config.SERVER_ADDRESS, self.state_manager, self.server_message_queue)
+        self.network_handler.set_tutorial("--tutorial" in sys.argv)
+        if "--map" in sys.argv[:-1]:
+            self.network_handler.set_map(
+                sys.argv[sys.argv.index("--map") + 1])
+        self.network_handler.set_find_match("--find-match" in sys.argv)
+        if "--team" in sys.argv[:-1]:
+            self.network_handler.set_team(
+                int(sys.argv[sys.argv.index("--team") + 1]))
+        if "--skin" in sys.argv[:-1]:
+            self.network_handler.set_skin(
+                sys.argv[sys.argv.index("--skin") + 1])
+        if "--room" in sys.argv[:-1]:
+            password = ""
+            if "--password" in sys.argv[:-1]:
+                password = sys.argv[sys.argv.index("--password") + 1]
+            self.network_handler.set_room(
+                sys.argv[sys.argv.index("--room") + 1], password)
+        self.account_username = ""
+        for flag in ("--login", "--register"):
+            if flag in sys.argv[:-1]:
+                self.account_username = sys.argv[sys.argv.index(flag) + 1]
+                self.network_handler.set_account(
+                    self.account_username, getpass.getpass(f"Password for {self.account_username}: "),
+                    register=flag == "--register")
         self.running = False
         self.username = ""
         print("GameClient Initialized.")
@@ -99,6 +128,8 @@ class GameClient:
 
                 if message_type == "map_data":
                     self.state_manager.set_initial_map_data(message_data)
+                    self.renderer.set_tile_definitions(
+                        message_data.tile_definitions)
                     # Update renderer's tile size if needed (Renderer checks internally now)
                     _, _, _, tile_size = self.state_manager.get_map_data()
                     if self.renderer.tile_size != tile_size:
@@ -108,9 +139,68 @@ class GameClient:
                         # TODO: Potentially trigger re-extraction of tile graphics in renderer here
                 elif message_type == "delta_update":
                     self.state_manager.apply_delta_update(message_data)
+                elif message_type == "map_chunk":
+                    self.state_manager.apply_map_chunk(message_data)
+                elif message_type == "map_tile_update":
+                    self.state_manager.apply_tile_updates(message_data)
+                elif message_type == "tick_rate":
+                    self.state_manager.set_tick_interval(
+                        message_data.tick_interval_ms)
+                elif message_type == "tutorial":
+                    self.state_manager.set_tutorial_prompt(message_data)
+                elif message_type == "checksum":
+                    self.check_desync(message_data)
+                elif message_type == "tag":
+                    since = self.network_handler.local_time_of(
+                        message_data.it_since_server_ms)
+                    self.state_manager.set_it_since(
+                        since if since is not None else time.time())
+                elif message_type == "attack":
+                    self.state_manager.add_attack(message_data)
+                elif message_type == "pause":
+                    self.state_manager.set_pause(message_data)
+                elif message_type == "announcement":
+                    until = self.network_handler.local_time_of(
+                        message_data.expires_at_unix_ms)
+                    self.state_manager.set_announcement(
+                        message_data,
+                        until if until is not None else message_data.expires_at_unix_ms / 1000.0)
+                elif message_type == "sync_rtt":
+                    self.state_manager.set_sync_rtt(message_data)
+                elif message_type == "udp_snapshot":
+                    self.state_manager.apply_udp_snapshot(*message_data)
+                elif message_type == "correction":
+                    self.state_manager.apply_position_correction(message_data)
+                elif message_type == "emote":
+                    until = self.network_handler.local_time_of(
+                        message_data.until_unix_ms)
+                    self.state_manager.add_emote(
+                        message_data.player_id, message_data.kind,
+                        until if until is not None else time.time() + 2.0)
+                elif message_type == "player_died":
+                    if message_data.player_id == self.state_manager.get_my_player_id():
+                        respawn_at = self.network_handler.local_time_of(
+                            message_data.respawn_at_unix_ms)
+                        self.state_manager.set_respawn_at(
+                            respawn_at if respawn_at is not None
+                            else message_data.respawn_at_unix_ms / 1000.0)
+                elif message_type == "scoreboard":
+                    self.state_manager.set_scoreboard(message_data)
+                elif message_type == "countdown":
+                    start = self.network_handler.local_time_of(
+                        message_data.start_server_ms)
+                    if start is None:  # Not synced yet; count ticks instead
+                        ticks = message_data.start_tick - message_data.current_tick
+                        start = time.time() + ticks * \
+                            self.state_manager.get_tick_interval_ms() / 1000.0
+                    self.state_manager.set_countdown(start)
                 elif message_type == "chat":
                     # Pass received chat message to ChatManager
                     self.chat_manager.add_message(message_data)
+                elif message_type == "chat_history":
+                    # Recent messages sent on joining a room or channel
+                    for chat_message in message_data.messages:
+                        self.chat_manager.add_message(chat_message)
                 else:
                     print(f"Warn: Unknown queue msg type: {message_type}")
         except queue.Empty:
@@ -119,9 +209,22 @@ class GameClient:
             print(f"Error processing server message queue: {e}")
             traceback.print_exc()  # Print full traceback for queue errors
 
+    def check_desync(self, checksum):
+        """Compares the local state with a server StateChecksum and reports a
+        mismatch back to the server."""
+        players, count, tiles = self.state_manager.checksums()
+        players_ok = players == checksum.players_checksum and count == checksum.player_count
+        tiles_ok = tiles == 0 or tiles == checksum.tiles_checksum
+        if players_ok and tiles_ok:
+            return
+        print(f"Client: State diverged from the server at tick {checksum.tick} "
+              f"(players ok: {players_ok}, tiles ok: {tiles_ok})")
+        self.network_handler.send_desync_report(checksum.tick, players, count, tiles)
+
     def run(self):
         """Main game loop."""
-        self.username = self.get_username_input()
+        # A logged-in player always plays under the account's username.
+        self.username = self.account_username or self.get_username_input()
         if self.username is None:  # User quit during input
             self.shutdown()
             return
@@ -202,6 +305,15 @@ class GameClient:
                     # Chat Toggle 'T'
                     elif event.key == pygame.K_t and not self.chat_manager.is_active():
                         self.chat_manager.toggle_active()
+                    # Respawn 'R'
+                    elif event.key == pygame.K_r and not self.chat_manager.is_active():
+                        self.network_handler.send_respawn_request()
+                    # Attack 'Space', in combat rooms
+                    elif event.key == pygame.K_SPACE and not self.chat_manager.is_active():
+                        self.network_handler.send_attack()
+                    # Emotes '1' wave, '2' dance, '3' laugh
+                    elif event.key in EMOTE_KEYS and not self.chat_manager.is_active():
+                        self.network_handler.send_emote(EMOTE_KEYS[event.key])
                     # Pass other keydown events to ChatManager if it's active
                     elif self.chat_manager.is_active():
                         message_to_send = self.chat_manager.handle_input_event(
@@ -252,7 +364,79 @@ class GameClient:
         print("Client: Shutdown complete.")
 
 
+def print_rooms():
+    """Prints the server's joinable rooms for --rooms."""
+    rooms = network.list_rooms(config.SERVER_ADDRESS)
+    if not rooms:
+        print("No joinable rooms.")
+    for room in rooms:
+        lock = " (password)" if room.password_protected else ""
+        teams = f" {room.teams} teams" if room.teams else ""
+        print(f"{room.room_id:14} {room.name[:24]:24} {room.map_name:16} "
+              f"{room.player_count}/{room.max_players}{teams}{lock}")
+
+
+def print_servers(servers):
+    """Prints a registry's game servers, numbered from 1."""
+    if not servers:
+        print("No servers registered.")
+    for i, server in enumerate(servers, 1):
+        region = f" [{server.region}]" if server.region else ""
+        print(f"{i:3}. {server.name[:24]:24} {server.address:21} {server.map_name:16} "
+              f"{server.player_count}/{server.max_players}{region}")
+
+
+def choose_server(servers):
+    """Lets the player pick one of the servers for --browse and --lan,
+    returning its address, or None to quit."""
+    print_servers(servers)
+    while servers:
+        choice = input("Join server number (empty to quit): ").strip()
+        if not choice:
+            return None
+        if choice.isdigit() and 1 <= int(choice) <= len(servers):
+            return servers[int(choice) - 1].address
+        print(f"Pick a number from 1 to {len(servers)}.")
+    return None
+
+
+def print_leaderboard():
+    """Prints the server's top accounts by score for --leaderboard."""
+    entries = network.get_leaderboard(config.SERVER_ADDRESS)
+    if not entries:
+        print("No ranked players yet.")
+    for entry in entries:
+        account = entry.account
+        print(f"{entry.rank:3}. {account.username:20} {account.score:6} points "
+              f"{account.tiles_visited:6} tiles {account.play_seconds // 60:6} min")
+
+
 if __name__ == "__main__":
+    if "--registry" in sys.argv[:-1]:
+        config.REGISTRY_ADDRESS = sys.argv[sys.argv.index("--registry") + 1]
+    if "--server" in sys.argv[:-1]:
+        config.SERVER_ADDRESS = sys.argv[sys.argv.index("--server") + 1]
+    region = sys.argv[sys.argv.index("--region") + 1] if "--region" in sys.argv[:-1] else ""
+    if "--servers" in sys.argv:
+        print_servers(network.list_servers(config.REGISTRY_ADDRESS, region))
+        sys.exit(0)
+    if "--browse" in sys.argv:
+        address = choose_server(network.list_servers(config.REGISTRY_ADDRESS, region))
+        if address is None:
+            sys.exit(0)
+        config.SERVER_ADDRESS = address
+    elif "--lan" in sys.argv:
+        print("Looking for servers on the local network...")
+        address = choose_server(network.discover_lan_servers())
+        if address is None:
+            sys.exit(0)
+        config.SERVER_ADDRESS = address
+    if "--rooms" in sys.argv:
+        print_rooms()
+        sys.exit(0)
+    if "--leaderboard" in sys.argv:
+        print_leaderboard()
+        sys.exit(0)
     # Ensure Pygame initializes fonts correctly before GameClient uses them
     pygame.init()
     pygame.font.init()  # Explicitly init font system
@@ -1,7 +1,10 @@
 # client/network.py
 import grpc
+import hashlib
+import socket
 import threading
 import time
+import uuid
 import queue
 import sys
 
@@ -19,6 +22,9 @@ from typing import TYPE_CHECKING
 if TYPE_CHECKING:
     from .state import GameStateManager
 
+from . import config
+from .utils import resource_path
+
 
 class NetworkHandler:
     """Handles gRPC communication in a separate thread."""
@@ -36,12 +42,142 @@ class NetworkHandler:
         self.stub = None
         self.channel = None
         self._username_to_send = "Player"
+        self._tutorial = False
+        self._map_name = ""
+        self._room_id = ""
+        self._room_password = ""
+        self._find_match = False
+        self._team = 0  # Preferred team in rooms with teams; 0 for any
+        self._skin = ""  # Skin to wear; empty lets the server pick
+        self._account = None  # (username, password, register) to log in with
+        self._session_token = ""
+        self._handoff_ticket = ""  # Admits us to the server of the zone we walked into
+        self._join_request_id = uuid.uuid4().hex  # Lets the server spot retried joins
+        self._clock_offset_ms = None  # Server clock minus ours, once synced
+        self._input_seq = 0  # Numbers our inputs for PositionCorrection
+        self._last_time_sync = 0.0
         self._stream_started = threading.Event()
+        self._udp_socket = None  # Receives position snapshots once offered
 
     def set_username(self, username: str):
         """Sets the username to be sent in ClientHello."""
         self._username_to_send = username if username else "Player"
 
+    def set_tutorial(self, tutorial: bool):
+        """Requests a single-player tutorial room instead of the lobby."""
+        self._tutorial = tutorial
+
+    def set_map(self, map_name: str):
+        """Requests the shared world on the named map instead of the lobby."""
+        self._map_name = map_name or ""
+
+    def set_room(self, room_id: str, password: str = ""):
+        """Requests a specific room instead of the lobby."""
+        self._room_id = room_id or ""
+        self._room_password = password or ""
+
+    def set_team(self, team: int):
+        """Asks for a team in rooms with teams; 0 takes the smallest."""
+        self._team = team
+
+    def set_skin(self, skin: str):
+        """Asks for a skin, such as "red"; empty lets the server pick."""
+        self._skin = skin or ""
+
+    def set_find_match(self, find_match: bool):
+        """Queues for a matchmade room instead of joining the lobby."""
+        self._find_match = find_match
+
+    def set_account(self, username: str, password: str, register: bool = False):
+        """Logs in to an account, or registers it, when connecting. The
+        player then joins under the account's username."""
+        self._account = (username, password, register)
+
+    def _check_assets(self):
+        """Compares our art with the server's asset manifest, warning about
+        files that are missing or differ. The game still runs, drawn with
+        whatever art we have."""
+        try:
+            manifest = self.stub.GetAssetManifest(
+                game_pb2.AssetManifestRequest(), timeout=5)
+        except grpc.RpcError as e:
+            print(f"NetHandler: Could not check assets: {e.details()}")
+            return
+        for asset in manifest.assets:
+            if not asset.sha256:
+                continue
+            try:
+                with open(resource_path(f"assets/{asset.file}"), "rb") as f:
+                    digest = hashlib.sha256(f.read()).hexdigest()
+            except OSError:
+                print(f"NetHandler: Warning: asset '{asset.id}' ({asset.file}) is missing.")
+                continue
+            if digest != asset.sha256:
+                print(f"NetHandler: Warning: asset '{asset.id}' ({asset.file}) "
+                      f"differs from the server's.")
+
+    def _log_in(self):
+        """Exchanges the account's credentials for a session token."""
+        username, password, register = self._account
+        request = game_pb2.AccountRequest(username=username, password=password)
+        try:
+            if register:
+                response = self.stub.Register(request, timeout=10)
+            else:
+                response = self.stub.Login(request, timeout=10)
+        except grpc.RpcError as e:
+            raise RuntimeError(f"{'Registration' if register else 'Login'} failed: {e.details()}")
+        self._session_token = response.session_token
+        self._username_to_send = response.account.username
+        print(f"NetHandler: Logged in as {response.account.username} "
+              f"({response.account.sessions} sessions, "
+              f"{response.account.play_seconds // 60} minutes played).")
+
+    def _wait_for_match(self):
+        """Waits in the matchmaking queue, then targets the matched room."""
+        request = game_pb2.FindMatchRequest(map_name=self._map_name)
+        for update in self.stub.FindMatch(request):
+            if update.HasField("queue_position"):
+                pos = update.queue_position
+                print(f"NetHandler: In matchmaking queue, position {pos.position} "
+                      f"of {pos.queue_size} ({pos.match_size} needed).")
+            elif update.HasField("match_found"):
+                found = update.match_found
+                print(f"NetHandler: Match found in room {found.room.room_id}.")
+                self._map_name = ""
+                self.set_room(found.room.room_id, found.room_password)
+                return
+        raise RuntimeError("matchmaking ended without a match")
+
+    def _current_input(self):
+        """Builds a PlayerInput for the held direction, stamped with the
+        estimated server time once the clock is synced."""
+        with self.direction_lock:
+            dir_to_send = self.input_direction
+        self._input_seq += 1
+        input_msg = game_pb2.PlayerInput(direction=dir_to_send, seq=self._input_seq)
+        offset = self._clock_offset_ms
+        if offset is not None:
+            input_msg.sent_at_server_ms = int(time.time() * 1000) + offset
+        return game_pb2.ClientMessage(player_input=input_msg)
+
+    def _handle_time_sync(self, response):
+        """Updates the clock offset from a TimeSyncResponse, assuming the
+        request and reply took equally long."""
+        now_ms = int(time.time() * 1000)
+        self._clock_offset_ms = response.server_time_ms - \
+            (response.client_time_ms + now_ms) // 2
+        self.incoming_queue.put(
+            ("sync_rtt", now_ms - response.client_time_ms))
+
+    def local_time_of(self, server_ms):
+        """Converts a server clock time in ms to a local time.time() value,
+        or returns None before the first TimeSyncResponse."""
+        offset = self._clock_offset_ms
+        if offset is None:
+            return None
+        return (server_ms - offset) / 1000.0
+
     def _message_generator(self):
         """Generator yields ClientHello, then messages from outgoing_queue, then PlayerInput."""
         try:
@@ -49,7 +185,15 @@ class NetworkHandler:
             print(
                 f"NetHandler GEN: Sending ClientHello for '{self._username_to_send}'")
             hello_msg = game_pb2.ClientHello(
-                desired_username=self._username_to_send)
+                desired_username=self._username_to_send, tutorial=self._tutorial,
+                map_name=self._map_name, room_id=self._room_id,
+                room_password=self._room_password, supports_map_chunks=True,
+                supports_partial_players=True,
+                supports_udp_snapshots=config.UDP_SNAPSHOTS,
+                max_message_bytes=config.MAX_MESSAGE_BYTES,
+                join_request_id=self._join_request_id,
+                session_token=self._session_token, team=self._team,
+                skin=self._skin, handoff_ticket=self._handoff_ticket)
             yield game_pb2.ClientMessage(client_hello=hello_msg)
             print("NetHandler GEN: ClientHello sent.")
             self._stream_started.set()
@@ -57,6 +201,10 @@ class NetworkHandler:
             # 2. Send other messages (Chat first, then Input)
             while not self.stop_event.is_set():
                 outgoing_msg_to_yield = None
+                if time.time() - self._last_time_sync >= config.TIME_SYNC_INTERVAL:
+                    self._last_time_sync = time.time()
+                    yield game_pb2.ClientMessage(time_sync=game_pb2.TimeSyncRequest(
+                        client_time_ms=int(time.time() * 1000)))
                 try:
                     # Check for priority messages (like chat) first, non-blocking
                     retrieved_item = self.outgoing_queue.get_nowait()
@@ -71,21 +219,13 @@ class NetworkHandler:
 
                 except queue.Empty:
                     # No priority message OR unexpected type found, send current player input
-                    with self.direction_lock:
-                        dir_to_send = self.input_direction
-                    input_msg = game_pb2.PlayerInput(direction=dir_to_send)
-                    outgoing_msg_to_yield = game_pb2.ClientMessage(
-                        player_input=input_msg)
+                    outgoing_msg_to_yield = self._current_input()
 
                 except Exception as e:
                     print(
                         f"NetHandler GEN OutQueue Err: Type={type(e).__name__}, Msg='{e}'")
                     # Fallback to sending input
-                    with self.direction_lock:
-                        dir_to_send = self.input_direction
-                    input_msg = game_pb2.PlayerInput(direction=dir_to_send)
-                    outgoing_msg_to_yield = game_pb2.ClientMessage(
-                        player_input=input_msg)
+                    outgoing_msg_to_yield = self._current_input()
 
                 if outgoing_msg_to_yield:
                     msg_type = outgoing_msg_to_yield.WhichOneof(
@@ -104,25 +244,103 @@ class NetworkHandler:
             # Potentially signal error to main thread more directly here
 
     def _listen_for_updates(self):
-        """The main loop for the network thread."""
+        """The main loop for the network thread. A stream lost as unavailable
+        is retried a few times with the same join request ID, so the server
+        hands back our player instead of adding a second one."""
         print("NetHandler: Connecting...")
+        retries_left = config.JOIN_RETRIES
         try:
-            # Create stream using the generator
-            stream = self.stub.GameStream(self._message_generator())
-            print("NetHandler: Stream started.")
-
-            # Process incoming messages from server
-            for message in stream:
-                if self.stop_event.is_set():
-                    break
-                if message.HasField("initial_map_data"):
-                    self.incoming_queue.put(
-                        ("map_data", message.initial_map_data))
-                elif message.HasField("delta_update"):
-                    self.incoming_queue.put(
-                        ("delta_update", message.delta_update))
-                elif message.HasField("chat_message"):
-                    self.incoming_queue.put(("chat", message.chat_message))
+            while True:
+                try:
+                    # Create stream using the generator
+                    stream = self.stub.GameStream(
+                        self._message_generator(), metadata=config.SIMULATED_FAULTS or None
+                    )
+                    print("NetHandler: Stream started.")
+                    handoff = None
+
+                    # Process incoming messages from server
+                    for message in stream:
+                        if self.stop_event.is_set():
+                            break
+                        if message.HasField("initial_map_data"):
+                            self.incoming_queue.put(
+                                ("map_data", message.initial_map_data))
+                        elif message.HasField("delta_update"):
+                            self.incoming_queue.put(
+                                ("delta_update", message.delta_update))
+                        elif message.HasField("chat_message"):
+                            self.incoming_queue.put(("chat", message.chat_message))
+                        elif message.HasField("chat_history"):
+                            self.incoming_queue.put(
+                                ("chat_history", message.chat_history))
+                        elif message.HasField("map_chunk"):
+                            self.incoming_queue.put(("map_chunk", message.map_chunk))
+                        elif message.HasField("map_tile_update"):
+                            self.incoming_queue.put(
+                                ("map_tile_update", message.map_tile_update))
+                        elif message.HasField("tick_rate_update"):
+                            self.incoming_queue.put(
+                                ("tick_rate", message.tick_rate_update))
+                        elif message.HasField("time_sync"):
+                            self._handle_time_sync(message.time_sync)
+                        elif message.HasField("ping"):
+                            self.outgoing_queue.put(game_pb2.ClientMessage(
+                                pong=game_pb2.Pong(server_time_ms=message.ping.server_time_ms)))
+                        elif message.HasField("tutorial_prompt"):
+                            self.incoming_queue.put(
+                                ("tutorial", message.tutorial_prompt))
+                        elif message.HasField("countdown"):
+                            self.incoming_queue.put(("countdown", message.countdown))
+                        elif message.HasField("state_checksum"):
+                            self.incoming_queue.put(
+                                ("checksum", message.state_checksum))
+                        elif message.HasField("tag_update"):
+                            self.incoming_queue.put(("tag", message.tag_update))
+                        elif message.HasField("attack_event"):
+                            self.incoming_queue.put(
+                                ("attack", message.attack_event))
+                        elif message.HasField("position_correction"):
+                            self.incoming_queue.put(
+                                ("correction", message.position_correction))
+                        elif message.HasField("emote_event"):
+                            self.incoming_queue.put(
+                                ("emote", message.emote_event))
+                        elif message.HasField("player_died"):
+                            self.incoming_queue.put(
+                                ("player_died", message.player_died))
+                        elif message.HasField("scoreboard"):
+                            self.incoming_queue.put(
+                                ("scoreboard", message.scoreboard))
+                        elif message.HasField("pause_state"):
+                            self.incoming_queue.put(
+                                ("pause", message.pause_state))
+                        elif message.HasField("udp_offer"):
+                            self._start_udp(message.udp_offer)
+                        elif message.HasField("announcement"):
+                            self.incoming_queue.put(
+                                ("announcement", message.announcement))
+                        elif message.HasField("disconnect_notice"):
+                            notice = message.disconnect_notice
+                            if notice.HasField("handoff"):
+                                handoff = notice.handoff
+                                break
+                            print(f"NetHandler: Disconnected by server ({notice.reason}): {notice.message}")
+                            self.state_manager.set_connection_error(notice.message)
+                            self.stop_event.set()  # Don't report the stream ending as an error
+                    if handoff is None:
+                        break  # Stream ended normally
+                    stream.cancel()
+                    self._switch_zone(handoff)
+                    retries_left = config.JOIN_RETRIES
+                except grpc.RpcError as e:
+                    if (e.code() != grpc.StatusCode.UNAVAILABLE or retries_left == 0
+                            or self.stop_event.is_set()):
+                        raise
+                    retries_left -= 1
+                    print(f"NetHandler: Connection lost ({e.details()}), retrying join...")
+                    self._stream_started.clear()
+                    time.sleep(config.JOIN_RETRY_DELAY)
 
         except grpc.RpcError as e:
             # Handle gRPC specific errors (connection loss, etc.)
@@ -145,6 +363,92 @@ class NetworkHandler:
             print("NetHandler: Listener finished.")
             self._stream_started.clear()  # Clear stream readiness signal
             self.stop_event.set()  # Ensure stop is set on any exit path
+            self._close_udp()
+
+    def _start_udp(self, offer):
+        """Starts taking position snapshots over UDP as the server offered,
+        replacing the socket of an earlier offer after a rejoin."""
+        self._close_udp()
+        host = self.server_address.rsplit(":", 1)[0].strip("[]")
+        try:
+            address = socket.getaddrinfo(host, offer.port, type=socket.SOCK_DGRAM)[0]
+            sock = socket.socket(address[0], socket.SOCK_DGRAM)
+        except OSError as e:
+            print(f"NetHandler: UDP snapshots unavailable ({e}); using the stream only.")
+            return
+        sock.settimeout(0.5)
+        self._udp_socket = sock
+        threading.Thread(target=self._receive_udp,
+                         args=(sock, address[4], offer.token), daemon=True).start()
+        print(f"NetHandler: Taking position snapshots over UDP from port {offer.port}.")
+
+    def _receive_udp(self, sock, address, token):
+        """Sends UdpHello every few seconds, and after each snapshot to
+        acknowledge it, and queues the positions snapshots resolve to, until
+        stopped or replaced. Lost datagrams are fine: the stream's deltas
+        carry every position too."""
+        ack_tick = 0
+        last_hello = 0.0
+        parts = {}  # Tick -> datagrams of a snapshot still arriving
+        frames = {}  # Tick -> positions we hold after it, baselines for deltas
+        while not self.stop_event.is_set() and self._udp_socket is sock:
+            try:
+                if time.time() - last_hello >= config.UDP_HELLO_INTERVAL:
+                    sock.sendto(game_pb2.UdpHello(token=token, ack_tick=ack_tick).SerializeToString(), address)
+                    last_hello = time.time()
+                data = sock.recv(65536)
+            except socket.timeout:
+                continue
+            except OSError:
+                break  # Closed, or the network is unreachable
+            snapshot = game_pb2.UdpSnapshot()
+            try:
+                snapshot.ParseFromString(data)
+            except Exception:
+                continue
+            received = parts.setdefault(snapshot.tick, [])
+            received.append(snapshot)
+            if len(received) < max(snapshot.parts, 1):
+                continue
+            del parts[snapshot.tick]
+            if snapshot.base_tick == 0:
+                positions = {}
+            elif snapshot.base_tick in frames:
+                positions = dict(frames[snapshot.base_tick])
+            else:
+                continue  # Baseline long gone; a keyframe will follow
+            for part in received:
+                for position in part.players:
+                    positions[position.id] = position
+            frames[snapshot.tick] = positions
+            for tick in [t for t in frames if t + config.UDP_FRAME_HISTORY < snapshot.tick]:
+                del frames[tick]
+            for tick in [t for t in parts if t + config.UDP_FRAME_HISTORY < snapshot.tick]:
+                del parts[tick]
+            ack_tick = max(ack_tick, snapshot.tick) if snapshot.base_tick else snapshot.tick
+            last_hello = 0.0  # Acknowledge it now
+            self.incoming_queue.put(("udp_snapshot", (snapshot.tick, positions)))
+
+    def _switch_zone(self, handoff):
+        """Moves us to the server hosting the zone of a sharded world we
+        walked into; the next stream joins it with the handoff ticket."""
+        print(f"NetHandler: Crossing into zone {handoff.zone_id} at {handoff.address}")
+        self._close_udp()
+        old_channel = self.channel
+        self.server_address = handoff.address
+        self.channel = grpc.insecure_channel(self.server_address, options=[
+            ("grpc.max_receive_message_length", config.MAX_MESSAGE_BYTES)])
+        self.stub = game_pb2_grpc.GameServiceStub(self.channel)
+        if old_channel:
+            old_channel.close()
+        self._handoff_ticket = handoff.ticket
+        self._join_request_id = uuid.uuid4().hex
+        self._stream_started.clear()
+
+    def _close_udp(self):
+        sock, self._udp_socket = self._udp_socket, None
+        if sock is not None:
+            sock.close()
 
     def send_chat_message(self, text: str):
         """Queues a chat message to be sent to the server."""
@@ -159,14 +463,52 @@ class NetworkHandler:
         else:
             print("NetHandler SEND: Cannot send chat, stream not ready.")
 
+    def send_respawn_request(self):
+        """Queues a request to respawn at a spawn point."""
+        if self._stream_started.is_set():
+            self.outgoing_queue.put(game_pb2.ClientMessage(
+                respawn_request=game_pb2.RespawnRequest()))
+
+    def send_attack(self):
+        """Queues an attack on the players within reach (combat rooms)."""
+        if self._stream_started.is_set():
+            request = game_pb2.AttackRequest()
+            if self._clock_offset_ms is not None:
+                request.sent_at_server_ms = int(time.time() * 1000) + self._clock_offset_ms
+            self.outgoing_queue.put(game_pb2.ClientMessage(attack=request))
+
+    def send_emote(self, kind):
+        """Queues an emote (an EmoteKind) for the players nearby."""
+        if self._stream_started.is_set():
+            self.outgoing_queue.put(game_pb2.ClientMessage(
+                emote=game_pb2.EmoteRequest(kind=kind)))
+
+    def send_desync_report(self, tick, players_checksum, player_count, tiles_checksum):
+        """Tells the server our state did not match its checksum."""
+        if self._stream_started.is_set():
+            self.outgoing_queue.put(game_pb2.ClientMessage(
+                desync_report=game_pb2.DesyncReport(
+                    tick=tick, players_checksum=players_checksum,
+                    player_count=player_count, tiles_checksum=tiles_checksum)))
+
     def start(self) -> bool:
         """Connects to the server and starts the network thread."""
         print(f"NetHandler: Attempting to connect to {self.server_address}...")
         try:
-            self.channel = grpc.insecure_channel(self.server_address)
+            self.channel = grpc.insecure_channel(self.server_address, options=[
+                ("grpc.max_receive_message_length", config.MAX_MESSAGE_BYTES)])
             grpc.channel_ready_future(self.channel).result(timeout=5)
             print("NetHandler: Channel connected.")
             self.stub = game_pb2_grpc.GameServiceStub(self.channel)
+            self._check_assets()
+            if self._account and not self._session_token:
+                self._log_in()
+            if self._find_match:
+                self._wait_for_match()
+            if self._room_id:
+                # Fail early with a clear message for a bad ID or password.
+                self.stub.JoinRoom(game_pb2.JoinRoomRequest(
+                    room_id=self._room_id, password=self._room_password), timeout=5)
             self.stop_event.clear()
             self._stream_started.clear()
             self.thread = threading.Thread(
@@ -181,6 +523,12 @@ class NetworkHandler:
             if self.channel:
                 self.channel.close()  # Close channel if created
             return False
+        except grpc.RpcError as e:
+            err_msg = f"Cannot join a room: {e.details()}"
+            print(err_msg)
+            self.state_manager.set_connection_error(err_msg)
+            self.channel.close()
+            return False
         except Exception as e:
             err_msg = f"Connection error: {e}"
             print(err_msg)
@@ -211,3 +559,71 @@ class NetworkHandler:
             with self.direction_lock:
                 if self.input_direction != new_direction:
                     self.input_direction = new_direction
+
+
+def list_rooms(server_address: str, map_name: str = ""):
+    """Returns the joinable rooms on a server as RoomInfo messages."""
+    with grpc.insecure_channel(server_address) as channel:
+        stub = game_pb2_grpc.GameServiceStub(channel)
+        return stub.ListRooms(game_pb2.ListRoomsRequest(map_name=map_name), timeout=5).rooms
+
+
+def list_servers(registry_address: str, region: str = ""):
+    """Returns the game servers listed in a registry as ServerListing
+    messages, busiest first."""
+    with grpc.insecure_channel(registry_address) as channel:
+        stub = game_pb2_grpc.RegistryServiceStub(channel)
+        return stub.ListServers(game_pb2.ListServersRequest(region=region), timeout=5).servers
+
+
+def discover_lan_servers(timeout: float = config.LAN_DISCOVERY_SECONDS):
+    """Listens for servers advertised on the local network with mDNS
+    (started with -lan), returning them as ServerListing messages, busiest
+    first. Needs the zeroconf package."""
+    from zeroconf import ServiceBrowser, Zeroconf
+
+    class Collector:
+        def __init__(self):
+            self.names = []
+
+        def add_service(self, zc, type_, name):
+            self.names.append(name)
+
+        def update_service(self, zc, type_, name):
+            pass
+
+        def remove_service(self, zc, type_, name):
+            pass
+
+    zc = Zeroconf()
+    try:
+        collector = Collector()
+        ServiceBrowser(zc, config.LAN_SERVICE_TYPE, collector)
+        time.sleep(timeout)
+        servers = []
+        for name in collector.names:
+            info = zc.get_service_info(config.LAN_SERVICE_TYPE, name, timeout=1000)
+            if info is None or not info.parsed_addresses():
+                continue
+            txt = {k.decode(): (v or b"").decode() for k, v in info.properties.items()}
+            servers.append(game_pb2.ServerListing(
+                name=txt.get("name", name.split(".")[0]),
+                address=f"{info.parsed_addresses()[0]}:{info.port}",
+                map_name=txt.get("map", ""),
+                player_count=int(txt.get("players", 0)),
+                max_players=int(txt.get("max", 0))))
+        servers.sort(key=lambda s: (-s.player_count, s.name))
+        return servers
+    finally:
+        zc.close()
+
+
+def get_leaderboard(server_address: str, metric=None, page_size: int = 20):
+    """Returns the first page of a server's leaderboard as LeaderboardEntry
+    messages, ranked by score unless another LeaderboardMetric is given."""
+    if metric is None:
+        metric = game_pb2.LEADERBOARD_SCORE
+    with grpc.insecure_channel(server_address) as channel:
+        stub = game_pb2_grpc.GameServiceStub(channel)
+        request = game_pb2.GetLeaderboardRequest(metric=metric, page_size=page_size)
+        return stub.GetLeaderboard(request, timeout=5).entries
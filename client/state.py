@@ -1,10 +1,47 @@
 # client/state.py
+import math
+import struct
 import threading
+import time
 from gen.python import game_pb2
 
 # Import config constants if needed directly, or receive them via methods
 from .config import AVAILABLE_COLORS
 
+UNLOADED_TILE = -1  # Map cell of a streamed map whose chunk has not arrived
+
+
+def _apply_player_patch(player, patch):
+    """Copies the fields flagged in patch.changed_fields onto player."""
+    mask = patch.changed_fields
+    if mask & game_pb2.PLAYER_FIELD_POSITION:
+        player.x_pos = patch.x_pos
+        player.y_pos = patch.y_pos
+    if mask & game_pb2.PLAYER_FIELD_ANIMATION:
+        player.current_animation_state = patch.current_animation_state
+    if mask & game_pb2.PLAYER_FIELD_METADATA:
+        player.username = patch.username
+        player.display_name = patch.display_name
+        player.skin = patch.skin
+        player.color = patch.color
+        player.invulnerable = patch.invulnerable
+        player.it = patch.it
+        player.team = patch.team
+        player.keys = patch.keys
+        player.speed_boost = patch.speed_boost
+        player.ghost = patch.ghost
+        player.shielded = patch.shielded
+    if mask & game_pb2.PLAYER_FIELD_HEALTH:
+        player.health = patch.health
+        player.max_health = patch.max_health
+
+
+def _fnv1a(data, h=0x811c9dc5):
+    """32-bit FNV-1a, continuing from h."""
+    for byte in data:
+        h = ((h ^ byte) * 0x01000193) & 0xffffffff
+    return h
+
 
 class GameStateManager:
     """Manages the client-side game state by applying delta updates."""
@@ -27,6 +64,58 @@ class GameStateManager:
         self.world_pixel_width = 0.0
         self.world_pixel_height = 0.0
         self.tile_size = 32  # Default
+        self.map_layers = {}  # Map[MapLayerKind, rows of sprite indices]
+        self.map_name = ""  # Server-side map identifier
+        self.chunk_size = 0  # Non-zero while the map is streamed in chunks
+        self.wrap = False  # Toroidal world: edges connect to the opposite side
+
+        self.tick_interval_ms = 0  # Server simulation interval, advertised by the server
+
+        # Current tutorial objective (TutorialPrompt), if in a tutorial room
+        self.tutorial_prompt = None
+
+        # Local time a synchronized start happens at, or None
+        self.countdown_start = None
+
+        # Latest Scoreboard of the room, highest score first, and the team
+        # totals in rooms with teams
+        self.scoreboard = []
+        self.team_scores = []
+
+        # Local time the current "it" of a tag room became it, or None
+        self.it_since = None
+
+        # Local time our player respawns after dying, or None
+        self.respawn_at = None
+
+        # Latest PauseState while an admin has paused the room, else None
+        self.pause = None
+
+        # Latest ServerAnnouncement and the local time it stops showing
+        self.announcement = None
+        self.announcement_until = 0.0
+
+        # Round trip of the last clock sync in ms, shown as our ping when the
+        # server does not publish rtt_ms
+        self.sync_rtt = None
+
+        # Items lying on the map by ID
+        self.items = {}
+
+        # Non-player characters by ID
+        self.npcs = {}
+
+        # Recent attack swings to animate: attacker ID -> (direction, time)
+        self.attacks = {}
+
+        # Sequence number of the last input the server corrected
+        self.last_corrected_seq = 0
+
+        # Tick of the newest UdpSnapshot applied, to skip late datagrams
+        self.udp_tick = 0
+
+        # Emotes of nearby players: player ID -> (EmoteKind, local end time)
+        self.emotes = {}
 
         # Player appearance
         self.player_colors = {}
@@ -47,14 +136,52 @@ class GameStateManager:
             for updated_player in delta_update.updated_players:
                 player_id = updated_player.id
                 # Add or update player in the map
-                self.players_map[player_id] = updated_player
-                # Assign color if new
-                if player_id not in self.player_colors:
+                existing = self.players_map.get(player_id)
+                if updated_player.changed_fields and existing is not None:
+                    _apply_player_patch(existing, updated_player)
+                else:
+                    updated_player.changed_fields = 0
+                    self.players_map[player_id] = updated_player
+                # Use the skin's color, or assign one if the server sent none
+                color = self.players_map[player_id].color
+                if color:
+                    self.player_colors[player_id] = (
+                        (color >> 16) & 0xff, (color >> 8) & 0xff, color & 0xff)
+                elif player_id not in self.player_colors:
                     self.player_colors[player_id] = AVAILABLE_COLORS[self.next_color_index % len(
                         AVAILABLE_COLORS)]
                     self.next_color_index += 1
                     # print(f"StateMgr: Player {player_id} added/updated.") # Optional log
 
+            for removed_id in delta_update.removed_item_ids:
+                self.items.pop(removed_id, None)
+            for item in delta_update.spawned_items:
+                self.items[item.id] = item
+
+            for removed_id in delta_update.removed_npc_ids:
+                self.npcs.pop(removed_id, None)
+            for npc in delta_update.updated_npcs:
+                self.npcs[npc.id] = npc
+
+    def checksums(self):
+        """Computes the checksums of a StateChecksum from the local state;
+        the tiles checksum is 0 while the map is streamed in chunks. Players
+        hosted by other servers are not part of it."""
+        h = 0x811c9dc5
+        with self.state_lock:
+            players = sorted((p for p in self.players_map.values() if not p.remote),
+                             key=lambda p: p.id)
+            for p in players:
+                h = _fnv1a(p.id.encode() + b"\0" + struct.pack(
+                    "<ii", math.floor(p.x_pos + 0.5), math.floor(p.y_pos + 0.5)), h)
+        tiles = 0
+        with self.map_lock:
+            if self.world_map_data and not self.chunk_size:
+                tiles = 0x811c9dc5
+                for row in self.world_map_data:
+                    tiles = _fnv1a(struct.pack(f"<{len(row)}i", *row), tiles)
+        return h, len(players), tiles
+
     def get_state_snapshot_map(self):
         """Returns a *reference* to the internal players map. Use with caution or copy."""
         # This is efficient but requires careful handling by the caller (Renderer)
@@ -64,16 +191,26 @@ class GameStateManager:
     def set_initial_map_data(self, map_proto):
         """Sets the initial map data and own player ID."""
         print(
-            f"StateMgr: Received map data: {map_proto.tile_width}x{map_proto.tile_height} tiles")
+            f"StateMgr: Received map data for '{map_proto.map_name}': {map_proto.tile_width}x{map_proto.tile_height} tiles")
+        if map_proto.map_title:
+            print(
+                f"StateMgr: Map '{map_proto.map_title}' by {map_proto.map_author or 'unknown'}")
         temp_map = []
-        for y in range(map_proto.tile_height):
-            # Ensure row exists before accessing tiles
-            if y < len(map_proto.rows):
-                temp_map.append(list(map_proto.rows[y].tiles))
-            else:
-                print(f"Warning: Missing row {y} in map data proto.")
-                # Add empty row as fallback
-                temp_map.append([0] * map_proto.tile_width)
+        if map_proto.chunk_size:
+            # Streamed map: tiles arrive in MapChunk messages
+            temp_map = [[UNLOADED_TILE] * map_proto.tile_width
+                        for _ in range(map_proto.tile_height)]
+        else:
+            for y in range(map_proto.tile_height):
+                # Ensure row exists before accessing tiles
+                if y < len(map_proto.rows):
+                    temp_map.append(list(map_proto.rows[y].tiles))
+                else:
+                    print(f"Warning: Missing row {y} in map data proto.")
+                    # Add empty row as fallback
+                    temp_map.append([0] * map_proto.tile_width)
+        temp_layers = {layer.kind: [list(row.tiles) for row in layer.rows]
+                       for layer in map_proto.layers}
 
         with self.map_lock:
             self.world_map_data = temp_map
@@ -82,24 +219,240 @@ class GameStateManager:
             self.world_pixel_height = map_proto.world_pixel_height
             self.world_pixel_width = map_proto.world_pixel_width
             self.tile_size = map_proto.tile_size_pixels
+            self.map_layers = temp_layers
+            self.map_name = map_proto.map_name
+            self.chunk_size = map_proto.chunk_size
+            self.wrap = map_proto.wrap
+            self.tick_interval_ms = map_proto.tick_interval_ms
             print(
                 f"StateMgr: World set to {self.world_pixel_width}x{self.world_pixel_height}px, Tile Size: {self.tile_size}px")
 
         # Must set player ID outside map_lock but before returning control
         with self.state_lock:
             self.my_player_id = map_proto.assigned_player_id
+            self.udp_tick = 0  # Ticks count from zero in each room
+            if not map_proto.resumed:
+                # A new room, as after a zone handoff, starts out empty
+                self.players_map.clear()
+                self.items.clear()
+                self.npcs.clear()
             print(f"StateMgr: Received own player ID: {self.my_player_id}")
 
+    def apply_tile_updates(self, tile_update):
+        """Applies runtime tile changes (doors, etc.) from a MapTileUpdate."""
+        with self.map_lock:
+            if self.world_map_data is None:
+                return
+            for tile in tile_update.tiles:
+                if 0 <= tile.y < len(self.world_map_data) and 0 <= tile.x < len(self.world_map_data[tile.y]):
+                    self.world_map_data[tile.y][tile.x] = tile.tile
+
+    def apply_map_chunk(self, chunk):
+        """Copies a streamed MapChunk into the map and its visual layers."""
+        with self.map_lock:
+            if self.world_map_data is None or not self.chunk_size:
+                return
+            x0 = chunk.chunk_x * self.chunk_size
+            y0 = chunk.chunk_y * self.chunk_size
+            self._copy_chunk_rows(self.world_map_data, chunk.rows, x0, y0)
+            for layer in chunk.layers:
+                if layer.kind not in self.map_layers:
+                    self.map_layers[layer.kind] = [[0] * self.map_width_tiles
+                                                   for _ in range(self.map_height_tiles)]
+                self._copy_chunk_rows(
+                    self.map_layers[layer.kind], layer.rows, x0, y0)
+
+    @staticmethod
+    def _copy_chunk_rows(grid, rows, x0, y0):
+        for dy, row in enumerate(rows):
+            y = y0 + dy
+            if 0 <= y < len(grid):
+                tiles = list(row.tiles)[:max(0, len(grid[y]) - x0)]
+                grid[y][x0:x0 + len(tiles)] = tiles
+
     def get_map_data(self):
         """Thread-safely gets map data."""
         with self.map_lock:
             return self.world_map_data, self.map_width_tiles, self.map_height_tiles, self.tile_size
 
+    def get_map_layers(self):
+        """Thread-safely gets the visual map layers (static after load)."""
+        with self.map_lock:
+            return self.map_layers
+
+    def set_tick_interval(self, tick_interval_ms):
+        """Records a server tick rate change."""
+        with self.map_lock:
+            print(
+                f"StateMgr: Server tick interval changed from {self.tick_interval_ms}ms to {tick_interval_ms}ms")
+            self.tick_interval_ms = tick_interval_ms
+
+    def get_tick_interval_ms(self):
+        with self.map_lock:
+            return self.tick_interval_ms
+
+    def set_tutorial_prompt(self, prompt):
+        """Stores the latest tutorial objective."""
+        with self.state_lock:
+            self.tutorial_prompt = prompt
+
+    def get_tutorial_prompt(self):
+        with self.state_lock:
+            return self.tutorial_prompt
+
+    def set_countdown(self, start_time):
+        """Stores the local time of an announced synchronized start."""
+        with self.state_lock:
+            self.countdown_start = start_time
+
+    def get_countdown(self):
+        with self.state_lock:
+            return self.countdown_start
+
+    def set_scoreboard(self, scoreboard):
+        """Stores the room's scores from a Scoreboard message."""
+        with self.state_lock:
+            self.scoreboard = [(e.player_id, e.username, e.score)
+                               for e in scoreboard.entries]
+            self.team_scores = [(t.team, t.score, t.players)
+                                for t in scoreboard.teams]
+
+    def get_scoreboard(self):
+        with self.state_lock:
+            return list(self.scoreboard)
+
+    def get_team_scores(self):
+        with self.state_lock:
+            return list(self.team_scores)
+
+    def get_items(self):
+        """Returns the items lying on the map."""
+        with self.state_lock:
+            return list(self.items.values())
+
+    def get_npcs(self):
+        """Returns the non-player characters."""
+        with self.state_lock:
+            return list(self.npcs.values())
+
+    def add_attack(self, attack_event):
+        """Records an AttackEvent so its swing is drawn for a moment."""
+        with self.state_lock:
+            self.attacks[attack_event.attacker_player_id] = (
+                attack_event.direction, time.time())
+
+    def get_attacks(self, max_age=0.2):
+        """Returns the swings younger than max_age seconds, forgetting the
+        rest."""
+        now = time.time()
+        with self.state_lock:
+            self.attacks = {pid: a for pid, a in self.attacks.items()
+                            if now - a[1] < max_age}
+            return {pid: a[0] for pid, a in self.attacks.items()}
+
+    def apply_position_correction(self, correction):
+        """Moves a player to where the server says they are after it refused
+        or changed one of our inputs, without waiting for the next delta."""
+        with self.state_lock:
+            player = self.players_map.get(correction.player_id)
+            if player is not None:
+                player.x_pos = correction.x_pos
+                player.y_pos = correction.y_pos
+            self.last_corrected_seq = correction.last_processed_seq
+
+    def apply_udp_snapshot(self, tick, positions):
+        """Moves known players to the positions of a UDP snapshot, unless a
+        newer one was already applied. Players are only added and removed by
+        the stream's deltas."""
+        with self.state_lock:
+            if tick < self.udp_tick:
+                return
+            self.udp_tick = tick
+            for position in positions.values():
+                player = self.players_map.get(position.id)
+                if player is not None:
+                    player.x_pos = position.x_pos
+                    player.y_pos = position.y_pos
+                    player.current_animation_state = position.current_animation_state
+
+    def add_emote(self, player_id, kind, until):
+        """Records an emote to show over a player until the local time until."""
+        with self.state_lock:
+            self.emotes[player_id] = (kind, until)
+
+    def get_emotes(self):
+        """Returns the emotes still playing, forgetting the rest. Players
+        who moved since emoting are left out."""
+        now = time.time()
+        emoting = (game_pb2.AnimationState.WAVING, game_pb2.AnimationState.DANCING,
+                   game_pb2.AnimationState.LAUGHING)
+        with self.state_lock:
+            self.emotes = {pid: e for pid, e in self.emotes.items() if now < e[1]}
+            return {pid: e[0] for pid, e in self.emotes.items()
+                    if pid in self.players_map
+                    and self.players_map[pid].current_animation_state in emoting}
+
+    def set_respawn_at(self, respawn_time):
+        """Stores the local time our dead player respawns."""
+        with self.state_lock:
+            self.respawn_at = respawn_time
+
+    def get_respawn_at(self):
+        with self.state_lock:
+            return self.respawn_at
+
+    def set_pause(self, pause_state):
+        with self.state_lock:
+            self.pause = pause_state if pause_state.paused else None
+
+    def get_pause(self):
+        with self.state_lock:
+            return self.pause
+
+    def set_announcement(self, announcement, until):
+        with self.state_lock:
+            self.announcement = announcement
+            self.announcement_until = until
+
+    def get_announcement(self):
+        """Returns the announcement to show, or None once it has expired."""
+        with self.state_lock:
+            if self.announcement is None or time.time() >= self.announcement_until:
+                return None
+            return self.announcement
+
+    def set_sync_rtt(self, rtt_ms):
+        with self.state_lock:
+            self.sync_rtt = rtt_ms
+
+    def get_ping(self):
+        """Returns our round trip in ms: the server's measurement if it
+        publishes one, else the last clock sync's, or None."""
+        with self.state_lock:
+            me = self.players_map.get(self.my_player_id)
+            if me is not None and me.rtt_ms:
+                return me.rtt_ms
+            return self.sync_rtt
+
+    def set_it_since(self, start_time):
+        """Stores the local time the current "it" was tagged."""
+        with self.state_lock:
+            self.it_since = start_time
+
+    def get_it_since(self):
+        with self.state_lock:
+            return self.it_since
+
     def get_world_dimensions(self):
         """Gets world pixel dimensions."""
         with self.map_lock:
             return self.world_pixel_width, self.world_pixel_height
 
+    def get_wrap(self):
+        """Reports whether the world wraps around at its edges."""
+        with self.map_lock:
+            return self.wrap
+
     def get_my_player_id(self):
         """Thread-safely gets the player's own ID."""
         with self.state_lock:
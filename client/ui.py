@@ -1,5 +1,6 @@
 # client/ui.py
 import pygame
+import math
 import time
 import textwrap
 import hashlib
@@ -15,7 +16,9 @@ from .config import (SCREEN_WIDTH, SCREEN_HEIGHT, BACKGROUND_COLOR,
                      CHAT_TIMESTAMP_COLOR, CHAT_DEFAULT_USERNAME_COLOR, CHAT_MY_MESSAGE_COLOR,
                      CHAT_OTHER_MESSAGE_COLOR, CHAT_INPUT_PROMPT_COLOR, CHAT_INPUT_ACTIVE_COLOR,
                      CHAT_INPUT_BOX_COLOR_ACTIVE, CHAT_INPUT_BOX_COLOR_INACTIVE,
-                     CHAT_INPUT_BORDER_COLOR_ACTIVE, CHAT_HISTORY_BG_COLOR)
+                     CHAT_INPUT_BORDER_COLOR_ACTIVE, CHAT_HISTORY_BG_COLOR,
+                     TEAM_COLORS, ITEM_COLORS, NPC_COLOR, EMOTE_TEXT,
+                     PING_GOOD_MS, PING_POOR_MS, ANNOUNCEMENT_COLORS)
 from .utils import resource_path
 
 
@@ -241,11 +244,15 @@ class Renderer:
 
         self.directional_frames = {}
         self.tile_graphics = {}
+        self.layer_sprites = {}  # Sprite index (1-based, row-major) -> tileset cell
         self.player_rect = None
         self.tile_size = 32  # Default
         self._load_assets()
         self.camera_x = 0.0
         self.camera_y = 0.0
+        self.wrap = False  # Toroidal world: draw across the edges
+        self.world_width = 0.0
+        self.world_height = 0.0
 
     def _load_assets(self):
         """Loads game assets (sprites, tileset)."""
@@ -259,6 +266,14 @@ class Renderer:
                 (0, 0, self.tile_size, self.tile_size))
             self.tile_graphics[1] = tileset_img.subsurface(
                 (self.tile_size, 0, self.tile_size, self.tile_size))
+            # Every other tile type is drawn from the server's tile definitions
+            # Map layer sprites: every tileset cell, numbered from 1
+            cols = tileset_img.get_width() // self.tile_size
+            rows = tileset_img.get_height() // self.tile_size
+            for row in range(rows):
+                for col in range(cols):
+                    self.layer_sprites[row * cols + col + 1] = tileset_img.subsurface(
+                        (col * self.tile_size, row * self.tile_size, self.tile_size, self.tile_size))
 
             # Player Sprite Sheet
             sheet_img = pygame.image.load(SPRITE_SHEET_PATH).convert_alpha()
@@ -282,6 +297,11 @@ class Renderer:
         """Updates the camera position based on the target (player)."""
         target_cam_x = target_x - self.screen_width / 2
         target_cam_y = target_y - self.screen_height / 2
+        self.world_width, self.world_height = world_width, world_height
+        if self.wrap:
+            # The world repeats, so the camera simply follows the target
+            self.camera_x, self.camera_y = target_cam_x, target_cam_y
+            return
         if world_width > self.screen_width:
             self.camera_x = max(
                 0.0, min(target_cam_x, world_width - self.screen_width))
@@ -293,31 +313,72 @@ class Renderer:
         else:
             self.camera_y = (world_height - self.screen_height) / 2
 
-    def draw_map(self, map_data, map_w, map_h, tile_size):
-        """Draws the visible portion of the map."""
+    def _visible_tiles(self, map_w, map_h):
+        """Returns the (x, y) tile coordinates currently on screen."""
+        buffer = 1
+        stx = int(self.camera_x//self.tile_size)-buffer
+        etx = int((self.camera_x+self.screen_width)//self.tile_size)+buffer+1
+        sty = int(self.camera_y//self.tile_size)-buffer
+        ety = int((self.camera_y+self.screen_height)//self.tile_size)+buffer+1
+        if not self.wrap:
+            stx, sty = max(0, stx), max(0, sty)
+            etx, ety = min(map_w, etx), min(map_h, ety)
+        for y in range(sty, ety):
+            for x in range(stx, etx):
+                yield x, y
+
+    def _draw_grid(self, grid, graphics, map_w, map_h, only_on=None):
+        """Blits graphics[id] for every visible cell of grid, optionally only
+        where the collision tile in only_on is plain floor. On wrapping maps
+        cells past an edge show the opposite side."""
+        for x, y in self._visible_tiles(map_w, map_h):
+            gx, gy = (x % map_w, y % map_h) if self.wrap else (x, y)
+            if gy >= len(grid) or gx >= len(grid[gy]):
+                continue
+            if only_on is not None and (gy >= len(only_on) or gx >= len(only_on[gy]) or only_on[gy][gx] != 0):
+                continue
+            graphic = graphics.get(grid[gy][gx])
+            if graphic is not None:
+                self.screen.blit(
+                    graphic, (x*self.tile_size-self.camera_x, y*self.tile_size-self.camera_y))
+
+    def set_tile_definitions(self, definitions):
+        """Builds the graphic of each tile type from the server's
+        TileDefinition table; unknown textures fall back to plain floor."""
+        for definition in definitions:
+            graphic = self.layer_sprites.get(
+                definition.texture_id, self.tile_graphics.get(0))
+            if graphic is None:
+                continue
+            if definition.tint_rgb:
+                rgb = definition.tint_rgb
+                graphic = graphic.copy()
+                graphic.fill(((rgb >> 16) & 0xFF, (rgb >> 8) & 0xFF, rgb & 0xFF),
+                             special_flags=pygame.BLEND_MULT)
+            self.tile_graphics[definition.tile_id] = graphic
+
+    def draw_map(self, map_data, map_w, map_h, tile_size, layers=None):
+        """Draws the visible portion of the map beneath the players."""
         if not map_data or tile_size <= 0:
             return
         if self.tile_size != tile_size:
             self.tile_size = tile_size  # Update size if needed
-
-        buffer = 1
-        stx = max(0, int(self.camera_x/self.tile_size)-buffer)
-        etx = min(map_w, int(
-            (self.camera_x+self.screen_width)/self.tile_size)+buffer+1)
-        sty = max(0, int(self.camera_y/self.tile_size)-buffer)
-        ety = min(map_h, int(
-            (self.camera_y+self.screen_height)/self.tile_size)+buffer+1)
-
-        for y in range(sty, ety):
-            if y >= len(map_data):
-                continue
-            for x in range(stx, etx):
-                if x >= len(map_data[y]):
-                    continue
-                tid = map_data[y][x]
-                if tid in self.tile_graphics:
-                    self.screen.blit(
-                        self.tile_graphics[tid], (x*self.tile_size-self.camera_x, y*self.tile_size-self.camera_y))
+        layers = layers or {}
+
+        self._draw_grid(map_data, self.tile_graphics, map_w, map_h)
+        # Ground replaces plain floor only, so walls and special tiles stay visible
+        if game_pb2.MAP_LAYER_GROUND in layers:
+            self._draw_grid(layers[game_pb2.MAP_LAYER_GROUND],
+                            self.layer_sprites, map_w, map_h, only_on=map_data)
+        if game_pb2.MAP_LAYER_DECORATION in layers:
+            self._draw_grid(layers[game_pb2.MAP_LAYER_DECORATION],
+                            self.layer_sprites, map_w, map_h)
+
+    def draw_overhead(self, map_w, map_h, layers):
+        """Draws the overhead layer, which covers the players."""
+        if layers and game_pb2.MAP_LAYER_OVERHEAD in layers:
+            self._draw_grid(layers[game_pb2.MAP_LAYER_OVERHEAD],
+                            self.layer_sprites, map_w, map_h)
 
     def draw_players(self, player_map, player_colors, my_player_id):
         """Draws the players and their usernames."""
@@ -329,8 +390,9 @@ class Renderer:
             surf = self.directional_frames.get(
                 state, self.directional_frames[game_pb2.AnimationState.IDLE])
             if surf:
-                sx = player.x_pos-self.camera_x
-                sy = player.y_pos-self.camera_y
+                sx, sy = self._screen_position(player.x_pos, player.y_pos)
+                if state == game_pb2.AnimationState.DANCING:
+                    sy -= abs(math.sin(time.time() * 8)) * 6  # Bounce
                 prect = surf.get_rect(center=(int(sx), int(sy)))
 
                 # Tinting
@@ -342,19 +404,257 @@ class Renderer:
                            special_flags=pygame.BLEND_RGBA_MULT)
                 self.screen.blit(tsurf, prect)
 
-                # Player Username (above sprite)
-                if player.username:
+                # Player name (above sprite), as the server displays it
+                name = player.display_name or player.username
+                if name:
                     usurf = self.username_font.render(
-                        player.username, True, self.username_color)
+                        name, True, self.username_color)
                     urect = usurf.get_rect(
                         centerx=prect.centerx, bottom=prect.top-2)
                     self.screen.blit(usurf, urect)
 
+                # Power-ups: ghosts fade, shields glow and boosts leave
+                # speed lines behind the sprite
+                if player.ghost:
+                    fade = pygame.Surface(prect.size, pygame.SRCALPHA)
+                    fade.fill((0, 0, 50, 140))
+                    self.screen.blit(fade, prect)
+                if player.shielded:
+                    pygame.draw.ellipse(self.screen, ITEM_COLORS[game_pb2.ITEM_SHIELD],
+                                        prect.inflate(16, 16), 3)
+                if player.speed_boost:
+                    for i in range(3):
+                        y = prect.top + prect.height * (i + 1) // 4
+                        pygame.draw.line(self.screen, ITEM_COLORS[game_pb2.ITEM_SPEED],
+                                         (prect.left - 14, y), (prect.left - 4, y), 2)
+
+                # Dead players are greyed out until they respawn
+                if state == game_pb2.AnimationState.DEAD:
+                    shade = pygame.Surface(prect.size, pygame.SRCALPHA)
+                    shade.fill((60, 60, 60, 160))
+                    self.screen.blit(shade, prect)
+
+                # Health bar above the username once hurt
+                if 0 < player.health < player.max_health:
+                    bar = pygame.Rect(prect.left, prect.top - 24, prect.width, 4)
+                    pygame.draw.rect(self.screen, (80, 0, 0), bar)
+                    bar.width = bar.width * player.health // player.max_health
+                    pygame.draw.rect(self.screen, (0, 200, 0), bar)
+
+                # Team color under the sprite in rooms with teams
+                if 0 < player.team <= len(TEAM_COLORS):
+                    pygame.draw.line(self.screen, TEAM_COLORS[player.team - 1],
+                                     (prect.left, prect.bottom + 2),
+                                     (prect.right, prect.bottom + 2), 4)
+
+                # Mark whoever is "it" in a tag room
+                if player.it:
+                    pygame.draw.rect(
+                        self.screen, (255, 64, 64), prect.inflate(10, 10), 3)
+
                 # Highlight own player
                 if pid == my_player_id:
                     pygame.draw.rect(
                         self.screen, (255, 255, 255), prect.inflate(4, 4), 2)
 
+    def _screen_position(self, x, y):
+        """Converts a world position to the screen, using the copy of it
+        nearest the view centre on wrapping maps."""
+        sx, sy = x - self.camera_x, y - self.camera_y
+        if self.wrap and self.world_width > 0 and self.world_height > 0:
+            w, h = self.world_width, self.world_height
+            sx = (sx - self.screen_width / 2 + w / 2) % w - w / 2 + self.screen_width / 2
+            sy = (sy - self.screen_height / 2 + h / 2) % h - h / 2 + self.screen_height / 2
+        return sx, sy
+
+    def draw_tutorial(self, prompt):
+        """Draws the tutorial objective banner and its target marker."""
+        if prompt is None:
+            return
+        if prompt.has_target:
+            marker = pygame.Rect(prompt.target_tile_x*self.tile_size-self.camera_x,
+                                 prompt.target_tile_y*self.tile_size-self.camera_y,
+                                 self.tile_size, self.tile_size)
+            pygame.draw.rect(self.screen, (255, 215, 0), marker, 3)
+        if prompt.completed:
+            text = prompt.text
+        else:
+            text = f"[{prompt.step}/{prompt.total_steps}] {prompt.text}"
+        surf = self.username_font.render(text, True, (255, 255, 255))
+        rect = surf.get_rect(midtop=(self.screen_width // 2, 10))
+        pygame.draw.rect(self.screen, (0, 0, 0), rect.inflate(16, 8), border_radius=5)
+        self.screen.blit(surf, rect)
+
+    def draw_countdown(self, start_time):
+        """Draws the seconds left before a synchronized start, then "GO!"
+        for a second."""
+        if start_time is None:
+            return
+        remaining = start_time - time.time()
+        if remaining <= -1:
+            return
+        text = "GO!" if remaining <= 0 else str(math.ceil(remaining))
+        surf = self.error_font.render(text, True, (255, 255, 255))
+        rect = surf.get_rect(
+            center=(self.screen_width//2, self.screen_height//3))
+        self.screen.blit(surf, rect)
+
+    def draw_items(self, items):
+        """Draws the items lying on the map: coins, hearts, keys and
+        power-ups."""
+        for item in items:
+            color = ITEM_COLORS.get(item.kind)
+            if color is None:
+                continue
+            sx, sy = self._screen_position(item.x_pos, item.y_pos)
+            center = (int(sx), int(sy))
+            if item.kind in (game_pb2.ITEM_SPEED, game_pb2.ITEM_GHOST,
+                             game_pb2.ITEM_SHIELD):
+                # Power-ups are diamonds
+                x, y = center
+                pygame.draw.polygon(self.screen, color, [
+                    (x, y - 10), (x + 10, y), (x, y + 10), (x - 10, y)])
+            elif item.kind == game_pb2.ITEM_KEY:
+                pygame.draw.circle(self.screen, color, center, 6, 3)
+                pygame.draw.line(self.screen, color, (center[0] + 6, center[1]),
+                                 (center[0] + 16, center[1]), 3)
+            else:
+                pygame.draw.circle(self.screen, color, center, 8)
+
+    def draw_npcs(self, npcs):
+        """Draws non-player characters as boxes the size of a player,
+        labelled with their kind; passable ones are outlined only."""
+        if not self.player_rect:
+            return
+        for npc in npcs:
+            sx, sy = self._screen_position(npc.x_pos, npc.y_pos)
+            rect = self.player_rect.copy()
+            rect.center = (int(sx), int(sy))
+            pygame.draw.rect(self.screen, NPC_COLOR, rect, 0 if npc.solid else 3)
+            if npc.kind:
+                surf = self.username_font.render(npc.kind, True, NPC_COLOR)
+                self.screen.blit(surf, surf.get_rect(
+                    centerx=rect.centerx, bottom=rect.top - 2))
+
+    def draw_attacks(self, player_map, attacks):
+        """Draws a slash in front of players who just attacked."""
+        offsets = {
+            game_pb2.PlayerInput.Direction.UP: (0, -1),
+            game_pb2.PlayerInput.Direction.DOWN: (0, 1),
+            game_pb2.PlayerInput.Direction.LEFT: (-1, 0),
+            game_pb2.PlayerInput.Direction.RIGHT: (1, 0),
+        }
+        for pid, direction in attacks.items():
+            player = player_map.get(pid)
+            if player is None or direction not in offsets or not self.player_rect:
+                continue
+            dx, dy = offsets[direction]
+            sx, sy = self._screen_position(player.x_pos, player.y_pos)
+            reach_x = self.player_rect.width // 2 + 24
+            reach_y = self.player_rect.height // 2 + 24
+            center = (int(sx + dx * reach_x), int(sy + dy * reach_y))
+            pygame.draw.circle(self.screen, (255, 255, 255), center, 20, 3)
+
+    def draw_emotes(self, player_map, emotes):
+        """Draws a speech bubble with the emote over players emoting."""
+        for pid, kind in emotes.items():
+            player = player_map.get(pid)
+            text = EMOTE_TEXT.get(kind)
+            if player is None or text is None or not self.player_rect:
+                continue
+            sx, sy = self._screen_position(player.x_pos, player.y_pos)
+            surf = self.username_font.render(text, True, (0, 0, 0))
+            rect = surf.get_rect(centerx=int(sx),
+                                 bottom=int(sy) - self.player_rect.height // 2 - 30)
+            pygame.draw.rect(self.screen, (255, 255, 255), rect.inflate(8, 4),
+                             border_radius=6)
+            self.screen.blit(surf, rect)
+
+    def draw_respawn_timer(self, respawn_at):
+        """Draws the seconds left before our dead player respawns."""
+        if respawn_at is None:
+            return
+        remaining = respawn_at - time.time()
+        if remaining <= 0:
+            return
+        surf = self.error_font.render(
+            f"Respawning in {math.ceil(remaining)}", True, (255, 80, 80))
+        rect = surf.get_rect(
+            center=(self.screen_width//2, self.screen_height//3))
+        self.screen.blit(surf, rect)
+
+    def draw_tag_timer(self, player_map, it_since):
+        """Draws who is "it" and for how long, in tag rooms."""
+        it = next((p for p in player_map.values() if p.it), None)
+        if it is None or it_since is None:
+            return
+        seconds = max(0, int(time.time() - it_since))
+        surf = self.username_font.render(
+            f"{it.display_name or it.username} is it ({seconds}s)", True, (255, 64, 64))
+        rect = surf.get_rect(topleft=(10, 10))
+        pygame.draw.rect(self.screen, (0, 0, 0), rect.inflate(8, 4))
+        self.screen.blit(surf, rect)
+
+    def draw_scoreboard(self, scoreboard, team_scores, my_player_id, limit=5):
+        """Draws the team totals and top scores in the top right corner, the
+        player's own highlighted."""
+        lines = [(f"Team {team}: {score} ({players})",
+                  TEAM_COLORS[(team - 1) % len(TEAM_COLORS)])
+                 for team, score, players in team_scores]
+        for rank, (player_id, username, score) in enumerate(scoreboard[:limit], 1):
+            color = (255, 215, 0) if player_id == my_player_id else (255, 255, 255)
+            lines.append((f"{rank}. {username} {score}", color))
+        y = 10
+        for text, color in lines:
+            surf = self.username_font.render(text, True, color)
+            rect = surf.get_rect(topright=(self.screen_width - 10, y))
+            pygame.draw.rect(self.screen, (0, 0, 0), rect.inflate(8, 4))
+            self.screen.blit(surf, rect)
+            y += rect.height + 4
+
+    def draw_pause(self, pause_state):
+        """Dims the world and says the game is paused, and why, while an
+        admin has paused the room."""
+        if pause_state is None:
+            return
+        shade = pygame.Surface((self.screen_width, self.screen_height), pygame.SRCALPHA)
+        shade.fill((0, 0, 0, 140))
+        self.screen.blit(shade, (0, 0))
+        surf = self.error_font.render("PAUSED", True, (255, 255, 255))
+        rect = surf.get_rect(center=(self.screen_width//2, self.screen_height//2))
+        self.screen.blit(surf, rect)
+        if pause_state.reason:
+            reason = self.username_font.render(pause_state.reason, True, (220, 220, 220))
+            self.screen.blit(reason, reason.get_rect(midtop=(rect.centerx, rect.bottom + 8)))
+
+    def draw_announcement(self, announcement):
+        """Draws a server announcement as a banner across the top of the
+        screen, colored by severity."""
+        if announcement is None:
+            return
+        color = ANNOUNCEMENT_COLORS.get(announcement.severity, ANNOUNCEMENT_COLORS[0])
+        surf = self.username_font.render(announcement.text, True, (255, 255, 255))
+        banner = pygame.Rect(0, 0, self.screen_width, surf.get_height() + 12)
+        pygame.draw.rect(self.screen, color, banner)
+        self.screen.blit(surf, surf.get_rect(center=banner.center))
+
+    def draw_ping(self, rtt_ms):
+        """Draws our round trip to the server in the bottom right corner,
+        colored by how playable it is."""
+        if rtt_ms is None:
+            return
+        if rtt_ms < PING_GOOD_MS:
+            color = (0, 200, 0)
+        elif rtt_ms < PING_POOR_MS:
+            color = (255, 215, 0)
+        else:
+            color = (255, 64, 64)
+        surf = self.username_font.render(f"{rtt_ms} ms", True, color)
+        rect = surf.get_rect(
+            bottomright=(self.screen_width - 10, self.screen_height - 10))
+        pygame.draw.rect(self.screen, (0, 0, 0), rect.inflate(8, 4))
+        self.screen.blit(surf, rect)
+
     def draw_error_message(self, message):
         """Draws an error message centered on the screen."""
         surf = self.error_font.render(message, True, self.error_text_color)
@@ -373,10 +673,12 @@ class Renderer:
             # Get data needed for rendering
             current_player_map = state_manager.get_state_snapshot_map()
             map_data, map_w, map_h, tile_size = state_manager.get_map_data()
+            layers = state_manager.get_map_layers()
             my_player_id = state_manager.get_my_player_id()
             player_colors = state_manager.get_all_player_colors()
 
             # Update camera
+            self.wrap = state_manager.get_wrap()
             my_player_snapshot = current_player_map.get(my_player_id)
             if my_player_snapshot:
                 world_w, world_h = state_manager.get_world_dimensions()
@@ -385,6 +687,21 @@ class Renderer:
 
             # Draw elements
             self.screen.fill(BACKGROUND_COLOR)
-            self.draw_map(map_data, map_w, map_h, tile_size)
+            self.draw_map(map_data, map_w, map_h, tile_size, layers)
+            self.draw_items(state_manager.get_items())
+            self.draw_npcs(state_manager.get_npcs())
             self.draw_players(current_player_map, player_colors, my_player_id)
+            self.draw_attacks(current_player_map, state_manager.get_attacks())
+            self.draw_emotes(current_player_map, state_manager.get_emotes())
+            self.draw_overhead(map_w, map_h, layers)
+            self.draw_tutorial(state_manager.get_tutorial_prompt())
+            self.draw_countdown(state_manager.get_countdown())
+            self.draw_scoreboard(state_manager.get_scoreboard(),
+                                 state_manager.get_team_scores(), my_player_id)
+            self.draw_tag_timer(current_player_map,
+                                state_manager.get_it_since())
+            self.draw_respawn_timer(state_manager.get_respawn_at())
+            self.draw_pause(state_manager.get_pause())
+            self.draw_ping(state_manager.get_ping())
+            self.draw_announcement(state_manager.get_announcement())
             return True  # Render successful
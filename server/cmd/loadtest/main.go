@@ -0,0 +1,364 @@
+// Command loadtest connects many simulated clients to a game server and
+// reports how quickly their inputs come back in broadcasts, so performance
+// regressions are measurable. Each client joins over GameStream and sends
+// inputs following a pattern. Every change of direction is timed from the
+// input to the first DeltaUpdate showing the client's player moving the new
+// way. With -admin-token, the server's CPU
+// time and tick durations are read from GetServerStats before and after.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	stallAfter     = time.Second // A turn unanswered this long is counted as stalled, not timed
+	progressPeriod = 5 * time.Second
+)
+
+var directions = map[string]pb.PlayerInput_Direction{
+	"up":    pb.PlayerInput_UP,
+	"down":  pb.PlayerInput_DOWN,
+	"left":  pb.PlayerInput_LEFT,
+	"right": pb.PlayerInput_RIGHT,
+	"wait":  pb.PlayerInput_UNKNOWN,
+}
+
+// step is a leg of an input pattern: a direction held for a number of inputs.
+type step struct {
+	dir   pb.PlayerInput_Direction
+	count int
+}
+
+// parsePattern parses -pattern: "random" (a random direction every ten
+// inputs), "still" (no movement), "square" or a route such as
+// "right:5,down:3,wait:2", which is repeated.
+func parsePattern(spec string) ([]step, error) {
+	switch spec {
+	case "random":
+		return nil, nil
+	case "still":
+		return []step{{pb.PlayerInput_UNKNOWN, 1}}, nil
+	case "square":
+		spec = "right:10,down:10,left:10,up:10"
+	}
+	var steps []step
+	for _, leg := range strings.Split(spec, ",") {
+		name, count, ok := strings.Cut(strings.TrimSpace(leg), ":")
+		dir, known := directions[strings.ToLower(name)]
+		n, err := strconv.Atoi(count)
+		if !ok || !known || err != nil || n < 1 {
+			return nil, fmt.Errorf("pattern leg %q must be up, down, left, right or wait, a colon and a positive count", leg)
+		}
+		steps = append(steps, step{dir, n})
+	}
+	return steps, nil
+}
+
+// inputs yields a client's input directions.
+type inputs struct {
+	steps []step // Nil for random
+	rng   *rand.Rand
+	leg   int
+	sent  int
+	dir   pb.PlayerInput_Direction
+}
+
+func (in *inputs) next() pb.PlayerInput_Direction {
+	if in.steps == nil {
+		if in.sent%10 == 0 {
+			in.dir = pb.PlayerInput_Direction(1 + in.rng.Intn(4))
+		}
+		in.sent++
+		return in.dir
+	}
+	s := in.steps[in.leg]
+	in.sent++
+	if in.sent >= s.count {
+		in.leg, in.sent = (in.leg+1)%len(in.steps), 0
+	}
+	return s.dir
+}
+
+// results are gathered from every client. Traffic and latencies count only
+// while measuring, once every client has joined.
+type results struct {
+	measuring       atomic.Bool
+	joined, failed  atomic.Int64
+	deltas, bytes   atomic.Int64
+	inputs, stalled atomic.Int64
+	disconnected    atomic.Int64
+	mu              sync.Mutex
+	latencies       []time.Duration
+	firstErr        error
+}
+
+func (r *results) record(d time.Duration) {
+	r.mu.Lock()
+	r.latencies = append(r.latencies, d)
+	r.mu.Unlock()
+}
+
+func (r *results) fail(err error) {
+	r.failed.Add(1)
+	r.mu.Lock()
+	if r.firstErr == nil {
+		r.firstErr = err
+	}
+	r.mu.Unlock()
+}
+
+type config struct {
+	addr      string
+	prefix    string
+	mapName   string
+	roomID    string
+	inputRate float64
+	steps     []step
+}
+
+// runClient plays one simulated client until ctx is done.
+func runClient(ctx context.Context, cfg config, n int, res *results) {
+	conn, err := grpc.NewClient(cfg.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		res.fail(err)
+		return
+	}
+	defer conn.Close()
+	stream, err := pb.NewGameServiceClient(conn).GameStream(ctx)
+	if err != nil {
+		res.fail(err)
+		return
+	}
+	hello := &pb.ClientHello{DesiredUsername: fmt.Sprintf("%s%d", cfg.prefix, n), MapName: cfg.mapName, RoomId: cfg.roomID}
+	if err := stream.Send(&pb.ClientMessage{Payload: &pb.ClientMessage_ClientHello{ClientHello: hello}}); err != nil {
+		res.fail(err)
+		return
+	}
+	first, err := stream.Recv()
+	if err != nil || first.GetInitialMapData() == nil {
+		if err == nil {
+			err = fmt.Errorf("first message was not InitialMapData")
+		}
+		res.fail(err)
+		return
+	}
+	res.joined.Add(1)
+	myID := first.GetInitialMapData().GetAssignedPlayerId()
+
+	var mu sync.Mutex
+	var pending time.Time // When the turn awaiting a broadcast was sent
+	var turn pb.PlayerInput_Direction
+	go func() {
+		var x, y float32
+		known := false
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				if ctx.Err() == nil {
+					res.disconnected.Add(1)
+				}
+				return
+			}
+			delta := msg.GetDeltaUpdate()
+			if delta == nil {
+				continue
+			}
+			now := time.Now()
+			if res.measuring.Load() {
+				res.deltas.Add(1)
+				res.bytes.Add(int64(proto.Size(msg)))
+			}
+			for _, p := range delta.UpdatedPlayers {
+				if p.GetId() != myID {
+					continue
+				}
+				if known {
+					mu.Lock()
+					if !pending.IsZero() && movedToward(turn, p.GetXPos()-x, p.GetYPos()-y) {
+						if res.measuring.Load() {
+							res.record(now.Sub(pending))
+						}
+						pending = time.Time{}
+					}
+					mu.Unlock()
+				}
+				x, y, known = p.GetXPos(), p.GetYPos(), true
+			}
+		}
+	}()
+
+	in := &inputs{steps: cfg.steps, rng: rand.New(rand.NewSource(int64(n)))}
+	last := pb.PlayerInput_UNKNOWN
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.inputRate))
+	defer ticker.Stop()
+	for seq := uint32(1); ; seq++ {
+		select {
+		case <-ctx.Done():
+			stream.CloseSend()
+			return
+		case now := <-ticker.C:
+			dir := in.next()
+			if err := stream.Send(&pb.ClientMessage{Payload: &pb.ClientMessage_PlayerInput{PlayerInput: &pb.PlayerInput{Direction: dir, Seq: seq}}}); err != nil {
+				return
+			}
+			if res.measuring.Load() {
+				res.inputs.Add(1)
+			}
+			mu.Lock()
+			if !pending.IsZero() && now.Sub(pending) > stallAfter {
+				if res.measuring.Load() {
+					res.stalled.Add(1) // Walked into a wall or another player, most likely
+				}
+				pending = time.Time{}
+			}
+			if dir != last && dir != pb.PlayerInput_UNKNOWN {
+				pending, turn = now, dir
+			}
+			mu.Unlock()
+			last = dir
+		}
+	}
+}
+
+// movedToward reports whether a move by dx, dy goes the way of dir.
+func movedToward(dir pb.PlayerInput_Direction, dx, dy float32) bool {
+	switch dir {
+	case pb.PlayerInput_UP:
+		return dy < 0
+	case pb.PlayerInput_DOWN:
+		return dy > 0
+	case pb.PlayerInput_LEFT:
+		return dx < 0
+	case pb.PlayerInput_RIGHT:
+		return dx > 0
+	}
+	return false
+}
+
+// serverStats reads GetServerStats with the admin token; nil without one.
+func serverStats(addr, token string) *pb.ServerStats {
+	if token == "" {
+		return nil
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	stats, err := pb.NewAdminServiceClient(conn).GetServerStats(ctx, &pb.GetServerStatsRequest{})
+	if err != nil {
+		log.Printf("GetServerStats failed: %v", err)
+		return nil
+	}
+	return stats
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[min(len(sorted)-1, int(p*float64(len(sorted))))]
+}
+
+func report(res *results, elapsed time.Duration, before, after *pb.ServerStats) {
+	res.mu.Lock()
+	latencies := slices.Clone(res.latencies)
+	res.mu.Unlock()
+	slices.Sort(latencies)
+	secs := elapsed.Seconds()
+	fmt.Printf("\nClients:   %d joined, %d failed, %d disconnected early\n", res.joined.Load(), res.failed.Load(), res.disconnected.Load())
+	if res.firstErr != nil {
+		fmt.Printf("           first failure: %v\n", res.firstErr)
+	}
+	fmt.Printf("Inputs:    %d sent (%.0f/s), %d turns stalled\n", res.inputs.Load(), float64(res.inputs.Load())/secs, res.stalled.Load())
+	fmt.Printf("Deltas:    %d received (%.0f/s), %.1f KiB/s\n", res.deltas.Load(), float64(res.deltas.Load())/secs, float64(res.bytes.Load())/1024/secs)
+	fmt.Printf("Latency:   %d turns, input to broadcast p50 %v, p90 %v, p99 %v, max %v\n", len(latencies),
+		percentile(latencies, 0.5).Round(time.Millisecond), percentile(latencies, 0.9).Round(time.Millisecond),
+		percentile(latencies, 0.99).Round(time.Millisecond), percentile(latencies, 1).Round(time.Millisecond))
+	if before != nil && after != nil {
+		fmt.Printf("Server:    %.0f%% CPU, %d players, ticks avg %v max %v, %d ms interval\n",
+			100*(after.CpuSeconds-before.CpuSeconds)/secs, after.Players,
+			time.Duration(after.AvgTickMicros)*time.Microsecond, time.Duration(after.MaxTickMicros)*time.Microsecond, after.TickIntervalMs)
+	}
+}
+
+func main() {
+	addrFlag := flag.String("addr", "localhost:50051", "Game server to load")
+	clientsFlag := flag.Int("clients", 50, "Simulated clients")
+	durationFlag := flag.Duration("duration", 30*time.Second, "How long to run, after every client has joined")
+	rampFlag := flag.Duration("ramp", 5*time.Second, "Time over which clients join, evenly spread")
+	patternFlag := flag.String("pattern", "random", "Inputs clients send: random, still, square or a route such as right:5,down:3,wait:2")
+	rateFlag := flag.Float64("input-rate", 10, "Inputs each client sends per second")
+	mapFlag := flag.String("map", "", "Map world to join instead of the lobby")
+	roomFlag := flag.String("room", "", "Room to join instead of the lobby")
+	prefixFlag := flag.String("prefix", "load", "Username prefix of the clients, numbered from 0")
+	adminTokenFlag := flag.String("admin-token", "", "Admin or read-status token, to report the server's CPU and tick times")
+	flag.Parse()
+
+	steps, err := parsePattern(*patternFlag)
+	if err != nil {
+		log.Fatalf("Invalid -pattern: %v", err)
+	}
+	if *rateFlag <= 0 || *clientsFlag < 1 {
+		log.Fatal("-clients and -input-rate must be positive")
+	}
+	cfg := config{addr: *addrFlag, prefix: *prefixFlag, mapName: *mapFlag, roomID: *roomFlag, inputRate: *rateFlag, steps: steps}
+	res := &results{}
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	log.Printf("Starting %d clients against %s over %v...", *clientsFlag, *addrFlag, *rampFlag)
+	for i := 0; i < *clientsFlag; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			runClient(ctx, cfg, n, res)
+		}(i)
+		time.Sleep(*rampFlag / time.Duration(*clientsFlag))
+	}
+	before := serverStats(*addrFlag, *adminTokenFlag)
+	res.measuring.Store(true)
+	start := time.Now()
+	progress := time.NewTicker(progressPeriod)
+	deadline := time.After(*durationFlag)
+loop:
+	for {
+		select {
+		case <-progress.C:
+			log.Printf("%v: %d clients joined, %d deltas received", time.Since(start).Round(time.Second), res.joined.Load(), res.deltas.Load())
+		case <-deadline:
+			break loop
+		}
+	}
+	progress.Stop()
+	res.measuring.Store(false)
+	elapsed := time.Since(start)
+	after := serverStats(*addrFlag, *adminTokenFlag)
+	cancel()
+	wg.Wait()
+	report(res, elapsed, before, after)
+	if res.joined.Load() == 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,122 @@
+// Command registry serves RegistryService, a directory of game servers for
+// server browsers. Game servers started with -registry pointing here register
+// themselves every few seconds; entries not refreshed within registryTTL are
+// dropped from ListServers.
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"flag"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	registryTTL        = 30 * time.Second // Servers not heard from this long are unlisted
+	maxListedServers   = 1000             // Registrations beyond this many are refused
+	maxServerNameRunes = 64
+)
+
+type registry struct {
+	pb.UnimplementedRegistryServiceServer
+	token string // Required of registering servers; empty lets anyone register
+
+	mu      sync.Mutex
+	servers map[string]*pb.ServerListing // By address
+}
+
+func newRegistry(token string) *registry {
+	return &registry{token: token, servers: make(map[string]*pb.ServerListing)}
+}
+
+// RegisterServer adds or refreshes a server's entry.
+func (r *registry) RegisterServer(ctx context.Context, req *pb.RegisterServerRequest) (*pb.RegisterServerResponse, error) {
+	if r.token != "" && subtle.ConstantTimeCompare([]byte(req.GetToken()), []byte(r.token)) != 1 {
+		return nil, status.Error(codes.PermissionDenied, "invalid registry token")
+	}
+	listing := req.GetServer()
+	if listing.GetAddress() == "" {
+		return nil, status.Error(codes.InvalidArgument, "server address is required")
+	}
+	if _, _, err := net.SplitHostPort(listing.GetAddress()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "server address %q is not host:port", listing.GetAddress())
+	}
+	if name := []rune(listing.GetName()); len(name) > maxServerNameRunes {
+		listing.Name = string(name[:maxServerNameRunes])
+	}
+	now := time.Now()
+	listing.LastSeenUnixMs = now.UnixMilli()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire(now)
+	if _, ok := r.servers[listing.Address]; !ok {
+		if len(r.servers) >= maxListedServers {
+			return nil, status.Error(codes.ResourceExhausted, "registry is full")
+		}
+		log.Printf("Server '%s' registered at %s (%s).", listing.Name, listing.Address, listing.Region)
+	}
+	r.servers[listing.Address] = listing
+	return &pb.RegisterServerResponse{TtlSeconds: int32(registryTTL / time.Second)}, nil
+}
+
+// ListServers returns the servers that registered recently, busiest first.
+func (r *registry) ListServers(ctx context.Context, req *pb.ListServersRequest) (*pb.ListServersResponse, error) {
+	resp := &pb.ListServersResponse{}
+	r.mu.Lock()
+	r.expire(time.Now())
+	for _, listing := range r.servers {
+		if req.GetRegion() != "" && listing.Region != req.GetRegion() {
+			continue
+		}
+		if req.GetMapName() != "" && listing.MapName != req.GetMapName() {
+			continue
+		}
+		resp.Servers = append(resp.Servers, listing)
+	}
+	r.mu.Unlock()
+	sort.Slice(resp.Servers, func(i, j int) bool {
+		a, b := resp.Servers[i], resp.Servers[j]
+		if a.PlayerCount != b.PlayerCount {
+			return a.PlayerCount > b.PlayerCount
+		}
+		return a.Name < b.Name
+	})
+	return resp, nil
+}
+
+// expire drops servers that stopped registering. r.mu must be held.
+func (r *registry) expire(now time.Time) {
+	for addr, listing := range r.servers {
+		if now.Sub(time.UnixMilli(listing.LastSeenUnixMs)) > registryTTL {
+			log.Printf("Server '%s' at %s stopped registering; unlisted.", listing.Name, addr)
+			delete(r.servers, addr)
+		}
+	}
+}
+
+func main() {
+	addrFlag := flag.String("addr", ":50050", "Address to serve RegistryService on")
+	tokenFlag := flag.String("token", "", "Token game servers must register with (-registry-token); empty lets anyone register")
+	flag.Parse()
+
+	lis, err := net.Listen("tcp", *addrFlag)
+	if err != nil {
+		log.Fatalf("Listen failed: %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	pb.RegisterRegistryServiceServer(grpcServer, newRegistry(*tokenFlag))
+	log.Printf("Starting server registry on %s...", *addrFlag)
+	if err := grpcServer.Serve(lis); err != nil {
+		log.Fatalf("Serve failed: %v", err)
+	}
+}
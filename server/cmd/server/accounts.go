@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"simple-grpc-game/server/internal/accounts"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	accountTimeout = 5 * time.Second // Per accounts database call outside RPCs
+	loginInterval  = 2 * time.Second // Register and Login attempts regained per address
+	loginBurst     = 5
+)
+
+// anonymousUsername is used by players who join without a name. It cannot
+// be registered, or nobody could join anonymously.
+const anonymousUsername = "AnonPlayer"
+
+// openAccounts opens the -accounts target: "memory", a postgres:// URL, or
+// nothing to disable accounts.
+func openAccounts(target string) (*accounts.Service, error) {
+	switch {
+	case target == "":
+		return nil, nil
+	case target == "memory":
+		log.Println("Warning: Accounts are kept in memory and will be lost when the server stops.")
+		return accounts.NewService(accounts.NewMemoryStore()), nil
+	case strings.HasPrefix(target, "postgres://"), strings.HasPrefix(target, "postgresql://"):
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		store, err := accounts.OpenPostgres(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		return accounts.NewService(store), nil
+	}
+	return nil, errors.New("-accounts must be \"memory\" or a postgres:// URL")
+}
+
+func accountInfo(a accounts.Account) *pb.AccountInfo {
+	info := &pb.AccountInfo{
+		Username:      a.Username,
+		CreatedAtUnix: a.CreatedAt.Unix(),
+		Sessions:      int32(a.Sessions),
+		PlaySeconds:   a.PlaySeconds,
+		Score:         a.Score,
+		TilesVisited:  a.TilesVisited,
+	}
+	if !a.LastSeen.IsZero() {
+		info.LastSeenUnix = a.LastSeen.Unix()
+	}
+	return info
+}
+
+// accountError converts an accounts error to a gRPC status error.
+func accountError(err error) error {
+	switch {
+	case errors.Is(err, accounts.ErrInvalidUsername), errors.Is(err, accounts.ErrWeakPassword):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, accounts.ErrUsernameTaken):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, accounts.ErrInvalidCredentials), errors.Is(err, accounts.ErrInvalidSession):
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	log.Printf("Accounts error: %v", err)
+	return status.Error(codes.Unavailable, "accounts are unavailable, try again later")
+}
+
+// checkAccountRequest applies the checks shared by Register and Login.
+func (s *gameServer) checkAccountRequest(ctx context.Context) error {
+	if s.accounts == nil {
+		return status.Error(codes.Unimplemented, "accounts are not enabled on this server")
+	}
+	if !s.loginLimiter.allow(peerHost(ctx)) {
+		return status.Error(codes.ResourceExhausted, "too many attempts, try again shortly")
+	}
+	return nil
+}
+
+// Register implements the unary RPC that creates an account.
+func (s *gameServer) Register(ctx context.Context, req *pb.AccountRequest) (*pb.AccountResponse, error) {
+	if err := s.checkAccountRequest(ctx); err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(req.GetUsername(), anonymousUsername) {
+		return nil, status.Errorf(codes.InvalidArgument, "%s is reserved for players without a name", anonymousUsername)
+	}
+	acct, token, err := s.accounts.Register(ctx, req.GetUsername(), req.GetPassword())
+	if err != nil {
+		return nil, accountError(err)
+	}
+	log.Printf("Account '%s' registered from %s.", acct.Username, peerHost(ctx))
+	return &pb.AccountResponse{SessionToken: token, Account: accountInfo(acct)}, nil
+}
+
+// Login implements the unary RPC that logs in to an account.
+func (s *gameServer) Login(ctx context.Context, req *pb.AccountRequest) (*pb.AccountResponse, error) {
+	if err := s.checkAccountRequest(ctx); err != nil {
+		return nil, err
+	}
+	acct, token, err := s.accounts.Login(ctx, req.GetUsername(), req.GetPassword())
+	if err != nil {
+		if errors.Is(err, accounts.ErrInvalidCredentials) {
+			log.Printf("Failed login as '%s' from %s.", req.GetUsername(), peerHost(ctx))
+		}
+		return nil, accountError(err)
+	}
+	log.Printf("Account '%s' logged in from %s.", acct.Username, peerHost(ctx))
+	return &pb.AccountResponse{SessionToken: token, Account: accountInfo(acct)}, nil
+}
+
+// joinAccount returns the account a join's session token belongs to, or nil
+// for a join without one. Registered usernames are only available to their
+// account. Errors are gRPC status errors.
+func (s *gameServer) joinAccount(ctx context.Context, token, username string) (*accounts.Account, error) {
+	if s.accounts == nil {
+		if token != "" {
+			return nil, status.Error(codes.FailedPrecondition, "accounts are not enabled on this server")
+		}
+		return nil, nil
+	}
+	if token == "" {
+		registered, err := s.accounts.Registered(ctx, username)
+		if err != nil {
+			return nil, accountError(err)
+		}
+		if registered {
+			return nil, status.Errorf(codes.PermissionDenied, "username '%s' is registered; log in to use it", username)
+		}
+		return nil, nil
+	}
+	acct, err := s.accounts.Authenticate(ctx, token)
+	if err != nil {
+		return nil, accountError(err)
+	}
+	return &acct, nil
+}
+
+// expectAccountPlayer has a logged-in player spawn where their account last
+// left a persistent room.
+func (s *gameServer) expectAccountPlayer(ctx context.Context, rm *room, acct *accounts.Account) {
+	if acct == nil || !rm.persistent {
+		return
+	}
+	pos, ok, err := s.accounts.LastPosition(ctx, acct.ID, rm.id)
+	if err != nil {
+		log.Printf("Warning: Could not load the last position of account '%s' in room %s: %v", acct.Username, rm.id, err)
+		return
+	}
+	if ok {
+		rm.state.ExpectPlayer(acct.Username, pos.X, pos.Y, time.Now())
+	}
+}
+
+// endAccountSession records a logged-in player's session with its stats and,
+// in persistent rooms, where they left. Call it before removing the player.
+func (s *gameServer) endAccountSession(rm *room, playerID string, acct *accounts.Account, joinedAt time.Time) {
+	if acct == nil {
+		return
+	}
+	stats := accounts.SessionStats{Played: time.Since(joinedAt)}
+	if played, ok := rm.state.Stats(playerID); ok {
+		stats.Score, stats.TilesVisited = played.Score, int64(played.TilesVisited)
+	}
+	var pos accounts.Position
+	if player, ok := rm.state.GetPlayer(playerID); ok && rm.persistent {
+		pos = accounts.Position{RoomID: rm.id, X: player.XPos, Y: player.YPos}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), accountTimeout)
+	defer cancel()
+	if err := s.accounts.EndSession(ctx, acct.ID, stats, pos); err != nil {
+		log.Printf("Warning: Could not record the session of account '%s': %v", acct.Username, err)
+	}
+}
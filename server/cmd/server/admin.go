@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"simple-grpc-game/server/internal/game"
+	"strings"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// adminServer serves AdminService on top of the game server's internals. It
+// is only registered when an admin token is configured.
+type adminServer struct {
+	pb.UnimplementedAdminServiceServer
+	game    *gameServer
+	console bool // Calls come from the server console, which needs no token
+}
+
+// authorize checks the "authorization: Bearer <token>" metadata of a call:
+// the admin token may do anything, an API token what its scopes allow.
+func (a *adminServer) authorize(ctx context.Context, scope string) error {
+	if a.console {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return authorizeBearer(md.Get("authorization"), a.game.adminToken, a.game.tokens, scope)
+}
+
+// authorizeBearer checks Authorization header values against the admin token
+// and the API tokens. Errors are gRPC status errors.
+func authorizeBearer(headers []string, adminToken string, tokens *tokenStore, scope string) error {
+	for _, v := range headers {
+		secret, ok := strings.CutPrefix(v, "Bearer ")
+		if !ok {
+			continue
+		}
+		if adminToken != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(adminToken)) == 1 {
+			return nil
+		}
+		return tokens.check(secret, scope)
+	}
+	return status.Error(codes.Unauthenticated, "a valid admin or API token is required")
+}
+
+// adminRoom looks up the room an admin call targets; empty means the lobby.
+func (a *adminServer) adminRoom(roomID string) (*room, error) {
+	if roomID == "" {
+		roomID = defaultRoomID
+	}
+	rm, ok := a.game.rooms.get(roomID)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "room %s not found", roomID)
+	}
+	return rm, nil
+}
+
+// SetTile changes one tile of a room's map and broadcasts it, along with any
+// players moved out of a new wall.
+func (a *adminServer) SetTile(ctx context.Context, req *pb.SetTileRequest) (*pb.SetTileResponse, error) {
+	if err := a.authorize(ctx, scopeAdmin); err != nil {
+		return nil, err
+	}
+	rm, err := a.adminRoom(req.GetRoomId())
+	if err != nil {
+		return nil, err
+	}
+	relocated, err := rm.state.SetTile(int(req.GetX()), int(req.GetY()), game.TileType(req.GetTile()))
+	if err != nil {
+		return nil, status.Errorf(gameErrorCode(err), "set tile: %v", err)
+	}
+	log.Printf("Admin set tile (%d, %d) in room %s to %d.", req.GetX(), req.GetY(), rm.id, req.GetTile())
+	if cut := rm.state.UnreachableSpawns(); len(cut) > 0 {
+		log.Printf("Warning: Could not find a path to %d spawn point(s) of room %s after the edit.", len(cut), rm.id)
+	}
+	rm.broadcastDeltaState()
+	return &pb.SetTileResponse{RelocatedPlayerIds: relocated}, nil
+}
+
+// TeleportPlayer moves a connected player to a point of their room, e.g. to
+// free them from somewhere they are stuck.
+func (a *adminServer) TeleportPlayer(ctx context.Context, req *pb.TeleportPlayerRequest) (*pb.TeleportPlayerResponse, error) {
+	if err := a.authorize(ctx, scopeAdmin); err != nil {
+		return nil, err
+	}
+	for _, rm := range a.game.rooms.all() {
+		if _, ok := rm.state.GetPlayer(req.GetPlayerId()); !ok {
+			continue
+		}
+		if _, err := rm.state.TeleportPlayer(req.GetPlayerId(), req.GetX(), req.GetY()); err != nil {
+			return nil, status.Errorf(gameErrorCode(err), "teleport: %v", err)
+		}
+		log.Printf("Admin teleported player %s in room %s to (%.1f, %.1f).", req.GetPlayerId(), rm.id, req.GetX(), req.GetY())
+		rm.broadcastDeltaState()
+		return &pb.TeleportPlayerResponse{RoomId: rm.id}, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "player %s is not connected", req.GetPlayerId())
+}
+
+// StartCapture begins recording a player's or room's traffic for a support
+// ticket; the result is fetched with DownloadCapture.
+func (a *adminServer) StartCapture(ctx context.Context, req *pb.StartCaptureRequest) (*pb.StartCaptureResponse, error) {
+	if err := a.authorize(ctx, scopeAdmin); err != nil {
+		return nil, err
+	}
+	if req.GetRoomId() != "" {
+		if _, err := a.adminRoom(req.GetRoomId()); err != nil {
+			return nil, err
+		}
+	}
+	c, err := a.game.rooms.captures.start(req.GetPlayerId(), req.GetRoomId(), time.Duration(req.GetDurationSeconds())*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	logCaptureStart(c)
+	return &pb.StartCaptureResponse{CaptureId: c.ID, ExpiresAtUnix: c.ExpiresAt.Unix()}, nil
+}
+
+// DownloadCapture returns a capture, finished or still recording, as JSON.
+func (a *adminServer) DownloadCapture(ctx context.Context, req *pb.DownloadCaptureRequest) (*pb.DownloadCaptureResponse, error) {
+	if err := a.authorize(ctx, scopeAdmin); err != nil {
+		return nil, err
+	}
+	data, complete, err := a.game.rooms.captures.bundle(req.GetCaptureId())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.DownloadCaptureResponse{
+		Filename: fmt.Sprintf("capture-%s.json", req.GetCaptureId()),
+		Data:     data,
+		Complete: complete,
+	}, nil
+}
+
+// IssueToken creates an API token for an integration.
+func (a *adminServer) IssueToken(ctx context.Context, req *pb.IssueTokenRequest) (*pb.IssueTokenResponse, error) {
+	if err := a.authorize(ctx, scopeAdmin); err != nil {
+		return nil, err
+	}
+	t, secret, err := a.game.tokens.issue(req.GetName(), req.GetScopes())
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("API token %s ('%s') issued with scopes %v.", t.ID, t.Name, t.Scopes)
+	return &pb.IssueTokenResponse{Token: t.proto(), Secret: secret}, nil
+}
+
+func (a *adminServer) ListTokens(ctx context.Context, _ *pb.ListTokensRequest) (*pb.ListTokensResponse, error) {
+	if err := a.authorize(ctx, scopeAdmin); err != nil {
+		return nil, err
+	}
+	return &pb.ListTokensResponse{Tokens: a.game.tokens.list()}, nil
+}
+
+func (a *adminServer) RevokeToken(ctx context.Context, req *pb.RevokeTokenRequest) (*pb.RevokeTokenResponse, error) {
+	if err := a.authorize(ctx, scopeAdmin); err != nil {
+		return nil, err
+	}
+	if err := a.game.tokens.revoke(req.GetTokenId()); err != nil {
+		return nil, err
+	}
+	log.Printf("API token %s revoked.", req.GetTokenId())
+	return &pb.RevokeTokenResponse{}, nil
+}
+
+// BridgeChat posts a chat message from outside the game into a room or the
+// global channel.
+func (a *adminServer) BridgeChat(ctx context.Context, req *pb.BridgeChatRequest) (*pb.BridgeChatResponse, error) {
+	if err := a.authorize(ctx, scopeChatBridge); err != nil {
+		return nil, err
+	}
+	sender, text := strings.TrimSpace(req.GetSenderName()), strings.TrimSpace(req.GetMessageText())
+	if sender == "" || len(sender) > maxBridgeSenderLength {
+		return nil, status.Errorf(codes.InvalidArgument, "sender name must be 1-%d characters", maxBridgeSenderLength)
+	}
+	if text == "" || len(text) >= 200 {
+		return nil, status.Error(codes.InvalidArgument, "message must be 1-199 characters")
+	}
+	if req.GetGlobal() {
+		if a.game.global == nil {
+			return nil, status.Error(codes.FailedPrecondition, "the global channel is disabled")
+		}
+		a.game.global.post("", sender, "", text)
+		return &pb.BridgeChatResponse{}, nil
+	}
+	rm, err := a.adminRoom(req.GetRoomId())
+	if err != nil {
+		return nil, err
+	}
+	rm.broadcastChatMessage("", sender, text)
+	return &pb.BridgeChatResponse{}, nil
+}
+
+// WatchChat streams chat messages as they are sent until the caller hangs up.
+func (a *adminServer) WatchChat(req *pb.WatchChatRequest, stream pb.AdminService_WatchChatServer) error {
+	if err := a.authorize(stream.Context(), scopeChatBridge); err != nil {
+		return err
+	}
+	if req.GetRoomId() != "" {
+		if _, err := a.adminRoom(req.GetRoomId()); err != nil {
+			return err
+		}
+	}
+	messages, stop := a.game.rooms.chatFeed.watch(req.GetRoomId())
+	defer stop()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case msg := <-messages:
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// SanctionPlayer mutes or bans a player for a time. A ban also disconnects
+// matching players who are online, on their next message.
+func (a *adminServer) SanctionPlayer(ctx context.Context, req *pb.SanctionPlayerRequest) (*pb.SanctionPlayerResponse, error) {
+	if err := a.authorize(ctx, scopeAdmin); err != nil {
+		return nil, err
+	}
+	sc, err := a.game.sanctions.issue(req)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Admin issued sanction %s: %v of '%s%s' until %s.", sc.ID, sc.Kind, sc.Username, sc.Address,
+		sc.ExpiresAt.Format(time.RFC3339))
+	return &pb.SanctionPlayerResponse{Sanction: sc.proto()}, nil
+}
+
+// ListSanctions returns the active mutes and bans.
+func (a *adminServer) ListSanctions(ctx context.Context, req *pb.ListSanctionsRequest) (*pb.ListSanctionsResponse, error) {
+	if err := a.authorize(ctx, scopeAdmin); err != nil {
+		return nil, err
+	}
+	return &pb.ListSanctionsResponse{Sanctions: a.game.sanctions.list()}, nil
+}
+
+// LiftSanction ends a mute or ban early.
+func (a *adminServer) LiftSanction(ctx context.Context, req *pb.LiftSanctionRequest) (*pb.LiftSanctionResponse, error) {
+	if err := a.authorize(ctx, scopeAdmin); err != nil {
+		return nil, err
+	}
+	if err := a.game.sanctions.lift(req.GetSanctionId()); err != nil {
+		return nil, err
+	}
+	log.Printf("Admin lifted sanction %s.", req.GetSanctionId())
+	return &pb.LiftSanctionResponse{}, nil
+}
+
+// BanPlayer bans a connected player, by their username and address, or an
+// address, and disconnects every connected player the ban applies to rather
+// than waiting for their next message.
+func (a *adminServer) BanPlayer(ctx context.Context, req *pb.BanPlayerRequest) (*pb.BanPlayerResponse, error) {
+	if err := a.authorize(ctx, scopeAdmin); err != nil {
+		return nil, err
+	}
+	playerID, address := req.GetPlayerId(), strings.TrimSpace(req.GetAddress())
+	if (playerID == "") == (address == "") {
+		return nil, status.Error(codes.InvalidArgument, "set exactly one of player_id and address")
+	}
+	var username string
+	if playerID != "" {
+		var ok bool
+		if username, address, ok = a.game.kicks.lookup(playerID); !ok {
+			return nil, status.Errorf(codes.NotFound, "player %s is not connected", playerID)
+		}
+	}
+	sc, err := a.game.sanctions.add(pb.SanctionKind_SANCTION_BAN, username, address,
+		time.Duration(req.GetDurationSeconds())*time.Second, req.GetReason())
+	if err != nil {
+		return nil, err
+	}
+	kicked := a.game.kicks.kickMatching(sc)
+	log.Printf("Admin banned '%s' (%s) until %s as %s; disconnecting %d player(s).", sc.Username, sc.Address,
+		sc.ExpiresAt.Format(time.RFC3339), sc.ID, len(kicked))
+	return &pb.BanPlayerResponse{Sanction: sc.proto(), DisconnectedPlayerIds: kicked}, nil
+}
+
+// UnbanPlayer lifts every ban of a username or address.
+func (a *adminServer) UnbanPlayer(ctx context.Context, req *pb.UnbanPlayerRequest) (*pb.UnbanPlayerResponse, error) {
+	if err := a.authorize(ctx, scopeAdmin); err != nil {
+		return nil, err
+	}
+	username, address := strings.TrimSpace(req.GetUsername()), strings.TrimSpace(req.GetAddress())
+	if (username == "") == (address == "") {
+		return nil, status.Error(codes.InvalidArgument, "set exactly one of username and address")
+	}
+	lifted := a.game.sanctions.liftMatching(pb.SanctionKind_SANCTION_BAN, username, address)
+	if len(lifted) == 0 {
+		return nil, status.Errorf(codes.NotFound, "no ban of '%s%s'", username, address)
+	}
+	log.Printf("Admin lifted %d ban(s) of '%s%s': %v", len(lifted), username, address, lifted)
+	return &pb.UnbanPlayerResponse{LiftedSanctionIds: lifted}, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	alertCooldown          = 5 * time.Minute // Minimum time between two firings of one rule
+	playerDropWindow       = 1 * time.Minute
+	playerDropFraction     = 0.5 // Fire when players fall below this fraction of the window peak
+	playerDropMinPeak      = 4   // Ignore drops in nearly empty servers
+	tickOverBudgetDuration = 30 * time.Second
+	errorSpikeWindow       = 1 * time.Minute
+	errorSpikeThreshold    = 20
+	notifierTimeout        = 5 * time.Second
+)
+
+// alert is a fired alert rule.
+type alert struct {
+	Rule    string    `json:"rule"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// notifier delivers alerts to an operator.
+type notifier interface {
+	Name() string
+	Notify(a alert) error
+}
+
+type logNotifier struct{}
+
+func (logNotifier) Name() string { return "log" }
+func (logNotifier) Notify(a alert) error {
+	log.Printf("ALERT [%s]: %s", a.Rule, a.Message)
+	return nil
+}
+
+// webhookNotifier POSTs the alert as JSON to a URL.
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *webhookNotifier) Name() string { return "webhook" }
+func (n *webhookNotifier) Notify(a alert) error {
+	return postJSON(n.client, n.url, a)
+}
+
+// discordNotifier posts the alert as a message to a Discord webhook.
+type discordNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *discordNotifier) Name() string { return "discord" }
+func (n *discordNotifier) Notify(a alert) error {
+	return postJSON(n.client, n.url, map[string]string{
+		"content": fmt.Sprintf(":rotating_light: **%s**: %s", a.Rule, a.Message),
+	})
+}
+
+func postJSON(client *http.Client, url string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// observation is the per-tick input to alert rules.
+type observation struct {
+	now          time.Time
+	players      int
+	tickElapsed  time.Duration
+	tickInterval time.Duration // The tick's budget: the governor's interval when it ran
+	errorsTotal  int64
+}
+
+// alertRule inspects observations and returns a message when it should fire.
+type alertRule interface {
+	Name() string
+	Evaluate(o observation) (string, bool)
+}
+
+type countSample struct {
+	at    time.Time
+	value int64
+}
+
+// playerDropRule fires when the player count falls sharply within a minute.
+type playerDropRule struct {
+	samples []countSample
+}
+
+func (r *playerDropRule) Name() string { return "player_drop" }
+func (r *playerDropRule) Evaluate(o observation) (string, bool) {
+	if n := len(r.samples); n == 0 || o.now.Sub(r.samples[n-1].at) >= time.Second {
+		r.samples = append(r.samples, countSample{at: o.now, value: int64(o.players)})
+	}
+	for len(r.samples) > 0 && o.now.Sub(r.samples[0].at) > playerDropWindow {
+		r.samples = r.samples[1:]
+	}
+	var peak int64
+	for _, sm := range r.samples {
+		peak = max(peak, sm.value)
+	}
+	if peak < playerDropMinPeak || float64(o.players) >= float64(peak)*playerDropFraction {
+		return "", false
+	}
+	return fmt.Sprintf("player count dropped from %d to %d within %v", peak, o.players, playerDropWindow), true
+}
+
+// tickBudgetRule fires when every tick has exceeded the tick interval for a sustained period.
+type tickBudgetRule struct {
+	overSince time.Time
+}
+
+func (r *tickBudgetRule) Name() string { return "tick_over_budget" }
+func (r *tickBudgetRule) Evaluate(o observation) (string, bool) {
+	if o.tickElapsed <= o.tickInterval {
+		r.overSince = time.Time{}
+		return "", false
+	}
+	if r.overSince.IsZero() {
+		r.overSince = o.now
+	}
+	if o.now.Sub(r.overSince) < tickOverBudgetDuration {
+		return "", false
+	}
+	return fmt.Sprintf("tick duration over the %v budget for %v (last %v)", o.tickInterval, o.now.Sub(r.overSince).Truncate(time.Second), o.tickElapsed), true
+}
+
+// errorSpikeRule fires when stream errors within a minute exceed a threshold.
+type errorSpikeRule struct {
+	samples []countSample
+}
+
+func (r *errorSpikeRule) Name() string { return "error_spike" }
+func (r *errorSpikeRule) Evaluate(o observation) (string, bool) {
+	r.samples = append(r.samples, countSample{at: o.now, value: o.errorsTotal})
+	for len(r.samples) > 1 && o.now.Sub(r.samples[0].at) > errorSpikeWindow {
+		r.samples = r.samples[1:]
+	}
+	recent := o.errorsTotal - r.samples[0].value
+	if recent < errorSpikeThreshold {
+		return "", false
+	}
+	return fmt.Sprintf("%d stream errors in the last %v", recent, errorSpikeWindow), true
+}
+
+// alertManager evaluates rules on every tick and fans fired alerts out to the
+// notifiers without blocking the tick loop.
+type alertManager struct {
+	mu        sync.Mutex
+	rules     []alertRule
+	notifiers []notifier
+	lastFired map[string]time.Time
+}
+
+func newAlertManager(webhookURL, discordURL string) *alertManager {
+	client := &http.Client{Timeout: notifierTimeout}
+	m := &alertManager{
+		rules:     []alertRule{&playerDropRule{}, &tickBudgetRule{}, &errorSpikeRule{}},
+		notifiers: []notifier{logNotifier{}},
+		lastFired: make(map[string]time.Time),
+	}
+	if webhookURL != "" {
+		m.notifiers = append(m.notifiers, &webhookNotifier{url: webhookURL, client: client})
+	}
+	if discordURL != "" {
+		m.notifiers = append(m.notifiers, &discordNotifier{url: discordURL, client: client})
+	}
+	return m
+}
+
+func (m *alertManager) observe(o observation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, rule := range m.rules {
+		msg, fire := rule.Evaluate(o)
+		if !fire || o.now.Sub(m.lastFired[rule.Name()]) < alertCooldown {
+			continue
+		}
+		m.lastFired[rule.Name()] = o.now
+		a := alert{Rule: rule.Name(), Message: msg, Time: o.now}
+		for _, n := range m.notifiers {
+			go func(n notifier) {
+				if err := n.Notify(a); err != nil {
+					log.Printf("Alert notifier %s failed: %v", n.Name(), err)
+				}
+			}(n)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultAnnouncementDuration = 10 * time.Second
+	maxAnnouncementDuration     = time.Hour
+	maxAnnouncementLength       = 200 // Bytes, as for chat
+)
+
+// announcementBoard remembers the latest server-wide announcement and the
+// latest of each room, so players who join while one is showing see it.
+type announcementBoard struct {
+	mu         sync.Mutex
+	serverWide *pb.ServerAnnouncement
+	byRoom     map[string]*pb.ServerAnnouncement
+}
+
+func (b *announcementBoard) post(roomID string, a *pb.ServerAnnouncement) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if roomID == "" {
+		b.serverWide = a
+		return
+	}
+	if b.byRoom == nil {
+		b.byRoom = make(map[string]*pb.ServerAnnouncement)
+	}
+	b.byRoom[roomID] = a
+}
+
+// showing returns the announcements still showing in a room, oldest first.
+func (b *announcementBoard) showing(roomID string, now time.Time) []*pb.ServerAnnouncement {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []*pb.ServerAnnouncement
+	for _, a := range []*pb.ServerAnnouncement{b.serverWide, b.byRoom[roomID]} {
+		if a != nil && now.UnixMilli() < a.ExpiresAtUnixMs {
+			out = append(out, a)
+		}
+	}
+	if len(out) == 2 && out[1].SentAtUnixMs < out[0].SentAtUnixMs {
+		out[0], out[1] = out[1], out[0]
+	}
+	return out
+}
+
+// sendAnnouncements sends a player who just joined the announcements still
+// showing in their room.
+func (s *gameServer) sendAnnouncements(rm *room, playerID string) {
+	for _, a := range s.announced.showing(rm.id, time.Now()) {
+		rm.broadcastTo(&pb.ServerMessage{Message: &pb.ServerMessage_Announcement{Announcement: a}}, "announcement",
+			func(id string) bool { return id == playerID })
+	}
+}
+
+// Announce sends an operator's announcement, such as a restart warning, to
+// every connected player or those of one room.
+func (a *adminServer) Announce(ctx context.Context, req *pb.AnnounceRequest) (*pb.AnnounceResponse, error) {
+	if err := a.authorize(ctx, scopeAdmin); err != nil {
+		return nil, err
+	}
+	text := strings.TrimSpace(req.GetText())
+	if text == "" || len(text) > maxAnnouncementLength {
+		return nil, status.Errorf(codes.InvalidArgument, "text must be 1 to %d bytes", maxAnnouncementLength)
+	}
+	if _, known := pb.AnnouncementSeverity_name[int32(req.GetSeverity())]; !known {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown severity %d", req.GetSeverity())
+	}
+	duration := time.Duration(req.GetDurationSeconds()) * time.Second
+	if duration == 0 {
+		duration = defaultAnnouncementDuration
+	}
+	if duration < 0 || duration > maxAnnouncementDuration {
+		return nil, status.Errorf(codes.InvalidArgument, "duration must be between 1s and %v", maxAnnouncementDuration)
+	}
+	rooms := a.game.rooms.all()
+	if req.GetRoomId() != "" {
+		rm, err := a.adminRoom(req.GetRoomId())
+		if err != nil {
+			return nil, err
+		}
+		rooms = []*room{rm}
+	}
+	now := time.Now()
+	announcement := &pb.ServerAnnouncement{
+		Text:            text,
+		Severity:        req.GetSeverity(),
+		SentAtUnixMs:    now.UnixMilli(),
+		ExpiresAtUnixMs: now.Add(duration).UnixMilli(),
+	}
+	a.game.announced.post(req.GetRoomId(), announcement)
+	msg := &pb.ServerMessage{Message: &pb.ServerMessage_Announcement{Announcement: announcement}}
+	players := 0
+	for _, rm := range rooms {
+		players += rm.streamCount()
+		rm.broadcast(msg, "announcement")
+	}
+	log.Printf("Admin announced to %d room(s), %d player(s) (%v): %s", len(rooms), players, req.GetSeverity(), text)
+	return &pb.AnnounceResponse{Rooms: int32(len(rooms)), Players: int32(players)}, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/png" // Frame counts of PNG sheets
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"simple-grpc-game/server/internal/game"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// assetManifestFile is the optional file in the -assets directory describing
+// its art; without it the directory holds the client's standard assets.
+const assetManifestFile = "manifest.json"
+
+// assetLayout is the art skins and tiles are drawn with, as read from
+// manifest.json.
+type assetLayout struct {
+	Assets  []assetSpec       `json:"assets"`
+	Sprite  string            `json:"sprite"`  // Sprite sheet of every skin not in Skins
+	Skins   map[string]string `json:"skins"`   // Skin -> sprite sheet
+	Tileset string            `json:"tileset"` // Sheet tile textures index into
+}
+
+type assetSpec struct {
+	ID          string `json:"id"`
+	File        string `json:"file"`
+	FrameWidth  int32  `json:"frame_width"`
+	FrameHeight int32  `json:"frame_height"`
+	FrameCount  int32  `json:"frame_count"` // 0 counts the frames the image holds
+}
+
+// defaultAssetLayout is the art in client/assets.
+var defaultAssetLayout = assetLayout{
+	Assets: []assetSpec{
+		{ID: "player", File: "player_sheet_256.png", FrameWidth: 128, FrameHeight: 128, FrameCount: 4},
+		{ID: "tileset", File: "tileset.png", FrameWidth: 32, FrameHeight: 32, FrameCount: 2},
+	},
+	Sprite:  "player",
+	Tileset: "tileset",
+}
+
+// loadAssetManifest builds the manifest of the art in dir, hashing every
+// file; an empty dir describes the standard assets without hashes.
+func loadAssetManifest(dir string) (*pb.AssetManifest, error) {
+	layout := defaultAssetLayout
+	if dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, assetManifestFile))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return nil, err
+		default:
+			layout = assetLayout{}
+			if err := json.Unmarshal(data, &layout); err != nil {
+				return nil, fmt.Errorf("%s: %w", assetManifestFile, err)
+			}
+		}
+	}
+
+	manifest := &pb.AssetManifest{SkinAssets: map[string]string{}, TilesetAsset: layout.Tileset}
+	ids := map[string]bool{}
+	for _, spec := range layout.Assets {
+		if spec.ID == "" || ids[spec.ID] {
+			return nil, fmt.Errorf("asset IDs must be set and unique, got %q twice or empty", spec.ID)
+		}
+		if spec.FrameWidth <= 0 || spec.FrameHeight <= 0 {
+			return nil, fmt.Errorf("asset %s: frame_width and frame_height must be positive", spec.ID)
+		}
+		ids[spec.ID] = true
+		asset := &pb.Asset{Id: spec.ID, File: spec.File, FrameWidth: spec.FrameWidth, FrameHeight: spec.FrameHeight, FrameCount: spec.FrameCount}
+		if dir != "" {
+			if err := hashAsset(filepath.Join(dir, spec.File), asset); err != nil {
+				return nil, fmt.Errorf("asset %s: %w", spec.ID, err)
+			}
+		}
+		manifest.Assets = append(manifest.Assets, asset)
+	}
+	for _, skin := range game.Skins() {
+		sprite, ok := layout.Skins[skin]
+		if !ok {
+			sprite = layout.Sprite
+		}
+		if !ids[sprite] {
+			return nil, fmt.Errorf("skin %s: no asset %q", skin, sprite)
+		}
+		manifest.SkinAssets[skin] = sprite
+	}
+	for skin := range layout.Skins {
+		if !game.ValidSkin(skin) {
+			return nil, fmt.Errorf("unknown skin %q", skin)
+		}
+	}
+	if !ids[layout.Tileset] {
+		return nil, fmt.Errorf("tileset: no asset %q", layout.Tileset)
+	}
+
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	manifest.Version = hex.EncodeToString(sum[:8])
+	return manifest, nil
+}
+
+// hashAsset fills in an asset's size and hash from its file, and its frame
+// count if the manifest left it to be counted.
+func hashAsset(path string, asset *pb.Asset) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	asset.Sha256 = hex.EncodeToString(sum[:])
+	asset.SizeBytes = int64(len(data))
+	if asset.FrameCount == 0 {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		cfg, _, err := image.DecodeConfig(f)
+		if err != nil {
+			return fmt.Errorf("counting frames: %w", err)
+		}
+		asset.FrameCount = int32(cfg.Width/int(asset.FrameWidth)) * int32(cfg.Height/int(asset.FrameHeight))
+	}
+	return nil
+}
+
+// GetAssetManifest implements the unary RPC describing the server's art.
+func (s *gameServer) GetAssetManifest(ctx context.Context, req *pb.AssetManifestRequest) (*pb.AssetManifest, error) {
+	return proto.Clone(s.assets).(*pb.AssetManifest), nil
+}
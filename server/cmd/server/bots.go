@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"simple-grpc-game/server/internal/game"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// botInputInterval is how often bots send an input, about as often as a
+// client holding a key.
+const botInputInterval = 100 * time.Millisecond
+
+// routeStep is one leg of a scripted bot route: inputs in one direction.
+type routeStep struct {
+	dir   pb.PlayerInput_Direction
+	steps int
+}
+
+var routeDirections = map[string]pb.PlayerInput_Direction{
+	"up":    pb.PlayerInput_UP,
+	"down":  pb.PlayerInput_DOWN,
+	"left":  pb.PlayerInput_LEFT,
+	"right": pb.PlayerInput_RIGHT,
+	"wait":  pb.PlayerInput_UNKNOWN,
+}
+
+// parseBotRoute parses a route such as "right:5,down:3,wait:2,left:5", each
+// leg a direction (or wait) and a number of inputs. Bots walk it in a loop.
+func parseBotRoute(spec string) ([]routeStep, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var route []routeStep
+	for _, leg := range strings.Split(spec, ",") {
+		name, count, ok := strings.Cut(strings.TrimSpace(leg), ":")
+		dir, known := routeDirections[strings.ToLower(name)]
+		steps, err := strconv.Atoi(count)
+		if !ok || !known || err != nil || steps < 1 {
+			return nil, fmt.Errorf("route leg %q must be up, down, left, right or wait, a colon and a positive count", leg)
+		}
+		route = append(route, routeStep{dir: dir, steps: steps})
+	}
+	return route, nil
+}
+
+// bot is a simulated player: in the room's State like anyone else, but with
+// no stream, moved by the server.
+type bot struct {
+	playerID string
+	route    []routeStep // Scripted route; nil walks at random
+	leg      int
+	stepsOn  int // Inputs sent on the current leg
+	wander   game.Wander
+	blocked  bool
+}
+
+// next returns the bot's next input direction.
+func (b *bot) next(now time.Time) pb.PlayerInput_Direction {
+	if len(b.route) == 0 {
+		return b.wander.Next(game.NPCView{Now: now, Blocked: b.blocked})
+	}
+	if b.stepsOn >= b.route[b.leg].steps {
+		b.leg, b.stepsOn = (b.leg+1)%len(b.route), 0
+	}
+	b.stepsOn++
+	return b.route[b.leg].dir
+}
+
+// roomBots keeps a room topped up with bots: as humans join, bots leave, so
+// the room holds at least want players while bots last. Only the room's tick
+// touches the bots; mu guards the settings.
+type roomBots struct {
+	mu    sync.Mutex
+	want  int
+	route []routeStep
+
+	bots      []*bot
+	ids       sync.Map // Player IDs of the bots, for lookups from other goroutines
+	named     int      // Bots created so far, for names
+	nextInput time.Time
+}
+
+// fillWithBots keeps every persistent room (the lobby and map worlds) at
+// players or more with server-side bots walking the route, or at random if
+// it is empty; 0 removes them.
+func (m *roomManager) fillWithBots(players int, route []routeStep) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.rooms {
+		if r.persistent {
+			r.bots.configure(players, route)
+		}
+	}
+}
+
+func (rb *roomBots) configure(want int, route []routeStep) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.want, rb.route = want, route
+}
+
+func (rb *roomBots) settings() (int, []routeStep) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.want, rb.route
+}
+
+// isBot reports whether a player of the room is a bot.
+func (r *room) isBot(playerID string) bool {
+	_, ok := r.bots.ids.Load(playerID)
+	return ok
+}
+
+// tickBots adds or removes bots to keep the room at its wanted population and
+// sends each bot's input, reporting whether the state may have changed.
+func (r *room) tickBots(now time.Time) bool {
+	rb := &r.bots
+	want, route := rb.settings()
+	changed := false
+	for target := max(want-r.streamCount(), 0); len(rb.bots) < target; {
+		rb.named++
+		b := &bot{playerID: fmt.Sprintf("bot_%s_%d", r.id, rb.named), route: route}
+		username := fmt.Sprintf("bot-%d", rb.named)
+		r.state.AddPlayer(b.playerID, username)
+		rb.ids.Store(b.playerID, true)
+		rb.bots = append(rb.bots, b)
+		log.Printf("Bot %s ('%s') joined room %s.", b.playerID, username, r.id)
+		changed = true
+	}
+	for target := max(want-r.streamCount(), 0); len(rb.bots) > target; {
+		b := rb.bots[len(rb.bots)-1]
+		rb.bots = rb.bots[:len(rb.bots)-1]
+		r.state.RemovePlayer(b.playerID)
+		rb.ids.Delete(b.playerID)
+		log.Printf("Bot %s left room %s.", b.playerID, r.id)
+		changed = true
+	}
+	if len(rb.bots) == 0 || now.Before(rb.nextInput) || r.holding() {
+		return changed
+	}
+	rb.nextInput = now.Add(botInputInterval)
+	for _, b := range rb.bots {
+		_, err := r.state.ApplyInput(b.playerID, b.next(now))
+		b.blocked = errors.Is(err, game.ErrBlockedByWall) || errors.Is(err, game.ErrBlockedByPlayer)
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+const maxBridgeSenderLength = 32
+
+// chatFeedBuffer is how many messages a slow watcher may fall behind by
+// before further messages to it are dropped.
+const chatFeedBuffer = 64
+
+// chatFeed fans out every room and global chat message to chat bridges
+// following it through WatchChat.
+type chatFeed struct {
+	mu       sync.Mutex
+	watchers map[chan *pb.ChatMessage]string // Channel -> room filter; empty for all rooms
+}
+
+func newChatFeed() *chatFeed {
+	return &chatFeed{watchers: make(map[chan *pb.ChatMessage]string)}
+}
+
+// watch subscribes to the chat of one room (and global chat), or of every
+// room if roomID is empty. The returned function unsubscribes.
+func (f *chatFeed) watch(roomID string) (<-chan *pb.ChatMessage, func()) {
+	ch := make(chan *pb.ChatMessage, chatFeedBuffer)
+	f.mu.Lock()
+	f.watchers[ch] = roomID
+	f.mu.Unlock()
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.watchers, ch)
+	}
+}
+
+// publish hands a message to every interested watcher without blocking.
+// Room messages must have RoomId set.
+func (f *chatFeed) publish(msg *pb.ChatMessage) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch, roomID := range f.watchers {
+		if roomID != "" && msg.Channel != pb.ChatChannel_CHAT_CHANNEL_GLOBAL && msg.RoomId != roomID {
+			continue
+		}
+		select {
+		case ch <- msg:
+		default:
+			log.Printf("Chat watcher fell behind; dropped a message from '%s'.", msg.SenderUsername)
+		}
+	}
+}
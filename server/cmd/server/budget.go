@@ -0,0 +1,118 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	budgetWindow          = 10 * time.Second // Usage is compared with the budget over this long
+	defaultRoomTickBudget = 0.5              // Share of the tick interval one room may spend ticking
+)
+
+// roomBudgetConfig is how much of the server one room may use.
+type roomBudgetConfig struct {
+	tickShare   float64 // Share of wall time spent in the room's tick; 0 is unlimited
+	bytesPerSec int64   // Bytes sent to the room's players and spectators; 0 is unlimited
+	throttle    bool    // Throttle rooms over budget; otherwise only warn
+}
+
+// roomBudget attributes tick time and bytes sent to a room, so one runaway
+// room can be told apart from general load, and throttles the room while it
+// uses more than its share. A throttled room ticks at half rate and sends
+// input-driven changes with its next tick rather than on every input.
+type roomBudget struct {
+	config    roomBudgetConfig
+	tickNanos atomic.Int64 // Spent ticking in the current window
+	bytes     atomic.Int64 // Sent in the current window
+	throttled atomic.Bool
+	over      atomic.Bool // Over budget in the last window, throttled or not
+
+	// Usage in the last complete window, for the status page.
+	lastTickPermille atomic.Int64
+	lastBytesPerSec  atomic.Int64
+
+	windowStart time.Time // Only used by the tick loop
+	skipped     bool      // Whether the last tick was skipped while throttled
+}
+
+// setRoomBudgets applies the per-room budget to every room, current and future.
+func (m *roomManager) setRoomBudgets(cfg roomBudgetConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.budget = cfg
+	for _, r := range m.rooms {
+		r.budget.config = cfg
+	}
+}
+
+// recordSend counts a message sent for the room.
+func (r *room) recordSend(bytes int) {
+	r.metrics.recordSend(bytes)
+	r.budget.bytes.Add(int64(bytes))
+}
+
+// throttled reports whether the room is being throttled for exceeding its budget.
+func (r *room) throttled() bool {
+	return r.budget.throttled.Load()
+}
+
+// broadcastInputChanges sends the changes a player's input made, or leaves
+// them for the next tick to send together while the room is throttled.
+func (r *room) broadcastInputChanges() {
+	if !r.throttled() {
+		r.broadcastDeltaState()
+	}
+}
+
+// tickWithinBudget ticks the room, timing the tick against its budget and
+// skipping every other tick while throttled.
+func (r *room) tickWithinBudget(interval time.Duration) {
+	b := &r.budget
+	now := time.Now()
+	if b.windowStart.IsZero() {
+		b.windowStart = now
+	}
+	if elapsed := now.Sub(b.windowStart); elapsed >= budgetWindow {
+		r.closeBudgetWindow(elapsed)
+		b.windowStart = now
+	}
+	if r.throttled() {
+		b.skipped = !b.skipped
+		if b.skipped {
+			return
+		}
+	}
+	start := time.Now()
+	r.tick(interval)
+	b.tickNanos.Add(int64(time.Since(start)))
+}
+
+// closeBudgetWindow compares the room's usage over the window that just
+// ended with its budget. A throttled room uses about half what it would at
+// full rate, so it is released only once twice its usage fits the budget.
+func (r *room) closeBudgetWindow(elapsed time.Duration) {
+	b := &r.budget
+	tickShare := float64(b.tickNanos.Swap(0)) / float64(elapsed)
+	bytesPerSec := float64(b.bytes.Swap(0)) / elapsed.Seconds()
+	b.lastTickPermille.Store(int64(tickShare * 1000))
+	b.lastBytesPerSec.Store(int64(bytesPerSec))
+	scale := 1.0
+	if b.throttled.Load() {
+		scale = 2
+	}
+	cfg := b.config
+	over := (cfg.tickShare > 0 && tickShare*scale > cfg.tickShare) ||
+		(cfg.bytesPerSec > 0 && bytesPerSec*scale > float64(cfg.bytesPerSec))
+	wasOver := b.over.Swap(over)
+	b.throttled.Store(over && cfg.throttle)
+	switch {
+	case over && !wasOver && cfg.throttle:
+		log.Printf("Warning: Room %s is over its budget (%.0f%% of the tick interval, %.0f KB/s); throttling it.", r.id, tickShare*100, bytesPerSec/1024)
+	case over && !wasOver:
+		log.Printf("Warning: Room %s is over its budget (%.0f%% of the tick interval, %.0f KB/s).", r.id, tickShare*100, bytesPerSec/1024)
+	case !over && wasOver:
+		log.Printf("Room %s is back within its budget.", r.id)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultCaptureDuration = 5 * time.Minute
+	maxCaptureDuration     = 30 * time.Minute
+	maxCaptureEvents       = 20000 // Per capture; later events are counted as dropped
+	maxCaptures            = 8     // Kept at once; the oldest finished one is evicted
+)
+
+// captureEvent is one recorded input, broadcast or error.
+type captureEvent struct {
+	Time     time.Time       `json:"time"`
+	Kind     string          `json:"kind"` // "input", "broadcast" or "error"
+	What     string          `json:"what,omitempty"`
+	RoomID   string          `json:"room_id"`
+	PlayerID string          `json:"player_id"`
+	Message  json.RawMessage `json:"message,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// capture records the traffic of one player or one room for a limited time.
+type capture struct {
+	ID        string    `json:"id"`
+	PlayerID  string    `json:"player_id,omitempty"`
+	RoomID    string    `json:"room_id,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	mu      sync.Mutex
+	Events  []captureEvent `json:"events"`
+	Dropped int            `json:"dropped_events"`
+}
+
+func (c *capture) matches(roomID, playerID string, now time.Time) bool {
+	if now.After(c.ExpiresAt) {
+		return false
+	}
+	if c.PlayerID != "" {
+		return c.PlayerID == playerID
+	}
+	return c.RoomID == roomID
+}
+
+// captureRegistry holds the diagnostic captures requested through the admin
+// service. Recording is a single atomic load while nothing is being captured.
+type captureRegistry struct {
+	mu          sync.Mutex
+	captures    map[string]*capture
+	activeUntil atomic.Int64 // Latest expiry of any capture, in Unix nanoseconds
+}
+
+func newCaptureRegistry() *captureRegistry {
+	return &captureRegistry{captures: make(map[string]*capture)}
+}
+
+// start begins capturing a player or a room. Errors are gRPC status errors.
+func (r *captureRegistry) start(playerID, roomID string, d time.Duration) (*capture, error) {
+	if (playerID == "") == (roomID == "") {
+		return nil, status.Error(codes.InvalidArgument, "exactly one of player_id and room_id must be set")
+	}
+	if d <= 0 {
+		d = defaultCaptureDuration
+	}
+	d = min(d, maxCaptureDuration)
+	now := time.Now()
+	c := &capture{ID: newCaptureID(), PlayerID: playerID, RoomID: roomID, StartedAt: now, ExpiresAt: now.Add(d)}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.captures) >= maxCaptures && !r.evictFinishedLocked(now) {
+		return nil, status.Errorf(codes.ResourceExhausted, "%d captures are already recording", maxCaptures)
+	}
+	r.captures[c.ID] = c
+	if until := c.ExpiresAt.UnixNano(); until > r.activeUntil.Load() {
+		r.activeUntil.Store(until)
+	}
+	return c, nil
+}
+
+// evictFinishedLocked drops the oldest finished capture, reporting whether
+// there was one. Must be called with r.mu held.
+func (r *captureRegistry) evictFinishedLocked(now time.Time) bool {
+	var finished []*capture
+	for _, c := range r.captures {
+		if now.After(c.ExpiresAt) {
+			finished = append(finished, c)
+		}
+	}
+	if len(finished) == 0 {
+		return false
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].StartedAt.Before(finished[j].StartedAt) })
+	delete(r.captures, finished[0].ID)
+	return true
+}
+
+// record adds an event to every capture following the room or player. msg
+// may be nil for errors.
+func (r *captureRegistry) record(kind, what, roomID, playerID string, msg proto.Message, errText string) {
+	if r == nil {
+		return
+	}
+	now := time.Now()
+	if now.UnixNano() > r.activeUntil.Load() {
+		return
+	}
+	r.mu.Lock()
+	var targets []*capture
+	for _, c := range r.captures {
+		if c.matches(roomID, playerID, now) {
+			targets = append(targets, c)
+		}
+	}
+	r.mu.Unlock()
+	if len(targets) == 0 {
+		return
+	}
+	ev := captureEvent{Time: now, Kind: kind, What: what, RoomID: roomID, PlayerID: playerID, Error: errText}
+	if msg != nil {
+		data, err := protojson.Marshal(msg)
+		if err != nil {
+			ev.Error = fmt.Sprintf("could not encode message: %v", err)
+		}
+		ev.Message = data
+	}
+	for _, c := range targets {
+		c.mu.Lock()
+		if len(c.Events) < maxCaptureEvents {
+			c.Events = append(c.Events, ev)
+		} else {
+			c.Dropped++
+		}
+		c.mu.Unlock()
+	}
+}
+
+// recordError is record for an error without a message.
+func (r *captureRegistry) recordError(roomID, playerID string, format string, args ...any) {
+	r.record("error", "", roomID, playerID, nil, fmt.Sprintf(format, args...))
+}
+
+// bundle returns a capture as a JSON document and whether it has finished.
+// Errors are gRPC status errors.
+func (r *captureRegistry) bundle(id string) ([]byte, bool, error) {
+	r.mu.Lock()
+	c, ok := r.captures[id]
+	r.mu.Unlock()
+	if !ok {
+		return nil, false, status.Errorf(codes.NotFound, "capture %s not found", id)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, false, status.Errorf(codes.Internal, "encode capture: %v", err)
+	}
+	return data, time.Now().After(c.ExpiresAt), nil
+}
+
+func newCaptureID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("cap_%d", time.Now().UnixNano())
+	}
+	return "cap_" + hex.EncodeToString(b)
+}
+
+// logCaptureStart notes a capture in the server log, which is not part of it.
+func logCaptureStart(c *capture) {
+	target := "room " + c.RoomID
+	if c.PlayerID != "" {
+		target = "player " + c.PlayerID
+	}
+	log.Printf("Capture %s started for %s until %s.", c.ID, target, c.ExpiresAt.Format(time.RFC3339))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	chatHistorySize   = 50 // Messages kept per channel
+	chatBackfillCount = 20 // Messages sent to a player joining a channel
+)
+
+// chatHistory keeps the most recent messages of one chat channel and
+// optionally persists them to disk so they survive restarts.
+type chatHistory struct {
+	mu       sync.Mutex
+	channel  pb.ChatChannel
+	messages []*pb.ChatMessage // Oldest first, at most chatHistorySize
+	path     string            // Empty disables persistence
+}
+
+// newChatHistory creates a history, loading previous messages from path if set.
+func newChatHistory(channel pb.ChatChannel, path string) *chatHistory {
+	h := &chatHistory{channel: channel, path: path}
+	if path == "" {
+		return h
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: Could not read chat history '%s': %v", path, err)
+		}
+		return h
+	}
+	var stored pb.ChatHistory
+	if err := protojson.Unmarshal(data, &stored); err != nil {
+		log.Printf("Warning: Could not parse chat history '%s': %v", path, err)
+		return h
+	}
+	h.messages = stored.Messages
+	if len(h.messages) > chatHistorySize {
+		h.messages = h.messages[len(h.messages)-chatHistorySize:]
+	}
+	log.Printf("Loaded %d chat messages from '%s'", len(h.messages), path)
+	return h
+}
+
+// add records a message, saving the history if it is persisted.
+func (h *chatHistory) add(msg *pb.ChatMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.messages = append(h.messages, proto.Clone(msg).(*pb.ChatMessage))
+	if len(h.messages) > chatHistorySize {
+		h.messages = h.messages[len(h.messages)-chatHistorySize:]
+	}
+	if h.path != "" {
+		if err := h.saveLocked(); err != nil {
+			log.Printf("Warning: Could not save chat history: %v", err)
+		}
+	}
+}
+
+// saveLocked writes the messages atomically via a temporary file.
+func (h *chatHistory) saveLocked() error {
+	data, err := protojson.Marshal(&pb.ChatHistory{Channel: h.channel, Messages: h.messages})
+	if err != nil {
+		return err
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// backfill returns a message carrying the last chatBackfillCount messages, or
+// nil if there are none.
+func (h *chatHistory) backfill() *pb.ServerMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.messages) == 0 {
+		return nil
+	}
+	recent := h.messages[max(0, len(h.messages)-chatBackfillCount):]
+	return &pb.ServerMessage{Message: &pb.ServerMessage_ChatHistory{ChatHistory: &pb.ChatHistory{
+		Channel:  h.channel,
+		Messages: append([]*pb.ChatMessage(nil), recent...),
+	}}}
+}
+
+// sendChatBackfill sends a player the recent messages of a channel, if any.
+func (r *room) sendChatBackfill(playerID string, h *chatHistory) {
+	if msg := h.backfill(); msg != nil {
+		r.broadcastTo(msg, "chat history", func(id string) bool { return id == playerID })
+	}
+}
+
+// chatHistoryPath returns where a channel's history is persisted in dir, or
+// "" if dir is empty.
+func chatHistoryPath(dir, name string) string {
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, name+".chat.json")
+}
+
+// persistChat makes the chat history of every persistent room survive
+// restarts by keeping it in dir. Rooms created later keep theirs in memory.
+func (m *roomManager) persistChat(dir string) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("Warning: Could not create chat history directory '%s': %v", dir, err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.rooms {
+		if r.persistent {
+			r.chat = newChatHistory(pb.ChatChannel_CHAT_CHANNEL_ROOM, chatHistoryPath(dir, r.id))
+		}
+	}
+}
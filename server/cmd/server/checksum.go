@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"simple-grpc-game/server/internal/game"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+const (
+	checksumEveryTicks    = 50 // About every 5s at the normal tick rate
+	checksumHistoryLength = 4  // Recent checksums kept to check reports against
+)
+
+// checksumLog holds a room's recently broadcast checksums.
+type checksumLog struct {
+	mu     sync.Mutex
+	recent []*pb.StateChecksum // Oldest first
+}
+
+// broadcastChecksum flushes pending changes and sends every client a
+// checksum of the state they should now hold.
+func (r *room) broadcastChecksum(tick uint64) {
+	r.broadcastDeltaState()
+	players, count, tiles := r.state.Checksum()
+	sum := &pb.StateChecksum{Tick: tick, PlayersChecksum: players, PlayerCount: int32(count), TilesChecksum: tiles}
+	r.checksums.mu.Lock()
+	r.checksums.recent = append(r.checksums.recent, sum)
+	if len(r.checksums.recent) > checksumHistoryLength {
+		r.checksums.recent = r.checksums.recent[1:]
+	}
+	r.checksums.mu.Unlock()
+	r.broadcast(&pb.ServerMessage{Message: &pb.ServerMessage_StateChecksum{StateChecksum: sum}}, "checksum")
+}
+
+// checksumAt returns the checksum broadcast at a tick, if still kept.
+func (r *room) checksumAt(tick uint64) (*pb.StateChecksum, bool) {
+	r.checksums.mu.Lock()
+	defer r.checksums.mu.Unlock()
+	for _, sum := range r.checksums.recent {
+		if sum.Tick == tick {
+			return sum, true
+		}
+	}
+	return nil, false
+}
+
+// handleDesyncReport logs a client's checksums for a state it did not match.
+// Reports for checksums the room no longer keeps, or repeats for the same
+// tick, are ignored.
+func (s *gameServer) handleDesyncReport(sess *playerSession, report *pb.DesyncReport) {
+	sum, ok := sess.room.checksumAt(report.GetTick())
+	if !ok || report.GetTick() <= sess.lastDesyncTick {
+		return
+	}
+	sess.lastDesyncTick = report.GetTick()
+	s.metrics.desyncReports.Add(1)
+	playersOK := report.GetPlayersChecksum() == sum.PlayersChecksum && report.GetPlayerCount() == sum.PlayerCount
+	tilesOK := report.GetTilesChecksum() == 0 || report.GetTilesChecksum() == sum.TilesChecksum
+	log.Printf("Desync reported by player %s ('%s') in room %s at tick %d: players %08x/%d (server %08x/%d), tiles %08x (server %08x)",
+		sess.playerID, sess.username, sess.roomID, sum.Tick,
+		report.GetPlayersChecksum(), report.GetPlayerCount(), sum.PlayersChecksum, sum.PlayerCount,
+		report.GetTilesChecksum(), sum.TilesChecksum)
+	sess.room.emitEvent(game.EventDesync, sess.playerID, map[string]any{
+		"tick": sum.Tick, "players_match": playersOK, "tiles_match": tilesOK,
+		"client_player_count": report.GetPlayerCount(), "server_player_count": sum.PlayerCount,
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	pb "simple-grpc-game/gen/go/game"
+)
+
+const (
+	mapChunkSize       = 32        // Tiles per side of a streamed map chunk
+	chunkedMapMinTiles = 128 * 128 // Smaller maps are always sent whole
+	chunkViewRadius    = 1         // Chunks around the player's own chunk to keep loaded
+	// defaultClientMessageLimit is gRPC's default receive limit, assumed for
+	// clients that do not state their own.
+	defaultClientMessageLimit = 4 << 20
+)
+
+type chunkCoord struct{ X, Y int }
+
+// shouldStreamMap reports whether a joining client gets the map in chunks.
+func (r *room) shouldStreamMap(clientSupportsChunks bool) bool {
+	w, h := r.state.MapSize()
+	return clientSupportsChunks && w*h >= chunkedMapMinTiles
+}
+
+// clientMessageLimit returns the largest message a joining client accepts.
+func clientMessageLimit(hello *pb.ClientHello) int {
+	if limit := int(hello.GetMaxMessageBytes()); limit > 0 {
+		return limit
+	}
+	return defaultClientMessageLimit
+}
+
+// startChunkView starts streaming the map to a player who has been sent a
+// chunked InitialMapData, beginning with the chunks around them.
+func (r *room) startChunkView(playerID string) {
+	r.muChunks.Lock()
+	r.chunkViews[playerID] = make(map[chunkCoord]bool)
+	r.muChunks.Unlock()
+	r.sendMapChunks(playerID)
+}
+
+func (r *room) stopChunkView(playerID string) {
+	r.muChunks.Lock()
+	defer r.muChunks.Unlock()
+	delete(r.chunkViews, playerID)
+}
+
+// chunkStreamers returns the IDs of the players streaming the map.
+func (r *room) chunkStreamers() map[string]bool {
+	r.muChunks.Lock()
+	defer r.muChunks.Unlock()
+	streaming := make(map[string]bool, len(r.chunkViews))
+	for id := range r.chunkViews {
+		streaming[id] = true
+	}
+	return streaming
+}
+
+// resetChunkViews forgets what every streaming player has loaded, once they
+// have been sent the InitialMapData of a reloaded map, so the chunks around
+// them are sent again.
+func (r *room) resetChunkViews() {
+	r.muChunks.Lock()
+	defer r.muChunks.Unlock()
+	for id := range r.chunkViews {
+		r.chunkViews[id] = make(map[chunkCoord]bool)
+	}
+}
+
+// sendMapChunks sends a streaming player the chunks within chunkViewRadius of
+// their position that they do not have yet. Chunks stay loaded on the client,
+// and later changes to them arrive as MapTileUpdates like on any other map.
+func (r *room) sendMapChunks(playerID string) {
+	tileX, tileY, ok := r.state.PlayerTile(playerID)
+	if !ok {
+		return
+	}
+	cx, cy := tileX/mapChunkSize, tileY/mapChunkSize
+	// On wrapping maps the chunks past an edge are those on the opposite side
+	wrap := r.state.WrapsAround()
+	w, h := r.state.MapSize()
+	chunksX, chunksY := (w+mapChunkSize-1)/mapChunkSize, (h+mapChunkSize-1)/mapChunkSize
+
+	r.muChunks.Lock()
+	sent, streaming := r.chunkViews[playerID]
+	var missing []chunkCoord
+	for y := cy - chunkViewRadius; y <= cy+chunkViewRadius; y++ {
+		for x := cx - chunkViewRadius; x <= cx+chunkViewRadius; x++ {
+			c := chunkCoord{X: x, Y: y}
+			if wrap {
+				c = chunkCoord{X: (x%chunksX + chunksX) % chunksX, Y: (y%chunksY + chunksY) % chunksY}
+			}
+			if streaming && !sent[c] {
+				sent[c] = true
+				missing = append(missing, c)
+			}
+		}
+	}
+	r.muChunks.Unlock()
+
+	for _, c := range missing {
+		chunk, inMap := r.state.MapChunk(c.X, c.Y, mapChunkSize)
+		if !inMap {
+			continue
+		}
+		r.broadcastTo(&pb.ServerMessage{Message: &pb.ServerMessage_MapChunk{MapChunk: chunk}}, "map chunk",
+			func(id string) bool { return id == playerID })
+	}
+}
+
+// streamMapChunks tops up every streaming player's chunks after they move.
+func (r *room) streamMapChunks() {
+	r.muChunks.Lock()
+	ids := make([]string, 0, len(r.chunkViews))
+	for id := range r.chunkViews {
+		ids = append(ids, id)
+	}
+	r.muChunks.Unlock()
+	for _, id := range ids {
+		r.sendMapChunks(id)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	clusterChannelPrefix = "simple-grpc-game:room:"
+	clusterGlobalChannel = "simple-grpc-game:global"
+	clusterSyncInterval  = 2 * time.Second         // How often every hosted player is republished
+	clusterPeerTimeout   = 3 * clusterSyncInterval // Players of a server silent this long are dropped
+	clusterBuffer        = 1024                    // Updates queued for publishing before new ones are dropped
+)
+
+// cluster shares persistent rooms, the lobby and map worlds, with other
+// servers through Redis pub/sub, so players connected to different servers
+// meet in the same world. Each server simulates only its own players: it
+// publishes their changes and shows other servers' players as remote
+// players, merged into its broadcasts. Remote players do not collide with
+// local ones or count towards room capacity; this is a first step toward
+// horizontal scaling, not a shared simulation. The global channel, when
+// enabled, is shared too (see relayGlobal).
+type cluster struct {
+	client   *redis.Client
+	serverID string
+	rooms    *roomManager
+	out      chan *pb.ClusterPlayers
+	global   chan *pb.ClusterGlobal
+}
+
+// openCluster connects to the Redis server at url and starts sharing the
+// rooms' persistent rooms; an empty url disables sharing.
+func openCluster(url string, rooms *roomManager) (*cluster, error) {
+	if url == "" {
+		return nil, nil
+	}
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), playerStoreTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect to Redis at %s: %w", opts.Addr, err)
+	}
+	b := make([]byte, 4)
+	rand.Read(b)
+	c := &cluster{client: client, serverID: "srv_" + hex.EncodeToString(b), rooms: rooms, out: make(chan *pb.ClusterPlayers, clusterBuffer), global: make(chan *pb.ClusterGlobal, clusterBuffer)}
+	sub := client.PSubscribe(context.Background(), clusterChannelPrefix+"*")
+	if _, err := sub.Receive(ctx); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("subscribe to room updates: %w", err)
+	}
+	rooms.shareWith(c)
+	go c.publish()
+	go c.receive(sub)
+	log.Printf("Sharing persistent rooms through Redis at %s as server %s", opts.Addr, c.serverID)
+	return c, nil
+}
+
+// shareWith connects the persistent rooms to the cluster.
+func (m *roomManager) shareWith(c *cluster) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cluster = c
+	for _, r := range m.rooms {
+		r.cluster = c
+	}
+}
+
+// publishDelta queues the players of a room's delta for other servers,
+// without blocking. The players are copied, as the delta's go back to a pool
+// once it is broadcast.
+func (c *cluster) publishDelta(r *room, delta *pb.DeltaUpdate) {
+	if !r.persistent || (len(delta.UpdatedPlayers) == 0 && len(delta.RemovedPlayerIds) == 0) {
+		return
+	}
+	players := make([]*pb.Player, len(delta.UpdatedPlayers))
+	for i, p := range delta.UpdatedPlayers {
+		players[i] = proto.Clone(p).(*pb.Player)
+	}
+	c.enqueue(&pb.ClusterPlayers{RoomId: r.id, Players: players, RemovedPlayerIds: delta.RemovedPlayerIds})
+}
+
+func (c *cluster) enqueue(msg *pb.ClusterPlayers) {
+	msg.ServerId = c.serverID
+	select {
+	case c.out <- msg:
+	default:
+		log.Printf("Warning: Cluster updates are backed up; dropped an update of room %s.", msg.RoomId)
+	}
+}
+
+// publish sends queued updates, and every clusterSyncInterval every hosted
+// player, which also tells other servers this one is alive.
+func (c *cluster) publish() {
+	ticker := time.NewTicker(clusterSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg := <-c.out:
+			data, err := proto.Marshal(msg)
+			if err != nil {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), playerStoreTimeout)
+			if err := c.client.Publish(ctx, clusterChannelPrefix+msg.RoomId, data).Err(); err != nil {
+				log.Printf("Publishing an update of room %s failed: %v", msg.RoomId, err)
+			}
+			cancel()
+		case msg := <-c.global:
+			data, err := proto.Marshal(msg)
+			if err != nil {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), playerStoreTimeout)
+			if err := c.client.Publish(ctx, clusterGlobalChannel, data).Err(); err != nil {
+				log.Printf("Publishing a global channel message failed: %v", err)
+			}
+			cancel()
+		case now := <-ticker.C:
+			for _, r := range c.rooms.all() {
+				if r.persistent {
+					c.enqueue(&pb.ClusterPlayers{RoomId: r.id, Players: r.state.GetAllPlayers(), Full: true})
+					r.expireRemote(now)
+				}
+			}
+		}
+	}
+}
+
+// receive merges other servers' updates into the rooms they are for.
+func (c *cluster) receive(sub *redis.PubSub) {
+	for m := range sub.Channel() {
+		var msg pb.ClusterPlayers
+		if err := proto.Unmarshal([]byte(m.Payload), &msg); err != nil {
+			log.Printf("Ignoring a malformed update on %s: %v", m.Channel, err)
+			continue
+		}
+		if msg.ServerId == c.serverID {
+			continue
+		}
+		if r, ok := c.rooms.get(strings.TrimPrefix(m.Channel, clusterChannelPrefix)); ok && r.persistent {
+			r.mergeRemote(&msg, time.Now())
+		}
+	}
+}
+
+// relayGlobal shares the global channel with other servers: g publishes its
+// players' chat and presence through the cluster, and receives theirs.
+func (c *cluster) relayGlobal(g *globalChannel) error {
+	ctx, cancel := context.WithTimeout(context.Background(), playerStoreTimeout)
+	defer cancel()
+	sub := c.client.Subscribe(context.Background(), clusterGlobalChannel)
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("subscribe to the global channel: %w", err)
+	}
+	g.cluster = c
+	go func() {
+		for m := range sub.Channel() {
+			var msg pb.ClusterGlobal
+			if err := proto.Unmarshal([]byte(m.Payload), &msg); err != nil {
+				log.Printf("Ignoring a malformed global channel message: %v", err)
+				continue
+			}
+			if msg.ServerId != c.serverID {
+				g.receive(&msg)
+			}
+		}
+	}()
+	return nil
+}
+
+// publishGlobal queues a global chat message or presence update for other
+// servers, without blocking.
+func (c *cluster) publishGlobal(msg *pb.ClusterGlobal) {
+	msg.ServerId = c.serverID
+	select {
+	case c.global <- msg:
+	default:
+		log.Printf("Warning: Cluster updates are backed up; dropped a global channel message.")
+	}
+}
+
+// remotePlayers are the players other servers host in a room, by server.
+type remotePlayers struct {
+	mu      sync.Mutex
+	servers map[string]*remoteServer
+}
+
+type remoteServer struct {
+	players  map[string]*pb.Player // By remote ID (see remoteID)
+	lastSeen time.Time
+}
+
+// remoteID namespaces another server's player ID, which may clash with ours.
+func remoteID(serverID, playerID string) string {
+	return serverID + "/" + playerID
+}
+
+// mergeRemote applies another server's update and broadcasts the change.
+func (r *room) mergeRemote(msg *pb.ClusterPlayers, now time.Time) {
+	delta := &pb.DeltaUpdate{}
+	r.remote.mu.Lock()
+	if r.remote.servers == nil {
+		r.remote.servers = make(map[string]*remoteServer)
+	}
+	srv, ok := r.remote.servers[msg.ServerId]
+	if !ok {
+		srv = &remoteServer{players: make(map[string]*pb.Player)}
+		r.remote.servers[msg.ServerId] = srv
+		log.Printf("Room %s now shares players with server %s.", r.id, msg.ServerId)
+	}
+	srv.lastSeen = now
+	present := make(map[string]bool, len(msg.Players))
+	for _, p := range msg.Players {
+		p.Id = remoteID(msg.ServerId, p.Id)
+		p.Remote = true
+		p.ChangedFields = 0
+		present[p.Id] = true
+		if old, ok := srv.players[p.Id]; !ok || !proto.Equal(old, p) {
+			srv.players[p.Id] = p
+			delta.UpdatedPlayers = append(delta.UpdatedPlayers, p)
+		}
+	}
+	for _, id := range msg.RemovedPlayerIds {
+		id = remoteID(msg.ServerId, id)
+		if _, ok := srv.players[id]; ok {
+			delete(srv.players, id)
+			delta.RemovedPlayerIds = append(delta.RemovedPlayerIds, id)
+		}
+	}
+	if msg.Full {
+		for id := range srv.players {
+			if !present[id] {
+				delete(srv.players, id)
+				delta.RemovedPlayerIds = append(delta.RemovedPlayerIds, id)
+			}
+		}
+	}
+	r.remote.mu.Unlock()
+	if len(delta.UpdatedPlayers) > 0 || len(delta.RemovedPlayerIds) > 0 {
+		r.broadcast(&pb.ServerMessage{Message: &pb.ServerMessage_DeltaUpdate{DeltaUpdate: delta}}, "remote delta")
+	}
+}
+
+// expireRemote drops the players of servers that have gone silent.
+func (r *room) expireRemote(now time.Time) {
+	delta := &pb.DeltaUpdate{}
+	r.remote.mu.Lock()
+	for serverID, srv := range r.remote.servers {
+		if now.Sub(srv.lastSeen) < clusterPeerTimeout {
+			continue
+		}
+		for id := range srv.players {
+			delta.RemovedPlayerIds = append(delta.RemovedPlayerIds, id)
+		}
+		delete(r.remote.servers, serverID)
+		log.Printf("Server %s went silent; dropped its %d player(s) from room %s.", serverID, len(srv.players), r.id)
+	}
+	r.remote.mu.Unlock()
+	if len(delta.RemovedPlayerIds) > 0 {
+		r.broadcast(&pb.ServerMessage{Message: &pb.ServerMessage_DeltaUpdate{DeltaUpdate: delta}}, "remote delta")
+	}
+}
+
+// remoteStateMessage is a delta adding every remote player, for a player
+// joining the room; ok is false if there are none.
+func (r *room) remoteStateMessage() (msg *pb.ServerMessage, ok bool) {
+	delta := &pb.DeltaUpdate{}
+	r.remote.mu.Lock()
+	for _, srv := range r.remote.servers {
+		for _, p := range srv.players {
+			delta.UpdatedPlayers = append(delta.UpdatedPlayers, p)
+		}
+	}
+	r.remote.mu.Unlock()
+	return &pb.ServerMessage{Message: &pb.ServerMessage_DeltaUpdate{DeltaUpdate: delta}}, len(delta.UpdatedPlayers) > 0
+}
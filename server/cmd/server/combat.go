@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"simple-grpc-game/server/internal/game"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+const (
+	combatRoomMode = "combat"
+	killPoints     = 1 // Score for killing another player
+)
+
+// startCombat turns a new room into a combat room, keeping position history
+// so attacks can be judged against where the attacker saw the others.
+func (m *roomManager) startCombat(r *room) {
+	r.lag = m.lagCompensation()
+	r.state.EnablePositionHistory()
+}
+
+// attack handles a player's AttackRequest, announcing the swing so clients
+// can animate it. Only combat rooms allow attacks; hazard tiles hurt players
+// in every room.
+func (r *room) attack(sess *playerSession, req *pb.AttackRequest) {
+	if r.mode != combatRoomMode {
+		return
+	}
+	rewind := r.lag.rewindFor(sess.playerID, req.GetSentAtServerMs(), time.Now())
+	result, err := r.state.Attack(sess.playerID, rewind)
+	if err != nil {
+		return // Dead or on cooldown; clients may send attacks faster than allowed
+	}
+	r.broadcast(&pb.ServerMessage{Message: &pb.ServerMessage_AttackEvent{AttackEvent: &pb.AttackEvent{
+		AttackerPlayerId: sess.playerID,
+		Direction:        result.Direction,
+		HitPlayerIds:     result.Hit,
+		RewindMs:         int32(rewind.Milliseconds()),
+	}}}, "attack")
+	if len(result.Hit) > 0 {
+		r.broadcastDeltaState()
+	}
+	if result.Broken > 0 {
+		r.broadcastTileUpdates()
+	}
+}
+
+// tickHealth applies hazard damage, announces deaths and respawns players
+// whose respawn delay ended, reporting whether any player changed.
+func (r *room) tickHealth(now time.Time) bool {
+	if r.mode == combatRoomMode {
+		r.state.RecordPositions(now) // For lag-compensated attacks
+	}
+	changed := r.state.ApplyHazards(now)
+	for _, d := range r.state.TakeDeaths() {
+		r.announceDeath(d)
+		changed = true
+	}
+	for _, sp := range r.state.RespawnDead(now) {
+		r.broadcastRespawned(sp.PlayerID, sp.X, sp.Y, sp.InvulnerableUntil)
+		changed = true
+	}
+	return changed
+}
+
+// announceDeath tells the room who died and, for kills, awards the killer.
+func (r *room) announceDeath(d game.Death) {
+	text := fmt.Sprintf("%s died.", r.usernameOf(d.PlayerID))
+	if d.KillerID != "" {
+		text = fmt.Sprintf("%s was killed by %s.", r.usernameOf(d.PlayerID), r.usernameOf(d.KillerID))
+		r.state.AwardPoints(d.KillerID, killPoints, game.ScoreKill)
+	}
+	log.Printf("Room %s: %s", r.id, text)
+	r.broadcast(&pb.ServerMessage{Message: &pb.ServerMessage_PlayerDied{PlayerDied: &pb.PlayerDied{
+		PlayerId:        d.PlayerID,
+		KillerPlayerId:  d.KillerID,
+		Cause:           d.Cause,
+		RespawnAtUnixMs: d.RespawnAt.UnixMilli(),
+	}}}, "death")
+	r.broadcast(&pb.ServerMessage{Message: &pb.ServerMessage_ChatMessage{ChatMessage: &pb.ChatMessage{
+		SenderUsername: systemChatSender,
+		MessageText:    text,
+		Timestamp:      time.Now().Unix(),
+	}}}, "death chat")
+}
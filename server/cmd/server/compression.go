@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip" // Registers the gzip compressor
+	"google.golang.org/grpc/stats"
+	"google.golang.org/protobuf/proto"
+)
+
+// compressionPolicy decides which gRPC responses are compressed. Only large
+// ones are worth it: unary responses such as GetFullSnapshot over minBytes,
+// and game streams whose InitialMapData is over minBytes or whose map is
+// streamed in chunks. Small per-tick deltas alone would cost more CPU than
+// they save. Compression is only used when the client lists the compressor
+// in grpc-accept-encoding.
+type compressionPolicy struct {
+	name     string // Registered compressor, such as "gzip"; empty disables compression
+	minBytes int
+}
+
+// newCompressionPolicy checks that the named compressor is registered; "none"
+// or an empty name disables compression. Other compressors, such as zstd,
+// are used by registering them with encoding.RegisterCompressor.
+func newCompressionPolicy(name string, minBytes int) (compressionPolicy, error) {
+	if name == "" || name == "none" {
+		return compressionPolicy{}, nil
+	}
+	if encoding.GetCompressor(name) == nil {
+		return compressionPolicy{}, fmt.Errorf("unknown compressor %q", name)
+	}
+	return compressionPolicy{name: name, minBytes: minBytes}, nil
+}
+
+// accepts reports whether the client of a call takes the compressor.
+func (c compressionPolicy) accepts(ctx context.Context) bool {
+	if c.name == "" {
+		return false
+	}
+	supported, err := grpc.ClientSupportedCompressors(ctx)
+	return err == nil && slices.Contains(supported, c.name)
+}
+
+// compressStream compresses the rest of a game stream when its map is large.
+// It must be called before the first message is sent.
+func (c compressionPolicy) compressStream(ctx context.Context, playerID string, mapSize int, chunked bool) {
+	if (mapSize < c.minBytes && !chunked) || !c.accepts(ctx) {
+		return
+	}
+	if err := grpc.SetSendCompressor(ctx, c.name); err != nil {
+		log.Printf("Compressing the stream of player %s failed: %v", playerID, err)
+	}
+}
+
+// unaryInterceptor compresses large unary responses.
+func (c compressionPolicy) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	if msg, ok := resp.(proto.Message); ok && err == nil && proto.Size(msg) >= c.minBytes && c.accepts(ctx) {
+		grpc.SetSendCompressor(ctx, c.name)
+	}
+	return resp, err
+}
+
+// compressionStats is a gRPC stats handler counting the bytes of messages
+// sent before and after compression.
+type compressionStats struct {
+	metrics *serverMetrics
+}
+
+func (h compressionStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h compressionStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h compressionStats) HandleConn(context.Context, stats.ConnStats) {}
+
+func (h compressionStats) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if out, ok := s.(*stats.OutPayload); ok {
+		h.metrics.payloadBytes.Add(int64(out.Length))
+		h.metrics.compressedBytes.Add(int64(out.CompressedLength))
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"simple-grpc-game/server/internal/game"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Limits of the tick interval SetConfig accepts; the governor may still slow
+// ticks down from it under load.
+const (
+	minTickInterval = 20 * time.Millisecond
+	maxTickInterval = 1 * time.Second
+)
+
+// configSetting is a key SetConfig accepts: how to show its value and how to
+// change the tuning for a new one. Settings with no tune change the tick
+// interval instead.
+type configSetting struct {
+	show func(s *gameServer, t game.Tuning) string
+	tune func(t *game.Tuning, v float64)
+}
+
+func milliseconds(d time.Duration) string {
+	return strconv.FormatInt(d.Milliseconds(), 10)
+}
+
+func pixels(f float32) string {
+	return strconv.FormatFloat(float64(f), 'g', -1, 32)
+}
+
+var configSettings = map[string]configSetting{
+	"tick_interval_ms": {
+		show: func(s *gameServer, _ game.Tuning) string { return milliseconds(s.governor.baseInterval()) },
+	},
+	"move_speed": {
+		show: func(_ *gameServer, t game.Tuning) string { return pixels(t.MoveSpeed) },
+		tune: func(t *game.Tuning, v float64) { t.MoveSpeed = float32(v) },
+	},
+	"movement_timeout_ms": {
+		show: func(_ *gameServer, t game.Tuning) string { return milliseconds(t.MovementTimeout) },
+		tune: func(t *game.Tuning, v float64) { t.MovementTimeout = time.Duration(v * float64(time.Millisecond)) },
+	},
+	"hitbox_width": {
+		show: func(_ *gameServer, t game.Tuning) string { return pixels(2 * t.HalfWidth) },
+		tune: func(t *game.Tuning, v float64) { t.HalfWidth = float32(v) / 2 },
+	},
+	"hitbox_height": {
+		show: func(_ *gameServer, t game.Tuning) string { return pixels(2 * t.HalfHeight) },
+		tune: func(t *game.Tuning, v float64) { t.HalfHeight = float32(v) / 2 },
+	},
+}
+
+// currentTuning returns the tuning every room uses.
+func (m *roomManager) currentTuning() game.Tuning {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tuning
+}
+
+// setTuning applies new gameplay constants to every room, now and as rooms
+// open, broadcasting the players a larger hitbox moved; their IDs are
+// returned.
+func (m *roomManager) setTuning(t game.Tuning) ([]string, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.tuning = t
+	m.mu.Unlock()
+	var relocated []string
+	for _, r := range m.all() {
+		moved, err := r.state.SetTuning(t)
+		if err != nil {
+			return relocated, err
+		}
+		if len(moved) > 0 {
+			r.broadcastDeltaState()
+			relocated = append(relocated, moved...)
+		}
+	}
+	return relocated, nil
+}
+
+// configValues returns every setting as SetConfig shows it.
+func (s *gameServer) configValues() map[string]string {
+	t := s.rooms.currentTuning()
+	values := make(map[string]string, len(configSettings))
+	for key, setting := range configSettings {
+		values[key] = setting.show(s, t)
+	}
+	return values
+}
+
+// SetConfig changes a gameplay setting of every room while the game runs, so
+// balancing needs no rebuild. Changes last until the server restarts.
+func (a *adminServer) SetConfig(ctx context.Context, req *pb.SetConfigRequest) (*pb.SetConfigResponse, error) {
+	if err := a.authorize(ctx, scopeAdmin); err != nil {
+		return nil, err
+	}
+	resp := &pb.SetConfigResponse{}
+	if key := req.GetKey(); key != "" {
+		setting, ok := configSettings[key]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown setting %q", key)
+		}
+		v, err := strconv.ParseFloat(req.GetValue(), 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, status.Errorf(codes.InvalidArgument, "%s must be a number, not %q", key, req.GetValue())
+		}
+		if setting.tune == nil {
+			err = a.game.setTickInterval(v)
+		} else {
+			t := a.game.rooms.currentTuning()
+			setting.tune(&t, v)
+			resp.RelocatedPlayerIds, err = a.game.rooms.setTuning(t)
+		}
+		if err != nil {
+			return nil, status.Errorf(gameErrorCode(err), "set %s: %v", key, err)
+		}
+		log.Printf("Admin set %s to %s.", key, req.GetValue())
+	}
+	resp.Values = a.game.configValues()
+	return resp, nil
+}
+
+// errInvalidTickInterval is SetConfig's error for a tick interval out of
+// bounds.
+var errInvalidTickInterval = fmt.Errorf("%w: tick interval must be %v to %v", game.ErrInvalidTuning, minTickInterval, maxTickInterval)
+
+// setTickInterval changes the interval of ticks at full speed, in
+// milliseconds; the tick loop switches to it after its next tick.
+func (s *gameServer) setTickInterval(ms float64) error {
+	d := time.Duration(ms * float64(time.Millisecond))
+	if d < minTickInterval || d > maxTickInterval {
+		return errInvalidTickInterval
+	}
+	s.governor.setBase(d)
+	return nil
+}
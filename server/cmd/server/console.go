@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/status"
+)
+
+const consoleHelp = `Commands:
+  list                      Rooms and their players
+  kick <player_id> [reason] Disconnect a player
+  tp <player_id> <x> <y>    Move a player to a point of their room
+  say <text>                Announce to every player
+  reloadmap                 Reload every room's map from disk
+  help                      This list`
+
+// runConsole reads operator commands from in, one per line, and writes the
+// replies to out until in ends. Commands go through the admin RPCs, with the
+// console trusted as if it held the admin token.
+func (s *gameServer) runConsole(in io.Reader, out io.Writer) {
+	admin := &adminServer{game: s, console: true}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		reply, err := admin.runCommand(line)
+		if err != nil {
+			fmt.Fprintf(out, "error: %s\n", status.Convert(err).Message())
+			continue
+		}
+		fmt.Fprintln(out, reply)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Console input failed: %v", err)
+	}
+}
+
+// runCommand runs one console command line, returning the reply.
+func (a *adminServer) runCommand(line string) (string, error) {
+	ctx := context.Background()
+	name, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+	args := strings.Fields(rest)
+	switch strings.ToLower(name) {
+	case "list":
+		return a.consoleList(), nil
+	case "kick":
+		if len(args) == 0 {
+			return "", fmt.Errorf("usage: kick <player_id> [reason]")
+		}
+		reason := strings.TrimSpace(strings.TrimPrefix(rest, args[0]))
+		resp, err := a.KickPlayer(ctx, &pb.KickPlayerRequest{PlayerId: args[0], Reason: reason})
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Kicked %s ('%s') from room %s.", args[0], resp.GetUsername(), resp.GetRoomId()), nil
+	case "tp":
+		if len(args) != 3 {
+			return "", fmt.Errorf("usage: tp <player_id> <x> <y>")
+		}
+		x, errX := strconv.ParseFloat(args[1], 32)
+		y, errY := strconv.ParseFloat(args[2], 32)
+		if errX != nil || errY != nil {
+			return "", fmt.Errorf("x and y must be numbers")
+		}
+		resp, err := a.TeleportPlayer(ctx, &pb.TeleportPlayerRequest{PlayerId: args[0], X: float32(x), Y: float32(y)})
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Teleported %s in room %s to (%.1f, %.1f).", args[0], resp.GetRoomId(), x, y), nil
+	case "say":
+		resp, err := a.Announce(ctx, &pb.AnnounceRequest{Text: rest})
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Announced to %d player(s) in %d room(s).", resp.GetPlayers(), resp.GetRooms()), nil
+	case "reloadmap":
+		if err := a.game.rooms.reloadMaps(a.game.governor.interval()); err != nil {
+			return "", fmt.Errorf("map reload finished with errors: %v", err)
+		}
+		return "Maps reloaded.", nil
+	case "help", "?":
+		return consoleHelp, nil
+	}
+	return "", fmt.Errorf("unknown command %q; try help", name)
+}
+
+// consoleList describes every room and the players in it.
+func (a *adminServer) consoleList() string {
+	var b strings.Builder
+	for _, rm := range a.game.rooms.all() {
+		players := rm.state.GetAllPlayers()
+		fmt.Fprintf(&b, "%s (%s, map %s): %d player(s)", rm.id, rm.name, rm.mapName, len(players))
+		if rm.paused() {
+			b.WriteString(", paused")
+		}
+		b.WriteByte('\n')
+		for _, p := range players {
+			kind := ""
+			if rm.isBot(p.GetId()) {
+				kind = " [bot]"
+			}
+			fmt.Fprintf(&b, "  %s '%s' at (%.1f, %.1f)%s\n", p.GetId(), p.GetUsername(), p.GetXPos(), p.GetYPos(), kind)
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
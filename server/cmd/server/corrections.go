@@ -0,0 +1,27 @@
+package main
+
+import (
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// correct sends a PositionCorrection to a player whose numbered input the
+// server refused or played out differently than they predicted, with the
+// player as the server has them; nil looks them up. Inputs numbered 0 come
+// from clients that do not predict and get no correction.
+func (r *room) correct(playerID string, seq uint32, player *pb.Player) {
+	if seq == 0 {
+		return
+	}
+	if player == nil {
+		var ok bool
+		if player, ok = r.state.GetPlayer(playerID); !ok {
+			return
+		}
+	}
+	r.broadcastTo(&pb.ServerMessage{Message: &pb.ServerMessage_PositionCorrection{PositionCorrection: &pb.PositionCorrection{
+		PlayerId:         playerID,
+		XPos:             player.GetXPos(),
+		YPos:             player.GetYPos(),
+		LastProcessedSeq: seq,
+	}}}, "position correction", func(id string) bool { return id == playerID })
+}
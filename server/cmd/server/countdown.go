@@ -0,0 +1,117 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"simple-grpc-game/server/internal/game"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+const (
+	countdownLead = 3 * time.Second  // Warning clients get before a synchronized start
+	matchJoinWait = 20 * time.Second // A match starts with whoever has joined by then
+)
+
+// startGate holds a room's players in place until a start tick announced in
+// advance, so everyone begins on the same tick however late their copy of
+// the announcement arrives. Rooms whose gate is not enabled never hold input.
+type startGate struct {
+	mu        sync.Mutex
+	enabled   bool
+	scheduled bool
+	startTick uint64
+	startAt   time.Time // Estimated from the tick interval when scheduled
+	reason    string
+	started   bool // The start tick has been reached and reported
+}
+
+// holding reports whether the room is still waiting for its start tick.
+func (r *room) holding() bool {
+	g := &r.start
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.enabled && (!g.scheduled || r.ticks.Load() < g.startTick)
+}
+
+// scheduleStart announces a start countdownLead from now, rounded up to a
+// whole tick at the current interval. It does nothing if a start is already
+// scheduled.
+func (r *room) scheduleStart(reason string, interval time.Duration) {
+	g := &r.start
+	g.mu.Lock()
+	if !g.enabled || g.scheduled {
+		g.mu.Unlock()
+		return
+	}
+	ticks := uint64((countdownLead + interval - 1) / interval)
+	g.scheduled = true
+	now := r.ticks.Load()
+	g.startTick = now + ticks
+	g.startAt = time.Now().Add(time.Duration(ticks) * interval)
+	g.reason = reason
+	msg := g.messageLocked(now)
+	g.mu.Unlock()
+
+	log.Printf("Room %s: %s starts at tick %d (in %d ticks).", r.id, reason, now+ticks, ticks)
+	r.broadcast(msg, "countdown")
+}
+
+// reachedStart reports, once, that the room's scheduled start tick has
+// arrived.
+func (r *room) reachedStart() bool {
+	g := &r.start
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.scheduled || g.started || r.ticks.Load() < g.startTick {
+		return false
+	}
+	g.started = true
+	return true
+}
+
+// hasStarted reports whether the room's start tick has been reached.
+func (g *startGate) hasStarted() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.started
+}
+
+// countdownMessage returns the pending countdown for a player joining before
+// the start, if there is one.
+func (r *room) countdownMessage() (*pb.ServerMessage, bool) {
+	g := &r.start
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.scheduled || r.ticks.Load() >= g.startTick {
+		return nil, false
+	}
+	return g.messageLocked(r.ticks.Load()), true
+}
+
+// messageLocked builds the Countdown message. Must be called with g.mu held.
+func (g *startGate) messageLocked(tick uint64) *pb.ServerMessage {
+	return &pb.ServerMessage{Message: &pb.ServerMessage_Countdown{Countdown: &pb.Countdown{
+		StartTick:     g.startTick,
+		CurrentTick:   tick,
+		StartServerMs: g.startAt.UnixMilli(),
+		Reason:        g.reason,
+	}}}
+}
+
+// tickMatchStart schedules a match room's start once every matched player
+// has joined, or after matchJoinWait with whoever made it.
+func (r *room) tickMatchStart(interval time.Duration) {
+	if r.mode != matchRoomMode {
+		return
+	}
+	if r.reachedStart() {
+		r.emitEvent(game.EventMatchStarted, "", map[string]any{"map": r.mapName, "players": r.state.PlayerCount()})
+	}
+	players := r.state.PlayerCount()
+	if players >= r.maxPlayers || (players > 0 && time.Since(r.createdAt) > matchJoinWait) {
+		r.scheduleStart("match", interval)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"slices"
+
+	"simple-grpc-game/server/internal/game"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// emote handles a player's EmoteRequest, telling the players near them so
+// their clients can show it; the animation state follows in a delta.
+func (r *room) emote(sess *playerSession, kind pb.EmoteKind) {
+	until, nearby, err := r.state.Emote(sess.playerID, kind)
+	if err != nil {
+		if errors.Is(err, game.ErrUnknownEmote) {
+			log.Printf("Player %s ('%s') sent unknown emote %v.", sess.playerID, sess.username, kind)
+		}
+		return // Dead or on cooldown; clients may send emotes faster than allowed
+	}
+	r.broadcastTo(&pb.ServerMessage{Message: &pb.ServerMessage_EmoteEvent{EmoteEvent: &pb.EmoteEvent{
+		PlayerId:    sess.playerID,
+		Kind:        kind,
+		UntilUnixMs: until.UnixMilli(),
+	}}}, "emote", func(id string) bool {
+		_, found := slices.BinarySearch(nearby, id)
+		return found
+	})
+	r.broadcastDeltaState()
+}
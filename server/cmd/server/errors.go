@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"simple-grpc-game/server/internal/game"
+
+	"google.golang.org/grpc/codes"
+)
+
+// gameErrorCode maps an error from the game package to a gRPC status code.
+func gameErrorCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, game.ErrPlayerNotFound):
+		return codes.NotFound
+	case errors.Is(err, game.ErrOutOfBounds),
+		errors.Is(err, game.ErrInvalidTile),
+		errors.Is(err, game.ErrUnknownEmote),
+		errors.Is(err, game.ErrInvalidSkin),
+		errors.Is(err, game.ErrInvalidTuning):
+		return codes.InvalidArgument
+	case errors.Is(err, game.ErrRespawnCooldown),
+		errors.Is(err, game.ErrAttackCooldown),
+		errors.Is(err, game.ErrEmoteCooldown):
+		return codes.ResourceExhausted
+	case errors.Is(err, game.ErrMapInvalid),
+		errors.Is(err, game.ErrBlockedByWall),
+		errors.Is(err, game.ErrBlockedByPlayer),
+		errors.Is(err, game.ErrNothingToInteract),
+		errors.Is(err, game.ErrPlayerDead),
+		errors.Is(err, game.ErrPositionBlocked):
+		return codes.FailedPrecondition
+	default:
+		return codes.Internal
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"simple-grpc-game/server/internal/game"
+)
+
+const eventLogBuffer = 4096 // Events queued for the writer before new ones are dropped
+
+// eventLog is a game.EventSink that appends events as JSON lines. Events are
+// written by a background goroutine so emitting never holds up a tick; while
+// the writer is behind, new events are dropped and counted.
+type eventLog struct {
+	events  chan game.Event
+	out     io.Writer
+	dropped atomic.Int64
+}
+
+// openEventLog creates the sink named by -event-log: "stdout" or a file path,
+// optionally prefixed with "file:". Other sinks, such as Kafka, plug in by
+// implementing game.EventSink; an empty target disables the event log.
+func openEventLog(target string) (*eventLog, error) {
+	var out io.Writer
+	switch {
+	case target == "":
+		return nil, nil
+	case target == "stdout":
+		out = os.Stdout
+	case strings.Contains(target, "://"):
+		return nil, fmt.Errorf("event sink %q is not built in; use stdout or a file", target)
+	default:
+		path := strings.TrimPrefix(target, "file:")
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open event log: %w", err)
+		}
+		out = f
+	}
+	l := &eventLog{events: make(chan game.Event, eventLogBuffer), out: out}
+	go l.run()
+	return l, nil
+}
+
+// Emit queues an event without blocking.
+func (l *eventLog) Emit(e game.Event) {
+	select {
+	case l.events <- e:
+	default:
+		if l.dropped.Add(1)%1000 == 1 {
+			log.Printf("Warning: Event log is behind; %d events dropped so far", l.dropped.Load())
+		}
+	}
+}
+
+func (l *eventLog) run() {
+	enc := json.NewEncoder(l.out)
+	for e := range l.events {
+		if err := enc.Encode(e); err != nil {
+			log.Printf("Warning: Could not write event log: %v", err)
+		}
+	}
+}
+
+// teeEvents sends every event to each of its sinks.
+type teeEvents []game.EventSink
+
+func (t teeEvents) Emit(e game.Event) {
+	for _, sink := range t {
+		sink.Emit(e)
+	}
+}
+
+// roomEvents tags a room's events with its ID.
+type roomEvents struct {
+	roomID string
+	sink   game.EventSink
+}
+
+func (re roomEvents) Emit(e game.Event) {
+	e.Room = re.roomID
+	re.sink.Emit(e)
+}
+
+// emitEvent logs an event the server rather than the State observed.
+func (r *room) emitEvent(eventType, playerID string, fields map[string]any) {
+	if r.events == nil {
+		return
+	}
+	r.events.Emit(game.Event{Time: time.Now(), Type: eventType, PlayerID: playerID, Fields: fields})
+}
+
+// logEvents sends the events of every room, current and future, to sink.
+func (m *roomManager) logEvents(sink game.EventSink) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = sink
+	for _, r := range m.rooms {
+		r.logEventsTo(sink)
+	}
+}
+
+// logEventsTo connects a room to the event log before players can reach it.
+func (r *room) logEventsTo(sink game.EventSink) {
+	r.events = roomEvents{roomID: r.id, sink: sink}
+	r.state.SetEventSink(r.events)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const faultQueueSize = 4096 // Delayed messages held per stream before sends fail
+
+var errFaultDisconnect = status.Error(codes.Unavailable, "connection lost (injected fault)")
+
+// faultConfig is network trouble simulated on server streams, for testing
+// how clients cope with lag and loss. Messages are delayed in order, as on a
+// slow TCP connection; drops skip messages outright, which a real gRPC
+// stream never does, to exercise recovery such as desync detection.
+type faultConfig struct {
+	delay      time.Duration // Added to every message sent
+	jitter     time.Duration // Up to this much more, at random
+	drop       float64       // Chance of dropping each message after the first
+	disconnect float64       // Chance, at each message sent, of ending the stream as unavailable
+	metadata   bool          // Let clients set their own faults with fault-* metadata
+}
+
+func (f faultConfig) active() bool {
+	return f.delay > 0 || f.jitter > 0 || f.drop > 0 || f.disconnect > 0
+}
+
+// forStream applies a stream's fault-delay, fault-jitter, fault-drop and
+// fault-disconnect metadata, when clients may set them.
+func (f faultConfig) forStream(ctx context.Context) (faultConfig, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !f.metadata || !ok {
+		return f, nil
+	}
+	var err error
+	for key, dur := range map[string]*time.Duration{"fault-delay": &f.delay, "fault-jitter": &f.jitter} {
+		if v := md.Get(key); len(v) > 0 {
+			if *dur, err = time.ParseDuration(v[0]); err != nil || *dur < 0 {
+				return f, fmt.Errorf("%s must be a duration such as 150ms", key)
+			}
+		}
+	}
+	for key, chance := range map[string]*float64{"fault-drop": &f.drop, "fault-disconnect": &f.disconnect} {
+		if v := md.Get(key); len(v) > 0 {
+			if *chance, err = strconv.ParseFloat(v[0], 64); err != nil || *chance < 0 || *chance > 1 {
+				return f, fmt.Errorf("%s must be a chance from 0 to 1", key)
+			}
+		}
+	}
+	return f, nil
+}
+
+// streamInterceptor injects the configured faults into server streams.
+func (f faultConfig) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	cfg, err := f.forStream(ss.Context())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !cfg.active() {
+		return handler(srv, ss)
+	}
+	fs := &faultyStream{
+		ServerStream: ss,
+		cfg:          cfg,
+		rng:          rand.New(rand.NewSource(time.Now().UnixNano())),
+		queue:        make(chan delayedMessage, faultQueueSize),
+		done:         make(chan struct{}),
+		broken:       make(chan struct{}),
+	}
+	if cfg.delay > 0 || cfg.jitter > 0 {
+		go fs.deliver()
+	}
+	defer close(fs.done)
+	return handler(srv, fs)
+}
+
+// faultyStream is a server stream with injected faults.
+type faultyStream struct {
+	grpc.ServerStream
+	cfg   faultConfig
+	queue chan delayedMessage
+	done  chan struct{} // Closed when the handler returns
+
+	mu        sync.Mutex
+	rng       *rand.Rand
+	sent      int
+	lastDue   time.Time
+	sendErr   error // First failure of a delayed send
+	broken    chan struct{}
+	breakOnce sync.Once
+}
+
+type delayedMessage struct {
+	msg any
+	due time.Time
+}
+
+func (fs *faultyStream) SendMsg(m any) error {
+	select {
+	case <-fs.broken:
+		return errFaultDisconnect
+	default:
+	}
+	fs.mu.Lock()
+	first := fs.sent == 0
+	fs.sent++
+	if !first && fs.rng.Float64() < fs.cfg.disconnect {
+		fs.mu.Unlock()
+		fs.breakOnce.Do(func() { close(fs.broken) })
+		return errFaultDisconnect
+	}
+	if !first && fs.rng.Float64() < fs.cfg.drop {
+		fs.mu.Unlock()
+		return nil
+	}
+	if fs.cfg.delay == 0 && fs.cfg.jitter == 0 {
+		fs.mu.Unlock()
+		return fs.ServerStream.SendMsg(m)
+	}
+	if fs.sendErr != nil {
+		defer fs.mu.Unlock()
+		return fs.sendErr
+	}
+	due := time.Now().Add(fs.cfg.delay)
+	if fs.cfg.jitter > 0 {
+		due = due.Add(time.Duration(fs.rng.Int63n(int64(fs.cfg.jitter))))
+	}
+	due = maxTime(due, fs.lastDue) // Keep the stream's order
+	fs.lastDue = due
+	fs.mu.Unlock()
+	switch pm := m.(type) { // Senders may reuse the message once SendMsg returns
+	case proto.Message:
+		m = proto.Clone(pm)
+	case *preparedMessage:
+		m = &preparedMessage{data: pm.data} // The codec only needs the bytes
+	}
+	select {
+	case fs.queue <- delayedMessage{msg: m, due: due}:
+		return nil
+	default:
+		return status.Error(codes.ResourceExhausted, "too many messages delayed by fault injection")
+	}
+}
+
+// deliver sends delayed messages when they are due.
+func (fs *faultyStream) deliver() {
+	for {
+		select {
+		case <-fs.done:
+			return
+		case d := <-fs.queue:
+			time.Sleep(time.Until(d.due))
+			if err := fs.ServerStream.SendMsg(d.msg); err != nil {
+				fs.mu.Lock()
+				fs.sendErr = err
+				fs.mu.Unlock()
+				return
+			}
+		}
+	}
+}
+
+// RecvMsg returns errFaultDisconnect once the stream is broken, so the
+// handler ends the stream as if the connection dropped.
+func (fs *faultyStream) RecvMsg(m any) error {
+	if fs.cfg.disconnect == 0 {
+		return fs.ServerStream.RecvMsg(m)
+	}
+	received := make(chan error, 1)
+	go func() { received <- fs.ServerStream.RecvMsg(m) }()
+	select {
+	case err := <-received:
+		return err
+	case <-fs.broken:
+		return errFaultDisconnect
+	}
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"simple-grpc-game/server/internal/game"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// fixtureTime is the fixed clock of fixtures with timestamps, so exports
+// from the same map are byte-for-byte identical.
+const fixtureTime = 1700000000
+
+// protocolFixture is one golden message in an export.
+type protocolFixture struct {
+	Name        string `json:"name"`
+	Message     string `json:"message"` // Full protobuf message name
+	Description string `json:"description"`
+	File        string `json:"file"`   // Binary encoding, exactly as the server sends it
+	JSON        string `json:"json"`   // The same message as protojson, for reading and diffing
+	SHA256      string `json:"sha256"` // Of File
+}
+
+// fixtureManifest is the manifest.json of an export.
+type fixtureManifest struct {
+	Descriptors string            `json:"descriptors"` // FileDescriptorSet of game.proto
+	Map         string            `json:"map"`
+	Fixtures    []protocolFixture `json:"fixtures"`
+}
+
+// exportFixtures writes the protocol's descriptors and golden messages built
+// by a scripted room on mapPath to dir, for other client implementations to
+// regression-test their parsers against. Player IDs and clocks are fixed, so
+// a re-export only changes when the protocol or the server's encoding does.
+func exportFixtures(dir, mapPath string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	manifest := fixtureManifest{Descriptors: "game.protoset", Map: filepath.Base(mapPath)}
+	descriptors, err := proto.MarshalOptions{Deterministic: true}.Marshal(fileDescriptorSet(pb.File_game_proto))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, manifest.Descriptors), descriptors, 0o644); err != nil {
+		return err
+	}
+
+	rm, err := newRoom(defaultRoomID, "Lobby", mapNameFromPath(mapPath), mapPath, &serverMetrics{})
+	if err != nil {
+		return err
+	}
+	add := func(name, description string, msg proto.Message) error {
+		f, err := writeFixture(dir, name, description, msg)
+		if err == nil {
+			manifest.Fixtures = append(manifest.Fixtures, f)
+		}
+		return err
+	}
+	steps := []func() error{
+		func() error {
+			msg, err := rm.initialMapMessage("player_a", tickRate, false)
+			if err != nil {
+				return err
+			}
+			return add("initial_map_data", "Map sent on joining, with tiles, layers and tile definitions", msg)
+		},
+		func() error {
+			msg, err := rm.initialMapMessage("player_a", tickRate, true)
+			if err != nil {
+				return err
+			}
+			return add("initial_map_data_chunked", "Map header of a client that supports map chunks", msg)
+		},
+		func() error {
+			rm.state.AddPlayer("player_a", "alice")
+			rm.state.AddPlayer("player_b", "bob")
+			delta, _ := rm.state.GenerateDeltaUpdate()
+			return add("delta_players_joined", "Delta adding two players", deltaMessage(delta))
+		},
+		func() error {
+			if _, err := rm.state.ApplyInput("player_a", pb.PlayerInput_RIGHT); err != nil {
+				return err
+			}
+			delta, _ := rm.state.GenerateDeltaUpdate()
+			return add("delta_player_moved", "Delta after one step to the right", deltaMessage(delta))
+		},
+		func() error {
+			if _, err := rm.state.ApplyInput("player_a", pb.PlayerInput_DOWN); err != nil {
+				return err
+			}
+			full, partial, _ := rm.state.GeneratePartialDeltaUpdate()
+			if err := add("delta_player_moved_full", "Delta after a step down, for clients without partial players", deltaMessage(full)); err != nil {
+				return err
+			}
+			return add("delta_player_moved_partial", "The same delta with only the changed fields", deltaMessage(partial))
+		},
+		func() error {
+			players, count, tiles := rm.state.Checksum()
+			return add("state_checksum", "Checksum of the state after the deltas above", &pb.ServerMessage{Message: &pb.ServerMessage_StateChecksum{
+				StateChecksum: &pb.StateChecksum{Tick: checksumEveryTicks, PlayersChecksum: players, PlayerCount: int32(count), TilesChecksum: tiles},
+			}})
+		},
+		func() error {
+			if err := setFixtureTile(rm.state); err != nil {
+				return err
+			}
+			return add("map_tile_update", "A tile changed while playing", &pb.ServerMessage{Message: &pb.ServerMessage_MapTileUpdate{
+				MapTileUpdate: &pb.MapTileUpdate{Tiles: rm.state.TakeTileUpdates()},
+			}})
+		},
+		func() error {
+			rm.state.AwardPoints("player_b", 3, game.ScoreTag)
+			return add("scoreboard", "Scores after bob scored a tag", &pb.ServerMessage{Message: &pb.ServerMessage_Scoreboard{
+				Scoreboard: rm.state.Scoreboard(),
+			}})
+		},
+		func() error {
+			rm.state.RemovePlayer("player_b")
+			delta, _ := rm.state.GenerateDeltaUpdate()
+			return add("delta_player_left", "Delta removing a player", deltaMessage(delta))
+		},
+		func() error {
+			return add("full_snapshot", "GetFullSnapshot response", rm.snapshot(tickRate))
+		},
+		func() error {
+			return add("chat_message", "Room chat", &pb.ServerMessage{Message: &pb.ServerMessage_ChatMessage{ChatMessage: &pb.ChatMessage{
+				SenderUsername: "alice", MessageText: "hello", Timestamp: fixtureTime, PlayerId: "player_a",
+			}}})
+		},
+		func() error {
+			return add("tick_rate", "Tick interval change", tickRateMessage(tickRate))
+		},
+		func() error {
+			rm.start.mu.Lock()
+			rm.start.startTick, rm.start.startAt, rm.start.reason = 30, time.Unix(fixtureTime, 0).Add(countdownLead), "Match"
+			msg := rm.start.messageLocked(0)
+			rm.start.mu.Unlock()
+			return add("countdown", "Synchronized match start", msg)
+		},
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "manifest.json"), append(data, '\n'), 0o644)
+}
+
+func deltaMessage(delta *pb.DeltaUpdate) *pb.ServerMessage {
+	return &pb.ServerMessage{Message: &pb.ServerMessage_DeltaUpdate{DeltaUpdate: delta}}
+}
+
+// setFixtureTile turns the first empty tile well clear of every player into mud.
+func setFixtureTile(state *game.State) error {
+	players, tiles, tileSize := state.Snapshot()
+	clear := func(x, y int) bool {
+		cx, cy := float32(x*tileSize+tileSize/2), float32(y*tileSize+tileSize/2)
+		for _, p := range players {
+			if math.Abs(float64(p.XPos-cx)) < float64(2*tileSize) && math.Abs(float64(p.YPos-cy)) < float64(2*tileSize) {
+				return false
+			}
+		}
+		return true
+	}
+	for y, row := range tiles {
+		for x, t := range row {
+			if t == game.TileTypeEmpty && clear(x, y) {
+				_, err := state.SetTile(x, y, game.TileTypeMud)
+				return err
+			}
+		}
+	}
+	return fmt.Errorf("map has no empty tile clear of players")
+}
+
+// writeFixture writes one fixture's binary and JSON files.
+func writeFixture(dir, name, description string, msg proto.Message) (protocolFixture, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return protocolFixture{}, err
+	}
+	// protojson varies its whitespace between builds, so it is re-indented
+	// for exports that diff cleanly.
+	compact, err := protojson.Marshal(msg)
+	if err != nil {
+		return protocolFixture{}, err
+	}
+	var text bytes.Buffer
+	if err := json.Indent(&text, compact, "", "  "); err != nil {
+		return protocolFixture{}, err
+	}
+	sum := sha256.Sum256(data)
+	f := protocolFixture{
+		Name:        name,
+		Message:     string(msg.ProtoReflect().Descriptor().FullName()),
+		Description: description,
+		File:        name + ".binpb",
+		JSON:        name + ".json",
+		SHA256:      hex.EncodeToString(sum[:]),
+	}
+	if err := os.WriteFile(filepath.Join(dir, f.File), data, 0o644); err != nil {
+		return protocolFixture{}, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, f.JSON), append(text.Bytes(), '\n'), 0o644); err != nil {
+		return protocolFixture{}, err
+	}
+	log.Printf("Fixture %s: %s, %d bytes.", name, f.Message, len(data))
+	return f, nil
+}
+
+// fileDescriptorSet returns a file with everything it imports, dependencies first.
+func fileDescriptorSet(file protoreflect.FileDescriptor) *descriptorpb.FileDescriptorSet {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	var visit func(f protoreflect.FileDescriptor)
+	visit = func(f protoreflect.FileDescriptor) {
+		if seen[f.Path()] {
+			return
+		}
+		seen[f.Path()] = true
+		imports := f.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			visit(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(f))
+	}
+	visit(file)
+	return set
+}
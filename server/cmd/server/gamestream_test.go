@@ -0,0 +1,48 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	pb "simple-grpc-game/gen/go/game"
+	"simple-grpc-game/server/internal/harness"
+)
+
+// testMap returns the path of a walled 8x8 map with one spawn point, the one
+// the game package's tests use.
+func testMap(t *testing.T) string {
+	t.Helper()
+	return filepath.Join("..", "..", "internal", "game", "testdata", "arena.json")
+}
+
+func TestGameStreamBroadcastsMoves(t *testing.T) {
+	ts := startTestServer(t, serverConfig{mapPaths: []string{testMap(t)}})
+	alice := ts.Join(t, &pb.ClientHello{DesiredUsername: "alice"})
+	bob := ts.Join(t, &pb.ClientHello{DesiredUsername: "bob"})
+	start := bob.Expect(t, harness.HasPlayer("alice")).GetDeltaUpdate()
+	var startX float32
+	for _, p := range start.GetUpdatedPlayers() {
+		if p.GetId() == alice.ID {
+			startX = p.GetXPos()
+		}
+	}
+
+	alice.Move(t, pb.PlayerInput_RIGHT)
+	bob.ExpectSequence(t,
+		harness.IsDelta(),
+		harness.PlayerWhere("alice moving right", func(p *pb.Player) bool {
+			return p.GetId() == alice.ID && p.GetXPos() > startX
+		}))
+}
+
+func TestGameStreamChatAndLeave(t *testing.T) {
+	ts := startTestServer(t, serverConfig{mapPaths: []string{testMap(t)}})
+	alice := ts.Join(t, &pb.ClientHello{DesiredUsername: "alice"})
+	bob := ts.Join(t, &pb.ClientHello{DesiredUsername: "bob"})
+
+	bob.Chat(t, "hello")
+	alice.Expect(t, harness.IsChat("hello"))
+
+	bob.Leave()
+	alice.Expect(t, harness.RemovesPlayer(bob.ID))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+const (
+	globalChatInterval = 3 * time.Second // One global message regained per interval
+	globalChatBurst    = 2
+)
+
+// globalChannel relays chat and presence to every opted-in player across all
+// rooms on this instance, and on other servers of the cluster if there is one.
+// Global chat is rate limited separately from room chat.
+type globalChannel struct {
+	rooms   *roomManager
+	limiter *rateLimiter
+	optOut  sync.Map // playerID -> struct{} for players who left the channel
+	history *chatHistory
+	cluster *cluster // Set before serving when the channel is shared; nil otherwise
+}
+
+// newGlobalChannel creates the channel, persisting its chat history at
+// historyPath if set.
+func newGlobalChannel(rooms *roomManager, historyPath string) *globalChannel {
+	return &globalChannel{
+		rooms:   rooms,
+		limiter: newRateLimiter(globalChatInterval, globalChatBurst),
+		history: newChatHistory(pb.ChatChannel_CHAT_CHANNEL_GLOBAL, historyPath),
+	}
+}
+
+// subscribed reports whether the player receives global messages.
+func (g *globalChannel) subscribed(playerID string) bool {
+	_, out := g.optOut.Load(playerID)
+	return !out
+}
+
+func (g *globalChannel) setOptOut(playerID string, optOut bool) {
+	if optOut {
+		g.optOut.Store(playerID, struct{}{})
+	} else {
+		g.optOut.Delete(playerID)
+	}
+	log.Printf("Player %s global channel opt-out: %v", playerID, optOut)
+}
+
+// forget clears per-player channel state when a player disconnects.
+func (g *globalChannel) forget(playerID string) {
+	g.optOut.Delete(playerID)
+	g.limiter.forget(playerID)
+}
+
+func (g *globalChannel) publish(msg *pb.ServerMessage, what string) {
+	for _, r := range g.rooms.all() {
+		r.broadcastTo(msg, what, g.subscribed)
+	}
+}
+
+// sendChat relays a chat message to all subscribers. It returns false if the
+// sender is opted out or over the global rate limit.
+func (g *globalChannel) sendChat(playerID, username, roomID, text string) bool {
+	if !g.subscribed(playerID) || !g.limiter.allow(playerID) {
+		return false
+	}
+	g.post(playerID, username, roomID, text)
+	return true
+}
+
+// post relays a global chat message without any checks; playerID and roomID
+// are empty for messages from outside the game.
+func (g *globalChannel) post(playerID, username, roomID, text string) {
+	chat := &pb.ChatMessage{
+		SenderUsername: username,
+		MessageText:    text,
+		Timestamp:      time.Now().Unix(),
+		PlayerId:       playerID,
+		Channel:        pb.ChatChannel_CHAT_CHANNEL_GLOBAL,
+		RoomId:         roomID,
+	}
+	if g.cluster != nil {
+		g.cluster.publishGlobal(&pb.ClusterGlobal{Message: &pb.ClusterGlobal_ChatMessage{ChatMessage: chat}})
+	}
+	g.deliverChat(chat)
+}
+
+func (g *globalChannel) deliverChat(chat *pb.ChatMessage) {
+	g.history.add(chat)
+	g.rooms.chatFeed.publish(chat)
+	g.publish(&pb.ServerMessage{Message: &pb.ServerMessage_ChatMessage{ChatMessage: chat}}, "global chat")
+}
+
+// announcePresence tells subscribers that a player came online or went offline.
+func (g *globalChannel) announcePresence(playerID, username, roomID string, online bool) {
+	presence := &pb.PresenceUpdate{
+		PlayerId: playerID,
+		Username: username,
+		RoomId:   roomID,
+		Online:   online,
+	}
+	if g.cluster != nil {
+		g.cluster.publishGlobal(&pb.ClusterGlobal{Message: &pb.ClusterGlobal_PresenceUpdate{PresenceUpdate: presence}})
+	}
+	g.publish(&pb.ServerMessage{Message: &pb.ServerMessage_PresenceUpdate{PresenceUpdate: presence}}, "presence")
+}
+
+// receive delivers another server's global chat message or presence update,
+// with its player ID namespaced like the server's remote players.
+func (g *globalChannel) receive(msg *pb.ClusterGlobal) {
+	switch m := msg.Message.(type) {
+	case *pb.ClusterGlobal_ChatMessage:
+		if m.ChatMessage.PlayerId != "" {
+			m.ChatMessage.PlayerId = remoteID(msg.ServerId, m.ChatMessage.PlayerId)
+		}
+		g.deliverChat(m.ChatMessage)
+	case *pb.ClusterGlobal_PresenceUpdate:
+		m.PresenceUpdate.PlayerId = remoteID(msg.ServerId, m.PresenceUpdate.PlayerId)
+		g.publish(&pb.ServerMessage{Message: &pb.ServerMessage_PresenceUpdate{PresenceUpdate: m.PresenceUpdate}}, "presence")
+	}
+}
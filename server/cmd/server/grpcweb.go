@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	webMaxMessage  = 4 << 20 // Largest request message, as gRPC's default
+	webTrailerFlag = 0x80    // Frame flag marking the trailers of a gRPC-Web response
+)
+
+// webGateway serves registered gRPC services to browsers without a proxy
+// such as Envoy. Unary and server-streaming methods speak gRPC-Web
+// (application/grpc-web and grpc-web-text, over HTTP/1.1). Bidirectional
+// methods such as GameStream, which gRPC-Web cannot carry, are served over a
+// WebSocket at the same path (see serveWebSocket). Unary methods also take
+// JSON POSTs there, and the common ones have REST routes (see restRoutes).
+//
+// Services are registered on it as on a grpc.Server; calls go straight to
+// their handlers, with the HTTP headers as incoming metadata and the client's
+// address as its peer.
+//
+// Browsers may only call it from its own origin and those in origins, as any
+// page a player visits could otherwise play or administer as them.
+type webGateway struct {
+	methods map[string]webMethod // By full path, such as "/game.GameService/ListRooms"
+	rest    *http.ServeMux       // REST routes under /v1/; set by serve
+	origins []string             // Other origins allowed, such as "https://play.example.com"; "*" allows any
+}
+
+// webMethod is a registered method and the service implementing it.
+type webMethod struct {
+	impl   any
+	unary  *grpc.MethodDesc
+	stream *grpc.StreamDesc
+}
+
+func newWebGateway(origins []string) *webGateway {
+	return &webGateway{methods: make(map[string]webMethod), origins: origins}
+}
+
+// RegisterService implements grpc.ServiceRegistrar.
+func (g *webGateway) RegisterService(desc *grpc.ServiceDesc, impl any) {
+	for i := range desc.Methods {
+		g.methods["/"+desc.ServiceName+"/"+desc.Methods[i].MethodName] = webMethod{impl: impl, unary: &desc.Methods[i]}
+	}
+	for i := range desc.Streams {
+		g.methods["/"+desc.ServiceName+"/"+desc.Streams[i].StreamName] = webMethod{impl: impl, stream: &desc.Streams[i]}
+	}
+}
+
+// serve listens for browsers and REST callers on addr once every service is
+// registered.
+func (g *webGateway) serve(addr string) {
+	g.rest = g.restMux()
+	log.Printf("Serving gRPC-Web, WebSocket streams and REST on http://%s", addr)
+	if err := http.ListenAndServe(addr, g); err != nil {
+		log.Printf("Web gateway stopped: %v", err)
+	}
+}
+
+func (g *webGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	if origin := r.Header.Get("Origin"); origin != "" {
+		// Refused outright rather than by leaving out the CORS headers:
+		// browsers send simple POSTs and WebSocket upgrades regardless.
+		if !g.allowOrigin(origin, r.Host) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	h.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	h.Set("Access-Control-Allow-Headers", "authorization, content-type, x-grpc-web, x-user-agent, grpc-timeout")
+	h.Set("Access-Control-Expose-Headers", "grpc-status, grpc-message")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/v1/") {
+		g.rest.ServeHTTP(w, r)
+		return
+	}
+	path := r.URL.Path
+	if path == webSocketPath {
+		path = pb.GameService_GameStream_FullMethodName
+	}
+	m, ok := g.methods[path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		ws := websocket.Server{Handshake: pickSubprotocol, Handler: func(conn *websocket.Conn) { m.serveWebSocket(conn) }}
+		ws.ServeHTTP(w, r)
+		return
+	}
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case r.Method != http.MethodPost:
+	case strings.HasPrefix(contentType, "application/grpc-web"):
+		m.serveGRPCWeb(w, r)
+		return
+	case strings.HasPrefix(contentType, "application/json") && m.unary != nil:
+		m.serveJSON(w, r, nil)
+		return
+	}
+	http.Error(w, "expected a gRPC-Web or JSON POST, or a WebSocket upgrade", http.StatusUnsupportedMediaType)
+}
+
+// allowOrigin reports whether browsers on origin may call the gateway: its
+// own origin, served at host, or one of g.origins.
+func (g *webGateway) allowOrigin(origin, host string) bool {
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, host) {
+		return true
+	}
+	for _, allowed := range g.origins {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// callContext carries an HTTP request's headers as incoming metadata and its
+// client address as the peer, as gRPC would.
+func callContext(r *http.Request) context.Context {
+	md := metadata.MD{}
+	for k, v := range r.Header {
+		md.Append(strings.ToLower(k), v...)
+	}
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+	}
+	return ctx
+}
+
+// serveGRPCWeb answers a gRPC-Web call: a single request message, then the
+// responses and the trailers, base64-encoded for grpc-web-text.
+func (m webMethod) serveGRPCWeb(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	text := strings.HasPrefix(contentType, "application/grpc-web-text")
+	var body io.Reader = http.MaxBytesReader(w, r.Body, 2*webMaxMessage)
+	if text {
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	out := &webResponse{w: w, text: text}
+	w.Header().Set("Content-Type", contentType)
+	req, err := readWebFrame(body)
+	switch {
+	case err != nil:
+		err = status.Errorf(codes.InvalidArgument, "bad gRPC-Web request: %v", err)
+	case m.unary != nil:
+		var resp any
+		resp, err = m.unary.Handler(m.impl, callContext(r), func(v any) error { return proto.Unmarshal(req, v.(proto.Message)) }, nil)
+		if err == nil {
+			err = out.send(resp)
+		}
+	case m.stream.ClientStreams:
+		err = status.Error(codes.Unimplemented, "gRPC-Web cannot stream requests; connect with a WebSocket")
+	default:
+		err = m.stream.Handler(m.impl, &webServerStream{ctx: callContext(r), request: req, out: out})
+	}
+	out.finish(err)
+}
+
+// readWebFrame reads one length-prefixed gRPC message.
+func readWebFrame(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, errors.New("compressed messages are not supported")
+	}
+	n := binary.BigEndian.Uint32(header[1:])
+	if n > webMaxMessage {
+		return nil, fmt.Errorf("message of %d bytes is too large", n)
+	}
+	msg := make([]byte, n)
+	_, err := io.ReadFull(r, msg)
+	return msg, err
+}
+
+// webResponse writes gRPC-Web frames to an HTTP response.
+type webResponse struct {
+	w    http.ResponseWriter
+	text bool
+}
+
+func (o *webResponse) frame(flag byte, data []byte) error {
+	buf := make([]byte, 5+len(data))
+	buf[0] = flag
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(data)))
+	copy(buf[5:], data)
+	if o.text {
+		buf = []byte(base64.StdEncoding.EncodeToString(buf))
+	}
+	if _, err := o.w.Write(buf); err != nil {
+		return err
+	}
+	if f, ok := o.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+func (o *webResponse) send(m any) error {
+	if pm, ok := m.(*preparedMessage); ok {
+		return o.frame(0, pm.data)
+	}
+	data, err := proto.Marshal(m.(proto.Message))
+	if err != nil {
+		return err
+	}
+	return o.frame(0, data)
+}
+
+// finish writes the trailers with the call's status.
+func (o *webResponse) finish(err error) {
+	st := status.Convert(err)
+	trailers := fmt.Sprintf("grpc-status: %d\r\ngrpc-message: %s\r\n", st.Code(), url.PathEscape(st.Message()))
+	if err := o.frame(webTrailerFlag, []byte(trailers)); err != nil {
+		log.Printf("gRPC-Web response failed: %v", err)
+	}
+}
+
+// webServerStream is a server-streaming call over gRPC-Web.
+type webServerStream struct {
+	ctx     context.Context
+	request []byte
+	read    bool
+	out     *webResponse
+}
+
+func (s *webServerStream) Context() context.Context     { return s.ctx }
+func (s *webServerStream) SetHeader(metadata.MD) error  { return nil }
+func (s *webServerStream) SendHeader(metadata.MD) error { return nil }
+func (s *webServerStream) SetTrailer(metadata.MD)       {}
+func (s *webServerStream) SendMsg(m any) error          { return s.out.send(m) }
+func (s *webServerStream) RecvMsg(m any) error {
+	if s.read {
+		return io.EOF
+	}
+	s.read = true
+	return proto.Unmarshal(s.request, m.(proto.Message))
+}
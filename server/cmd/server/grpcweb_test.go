@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebGatewayOrigins(t *testing.T) {
+	g := newWebGateway([]string{"https://play.example.com"})
+	tests := []struct {
+		name    string
+		origin  string
+		upgrade bool
+		want    int
+	}{
+		{"no origin", "", false, http.StatusNoContent},
+		{"same origin", "http://game.example.com:8081", false, http.StatusNoContent},
+		{"allowed origin", "https://play.example.com", false, http.StatusNoContent},
+		{"other origin", "https://evil.example.com", false, http.StatusForbidden},
+		{"other origin upgrading", "https://evil.example.com", true, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodOptions, "http://game.example.com:8081"+webSocketPath, nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if tt.upgrade {
+			r.Method = http.MethodGet
+			r.Header.Set("Upgrade", "websocket")
+			r.Header.Set("Connection", "Upgrade")
+		}
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); w.Code != http.StatusForbidden && got != tt.origin {
+			t.Errorf("%s: Access-Control-Allow-Origin %q, want %q", tt.name, got, tt.origin)
+		}
+	}
+
+	any := newWebGateway([]string{"*"})
+	r := httptest.NewRequest(http.MethodOptions, "http://game.example.com"+webSocketPath, nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+	w := httptest.NewRecorder()
+	any.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("with * allowed: status %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"simple-grpc-game/server/internal/harness"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc"
+)
+
+// testServer is a gameServer served in-process over bufconn, for end-to-end
+// tests of this package (see package harness). Its tick loop does not run:
+// tests advance the game with tick, so the broadcasts they assert on come
+// in a fixed order.
+type testServer struct {
+	game *gameServer
+	*harness.Server
+}
+
+// startTestServer starts a game server with cfg, with AdminService when
+// cfg.adminToken is set, until the test ends.
+func startTestServer(tb harness.TB, cfg serverConfig) *testServer {
+	tb.Helper()
+	game, err := NewGameServer(cfg)
+	if err != nil {
+		tb.Fatalf("NewGameServer: %v", err)
+	}
+	srv := harness.Start(tb, func(s *grpc.Server) {
+		pb.RegisterGameServiceServer(s, game)
+		if cfg.adminToken != "" {
+			pb.RegisterAdminServiceServer(s, &adminServer{game: game})
+		}
+	}, grpc.UnaryInterceptor(game.compression.unaryInterceptor), grpc.ForceServerCodecV2(newPreparedCodec()))
+	return &testServer{game: game, Server: srv}
+}
+
+// tick runs n game ticks.
+func (ts *testServer) tick(n int) {
+	for range n {
+		ts.game.gameTick()
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"math/rand/v2"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// randomItemInterval is how often a room below its -random-items count places
+// another item.
+const randomItemInterval = 5 * time.Second
+
+// randomItemKinds are the items placed at random, coins several times as
+// often as the rest.
+var randomItemKinds = []pb.ItemKind{
+	pb.ItemKind_ITEM_COIN, pb.ItemKind_ITEM_COIN, pb.ItemKind_ITEM_COIN, pb.ItemKind_ITEM_COIN,
+	pb.ItemKind_ITEM_HEART, pb.ItemKind_ITEM_SPEED, pb.ItemKind_ITEM_GHOST, pb.ItemKind_ITEM_SHIELD,
+}
+
+// roomItems tops up a room's random items. Only the room's tick touches it.
+type roomItems struct {
+	random int       // Random items kept on the map; 0 places none
+	next   time.Time // When the next random item may be placed
+}
+
+// spawnRandomItems keeps up to n random coins, hearts and power-ups on every
+// room's map; 0 leaves only the items maps place.
+func (m *roomManager) spawnRandomItems(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.randomItems = n
+	for _, r := range m.rooms {
+		r.items.random = n
+	}
+}
+
+// tickItems lets players pick up the items they overlap, ends power-ups that
+// wore off and places a random item when the room is short of them, reporting
+// whether anything changed.
+func (r *room) tickItems(now time.Time) bool {
+	changed := r.state.CollectItems(now)
+	if r.state.ExpirePowerUps(now) {
+		changed = true
+	}
+	it := &r.items
+	if it.random <= 0 || now.Before(it.next) || r.state.RandomItemCount() >= it.random {
+		return changed
+	}
+	it.next = now.Add(randomItemInterval)
+	if r.state.SpawnRandomItem(randomItemKinds[rand.IntN(len(randomItemKinds))]) {
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// joinRequestTTL is how long after its last stream ends a join request
+	// ID can still be replayed.
+	joinRequestTTL         = 2 * time.Minute
+	maxJoinRequestIDLength = 64
+)
+
+// joinRecord is the outcome of a join handshake, kept so a client retrying
+// it with the same request ID gets the same player back.
+type joinRecord struct {
+	address  string // Only the client that made the join may replay it
+	roomID   string
+	playerID string
+	gen      uint64    // Incremented by each replay; only the latest stream owns the player
+	active   bool      // A stream is using the record
+	endedAt  time.Time // When the last stream ended
+}
+
+// joinTicket is one stream's claim on a join request. The zero ticket, for
+// clients that send no request ID, always owns its player.
+type joinTicket struct {
+	id       string
+	gen      uint64
+	replayed bool   // The request ID was seen before
+	roomID   string // Room and player of the original join when replayed
+	playerID string
+}
+
+// joinLedger makes the join handshake idempotent: a handshake retried after
+// a flaky connection replays the original join instead of adding a second
+// player.
+type joinLedger struct {
+	mu      sync.Mutex
+	records map[string]*joinRecord // By client-generated request ID
+}
+
+func newJoinLedger() *joinLedger {
+	return &joinLedger{records: make(map[string]*joinRecord)}
+}
+
+// begin claims a join request ID for a new stream. A known ID is a replay:
+// the ticket carries the original room and player, and any older stream
+// using them loses ownership. Errors are gRPC status errors.
+func (l *joinLedger) begin(id, address string) (joinTicket, error) {
+	if id == "" {
+		return joinTicket{}, nil
+	}
+	if len(id) > maxJoinRequestIDLength {
+		return joinTicket{}, status.Errorf(codes.InvalidArgument, "join_request_id is longer than %d bytes", maxJoinRequestIDLength)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for key, rec := range l.records {
+		if !rec.active && now.Sub(rec.endedAt) > joinRequestTTL {
+			delete(l.records, key)
+		}
+	}
+	rec, ok := l.records[id]
+	if !ok {
+		l.records[id] = &joinRecord{address: address, gen: 1, active: true}
+		return joinTicket{id: id, gen: 1}, nil
+	}
+	if rec.address != address || rec.playerID == "" {
+		return joinTicket{}, status.Error(codes.AlreadyExists, "join_request_id is already in use")
+	}
+	rec.gen++
+	rec.active = true
+	return joinTicket{id: id, gen: rec.gen, replayed: true, roomID: rec.roomID, playerID: rec.playerID}, nil
+}
+
+// bind records the room and player a new join produced.
+func (l *joinLedger) bind(t joinTicket, roomID, playerID string) {
+	if t.id == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if rec, ok := l.records[t.id]; ok && rec.gen == t.gen {
+		rec.roomID, rec.playerID = roomID, playerID
+	}
+}
+
+// owns reports whether the ticket's stream still owns its player, i.e. no
+// replay has taken it over.
+func (l *joinLedger) owns(t joinTicket) bool {
+	if t.id == "" {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rec, ok := l.records[t.id]
+	return ok && rec.gen == t.gen
+}
+
+// end releases a stream's claim, starting the replay window.
+func (l *joinLedger) end(t joinTicket) {
+	if t.id == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if rec, ok := l.records[t.id]; ok && rec.gen == t.gen {
+		if rec.playerID == "" {
+			delete(l.records, t.id) // The join never completed; nothing to replay
+			return
+		}
+		rec.active = false
+		rec.endedAt = time.Now()
+	}
+}
+
+// replaceStream hands a player over to a replayed join's stream. Unlike
+// reserveSlot and addStream it ignores the room's capacity, as the player is already in.
+func (r *room) replaceStream(playerID string, stream pb.GameService_GameStreamServer) {
+	r.muStreams.Lock()
+	defer r.muStreams.Unlock()
+	r.activeStreams[playerID] = stream
+	delete(r.partialPeers, playerID) // The new stream opts in again if it can
+	r.stopChunkView(playerID)        // The new client has none of the chunks
+	log.Printf("Stream replaced for player %s in room %s.", playerID, r.id)
+}
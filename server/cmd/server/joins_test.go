@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestJoinLedgerReplay(t *testing.T) {
+	l := newJoinLedger()
+	first, err := l.begin("req-1", "10.0.0.1")
+	if err != nil || first.replayed {
+		t.Fatalf("first begin = %+v, %v", first, err)
+	}
+	l.bind(first, "lobby", "p1")
+
+	if _, err := l.begin("req-1", "10.0.0.2"); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("replay from another address: err = %v, want AlreadyExists", err)
+	}
+
+	retry, err := l.begin("req-1", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !retry.replayed || retry.roomID != "lobby" || retry.playerID != "p1" {
+		t.Errorf("replay ticket = %+v, want room lobby and player p1", retry)
+	}
+	if l.owns(first) {
+		t.Error("the original stream still owns the player after a replay")
+	}
+	if !l.owns(retry) {
+		t.Error("the replayed stream does not own the player")
+	}
+
+	l.end(first) // A stale stream ending must not release the replay's claim
+	if rec := l.records["req-1"]; !rec.active {
+		t.Error("stale end released the replayed stream's record")
+	}
+	l.end(retry)
+	if rec := l.records["req-1"]; rec.active || rec.endedAt.IsZero() {
+		t.Errorf("record after end = %+v, want inactive with an end time", rec)
+	}
+}
+
+func TestJoinLedgerUnboundJoin(t *testing.T) {
+	l := newJoinLedger()
+	ticket, err := l.begin("req-1", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.begin("req-1", "10.0.0.1"); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("replay of an unfinished join: err = %v, want AlreadyExists", err)
+	}
+	l.end(ticket)
+	if _, ok := l.records["req-1"]; ok {
+		t.Error("a join that never bound a player is kept for replay")
+	}
+	again, err := l.begin("req-1", "10.0.0.1")
+	if err != nil || again.replayed {
+		t.Errorf("begin after an unbound join = %+v, %v, want a fresh join", again, err)
+	}
+}
+
+func TestJoinLedgerExpiry(t *testing.T) {
+	l := newJoinLedger()
+	ticket, _ := l.begin("req-1", "10.0.0.1")
+	l.bind(ticket, "lobby", "p1")
+	l.end(ticket)
+	l.records["req-1"].endedAt = time.Now().Add(-joinRequestTTL - time.Second)
+
+	again, err := l.begin("req-1", "10.0.0.1")
+	if err != nil || again.replayed {
+		t.Errorf("begin after the replay window = %+v, %v, want a fresh join", again, err)
+	}
+}
+
+func TestJoinLedgerWithoutRequestID(t *testing.T) {
+	l := newJoinLedger()
+	ticket, err := l.begin("", "10.0.0.1")
+	if err != nil || ticket.replayed || !l.owns(ticket) {
+		t.Errorf("begin without an ID = %+v, %v, want an owning ticket", ticket, err)
+	}
+	if _, err := l.begin(strings.Repeat("x", maxJoinRequestIDLength+1), "10.0.0.1"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("oversized ID: err = %v, want InvalidArgument", err)
+	}
+}
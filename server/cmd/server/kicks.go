@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"simple-grpc-game/server/internal/game"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// disconnect is why a player's stream is being ended by the server.
+type disconnect struct {
+	notice    *pb.DisconnectNotice // Sent to the player first
+	eventType string               // Event logged; kicked if empty
+	event     map[string]any       // Fields of the event
+	err       error                // Status the stream ends with
+}
+
+func kickDisconnect(reason string) disconnect {
+	text := "You were kicked from the server."
+	if reason != "" {
+		text = "You were kicked from the server: " + reason
+	}
+	return disconnect{
+		notice: &pb.DisconnectNotice{Reason: "kicked", Message: text},
+		event:  map[string]any{"reason": "admin", "message": reason},
+		err:    status.Error(codes.Aborted, text),
+	}
+}
+
+func banDisconnect(sc *sanction) disconnect {
+	err := sanctionError(sc)
+	return disconnect{
+		notice: &pb.DisconnectNotice{Reason: "banned", Message: "You are " + status.Convert(err).Message()},
+		event:  map[string]any{"reason": "banned", "sanction_id": sc.ID},
+		err:    err,
+	}
+}
+
+// roomExpiredDisconnect ends the stream of a player in a room that has
+// outlived its lifetime.
+func roomExpiredDisconnect() disconnect {
+	return disconnect{
+		notice: &pb.DisconnectNotice{Reason: "room_expired", Message: "This room has closed: its lifetime ended."},
+		event:  map[string]any{"reason": "room_expired"},
+	}
+}
+
+// connectedStream is a player's stream as the kick switch knows it.
+type connectedStream struct {
+	kick     chan disconnect // Buffered; the receive loop watches it
+	username string          // As sanctions match it
+	address  string
+}
+
+// kickSwitch lets admins end players' streams: each stream registers a
+// channel its receive loop watches alongside incoming messages.
+type kickSwitch struct {
+	mu      sync.Mutex
+	streams map[string]*connectedStream // By player ID
+}
+
+// watch registers a player's stream, returning the channel a kick arrives on.
+func (k *kickSwitch) watch(playerID, username, address string) <-chan disconnect {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.streams == nil {
+		k.streams = make(map[string]*connectedStream)
+	}
+	cs := &connectedStream{kick: make(chan disconnect, 1), username: username, address: address}
+	k.streams[playerID] = cs
+	return cs.kick
+}
+
+// forget unregisters a player's stream once it has ended, unless a newer
+// stream has taken the player over.
+func (k *kickSwitch) forget(playerID string, ch <-chan disconnect) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if cs, ok := k.streams[playerID]; ok && cs.kick == ch {
+		delete(k.streams, playerID)
+	}
+}
+
+// lookup returns the username and address a connected player joined with.
+func (k *kickSwitch) lookup(playerID string) (username, address string, ok bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	cs, ok := k.streams[playerID]
+	if !ok {
+		return "", "", false
+	}
+	return cs.username, cs.address, true
+}
+
+// kick asks a player's stream to end, reporting whether it is connected.
+func (k *kickSwitch) kick(playerID string, d disconnect) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	cs, ok := k.streams[playerID]
+	if ok {
+		select {
+		case cs.kick <- d:
+		default: // Already being disconnected
+		}
+	}
+	return ok
+}
+
+// kickMatching ends the streams of every player a sanction applies to,
+// returning their IDs.
+func (k *kickSwitch) kickMatching(sc *sanction) []string {
+	k.mu.Lock()
+	var matched []string
+	for id, cs := range k.streams {
+		if sc.matches(sc.Kind, cs.username, cs.address) {
+			matched = append(matched, id)
+		}
+	}
+	k.mu.Unlock()
+	for _, id := range matched {
+		k.kick(id, banDisconnect(sc))
+	}
+	return matched
+}
+
+// endStream tells a player why their stream is closing and logs it,
+// returning the status to end the stream with.
+func (r *room) endStream(playerID, username string, d disconnect) error {
+	log.Printf("Player %s ('%s') disconnected: %s", playerID, username, d.notice.Message)
+	eventType := d.eventType
+	if eventType == "" {
+		eventType = game.EventKicked
+	}
+	r.emitEvent(eventType, playerID, d.event)
+	r.broadcastTo(&pb.ServerMessage{Message: &pb.ServerMessage_DisconnectNotice{DisconnectNotice: d.notice}},
+		"disconnect notice", func(id string) bool { return id == playerID })
+	return d.err
+}
+
+// KickPlayer disconnects a connected player at once: their stream closes
+// with a DisconnectNotice and they leave the room as if they had quit.
+// Unlike a ban, nothing stops them from joining again.
+func (a *adminServer) KickPlayer(ctx context.Context, req *pb.KickPlayerRequest) (*pb.KickPlayerResponse, error) {
+	if err := a.authorize(ctx, scopeKick); err != nil {
+		return nil, err
+	}
+	playerID := req.GetPlayerId()
+	for _, rm := range a.game.rooms.all() {
+		player, ok := rm.state.GetPlayer(playerID)
+		if !ok || !a.game.kicks.kick(playerID, kickDisconnect(req.GetReason())) {
+			continue
+		}
+		log.Printf("Admin kicked player %s ('%s') from room %s: %q", playerID, player.Username, rm.id, req.GetReason())
+		return &pb.KickPlayerResponse{RoomId: rm.id, Username: player.Username}, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "player %s is not connected", playerID)
+}
@@ -0,0 +1,31 @@
+package main
+
+import "time"
+
+// lagCompensation decides how far back a player's contact with others (tags,
+// attacks) is judged, so that it matches what the player saw rather than
+// where the others are by the time the server hears of it.
+type lagCompensation struct {
+	latency   func(playerID string) time.Duration // Recent input latency of a player
+	maxRewind time.Duration
+}
+
+// rewindFor returns how far to rewind the others for a player's action sent
+// at sentAtMs on the server clock, or 0 if the action is not stamped. The
+// player saw the others about one latency late and the action took another
+// to arrive, so that is twice the action's own latency, or twice the
+// player's latest input latency for unstamped actions, capped at maxRewind.
+func (l lagCompensation) rewindFor(playerID string, sentAtMs int64, now time.Time) time.Duration {
+	var latency time.Duration
+	if sentAtMs != 0 {
+		latency = now.Sub(time.UnixMilli(sentAtMs))
+	} else if l.latency != nil {
+		latency = l.latency(playerID)
+	}
+	return min(max(2*latency, 0), l.maxRewind)
+}
+
+// lagCompensation returns the lag compensation of new tag and combat rooms.
+func (m *roomManager) lagCompensation() lagCompensation {
+	return lagCompensation{latency: m.latencyOf, maxRewind: m.maxRewind}
+}
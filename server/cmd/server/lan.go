@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	lanServiceType  = "_grpcgame._tcp.local." // DNS-SD service type clients browse for
+	lanRecordTTL    = 120                     // Seconds; short, as the TXT record carries player counts
+	lanAnnouncement = time.Second             // Gap between the startup announcements
+	lanReadBuffer   = 9000                    // Largest mDNS packet read
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// lanAdvertiser answers mDNS queries for the server's DNS-SD records, so
+// clients on the same network find it without knowing its address. It only
+// speaks IPv4 multicast and answers PTR, SRV, TXT and A questions.
+type lanAdvertiser struct {
+	s        *gameServer
+	conn     *net.UDPConn
+	name     string // Server name shown to players
+	instance dnsmessage.Name
+	service  dnsmessage.Name
+	host     dnsmessage.Name
+	port     uint16
+	ips      []net.IP
+}
+
+// advertiseLAN starts answering mDNS queries for the server listening on
+// listenAddress.
+func (s *gameServer) advertiseLAN(name, listenAddress string) error {
+	hostIP, portStr, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+	ips, err := lanAddresses(hostIP)
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	a := &lanAdvertiser{s: s, name: name, port: uint16(port), ips: ips}
+	label := strings.ReplaceAll(name, ".", "-")
+	if a.instance, err = dnsmessage.NewName(label + "." + lanServiceType); err != nil {
+		return fmt.Errorf("invalid server name %q: %w", name, err)
+	}
+	a.service = dnsmessage.MustNewName(lanServiceType)
+	if a.host, err = dnsmessage.NewName(strings.ReplaceAll(hostname, ".", "-") + ".local."); err != nil {
+		return fmt.Errorf("invalid host name %q: %w", hostname, err)
+	}
+	if a.conn, err = net.ListenMulticastUDP("udp4", nil, mdnsGroup); err != nil {
+		return err
+	}
+	log.Printf("Advertising '%s' on the local network as %s (port %d, %v)", name, a.instance, port, ips)
+	go a.serve()
+	go a.announce()
+	return nil
+}
+
+// lanAddresses returns the IPv4 addresses clients on the network reach the
+// server at: the listen address, or every non-loopback interface address
+// when listening on all of them.
+func lanAddresses(hostIP string) ([]net.IP, error) {
+	if ip := net.ParseIP(hostIP); ip != nil && !ip.IsUnspecified() {
+		if ip.To4() == nil {
+			return nil, fmt.Errorf("LAN discovery needs an IPv4 address, not %s", ip)
+		}
+		return []net.IP{ip.To4()}, nil
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			ips = append(ips, ipNet.IP.To4())
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IPv4 network interface to advertise")
+	}
+	return ips, nil
+}
+
+// announce sends the records unasked a couple of times at startup, as mDNS
+// responders do, so browsing clients see the server straight away.
+func (a *lanAdvertiser) announce() {
+	for i := 0; i < 2; i++ {
+		if packet, err := a.response(0, []dnsmessage.Question{{Name: a.service, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}}); err == nil {
+			a.conn.WriteToUDP(packet, mdnsGroup)
+		}
+		time.Sleep(lanAnnouncement)
+	}
+}
+
+// serve answers queries until the socket fails. Queries from a port other
+// than 5353 come from simple resolvers and are answered to the sender;
+// others are answered to the group.
+func (a *lanAdvertiser) serve() {
+	buf := make([]byte, lanReadBuffer)
+	for {
+		n, from, err := a.conn.ReadFromUDP(buf)
+		if err != nil {
+			log.Printf("LAN discovery stopped: %v", err)
+			return
+		}
+		var p dnsmessage.Parser
+		header, err := p.Start(buf[:n])
+		if err != nil || header.Response {
+			continue
+		}
+		questions, err := p.AllQuestions()
+		if err != nil {
+			continue
+		}
+		id, to := uint16(0), mdnsGroup
+		if from.Port != mdnsGroup.Port {
+			id, to = header.ID, from
+		}
+		packet, err := a.response(id, questions)
+		if err != nil || packet == nil {
+			continue
+		}
+		if _, err := a.conn.WriteToUDP(packet, to); err != nil {
+			log.Printf("LAN discovery answer to %s failed: %v", to, err)
+		}
+	}
+}
+
+// response builds the answer to questions about our records; it is nil if
+// none of them are.
+func (a *lanAdvertiser) response(id uint16, questions []dnsmessage.Question) ([]byte, error) {
+	var ptr, srv, txt, addr bool
+	for _, q := range questions {
+		name := strings.ToLower(q.Name.String())
+		all := q.Type == dnsmessage.TypeALL
+		switch name {
+		case strings.ToLower(a.service.String()):
+			ptr = ptr || all || q.Type == dnsmessage.TypePTR
+		case strings.ToLower(a.instance.String()):
+			srv = srv || all || q.Type == dnsmessage.TypeSRV
+			txt = txt || all || q.Type == dnsmessage.TypeTXT
+		case strings.ToLower(a.host.String()):
+			addr = addr || all || q.Type == dnsmessage.TypeA
+		}
+	}
+	if !ptr && !srv && !txt && !addr {
+		return nil, nil
+	}
+	if ptr {
+		// The PTR answer comes with everything needed to connect.
+		srv, txt, addr = true, true, true
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, Response: true, Authoritative: true})
+	b.EnableCompression()
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	shared := dnsmessage.ResourceHeader{Class: dnsmessage.ClassINET, TTL: lanRecordTTL}
+	unique := dnsmessage.ResourceHeader{Class: dnsmessage.ClassINET | 1<<15, TTL: lanRecordTTL} // Cache-flush bit
+	if ptr {
+		shared.Name = a.service
+		if err := b.PTRResource(shared, dnsmessage.PTRResource{PTR: a.instance}); err != nil {
+			return nil, err
+		}
+	}
+	if srv {
+		unique.Name = a.instance
+		if err := b.SRVResource(unique, dnsmessage.SRVResource{Port: a.port, Target: a.host}); err != nil {
+			return nil, err
+		}
+	}
+	if txt {
+		unique.Name = a.instance
+		if err := b.TXTResource(unique, dnsmessage.TXTResource{TXT: a.txt()}); err != nil {
+			return nil, err
+		}
+	}
+	if addr {
+		unique.Name = a.host
+		for _, ip := range a.ips {
+			var rec dnsmessage.AResource
+			copy(rec.A[:], ip)
+			if err := b.AResource(unique, rec); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.Finish()
+}
+
+// txt describes the server as DNS-SD key=value strings.
+func (a *lanAdvertiser) txt() []string {
+	l := a.s.listing(registration{name: a.name})
+	return []string{
+		"name=" + l.Name,
+		"map=" + l.MapName,
+		"players=" + strconv.Itoa(int(l.PlayerCount)),
+		"max=" + strconv.Itoa(int(l.MaxPlayers)),
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// latencyBuckets are the upper bounds of the input latency histogram; a final
+// overflow bucket holds everything slower.
+var latencyBuckets = [...]time.Duration{
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond,
+	200 * time.Millisecond, 500 * time.Millisecond, 1 * time.Second,
+}
+
+// latencyHistogram is the distribution of one client's input latency: the gap
+// between the server-clock send time the client stamps on its inputs and their
+// receipt. It includes network delay and client-side queueing but none of the
+// server's tick processing, so a high value with healthy ticks points at the
+// player's connection.
+type latencyHistogram struct {
+	mu     sync.Mutex
+	counts [len(latencyBuckets) + 1]int64 // Last bucket is the overflow
+	total  int64
+	max    time.Duration
+	last   time.Duration
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0 // Clock estimate error; the input was at least instant
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := 0
+	for i < len(latencyBuckets) && d > latencyBuckets[i] {
+		i++
+	}
+	h.counts[i]++
+	h.total++
+	h.last = d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// latencySummary is a histogram condensed for the admin listing. Percentiles
+// are bucket upper bounds, so they overestimate by up to one bucket.
+type latencySummary struct {
+	Samples  int64
+	P50, P95 time.Duration
+	Max      time.Duration
+}
+
+func (h *latencyHistogram) summary() latencySummary {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return latencySummary{Samples: h.total, P50: h.percentileLocked(0.50), P95: h.percentileLocked(0.95), Max: h.max.Round(time.Millisecond)}
+}
+
+func (h *latencyHistogram) percentileLocked(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	want := int64(q*float64(h.total-1)) + 1
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= want {
+			if i < len(latencyBuckets) {
+				return latencyBuckets[i]
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+// recordInputLatency adds a stamped input to the client's distribution.
+// Unstamped inputs (clients that have not synced their clock) are ignored.
+func (s *gameServer) recordInputLatency(playerID string, input *pb.PlayerInput, received time.Time) {
+	sentAt := input.GetSentAtServerMs()
+	if sentAt == 0 {
+		return
+	}
+	h, _ := s.inputLatency.LoadOrStore(playerID, &latencyHistogram{})
+	h.(*latencyHistogram).record(received.Sub(time.UnixMilli(sentAt)))
+}
+
+// inputLatencySummary returns the client's distribution, if it has any samples.
+func (s *gameServer) inputLatencySummary(playerID string) (latencySummary, bool) {
+	h, ok := s.inputLatency.Load(playerID)
+	if !ok {
+		return latencySummary{}, false
+	}
+	return h.(*latencyHistogram).summary(), true
+}
+
+// lastInputLatency returns the client's most recent input latency, or zero
+// if it has not stamped any inputs.
+func (s *gameServer) lastInputLatency(playerID string) time.Duration {
+	h, ok := s.inputLatency.Load(playerID)
+	if !ok {
+		return 0
+	}
+	lh := h.(*latencyHistogram)
+	lh.mu.Lock()
+	defer lh.mu.Unlock()
+	return lh.last
+}
+
+// answerTimeSync replies to a client's clock sync request.
+func (s *gameServer) answerTimeSync(sess *playerSession, req *pb.TimeSyncRequest) {
+	msg := &pb.ServerMessage{Message: &pb.ServerMessage_TimeSync{TimeSync: &pb.TimeSyncResponse{
+		ClientTimeMs: req.GetClientTimeMs(),
+		ServerTimeMs: time.Now().UnixMilli(),
+	}}}
+	sess.room.broadcastTo(msg, "time sync", func(id string) bool { return id == sess.playerID })
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"simple-grpc-game/server/internal/accounts"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultLeaderboardPageSize = 20
+	maxLeaderboardPageSize     = 100
+)
+
+var leaderboardMetrics = map[pb.LeaderboardMetric]accounts.Metric{
+	pb.LeaderboardMetric_LEADERBOARD_SCORE:         accounts.MetricScore,
+	pb.LeaderboardMetric_LEADERBOARD_TIME_PLAYED:   accounts.MetricTimePlayed,
+	pb.LeaderboardMetric_LEADERBOARD_TILES_VISITED: accounts.MetricTilesVisited,
+}
+
+// leaderboardPageToken encodes where the next page of a leaderboard starts.
+// The metric is included so a token cannot continue a different ranking.
+func leaderboardPageToken(metric pb.LeaderboardMetric, offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", metric, offset)))
+}
+
+// parseLeaderboardPageToken returns the offset a page token continues from.
+func parseLeaderboardPageToken(token string, metric pb.LeaderboardMetric) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		m, offset, ok := strings.Cut(string(raw), ":")
+		n, err1 := strconv.Atoi(offset)
+		if ok && err1 == nil && n >= 0 && m == strconv.Itoa(int(metric)) {
+			return n, nil
+		}
+	}
+	return 0, status.Error(codes.InvalidArgument, "invalid page token")
+}
+
+// GetLeaderboard implements the unary RPC ranking accounts by a stat.
+func (s *gameServer) GetLeaderboard(ctx context.Context, req *pb.GetLeaderboardRequest) (*pb.GetLeaderboardResponse, error) {
+	if s.accounts == nil {
+		return nil, status.Error(codes.Unimplemented, "accounts are not enabled on this server")
+	}
+	metric, ok := leaderboardMetrics[req.GetMetric()]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown leaderboard metric %v", req.GetMetric())
+	}
+	pageSize := int(req.GetPageSize())
+	if pageSize <= 0 {
+		pageSize = defaultLeaderboardPageSize
+	}
+	pageSize = min(pageSize, maxLeaderboardPageSize)
+	offset, err := parseLeaderboardPageToken(req.GetPageToken(), req.GetMetric())
+	if err != nil {
+		return nil, err
+	}
+	// One extra account tells whether there is a next page.
+	page, err := s.accounts.Leaderboard(ctx, metric, offset, pageSize+1)
+	if err != nil {
+		return nil, accountError(err)
+	}
+	resp := &pb.GetLeaderboardResponse{}
+	if len(page) > pageSize {
+		page = page[:pageSize]
+		resp.NextPageToken = leaderboardPageToken(req.GetMetric(), offset+pageSize)
+	}
+	for i, a := range page {
+		resp.Entries = append(resp.Entries, &pb.LeaderboardEntry{Rank: int32(offset + i + 1), Account: accountInfo(a)})
+	}
+	return resp, nil
+}
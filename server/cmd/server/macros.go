@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+const (
+	maxMacrosPerPlayer = 10
+	maxMacroSteps      = 5
+	macroRunInterval   = 1 * time.Second // One macro run regained per interval
+	macroRunBurst      = 3
+)
+
+var macroNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,16}$`)
+
+// macroBook maps macro names to their steps for one player session.
+type macroBook map[string][]*pb.MacroStep
+
+// validateMacro checks a macro definition against the server limits.
+func validateMacro(req *pb.RegisterMacro) error {
+	if !macroNamePattern.MatchString(req.GetName()) {
+		return fmt.Errorf("invalid macro name %q", req.GetName())
+	}
+	if len(req.GetSteps()) > maxMacroSteps {
+		return fmt.Errorf("macro has %d steps, limit is %d", len(req.GetSteps()), maxMacroSteps)
+	}
+	for i, step := range req.GetSteps() {
+		if step.GetCommand() == nil {
+			return fmt.Errorf("macro step %d has no command", i)
+		}
+	}
+	return nil
+}
+
+// registerMacro adds, replaces or (with no steps) deletes a session macro.
+func (s *gameServer) registerMacro(sess *playerSession, req *pb.RegisterMacro) {
+	if err := validateMacro(req); err != nil {
+		log.Printf("Player %s macro rejected: %v", sess.playerID, err)
+		return
+	}
+	name := req.GetName()
+	if len(req.GetSteps()) == 0 {
+		delete(sess.macros, name)
+		log.Printf("Player %s deleted macro '%s'", sess.playerID, name)
+		return
+	}
+	if _, exists := sess.macros[name]; !exists && len(sess.macros) >= maxMacrosPerPlayer {
+		log.Printf("Player %s macro rejected: limit of %d macros reached", sess.playerID, maxMacrosPerPlayer)
+		return
+	}
+	sess.macros[name] = req.GetSteps()
+	log.Printf("Player %s registered macro '%s' (%d steps)", sess.playerID, name, len(req.GetSteps()))
+}
+
+// runMacro executes each step of a macro through the regular message handler,
+// so every step is subject to the same validation and rate limits as if sent
+// individually.
+func (s *gameServer) runMacro(sess *playerSession, name string) {
+	steps, ok := sess.macros[name]
+	if !ok {
+		log.Printf("Player %s ran unknown macro '%s'", sess.playerID, name)
+		return
+	}
+	if !s.macroLimiter.allow(sess.playerID) {
+		log.Printf("Player %s macro '%s' dropped (rate limited)", sess.playerID, name)
+		return
+	}
+	for _, step := range steps {
+		if msg := macroStepMessage(step); msg != nil {
+			s.handleClientMessage(sess, msg)
+		}
+	}
+}
+
+// macroStepMessage converts a macro step to the equivalent client message.
+func macroStepMessage(step *pb.MacroStep) *pb.ClientMessage {
+	switch cmd := step.GetCommand().(type) {
+	case *pb.MacroStep_Chat:
+		return &pb.ClientMessage{Payload: &pb.ClientMessage_SendChatMessage{SendChatMessage: cmd.Chat}}
+	case *pb.MacroStep_Respawn:
+		return &pb.ClientMessage{Payload: &pb.ClientMessage_RespawnRequest{RespawnRequest: cmd.Respawn}}
+	case *pb.MacroStep_Emote:
+		return &pb.ClientMessage{Payload: &pb.ClientMessage_Emote{Emote: cmd.Emote}}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"simple-grpc-game/server/internal/harness"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+func TestMacroRunsEmote(t *testing.T) {
+	ts := startTestServer(t, serverConfig{mapPaths: []string{testMap(t)}})
+	alice := ts.Join(t, &pb.ClientHello{DesiredUsername: "alice"})
+	alice.Expect(t, harness.HasPlayer("alice"))
+
+	steps := []*pb.MacroStep{{Command: &pb.MacroStep_Emote{Emote: &pb.EmoteRequest{Kind: pb.EmoteKind_EMOTE_WAVE}}}}
+	for _, msg := range []*pb.ClientMessage{
+		{Payload: &pb.ClientMessage_RegisterMacro{RegisterMacro: &pb.RegisterMacro{Name: "hello", Steps: steps}}},
+		{Payload: &pb.ClientMessage_RunMacro{RunMacro: &pb.RunMacro{Name: "hello"}}},
+	} {
+		if err := alice.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice.Expect(t, harness.Matcher{Name: "wave", Match: func(msg *pb.ServerMessage) bool {
+		e := msg.GetEmoteEvent()
+		return e != nil && e.GetPlayerId() == alice.ID && e.GetKind() == pb.EmoteKind_EMOTE_WAVE
+	}})
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"os"
+	"simple-grpc-game/server/internal/accounts"
 	"simple-grpc-game/server/internal/game"
 	"strings"
 	"sync"
@@ -15,32 +19,273 @@ import (
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 type gameServer struct {
 	pb.UnimplementedGameServiceServer
-	state         *game.State
-	muStreams     sync.Mutex
-	activeStreams map[string]pb.GameService_GameStreamServer
-	playerInfo    sync.Map // Store playerID -> username mapping for chat
+	rooms        *roomManager
+	global       *globalChannel // Nil when the global channel is disabled
+	matchmaker   *matchmaker
+	macroLimiter *rateLimiter
+	chatLimiter  *rateLimiter      // Room chat messages per player
+	moves        *moveGuard        // Movement budgets against input flooding
+	kicks        kickSwitch        // Lets admins end players' streams
+	announced    announcementBoard // Announcements still showing, for players who join later
+	playerInfo   sync.Map          // Store playerID -> username mapping for chat
+	inputLatency sync.Map          // playerID -> *latencyHistogram
+	startTime    time.Time
+	tickHistory  tickHistory // Recent tick durations for the status page
+	metrics      *serverMetrics
+	history      *metricsHistory // Downsampled long-term trends
+	alerts       *alertManager
+	governor     tickGovernor // Adapts the tick interval to load
+	devRPCs      bool         // Serve development-only RPCs
+	adminToken   string       // Bootstrap token with every scope; empty disables AdminService
+	tokens       *tokenStore  // API tokens issued to integrations
+	sanctions    *sanctionStore
+	joins        *joinLedger       // Join handshakes clients may retry
+	store        game.Store        // Player positions kept across restarts; nil when disabled
+	accounts     *accounts.Service // Nil when accounts are disabled
+	loginLimiter *rateLimiter      // Register and Login attempts per address
+	statusAuth   bool              // Require a read-status token for the admin HTTP pages
+	assets       *pb.AssetManifest // Art skins and tiles are drawn with
+	udp          *udpTransport     // Nil unless position snapshots are served over UDP
+	shards       *sharding         // Nil unless this server hosts a zone of a sharded world
+	compression  compressionPolicy
 }
 
 const (
-	movementTimeout = 200 * time.Millisecond
-	tickRate        = 100 * time.Millisecond
+	tickRate = 100 * time.Millisecond // Tick interval at full speed, unless changed with SetConfig
+
+	maxChatLength    = 200             // Longest chat message, in bytes, the server relays
+	roomChatInterval = 1 * time.Second // One room chat message regained per interval
+	roomChatBurst    = 5
 )
 
-func NewGameServer() (*gameServer, error) {
-	gameState, err := game.NewState()
+// serverConfig holds the command-line options that shape the game server.
+type serverConfig struct {
+	mapPaths      []string      // Maps rooms may use; the first hosts the lobby
+	enableGlobal  bool          // Enable the cross-room global channel
+	metricsFile   string        // Where to persist metrics history; empty keeps it in memory
+	chatDir       string        // Where to persist chat history; empty keeps it in memory
+	adminToken    string        // Enables AdminService
+	tokenFile     string        // Where to persist API tokens; empty keeps them in memory
+	sanctionStore string        // Where to persist mutes and bans (a file or a redis:// URL); may be shared by several servers
+	matchSize     int           // Players per matchmade room
+	maxRewind     time.Duration // Cap on lag compensation for tags and attacks
+	sleepAfter    time.Duration // Empty rooms stop ticking after this long; 0 never
+	randomItems   int           // Random coins, hearts and power-ups kept on every room's map
+	aiBudget      int           // Pathfinding tiles each room's NPCs may expand per tick
+	bots          int           // Players the lobby and map worlds are topped up to with bots
+	botRoute      string        // Route bots walk in a loop (see parseBotRoute); empty walks at random
+	assetDir      string        // Art to hash for the asset manifest; empty describes the standard assets
+	kickSpeeders  bool          // Disconnect players flagged for flooding movement inputs
+	publishPing   bool          // Show every player's round trip in their player data
+	roomBudget    roomBudgetConfig
+	eventLog      string        // Structured event log sink ("stdout" or a file); empty disables it
+	webhooks      string        // Comma-separated URLs to POST game events to; empty disables them
+	hookEvents    []string      // Event types webhooks get
+	compressor    string        // gRPC compressor for large responses ("gzip"); "none" disables it
+	compressMin   int           // Smallest response, in bytes, worth compressing
+	worldDir      string        // Where to save persistent rooms' worlds; empty disables it
+	worldSave     time.Duration // How often worlds are saved
+	playerStore   string        // Player store ("memory" or a redis:// URL); empty disables it
+	cluster       string        // Redis URL to share persistent rooms with other servers through; empty disables it
+	shards        string        // Zone file of a sharded world; empty disables sharding
+	shardZone     string        // Zone of the sharded world this server hosts
+	accounts      string        // Accounts database ("memory" or a postgres:// URL); empty disables accounts
+	statusAuth    bool          // Require a read-status token for the admin HTTP pages
+	alertWebhook  string
+	alertDiscord  string
+	audit         bool // Enable State audit mode and stream consistency checks
+	devRPCs       bool // Enable development-only RPCs such as Simulate
+}
+
+func NewGameServer(cfg serverConfig) (*gameServer, error) {
+	metrics := &serverMetrics{}
+	rooms, err := newRoomManager(cfg.mapPaths, metrics, cfg.audit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize rooms: %w", err)
+	}
+	s := &gameServer{
+		rooms:        rooms,
+		macroLimiter: newRateLimiter(macroRunInterval, macroRunBurst),
+		chatLimiter:  newRateLimiter(roomChatInterval, roomChatBurst),
+		moves:        newMoveGuard(cfg.kickSpeeders),
+		playerInfo:   sync.Map{}, // Initialize the sync.Map
+		startTime:    time.Now(),
+		metrics:      metrics,
+		history:      newMetricsHistory(cfg.metricsFile),
+		alerts:       newAlertManager(cfg.alertWebhook, cfg.alertDiscord),
+		devRPCs:      cfg.devRPCs,
+		adminToken:   cfg.adminToken,
+		tokens:       newTokenStore(cfg.tokenFile),
+		joins:        newJoinLedger(),
+		loginLimiter: newRateLimiter(loginInterval, loginBurst),
+		statusAuth:   cfg.statusAuth,
+	}
+	s.matchmaker = newMatchmaker(rooms, cfg.matchSize)
+	if s.assets, err = loadAssetManifest(cfg.assetDir); err != nil {
+		return nil, fmt.Errorf("invalid assets: %w", err)
+	}
+	if s.compression, err = newCompressionPolicy(cfg.compressor, cfg.compressMin); err != nil {
+		return nil, fmt.Errorf("invalid compression: %w", err)
+	}
+	events, err := openEventLog(cfg.eventLog)
+	if err != nil {
+		return nil, err
+	}
+	hooks, err := newWebhooks(cfg.webhooks, cfg.hookEvents)
+	if err != nil {
+		return nil, err
+	}
+	var sinks teeEvents
+	if events != nil {
+		sinks = append(sinks, events)
+	}
+	if hooks != nil {
+		sinks = append(sinks, hooks)
+		s.alerts.notifiers = append(s.alerts.notifiers, hooks)
+	}
+	if len(sinks) > 0 {
+		rooms.logEvents(sinks)
+	}
+	if s.accounts, err = openAccounts(cfg.accounts); err != nil {
+		return nil, err
+	}
+	if s.sanctions, err = openSanctionStore(cfg.sanctionStore); err != nil {
+		return nil, fmt.Errorf("invalid sanctions store: %w", err)
+	}
+	if s.store, err = openPlayerStore(cfg.playerStore); err != nil {
+		return nil, err
+	}
+	if s.store != nil {
+		go s.savePlayersPeriodically()
+	}
+	peers, err := openCluster(cfg.cluster, rooms)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster: %w", err)
+	}
+	if s.shards, err = loadSharding(cfg.shards, cfg.shardZone, rooms); err != nil {
+		return nil, fmt.Errorf("invalid sharding: %w", err)
+	}
+	rooms.maxRewind = cfg.maxRewind
+	rooms.sleepWhenIdle(cfg.sleepAfter)
+	rooms.spawnRandomItems(cfg.randomItems)
+	rooms.setAIBudget(cfg.aiBudget)
+	rooms.publishPings(cfg.publishPing)
+	route, err := parseBotRoute(cfg.botRoute)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize game state: %w", err)
+		return nil, fmt.Errorf("invalid bot route: %w", err)
+	}
+	rooms.fillWithBots(cfg.bots, route)
+	rooms.setRoomBudgets(cfg.roomBudget)
+	rooms.latencyOf = s.lastInputLatency
+	if cfg.chatDir != "" {
+		rooms.persistChat(cfg.chatDir)
+	}
+	if cfg.worldDir != "" {
+		rooms.persistWorlds(cfg.worldDir, cfg.worldSave)
 	}
-	return &gameServer{
-		state:         gameState,
-		activeStreams: make(map[string]pb.GameService_GameStreamServer),
-		playerInfo:    sync.Map{}, // Initialize the sync.Map
-	}, nil
+	if cfg.enableGlobal {
+		s.global = newGlobalChannel(rooms, chatHistoryPath(cfg.chatDir, "global"))
+		if peers != nil {
+			if err := peers.relayGlobal(s.global); err != nil {
+				return nil, fmt.Errorf("invalid cluster: %w", err)
+			}
+		}
+	}
+	return s, nil
+}
+
+// playerSession holds the per-connection state of a joined player.
+type playerSession struct {
+	playerID string
+	username string
+	roomID   string
+	address  string // Client host, as used for address sanctions
+	room     *room
+	macros   macroBook
+
+	lastDesyncTick uint64 // Tick of the last desync report accepted
+}
+
+// ownerKey identifies the caller for per-owner quotas: their account when a
+// session token is given, otherwise their host address. Errors are gRPC
+// status errors.
+func (s *gameServer) ownerKey(ctx context.Context, token string) (string, error) {
+	if token == "" {
+		return peerHost(ctx), nil
+	}
+	if s.accounts == nil {
+		return "", status.Error(codes.FailedPrecondition, "accounts are not enabled on this server")
+	}
+	acct, err := s.accounts.Authenticate(ctx, token)
+	if err != nil {
+		return "", accountError(err)
+	}
+	return accountOwner(&acct, ""), nil
+}
+
+// accountOwner is ownerKey for a player already authenticated, or
+// anonymous with a nil acct.
+func accountOwner(acct *accounts.Account, host string) string {
+	if acct == nil {
+		return host
+	}
+	return fmt.Sprintf("account:%d", acct.ID)
+}
+
+// peerHost returns the caller's host address, as used for address sanctions.
+func peerHost(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "unknown"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// CreateRoom implements the unary RPC for player-created rooms.
+func (s *gameServer) CreateRoom(ctx context.Context, req *pb.CreateRoomRequest) (*pb.CreateRoomResponse, error) {
+	owner, err := s.ownerKey(ctx, req.GetSessionToken())
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.rooms.createRoom(owner, req)
+	if err != nil {
+		log.Printf("CreateRoom rejected: %v", err)
+		return nil, err
+	}
+	resp := &pb.CreateRoomResponse{Room: r.info()}
+	if req.GetInviteCode() {
+		resp.InviteCode = r.password
+	}
+	return resp, nil
+}
+
+// ListRooms lists the rooms a new player could join.
+func (s *gameServer) ListRooms(ctx context.Context, req *pb.ListRoomsRequest) (*pb.ListRoomsResponse, error) {
+	return &pb.ListRoomsResponse{Rooms: s.rooms.list(req.GetMapName(), req.GetIncludeFull())}, nil
+}
+
+// JoinRoom checks that a room exists and accepts the password, so clients can
+// report a bad room ID before opening the game stream.
+func (s *gameServer) JoinRoom(ctx context.Context, req *pb.JoinRoomRequest) (*pb.JoinRoomResponse, error) {
+	r, err := s.rooms.joinable(req.GetRoomId(), req.GetPassword())
+	if err != nil {
+		return nil, err
+	}
+	if r.full() {
+		return nil, status.Errorf(codes.ResourceExhausted, "room %s is full", r.id)
+	}
+	return &pb.JoinRoomResponse{Room: r.info()}, nil
 }
 
 // GameStream implements the bidirectional stream RPC
@@ -67,53 +312,179 @@ func (s *gameServer) GameStream(stream pb.GameService_GameStreamServer) error {
 
 	username = helloMsg.GetDesiredUsername()
 	if username == "" {
-		username = "AnonPlayer"
+		username = anonymousUsername
+	}
+	if skin := helloMsg.GetSkin(); skin != "" && !game.ValidSkin(skin) {
+		return status.Errorf(codes.InvalidArgument, "unknown skin %q; choose one of %s", skin, strings.Join(game.Skins(), ", "))
+	}
+	var handoff *handoffTicket
+	if ticket := helloMsg.GetHandoffTicket(); ticket != "" {
+		if handoff, err = s.redeemHandoff(ticket); err != nil {
+			return err
+		}
+		username = handoff.Username
+	}
+	account, err := s.joinAccount(stream.Context(), helloMsg.GetSessionToken(), username)
+	if err != nil {
+		return err
+	}
+	if account != nil {
+		if handoff != nil && account.Username != handoff.Username {
+			return status.Error(codes.InvalidArgument, "handoff ticket is for another account")
+		}
+		username = account.Username
+	}
+	joinedAt := time.Now()
+	address := peerHost(stream.Context())
+	if ban, banned := s.sanctions.active(pb.SanctionKind_SANCTION_BAN, username, address); banned {
+		log.Printf("Rejected join from '%s' (%s): banned by %s.", username, address, ban.ID)
+		return sanctionError(ban)
+	}
+	join, err := s.joins.begin(helloMsg.GetJoinRequestId(), address)
+	if err != nil {
+		return err
+	}
+	defer s.joins.end(join)
+	roomID := helloMsg.GetRoomId()
+	if roomID == "" {
+		roomID = defaultRoomID
+	}
+	var rm *room
+	if join.replayed {
+		// The original join already passed the room checks.
+		var ok bool
+		if rm, ok = s.rooms.get(join.roomID); !ok {
+			return status.Errorf(codes.NotFound, "room %s of the original join no longer exists", join.roomID)
+		}
+		roomID = rm.id
+	} else if handoff != nil {
+		if rm, err = s.joinHandoff(); err != nil {
+			return err
+		}
+		roomID = rm.id
+	} else if helloMsg.GetTutorial() {
+		if rm, err = s.rooms.createTutorial(accountOwner(account, address)); err != nil {
+			return err
+		}
+		roomID = rm.id
+	} else {
+		if mapName := helloMsg.GetMapName(); mapName != "" {
+			if helloMsg.GetRoomId() != "" {
+				return status.Errorf(codes.InvalidArgument, "set either room_id or map_name, not both")
+			}
+			if roomID, err = s.rooms.worldRoomID(mapName); err != nil {
+				return err
+			}
+		}
+		if rm, err = s.rooms.joinable(roomID, helloMsg.GetRoomPassword()); err != nil {
+			return err
+		}
 	}
 	playerID = fmt.Sprintf("player_%p", &stream) // TODO: Robust ID generation
-	s.state.AddPlayer(playerID, username, 100, 100)
+	resumed := false
+	if join.replayed {
+		playerID = join.playerID
+		_, resumed = rm.state.GetPlayer(playerID)
+	}
+	// Closed after the player leaves the room, so what is queued for it
+	// drains without the room still broadcasting to it.
+	var out *outboundStream
+	defer func() {
+		if out != nil {
+			out.close()
+		}
+	}()
+	if resumed {
+		log.Printf("Received ClientHello: Player %s ('%s') resumed in room %s by a replayed join.", playerID, username, roomID)
+	} else {
+		if err := rm.reserveSlot(playerID); err != nil {
+			return err
+		}
+		s.expectStoredPlayer(stream.Context(), rm, username)
+		s.expectAccountPlayer(stream.Context(), rm, account)
+		expectHandoffPlayer(rm, handoff)
+		player := rm.state.AddPlayer(playerID, username)
+		if skin := helloMsg.GetSkin(); skin != "" {
+			rm.state.SetSkin(playerID, skin) // Validated above
+		} else if handoff != nil && game.ValidSkin(handoff.Skin) {
+			rm.state.SetSkin(playerID, handoff.Skin)
+		}
+		if team := helloMsg.GetTeam(); team != 0 && rm.state.Teams() > 0 {
+			if got, err := rm.state.ChooseTeam(playerID, team); err != nil || got != team {
+				log.Printf("Player %s ('%s') asked for team %d, playing on team %d.", playerID, username, team, got)
+			}
+		}
+		s.joins.bind(join, roomID, playerID)
+		log.Printf("Received ClientHello: Player %s ('%s') joining room %s as '%s'.", playerID, username, roomID, player.GetDisplayName())
+	}
 	s.playerInfo.Store(playerID, username) // Store username for chat lookup
-	log.Printf("Received ClientHello: Player %s ('%s') joining.", playerID, username)
-	s.addStream(playerID, stream)
 
 	defer func() {
+		if !s.joins.owns(join) {
+			log.Printf("Player %s ('%s') stream ended; a replayed join took over the player.", playerID, username)
+			return
+		}
 		log.Printf("Player %s ('%s') disconnecting...", playerID, username)
-		s.state.RemovePlayer(playerID)
-		s.removeStream(playerID)
+		s.storePlayer(rm, playerID, false)
+		s.endAccountSession(rm, playerID, account, joinedAt)
+		rm.state.RemovePlayer(playerID)
+		rm.removeStream(playerID)
 		s.playerInfo.Delete(playerID) // Remove from username map
+		s.inputLatency.Delete(playerID)
+		s.macroLimiter.forget(playerID)
+		s.chatLimiter.forget(playerID)
+		s.moves.forget(playerID)
+		if s.udp != nil {
+			s.udp.forget(playerID)
+		}
 		log.Printf("Player %s removed.", playerID)
-		s.broadcastDeltaState() // Let others know player left
+		rm.broadcastDeltaState() // Let others know player left
+		rm.broadcastScoreboard()
+		if s.global != nil {
+			s.global.forget(playerID)
+			s.global.announcePresence(playerID, username, roomID, false)
+		}
 	}()
 
-	// Send Initial Map Data (unchanged)
-	_, _, _, _, mapErr := s.state.GetMapDataAndDimensions()
+	// Send Initial Map Data
+	chunked := rm.shouldStreamMap(helloMsg.GetSupportsMapChunks())
+	mapMessage, mapErr := rm.initialMapMessage(playerID, s.governor.interval(), chunked)
 	if mapErr != nil {
 		log.Printf("Error getting map data for %s: %v", playerID, mapErr)
-		return mapErr
-	}
-	// ... (rest of map sending logic as before) ...
-	mapGrid, mapW, mapH, tileSize, _ := s.state.GetMapDataAndDimensions() // Error already checked
-	worldW, worldH := s.state.GetWorldPixelDimensions()
-	initialMap := &pb.InitialMapData{TileWidth: int32(mapW), TileHeight: int32(mapH), Rows: make([]*pb.MapRow, mapH), WorldPixelHeight: worldH, WorldPixelWidth: worldW, TileSizePixels: int32(tileSize), AssignedPlayerId: playerID}
-	for y, rowData := range mapGrid {
-		rowTiles := make([]int32, mapW)
-		for x, tileID := range rowData {
-			if x < len(rowTiles) {
-				rowTiles[x] = int32(tileID)
-			}
-		}
-		if y < len(initialMap.Rows) {
-			initialMap.Rows[y] = &pb.MapRow{Tiles: rowTiles}
-		}
+		return status.Errorf(gameErrorCode(mapErr), "map unavailable: %v", mapErr)
 	}
-	mapMessage := &pb.ServerMessage{Message: &pb.ServerMessage_InitialMapData{InitialMapData: initialMap}}
+	mapMessage.GetInitialMapData().Resumed = resumed
+	mapSize := proto.Size(mapMessage)
+	if limit := clientMessageLimit(helloMsg); mapSize > limit {
+		// Sending would fail on the client with an opaque error instead.
+		log.Printf("Map of room %s is %d bytes, over the %d byte limit of player %s ('%s').", roomID, mapSize, limit, playerID, username)
+		return status.Errorf(codes.ResourceExhausted,
+			"map is %d bytes, over this client's %d byte message limit; use a client that supports map chunks", mapSize, limit)
+	}
+	s.compression.compressStream(stream.Context(), playerID, mapSize, chunked)
+	// From here on messages are queued and sent by a goroutine of the player's
+	// own, so a slow client never holds up the room. The compressor is set
+	// before, as the gRPC stream must not be used by two goroutines.
+	out = newOutboundStream(stream, s.metrics)
+	stream = out
 	log.Printf("Sending initial map to player %s ('%s')", playerID, username)
 	if err := stream.Send(mapMessage); err != nil {
 		log.Printf("Error sending initial map to %s: %v", playerID, err)
 		return err
 	}
+	rm.recordSend(mapSize)
+
+	// Only now, with the compressor chosen and the map queued first, may
+	// broadcasts reach the stream. The state below is read after this, so no
+	// delta between it and the first broadcast is missed.
+	if resumed {
+		rm.replaceStream(playerID, stream)
+	} else {
+		rm.addStream(playerID, stream)
+	}
 
 	// Send Initial State Delta (unchanged)
-	initialDelta := s.state.GetInitialStateDelta()
+	initialDelta := rm.state.GetInitialStateDelta()
 	if len(initialDelta.UpdatedPlayers) > 0 {
 		initialStateMessage := &pb.ServerMessage{Message: &pb.ServerMessage_DeltaUpdate{DeltaUpdate: initialDelta}}
 		log.Printf("Sending initial state delta (%d players) to player %s ('%s')", len(initialDelta.UpdatedPlayers), playerID, username)
@@ -121,149 +492,343 @@ func (s *gameServer) GameStream(stream pb.GameService_GameStreamServer) error {
 			log.Printf("Error sending initial state delta to %s: %v", playerID, err)
 			return err
 		}
+		rm.recordSend(proto.Size(initialStateMessage))
+	}
+	if msg, ok := rm.remoteStateMessage(); ok {
+		if err := stream.Send(msg); err != nil {
+			log.Printf("Error sending remote players to %s: %v", playerID, err)
+			return err
+		}
+		rm.recordSend(proto.Size(msg))
+	}
+
+	if chunked {
+		rm.startChunkView(playerID)
+	}
+	if helloMsg.GetSupportsPartialPlayers() {
+		rm.acceptPartialPlayers(playerID)
 	}
 
 	// Let other players know about the new player
-	s.broadcastDeltaState()
-	log.Printf("Player %s ('%s') connected successfully. Total streams: %d", playerID, username, len(s.activeStreams))
+	rm.broadcastDeltaState()
+	rm.broadcastScoreboard()
+	if resumed { // The scoreboard did not change, but the new client has none
+		rm.broadcastTo(&pb.ServerMessage{Message: &pb.ServerMessage_Scoreboard{Scoreboard: rm.state.Scoreboard()}}, "scoreboard",
+			func(id string) bool { return id == playerID })
+	}
+	if rm.tutorial != nil {
+		if player, ok := rm.state.GetPlayer(playerID); ok {
+			rm.startTutorial(player)
+		}
+	}
+	if s.global != nil {
+		s.global.announcePresence(playerID, username, roomID, true)
+	}
+	if msg, ok := rm.countdownMessage(); ok {
+		rm.broadcastTo(msg, "countdown", func(id string) bool { return id == playerID })
+	}
+	if msg, ok := rm.tagMessage(); ok {
+		rm.broadcastTo(msg, "tag", func(id string) bool { return id == playerID })
+	}
+	rm.sendChatBackfill(playerID, rm.chat)
+	if s.global != nil {
+		rm.sendChatBackfill(playerID, s.global.history)
+	}
+	s.sendAnnouncements(rm, playerID)
+	if s.udp != nil && helloMsg.GetSupportsUdpSnapshots() {
+		rm.broadcastTo(s.udp.offer(playerID, address), "UDP offer", func(id string) bool { return id == playerID })
+	}
+	if rm.paused() {
+		rm.broadcastTo(rm.pauseMessage(), "pause state", func(id string) bool { return id == playerID })
+	}
+	log.Printf("Player %s ('%s') connected successfully to room %s. Total streams: %d", playerID, username, roomID, rm.streamCount())
+	sess := &playerSession{playerID: playerID, username: username, roomID: roomID, address: address, room: rm, macros: macroBook{}}
 
 	// --- Receive Loop ---
+	// Messages are received on their own goroutine so a kick can end the
+	// stream even while the client is silent.
+	kicked := s.kicks.watch(playerID, username, address)
+	defer s.kicks.forget(playerID, kicked)
+	received := make(chan receivedMessage)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			select {
+			case received <- receivedMessage{msg: msg, err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
 	for {
-		clientMsg, err := stream.Recv()
+		var clientMsg *pb.ClientMessage
+		var err error
+		select {
+		case d := <-kicked:
+			return rm.endStream(playerID, username, d)
+		case <-out.failed:
+			log.Printf("Error sending to %s ('%s'): %v", playerID, username, out.Err())
+			return out.Err()
+		case r := <-received:
+			clientMsg, err = r.msg, r.err
+		}
 		if err != nil { // Handle EOF and other errors
 			if err == io.EOF {
 				log.Printf("Player %s ('%s') disconnected (EOF).", playerID, username)
 			} else {
 				log.Printf("Error receiving from %s ('%s'): %v", playerID, username, err)
+				s.metrics.streamErrors.Add(1)
+				s.rooms.captures.recordError(roomID, playerID, "receive: %v", err)
 			}
 			return err // Return error (or nil for EOF) to trigger defer
 		}
+		if ban, banned := s.sanctions.active(pb.SanctionKind_SANCTION_BAN, username, address); banned {
+			return rm.endStream(playerID, username, banDisconnect(ban))
+		}
+		if !s.joins.owns(join) {
+			return status.Error(codes.Aborted, "superseded by a replayed join")
+		}
 
-		// Process based on ClientMessage type
-		if playerInputMsg := clientMsg.GetPlayerInput(); playerInputMsg != nil {
-			_, ok := s.state.ApplyInput(playerID, playerInputMsg.Direction)
-			if ok {
-				s.broadcastDeltaState() // Broadcast movement/state changes
-			} else {
-				log.Printf("Failed input for %s ('%s')", playerID, username)
-			}
-		} else if chatReq := clientMsg.GetSendChatMessage(); chatReq != nil {
-			// *** ADDED: Handle incoming chat message ***
-			chatText := strings.TrimSpace(chatReq.GetMessageText())
-			// Basic validation (e.g., non-empty, length limit)
-			if chatText != "" && len(chatText) < 200 { // Limit chat message length
-				// Retrieve sender's username (should exist)
-				senderUsername := username // Use username established at connection
-				log.Printf("Chat from %s ('%s'): %s", playerID, senderUsername, chatText)
-				// Broadcast the chat message to everyone
-				s.broadcastChatMessage(senderUsername, chatText)
-			} else {
-				log.Printf("Player %s ('%s') sent invalid chat message (empty or too long).", playerID, username)
-			}
-		} else if clientMsg.GetClientHello() != nil {
-			log.Printf("Warning: Player %s ('%s') sent unexpected ClientHello.", playerID, username)
-		} else {
-			log.Printf("Warning: Player %s ('%s') sent unknown message type.", playerID, username)
+		s.handleClientMessage(sess, clientMsg)
+		if s.moves.shouldKick(playerID) {
+			log.Printf("Player %s ('%s') disconnected: moving faster than allowed.", playerID, username)
+			rm.emitEvent(game.EventKicked, playerID, map[string]any{"reason": "speed"})
+			return status.Error(codes.PermissionDenied, "disconnected for sending movement faster than allowed")
 		}
 	}
 }
 
-func (s *gameServer) addStream(playerID string, stream pb.GameService_GameStreamServer) {
-	s.muStreams.Lock()
-	defer s.muStreams.Unlock()
-	s.activeStreams[playerID] = stream
-	log.Printf("Stream added for player %s. Total streams: %d", playerID, len(s.activeStreams))
+// receivedMessage is the result of one Recv on a game stream.
+type receivedMessage struct {
+	msg *pb.ClientMessage
+	err error
 }
-func (s *gameServer) removeStream(playerID string) {
-	s.muStreams.Lock()
-	defer s.muStreams.Unlock()
-	delete(s.activeStreams, playerID)
-	log.Printf("Stream removed for player %s. Total streams: %d", playerID, len(s.activeStreams))
-}
-func (s *gameServer) broadcastDeltaState() { /* ... (no change needed here) ... */
-	delta, changed := s.state.GenerateDeltaUpdate()
-	if !changed {
-		return
-	}
-	s.muStreams.Lock()
-	defer s.muStreams.Unlock()
-	if len(s.activeStreams) == 0 {
+
+// handleClientMessage processes one in-game message from a joined player.
+func (s *gameServer) handleClientMessage(sess *playerSession, clientMsg *pb.ClientMessage) {
+	playerID, username, roomID, rm := sess.playerID, sess.username, sess.roomID, sess.room
+	captures := s.rooms.captures
+	captures.record("input", "", roomID, playerID, clientMsg, "")
+	if refusedWhilePaused(clientMsg) && rm.paused() {
+		if playerInputMsg := clientMsg.GetPlayerInput(); playerInputMsg != nil {
+			rm.correct(playerID, playerInputMsg.GetSeq(), nil)
+		}
 		return
 	}
-	deltaMessage := &pb.ServerMessage{Message: &pb.ServerMessage_DeltaUpdate{DeltaUpdate: delta}}
-	deadStreams := []string{}
-	for playerID, stream := range s.activeStreams {
-		err := stream.Send(deltaMessage)
-		if err != nil {
-			log.Printf("Error sending delta to %s: %v. Marking.", playerID, err)
-			deadStreams = append(deadStreams, playerID)
+	if playerInputMsg := clientMsg.GetPlayerInput(); playerInputMsg != nil {
+		s.recordInputLatency(playerID, playerInputMsg, time.Now())
+		seq := playerInputMsg.GetSeq()
+		if rm.holding() {
+			rm.correct(playerID, seq, nil)
+			return // Nobody moves before a synchronized start
 		}
-	}
-	for _, playerID := range deadStreams {
-		delete(s.activeStreams, playerID)
-		log.Printf("Dead stream removed during delta broadcast for %s. Total: %d", playerID, len(s.activeStreams))
+		if !s.moves.allow(playerID, playerInputMsg.Direction) {
+			if s.moves.strike(playerID) {
+				log.Printf("Player %s ('%s') had %d inputs refused within %v: moving faster than allowed.", playerID, username, moveViolationLimit, moveViolationWindow)
+				rm.emitEvent(game.EventSpeedViolation, playerID, map[string]any{"refused": moveViolationLimit, "window_seconds": moveViolationWindow.Seconds()})
+			}
+			rm.correct(playerID, seq, nil)
+			return
+		}
+		player, mispredicted, err := rm.state.ApplyInputPredicted(playerID, playerInputMsg.Direction)
+		if errors.Is(err, game.ErrPlayerNotFound) {
+			log.Printf("Failed input for %s ('%s'): %v", playerID, username, err)
+			captures.recordError(roomID, playerID, "input: %v", err)
+		} else {
+			if mispredicted {
+				rm.correct(playerID, seq, player)
+			}
+			rm.broadcastInputChanges() // Broadcast movement/state changes (a blocked move still turns the player)
+		}
+	} else if chatReq := clientMsg.GetSendChatMessage(); chatReq != nil {
+		// *** ADDED: Handle incoming chat message ***
+		chatText := strings.TrimSpace(chatReq.GetMessageText())
+		// Basic validation (e.g., non-empty, length limit)
+		if mute, muted := s.sanctions.active(pb.SanctionKind_SANCTION_MUTE, username, sess.address); muted {
+			log.Printf("Chat from %s ('%s') dropped: muted by %s.", playerID, username, mute.ID)
+			rm.sendSystemChat(playerID, fmt.Sprintf("You are muted until %s.", mute.ExpiresAt.UTC().Format("15:04 MST")))
+		} else if chatText != "" && len(chatText) <= maxChatLength {
+			// Retrieve sender's username (should exist)
+			senderUsername := username // Use username established at connection
+			if chatReq.GetChannel() == pb.ChatChannel_CHAT_CHANNEL_GLOBAL {
+				if s.global == nil {
+					log.Printf("Player %s ('%s') sent global chat but the global channel is disabled.", playerID, username)
+				} else if !s.global.sendChat(playerID, senderUsername, roomID, chatText) {
+					log.Printf("Global chat from %s ('%s') dropped (opted out or rate limited).", playerID, username)
+				} else {
+					log.Printf("Global chat from %s ('%s'): %s", playerID, senderUsername, chatText)
+				}
+			} else if !s.chatLimiter.allow(playerID) {
+				log.Printf("Chat from %s ('%s') dropped: rate limited.", playerID, username)
+				rm.sendSystemChat(playerID, "You are sending messages too fast; wait a moment.")
+			} else {
+				log.Printf("Chat from %s ('%s'): %s", playerID, senderUsername, chatText)
+				// Broadcast the chat message to everyone in the room
+				rm.broadcastChatMessage(playerID, senderUsername, chatText)
+				rm.tutorialEvent(triggerChat)
+			}
+		} else {
+			log.Printf("Player %s ('%s') sent invalid chat message (empty or too long).", playerID, username)
+			captures.recordError(roomID, playerID, "chat message empty or too long")
+		}
+	} else if clientMsg.GetRespawnRequest() != nil {
+		if err := rm.respawn(playerID); err != nil {
+			log.Printf("Respawn request from %s ('%s') rejected: %v", playerID, username, err)
+			captures.recordError(roomID, playerID, "respawn: %v", err)
+		} else {
+			rm.tutorialEvent(triggerRespawn)
+		}
+	} else if clientMsg.GetInteract() != nil {
+		if err := rm.state.Interact(playerID); err == nil {
+			rm.broadcastDeltaState()
+		} else if errors.Is(err, game.ErrPlayerNotFound) {
+			log.Printf("Interact from %s ('%s') failed: %v", playerID, username, err)
+			captures.recordError(roomID, playerID, "interact: %v", err)
+		}
+	} else if attackReq := clientMsg.GetAttack(); attackReq != nil {
+		rm.attack(sess, attackReq)
+	} else if emoteReq := clientMsg.GetEmote(); emoteReq != nil {
+		rm.emote(sess, emoteReq.GetKind())
+	} else if syncReq := clientMsg.GetTimeSync(); syncReq != nil {
+		s.answerTimeSync(sess, syncReq)
+	} else if pong := clientMsg.GetPong(); pong != nil {
+		s.handlePong(sess, pong)
+	} else if report := clientMsg.GetDesyncReport(); report != nil {
+		s.handleDesyncReport(sess, report)
+	} else if macroReq := clientMsg.GetRegisterMacro(); macroReq != nil {
+		s.registerMacro(sess, macroReq)
+	} else if runReq := clientMsg.GetRunMacro(); runReq != nil {
+		s.runMacro(sess, runReq.GetName())
+	} else if pref := clientMsg.GetGlobalChannelPreference(); pref != nil {
+		if s.global != nil {
+			rejoined := !pref.GetOptOut() && !s.global.subscribed(playerID)
+			s.global.setOptOut(playerID, pref.GetOptOut())
+			if rejoined {
+				rm.sendChatBackfill(playerID, s.global.history)
+			}
+		}
+	} else if clientMsg.GetClientHello() != nil {
+		log.Printf("Warning: Player %s ('%s') sent unexpected ClientHello.", playerID, username)
+		captures.recordError(roomID, playerID, "unexpected ClientHello")
+	} else {
+		log.Printf("Warning: Player %s ('%s') sent unknown message type.", playerID, username)
+		captures.recordError(roomID, playerID, "unknown message type")
 	}
 }
 
-// *** NEW: Function to broadcast chat messages ***
-func (s *gameServer) broadcastChatMessage(senderUsername, messageText string) {
-	s.muStreams.Lock() // Lock stream map for iteration
-	defer s.muStreams.Unlock()
-
-	if len(s.activeStreams) == 0 {
-		return // No one to send to
+// gameTick advances every room and tears down rooms that are no longer needed.
+// It returns how long the tick took.
+func (s *gameServer) gameTick() time.Duration {
+	start := time.Now()
+	rooms := s.rooms.all()
+	interval := s.governor.interval()
+	// Rooms share nothing but locked server-wide services, so they tick in
+	// parallel and a busy room does not delay the others.
+	var wg sync.WaitGroup
+	for _, r := range rooms {
+		wg.Add(1)
+		go func(r *room) {
+			defer wg.Done()
+			r.tickWithinBudget(interval)
+		}(r)
 	}
-
-	chatMsgProto := &pb.ChatMessage{
-		SenderUsername: senderUsername,
-		MessageText:    messageText,
+	wg.Wait()
+	if s.shards != nil {
+		s.tickHandoffs()
 	}
-	serverMsg := &pb.ServerMessage{
-		Message: &pb.ServerMessage_ChatMessage{ChatMessage: chatMsgProto},
+	if s.udp != nil {
+		s.udp.sendSnapshots(rooms)
 	}
-
-	deadStreams := []string{}
-	for playerID, stream := range s.activeStreams {
-		err := stream.Send(serverMsg)
-		if err != nil {
-			log.Printf("Error sending chat message to player %s: %v. Marking stream.", playerID, err)
-			deadStreams = append(deadStreams, playerID)
-		}
-	}
-
-	// Clean up dead streams
-	for _, playerID := range deadStreams {
-		delete(s.activeStreams, playerID)
-		log.Printf("Dead stream removed during chat broadcast for player %s. Total streams: %d", playerID, len(s.activeStreams))
-	}
-}
-
-func (s *gameServer) gameTick() { /* ... (no change needed here) ... */
-	playerIds := s.state.GetAllPlayerIDs()
-	stateChangedDuringTick := false
-	for _, playerID := range playerIds {
-		trackedPlayer, exists := s.state.GetTrackedPlayer(playerID)
-		if !exists {
-			continue
-		}
-		isMoving := trackedPlayer.LastDirection != pb.PlayerInput_UNKNOWN
-		inputTimedOut := time.Since(trackedPlayer.LastInputTime) > movementTimeout
-		if isMoving && inputTimedOut {
-			updated := s.state.UpdatePlayerDirection(playerID, pb.PlayerInput_UNKNOWN)
-			if updated {
-				stateChangedDuringTick = true
-			}
-		}
+	players := 0
+	for _, r := range rooms {
+		players += r.state.PlayerCount()
 	}
-	if stateChangedDuringTick {
-		s.broadcastDeltaState()
+	for _, id := range s.rooms.reap(time.Now()) {
+		s.kicks.kick(id, roomExpiredDisconnect())
 	}
+	elapsed := time.Since(start)
+	s.tickHistory.record(elapsed)
+	s.history.observeTick(elapsed, interval, players, len(rooms), s.metrics.bytesSent.Load())
+	s.alerts.observe(observation{now: time.Now(), players: players, tickElapsed: elapsed, tickInterval: interval, errorsTotal: s.metrics.streamErrors.Load()})
+	return elapsed
 }
 
 func main() { /* ... (no change needed here) ... */
 	ipFlag := flag.String("ip", "192.168.41.108", "IP address")
 	portFlag := flag.String("port", "50051", "Port")
+	globalFlag := flag.Bool("global-chat", false, "Enable the cross-room global chat and presence channel")
+	webAddrFlag := flag.String("web-addr", "", "Address to serve gRPC-Web, WebSocket streams and the REST/JSON API on for browsers and tools (e.g. 0.0.0.0:8081); empty disables it")
+	webOriginsFlag := flag.String("web-origins", "", "Comma-separated origins, such as https://play.example.com, whose pages may call -web-addr besides its own; * allows any")
+	compressionFlag := flag.String("compression", "gzip", "Compressor for large snapshots, maps and streams of large maps, used with clients that accept it (gzip or none)")
+	compressMinFlag := flag.Int("compress-min-bytes", 16*1024, "Smallest unary response or initial map, in bytes, that is compressed")
+	udpAddrFlag := flag.String("udp-addr", "", "Experimental: address to send position snapshots over UDP from (e.g. 0.0.0.0:50052), for clients that ask; empty disables it")
+	adminAddrFlag := flag.String("admin-addr", "", "Address for the admin HTTP status page (e.g. 127.0.0.1:8080); empty disables it")
+	chatDirFlag := flag.String("chat-history-dir", "", "Directory to persist lobby, world and global chat history in; empty keeps it in memory only")
+	metricsFileFlag := flag.String("metrics-file", "", "File to persist downsampled metrics history in; empty keeps it in memory only")
+	alertWebhookFlag := flag.String("alert-webhook", "", "URL to POST alert JSON to")
+	alertDiscordFlag := flag.String("alert-discord", "", "Discord webhook URL for alerts")
+	devRPCsFlag := flag.Bool("dev-rpcs", false, "Enable development-only RPCs (Simulate)")
+	adminTokenFlag := flag.String("admin-token", "", "Bearer token for AdminService RPCs; empty disables the admin service")
+	tokenFileFlag := flag.String("token-file", "", "File to persist issued API tokens in; empty keeps them in memory only")
+	sanctionStoreFlag := flag.String("sanctions-store", "", "Where to persist mutes and bans: a file, or a Redis URL such as redis://localhost:6379/0; servers sharing it enforce the same sanctions")
+	matchSizeFlag := flag.Int("match-size", defaultMatchSize, "Players per room started by FindMatch matchmaking")
+	worldDirFlag := flag.String("world-dir", "", "Directory to save the lobby and map worlds in and restore them from at startup; empty disables it")
+	accountsFlag := flag.String("accounts", "", "Enable player accounts stored in Postgres (a postgres:// URL; migrations run at startup) or \"memory\" for development; empty disables them")
+	clusterFlag := flag.String("cluster", "", "Redis URL, such as redis://localhost:6379/0, through which servers share the lobby and map worlds so their players meet; empty disables it")
+	lanFlag := flag.Bool("lan", false, "Advertise the server on the local network with mDNS, so clients find it with --lan")
+	registryFlag := flag.String("registry", "", "Address of a server registry (cmd/registry) to list this server in for server browsers; empty disables it")
+	registryTokenFlag := flag.String("registry-token", "", "Token the registry requires of servers registering")
+	serverNameFlag := flag.String("server-name", "", "Name shown in server browsers and LAN discovery; defaults to the host name")
+	publicAddrFlag := flag.String("public-addr", "", "Address clients reach this server at, as listed in the registry; defaults to -ip:-port")
+	regionFlag := flag.String("region", "", "Region shown in server browsers, such as eu-west")
+	shardsFlag := flag.String("shards", "", "JSON file splitting a map's world into zones hosted by different servers, shared by all of them; empty disables sharding")
+	shardZoneFlag := flag.String("shard-zone", "", "Zone of the -shards world this server hosts")
+	playerStoreFlag := flag.String("player-store", "", "Where to keep player positions across restarts: \"memory\" or a Redis URL such as redis://localhost:6379/0 shared by several servers; empty disables it")
+	worldSaveFlag := flag.Duration("world-save-interval", defaultWorldSaveInterval, "How often -world-dir snapshots are written")
+	webhooksFlag := flag.String("webhooks", "", "Comma-separated URLs to POST game events to as JSON (Discord and Slack webhooks get chat messages); empty disables them")
+	webhookEventsFlag := flag.String("webhook-events", strings.Join(defaultWebhookEvents, ","), "Comma-separated event types sent to -webhooks, such as player_joined, player_left, match_started, match_ended and server_error")
+	eventLogFlag := flag.String("event-log", "", "Structured game event log: \"stdout\" for JSON lines on stdout, or a file to append them to; empty disables it")
+	maxRewindFlag := flag.Duration("max-rewind", defaultMaxRewind, "Longest lag compensation applied when judging tags and attacks")
+	sleepAfterFlag := flag.Duration("sleep-after", defaultSleepAfter, "Stop simulating a room once nobody has played in or watched it for this long; 0 keeps empty rooms ticking")
+	randomItemsFlag := flag.Int("random-items", 0, "Random coins, hearts and power-ups kept on every room's map, on top of the items maps place; 0 places none")
+	aiBudgetFlag := flag.Int("ai-budget", game.DefaultAIBudget, "Tiles NPC pathfinding may expand per tick in each room; searches past it fail until the next tick")
+	botsFlag := flag.Int("bots", 0, "Keep the lobby and map worlds at this many players or more with server-side bots, which leave as people join; 0 disables bots")
+	kickSpeedersFlag := flag.Bool("kick-speeders", false, "Disconnect players who keep sending movement faster than the server allows; otherwise their extra inputs are only dropped and logged")
+	publishPingFlag := flag.Bool("publish-ping", false, "Include each player's measured round trip in the player data every client receives, for ping displays; otherwise it is only shown on the status page")
+	assetsFlag := flag.String("assets", "", "Directory of the client art (client/assets, or one with a manifest.json) to describe and hash in GetAssetManifest; empty describes the standard assets without hashes")
+	botRouteFlag := flag.String("bot-route", "", "Route bots walk in a loop, such as \"right:5,down:3,wait:2,left:5,up:3\" (counts are inputs, 10 a second); empty walks at random")
+	roomTickBudgetFlag := flag.Float64("room-tick-budget", defaultRoomTickBudget, "Share of the tick interval one room may spend ticking, averaged over 10s; 0 is unlimited")
+	roomBandwidthBudgetFlag := flag.Int64("room-bandwidth-budget", 0, "Bytes per second one room may send to its players and spectators, averaged over 10s; 0 is unlimited")
+	roomBudgetWarnOnlyFlag := flag.Bool("room-budget-warn-only", false, "Only log rooms over -room-tick-budget or -room-bandwidth-budget instead of throttling them")
+	consoleFlag := flag.Bool("console", false, "Read operator commands (list, kick, tp, say, reloadmap) from standard input; type help for details")
+	statusAuthFlag := flag.Bool("status-auth", false, "Require an admin or read-status API token for the admin HTTP pages")
+	auditFlag := flag.Bool("audit", false, "Enable concurrency audit checks (development servers only)")
+	tilesFlag := flag.String("tiles", "", "JSON file of tile definitions applied to every map; empty uses the built-in table")
+	mapsFlag := flag.String("maps", game.MapFilePath, "Comma-separated map files rooms may use; the first hosts the lobby")
+	faultDelayFlag := flag.Duration("fault-delay", 0, "Testing: delay every message the server streams by this much, to simulate a slow network")
+	faultJitterFlag := flag.Duration("fault-jitter", 0, "Testing: delay streamed messages by up to this much more, at random")
+	faultDropFlag := flag.Float64("fault-drop", 0, "Testing: chance from 0 to 1 of dropping each streamed message after the first")
+	faultDisconnectFlag := flag.Float64("fault-disconnect", 0, "Testing: chance from 0 to 1, at each streamed message, of ending the stream as UNAVAILABLE")
+	faultMetadataFlag := flag.Bool("fault-metadata", false, "Testing: let clients choose their own faults with fault-delay, fault-jitter, fault-drop and fault-disconnect stream metadata")
+	exportFixturesFlag := flag.String("export-fixtures", "", "Write the protocol descriptors and golden messages built on the lobby map to this directory, then exit")
 	flag.Parse()
+	if *tilesFlag != "" {
+		if err := game.LoadTileDefinitions(*tilesFlag); err != nil {
+			log.Fatalf("Tile definitions failed: %v", err)
+		}
+	}
+	if *exportFixturesFlag != "" {
+		if err := exportFixtures(*exportFixturesFlag, strings.Split(*mapsFlag, ",")[0]); err != nil {
+			log.Fatalf("Exporting fixtures failed: %v", err)
+		}
+		log.Printf("Protocol fixtures written to %s.", *exportFixturesFlag)
+		return
+	}
 	listenIP := *ipFlag
 	listenPort := *portFlag
 	listenAddress := net.JoinHostPort(listenIP, listenPort)
@@ -271,20 +836,102 @@ func main() { /* ... (no change needed here) ... */
 	if err != nil {
 		log.Fatalf("Listen failed: %v", err)
 	}
-	grpcServer := grpc.NewServer()
-	gServer, err := NewGameServer()
+	web := newWebGateway(strings.Split(*webOriginsFlag, ","))
+	gServer, err := NewGameServer(serverConfig{
+		mapPaths:      strings.Split(*mapsFlag, ","),
+		enableGlobal:  *globalFlag,
+		metricsFile:   *metricsFileFlag,
+		chatDir:       *chatDirFlag,
+		alertWebhook:  *alertWebhookFlag,
+		alertDiscord:  *alertDiscordFlag,
+		audit:         *auditFlag,
+		devRPCs:       *devRPCsFlag,
+		adminToken:    *adminTokenFlag,
+		tokenFile:     *tokenFileFlag,
+		sanctionStore: *sanctionStoreFlag,
+		matchSize:     *matchSizeFlag,
+		maxRewind:     *maxRewindFlag,
+		sleepAfter:    *sleepAfterFlag,
+		randomItems:   *randomItemsFlag,
+		aiBudget:      *aiBudgetFlag,
+		bots:          *botsFlag,
+		botRoute:      *botRouteFlag,
+		assetDir:      *assetsFlag,
+		kickSpeeders:  *kickSpeedersFlag,
+		publishPing:   *publishPingFlag,
+		eventLog:      *eventLogFlag,
+		webhooks:      *webhooksFlag,
+		hookEvents:    strings.Split(*webhookEventsFlag, ","),
+		compressor:    *compressionFlag,
+		compressMin:   *compressMinFlag,
+		worldDir:      *worldDirFlag,
+		worldSave:     *worldSaveFlag,
+		playerStore:   *playerStoreFlag,
+		cluster:       *clusterFlag,
+		shards:        *shardsFlag,
+		shardZone:     *shardZoneFlag,
+		accounts:      *accountsFlag,
+		statusAuth:    *statusAuthFlag,
+		roomBudget: roomBudgetConfig{
+			tickShare:   *roomTickBudgetFlag,
+			bytesPerSec: *roomBandwidthBudgetFlag,
+			throttle:    !*roomBudgetWarnOnlyFlag,
+		},
+	})
 	if err != nil {
 		log.Fatalf("Server creation failed: %v", err)
 	}
+	serverOptions := []grpc.ServerOption{
+		grpc.UnaryInterceptor(gServer.compression.unaryInterceptor),
+		grpc.StatsHandler(compressionStats{metrics: gServer.metrics}),
+		grpc.ForceServerCodecV2(newPreparedCodec()),
+	}
+	faults := faultConfig{delay: *faultDelayFlag, jitter: *faultJitterFlag, drop: *faultDropFlag, disconnect: *faultDisconnectFlag, metadata: *faultMetadataFlag}
+	if faults.active() || faults.metadata {
+		log.Printf("Warning: injecting network faults into streams (%+v); do not use in production.", faults)
+		serverOptions = append(serverOptions, grpc.StreamInterceptor(faults.streamInterceptor))
+	}
+	grpcServer := grpc.NewServer(serverOptions...)
 	pb.RegisterGameServiceServer(grpcServer, gServer)
-	log.Printf("Starting tick loop (Rate: %v)", tickRate)
-	ticker := time.NewTicker(tickRate)
-	defer ticker.Stop()
-	go func() {
-		for range ticker.C {
-			gServer.gameTick()
+	pb.RegisterGameServiceServer(web, gServer)
+	if *adminTokenFlag != "" {
+		pb.RegisterAdminServiceServer(grpcServer, &adminServer{game: gServer})
+		pb.RegisterAdminServiceServer(web, &adminServer{game: gServer})
+	}
+	if *webAddrFlag != "" {
+		go web.serve(*webAddrFlag)
+	}
+	if *udpAddrFlag != "" {
+		if gServer.udp, err = listenUDP(*udpAddrFlag); err != nil {
+			log.Fatalf("Failed to listen for UDP snapshots: %v", err)
 		}
-	}()
+		go gServer.udp.serve()
+	}
+	if *adminAddrFlag != "" {
+		go gServer.serveAdminHTTP(*adminAddrFlag)
+	}
+	serverName := *serverNameFlag
+	if serverName == "" {
+		serverName, _ = os.Hostname()
+	}
+	if *lanFlag {
+		if err := gServer.advertiseLAN(serverName, listenAddress); err != nil {
+			log.Printf("Warning: LAN discovery disabled: %v", err)
+		}
+	}
+	if *registryFlag != "" {
+		reg := registration{registry: *registryFlag, token: *registryTokenFlag, name: serverName, address: *publicAddrFlag, region: *regionFlag}
+		if reg.address == "" {
+			reg.address = listenAddress
+		}
+		go gServer.registerPeriodically(reg)
+	}
+	log.Printf("Starting tick loop (Rate: %v)", tickRate)
+	go gServer.runTickLoop()
+	go gServer.handleReloadSignals()
+	if *consoleFlag {
+		go gServer.runConsole(os.Stdin, os.Stdout)
+	}
 	log.Printf("Starting gRPC server on %s...", listenAddress)
 	if err := grpcServer.Serve(lis); err != nil {
 		log.Fatalf("Serve failed: %v", err)
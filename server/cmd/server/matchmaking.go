@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	matchRoomMode       = "match"
+	defaultMatchSize    = 4
+	matchLifetime       = time.Hour
+	maxMatchQueueLength = 256 // Per map
+)
+
+// matchTicket is one player's place in a matchmaking queue. Position updates
+// are latest-wins; the result is delivered exactly once.
+type matchTicket struct {
+	positions chan *pb.QueuePosition
+	result    chan matchResult
+}
+
+type matchResult struct {
+	found *pb.MatchFound
+	err   error
+}
+
+// offerPosition replaces any position update the player has not read yet.
+func (t *matchTicket) offerPosition(pos *pb.QueuePosition) {
+	select {
+	case <-t.positions:
+	default:
+	}
+	t.positions <- pos
+}
+
+// matchmaker groups queued players into private match rooms of a fixed size,
+// with one queue per map.
+type matchmaker struct {
+	mu     sync.Mutex
+	rooms  *roomManager
+	size   int
+	queues map[string][]*matchTicket // Map name -> waiting players, longest waiting first
+}
+
+func newMatchmaker(rooms *roomManager, size int) *matchmaker {
+	if size < 1 || size > maxPlayersLimit {
+		size = defaultMatchSize
+	}
+	return &matchmaker{rooms: rooms, size: size, queues: make(map[string][]*matchTicket)}
+}
+
+// enqueue adds a player to the queue for a map, starting a match if the queue
+// is now full. Errors are gRPC status errors.
+func (mm *matchmaker) enqueue(mapName string) (*matchTicket, error) {
+	if mapName == "" {
+		mapName = mm.rooms.lobbyMap()
+	}
+	if _, ok := mm.rooms.allowedMaps[mapName]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "map %q is not hosted on this server", mapName)
+	}
+	t := &matchTicket{positions: make(chan *pb.QueuePosition, 1), result: make(chan matchResult, 1)}
+
+	mm.mu.Lock()
+	queue := mm.queues[mapName]
+	if len(queue) >= maxMatchQueueLength {
+		mm.mu.Unlock()
+		return nil, status.Errorf(codes.ResourceExhausted, "the %s queue is full, try again later", mapName)
+	}
+	queue = append(queue, t)
+	var matched []*matchTicket
+	if len(queue) >= mm.size {
+		matched, queue = queue[:mm.size:mm.size], queue[mm.size:]
+	}
+	mm.queues[mapName] = queue
+	mm.notifyLocked(mapName)
+	mm.mu.Unlock()
+
+	if matched != nil {
+		go mm.startMatch(mapName, matched)
+	}
+	return t, nil
+}
+
+// leave removes a player who stopped waiting. It is a no-op once the player
+// has been matched.
+func (mm *matchmaker) leave(mapName string, t *matchTicket) {
+	if mapName == "" {
+		mapName = mm.rooms.lobbyMap()
+	}
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	queue := mm.queues[mapName]
+	if i := slices.Index(queue, t); i >= 0 {
+		mm.queues[mapName] = slices.Delete(queue, i, i+1)
+		mm.notifyLocked(mapName)
+	}
+}
+
+// notifyLocked tells everyone in a queue their position.
+// Must be called with mm.mu held.
+func (mm *matchmaker) notifyLocked(mapName string) {
+	queue := mm.queues[mapName]
+	for i, t := range queue {
+		t.offerPosition(&pb.QueuePosition{Position: int32(i + 1), QueueSize: int32(len(queue)), MatchSize: int32(mm.size)})
+	}
+}
+
+// startMatch creates the room for a full group and hands it to its players.
+func (mm *matchmaker) startMatch(mapName string, tickets []*matchTicket) {
+	r, err := mm.rooms.createMatch(mapName, len(tickets))
+	var res matchResult
+	if err != nil {
+		log.Printf("Failed to start %s match: %v", mapName, err)
+		res.err = err
+	} else {
+		res.found = &pb.MatchFound{Room: r.info(), RoomPassword: r.password}
+	}
+	for _, t := range tickets {
+		t.result <- res
+	}
+}
+
+// createMatch starts a private room for a matched group. Errors are gRPC
+// status errors.
+func (m *roomManager) createMatch(mapName string, players int) (*room, error) {
+	id := newRoomID()
+	r, err := newRoom(id, fmt.Sprintf("Match %s", id), mapName, m.allowedMaps[mapName], m.metrics)
+	if err != nil {
+		return nil, status.Errorf(gameErrorCode(err), "failed to create match: %v", err)
+	}
+	m.prepareRoom(r)
+	r.mode = matchRoomMode
+	r.maxPlayers = players
+	r.password = newInviteCode() // Only given to the matched players
+	r.owner = "matchmaker"
+	r.expiresAt = r.createdAt.Add(matchLifetime)
+	r.start.enabled = true // Held until every matched player is in; see tickMatchStart
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rooms[id] = r
+	log.Printf("Match room %s created on map %s for %d players.", id, mapName, players)
+	return r, nil
+}
+
+// FindMatch implements the server-streaming matchmaking RPC.
+func (s *gameServer) FindMatch(req *pb.FindMatchRequest, stream pb.GameService_FindMatchServer) error {
+	t, err := s.matchmaker.enqueue(req.GetMapName())
+	if err != nil {
+		return err
+	}
+	defer s.matchmaker.leave(req.GetMapName(), t)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case pos := <-t.positions:
+			if err := stream.Send(&pb.MatchmakingUpdate{Update: &pb.MatchmakingUpdate_QueuePosition{QueuePosition: pos}}); err != nil {
+				return err
+			}
+		case res := <-t.result:
+			if res.err != nil {
+				return res.err
+			}
+			return stream.Send(&pb.MatchmakingUpdate{Update: &pb.MatchmakingUpdate_MatchFound{MatchFound: res.found}})
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	metricsSampleInterval = 10 * time.Second
+	metricsHistorySize    = 1080 // Three hours of samples
+	metricsSaveInterval   = 1 * time.Minute
+)
+
+// serverMetrics holds process-wide counters updated from the hot path.
+type serverMetrics struct {
+	bytesSent     atomic.Int64
+	messagesSent  atomic.Int64
+	streamErrors  atomic.Int64 // Failed sends and abnormal receive errors
+	desyncReports atomic.Int64 // Clients reporting a state checksum mismatch
+
+	snapshotsDropped atomic.Int64 // Stale deltas dropped from full outbound queues
+	slowDisconnects  atomic.Int64 // Streams ended for a queue full of other messages
+
+	payloadBytes    atomic.Int64 // gRPC messages sent, before compression
+	compressedBytes atomic.Int64 // The same messages as sent, after any compression
+}
+
+func (m *serverMetrics) recordSend(bytes int) {
+	m.bytesSent.Add(int64(bytes))
+	m.messagesSent.Add(1)
+}
+
+// metricsSample is one downsampled point of server history.
+type metricsSample struct {
+	Time          time.Time `json:"time"`
+	Players       int       `json:"players"`
+	Rooms         int       `json:"rooms"`
+	TickAvgMicros int64     `json:"tick_avg_us"`
+	TickMaxMicros int64     `json:"tick_max_us"`
+	BytesSent     int64     `json:"bytes_sent"`                 // Bytes sent during the sample interval
+	TickInterval  int64     `json:"tick_interval_ms,omitempty"` // Adaptive tick interval at sample time
+}
+
+// metricsHistory keeps a bounded, downsampled history of server metrics and
+// optionally persists it to disk so trends survive restarts.
+type metricsHistory struct {
+	mu      sync.Mutex
+	samples []metricsSample // Oldest first, at most metricsHistorySize
+	path    string          // Empty disables persistence
+
+	// Accumulators for the sample currently being built.
+	intervalStart time.Time
+	tickCount     int64
+	tickTotal     time.Duration
+	tickMax       time.Duration
+	lastBytes     int64
+	lastSaved     time.Time
+}
+
+// newMetricsHistory creates a history, loading previous samples from path if set.
+func newMetricsHistory(path string) *metricsHistory {
+	h := &metricsHistory{path: path, intervalStart: time.Now(), lastSaved: time.Now()}
+	if path == "" {
+		return h
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: Could not read metrics history '%s': %v", path, err)
+		}
+		return h
+	}
+	if err := json.Unmarshal(data, &h.samples); err != nil {
+		log.Printf("Warning: Could not parse metrics history '%s': %v", path, err)
+		h.samples = nil
+	}
+	if len(h.samples) > metricsHistorySize {
+		h.samples = h.samples[len(h.samples)-metricsHistorySize:]
+	}
+	log.Printf("Loaded %d metrics samples from '%s'", len(h.samples), path)
+	return h
+}
+
+// observeTick accumulates one tick and closes the current sample once
+// metricsSampleInterval has elapsed.
+func (h *metricsHistory) observeTick(d, interval time.Duration, players, rooms int, totalBytes int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tickCount++
+	h.tickTotal += d
+	if d > h.tickMax {
+		h.tickMax = d
+	}
+	now := time.Now()
+	if now.Sub(h.intervalStart) < metricsSampleInterval {
+		return
+	}
+	h.samples = append(h.samples, metricsSample{
+		Time:          now,
+		Players:       players,
+		Rooms:         rooms,
+		TickAvgMicros: (h.tickTotal / time.Duration(h.tickCount)).Microseconds(),
+		TickMaxMicros: h.tickMax.Microseconds(),
+		BytesSent:     totalBytes - h.lastBytes,
+		TickInterval:  interval.Milliseconds(),
+	})
+	if len(h.samples) > metricsHistorySize {
+		h.samples = h.samples[len(h.samples)-metricsHistorySize:]
+	}
+	h.intervalStart = now
+	h.tickCount, h.tickTotal, h.tickMax = 0, 0, 0
+	h.lastBytes = totalBytes
+	if h.path != "" && now.Sub(h.lastSaved) >= metricsSaveInterval {
+		h.lastSaved = now
+		if err := h.saveLocked(); err != nil {
+			log.Printf("Warning: Could not save metrics history: %v", err)
+		}
+	}
+}
+
+// saveLocked writes the samples atomically via a temporary file.
+func (h *metricsHistory) saveLocked() error {
+	data, err := json.Marshal(h.samples)
+	if err != nil {
+		return err
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// snapshot returns a copy of the samples, oldest first.
+func (h *metricsHistory) snapshot() []metricsSample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]metricsSample(nil), h.samples...)
+}
+
+// historyHandler serves the metrics history as JSON.
+func (s *gameServer) historyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.history.snapshot()); err != nil {
+		log.Printf("Error encoding metrics history: %v", err)
+	}
+}
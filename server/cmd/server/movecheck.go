@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+const (
+	// Moves each player may make per second, however fast inputs arrive: the
+	// client sends 30 a second, so four per 100ms tick leaves room for
+	// jitter. Inputs that stand still are not counted.
+	maxMovesPerSecond   = 40
+	moveBurst           = 10
+	moveViolationWindow = 10 * time.Second
+	moveViolationLimit  = 100 // Refused inputs per window that flag a player as cheating
+)
+
+// moveGuard caps how fast players move by refusing moving inputs beyond
+// their budget, and flags players whose refused inputs pile up, as a client
+// flooding inputs to run faster would.
+type moveGuard struct {
+	moves *rateLimiter
+	kick  bool // Disconnect flagged players
+
+	mu         sync.Mutex
+	violations map[string]*moveViolations
+}
+
+type moveViolations struct {
+	since   time.Time // Start of the current window
+	count   int
+	flagged bool // Reached moveViolationLimit in this window
+}
+
+func newMoveGuard(kick bool) *moveGuard {
+	return &moveGuard{
+		moves:      newRateLimiter(time.Second/maxMovesPerSecond, moveBurst),
+		kick:       kick,
+		violations: make(map[string]*moveViolations),
+	}
+}
+
+// allow reports whether an input may be applied: standing still always may,
+// moving only within the player's budget, and unknown directions never.
+func (g *moveGuard) allow(playerID string, dir pb.PlayerInput_Direction) bool {
+	if _, known := pb.PlayerInput_Direction_name[int32(dir)]; !known {
+		return false
+	}
+	return dir == pb.PlayerInput_UNKNOWN || g.moves.allow(playerID)
+}
+
+// strike counts a refused input, reporting true when it is the one that
+// flags the player for this window.
+func (g *moveGuard) strike(playerID string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	v, ok := g.violations[playerID]
+	if !ok || now.Sub(v.since) >= moveViolationWindow {
+		v = &moveViolations{since: now}
+		g.violations[playerID] = v
+	}
+	v.count++
+	if v.count == moveViolationLimit {
+		v.flagged = true
+		return true
+	}
+	return false
+}
+
+// shouldKick reports whether a player is flagged and flagged players are
+// disconnected.
+func (g *moveGuard) shouldKick(playerID string) bool {
+	if !g.kick {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	v, ok := g.violations[playerID]
+	return ok && v.flagged
+}
+
+// forget drops a player's budget and violations when they disconnect.
+func (g *moveGuard) forget(playerID string) {
+	g.moves.forget(playerID)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.violations, playerID)
+}
@@ -0,0 +1,12 @@
+package main
+
+// setAIBudget sets how many tiles NPC pathfinding may expand per tick in
+// every room; 0 keeps the game's default.
+func (m *roomManager) setAIBudget(tiles int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.aiBudget = tiles
+	for _, r := range m.rooms {
+		r.state.SetAIBudget(tiles)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+	"simple-grpc-game/server/internal/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	outboundBuffer       = 32              // Messages queued per player stream before stale deltas are dropped
+	outboundMaxBytes     = 4 << 20         // Bytes queued per player stream before it is given up on
+	outboundDrainTimeout = 2 * time.Second // How long an ending stream may take to send what is queued
+)
+
+var (
+	errSlowConsumer   = status.Error(codes.ResourceExhausted, "disconnected for not reading messages")
+	errOutboundClosed = errors.New("stream has ended")
+)
+
+// outboundStream sends a player's messages from a goroutine of its own, so a
+// client slow to read them holds up nobody else's broadcasts. Its queue is
+// bounded: when it is full, the stale queued delta updates are dropped, with
+// whatever in them later deltas do not supersede folded into the latest, so a
+// slow client skips old snapshots and catches up at once. Other messages, such
+// as chat or map chunks, cannot be dropped and queue past the bound; only a
+// client that lets outboundMaxBytes of them pile up is disconnected.
+type outboundStream struct {
+	pb.GameService_GameStreamServer
+	metrics *serverMetrics
+	wake    chan struct{} // Signalled when a message is queued or the stream closes
+	failed  chan struct{} // Closed when sending fails; err says why
+	drained chan struct{} // Closed when the sender has stopped
+
+	mu     sync.Mutex
+	queue  []queuedMessage
+	size   int // Bytes in queue
+	closed bool
+	err    error
+}
+
+// queuedMessage is a marshaled ServerMessage waiting to be sent.
+type queuedMessage struct {
+	data  []byte
+	delta bool
+}
+
+func newOutboundStream(stream pb.GameService_GameStreamServer, metrics *serverMetrics) *outboundStream {
+	o := &outboundStream{
+		GameService_GameStreamServer: stream,
+		metrics:                      metrics,
+		wake:                         make(chan struct{}, 1),
+		failed:                       make(chan struct{}),
+		drained:                      make(chan struct{}),
+	}
+	go o.send()
+	return o
+}
+
+func (o *outboundStream) Send(msg *pb.ServerMessage) error {
+	return o.SendMsg(msg)
+}
+
+// SendMsg queues a ServerMessage, or a broadcast's prepared one, failing only
+// once the stream has.
+func (o *outboundStream) SendMsg(m any) error {
+	var next queuedMessage
+	switch msg := m.(type) {
+	case *preparedMessage:
+		sm, _ := msg.msg.(*pb.ServerMessage)
+		next = queuedMessage{data: msg.data, delta: sm.GetDeltaUpdate() != nil}
+	case *pb.ServerMessage:
+		data, err := proto.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		next = queuedMessage{data: data, delta: msg.GetDeltaUpdate() != nil}
+	default:
+		return fmt.Errorf("cannot send %T on a game stream", m)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	switch {
+	case o.err != nil:
+		return o.err
+	case o.closed:
+		return errOutboundClosed
+	}
+	if len(o.queue) >= outboundBuffer {
+		if dropped := o.compactLocked(&next); dropped > 0 {
+			o.metrics.snapshotsDropped.Add(int64(dropped))
+		}
+	}
+	if o.size+len(next.data) > outboundMaxBytes {
+		o.metrics.slowDisconnects.Add(1)
+		o.failLocked(errSlowConsumer)
+		return errSlowConsumer
+	}
+	o.queue = append(o.queue, next)
+	o.size += len(next.data)
+	o.signal()
+	return nil
+}
+
+// compactLocked makes room by merging every queued delta, and next if it is
+// one, into the latest of them, returning how many stale deltas it dropped.
+// Must be called with o.mu held.
+func (o *outboundStream) compactLocked(next *queuedMessage) int {
+	var deltas [][]byte
+	last := -1 // Queue index of the latest delta; -1 if it is next
+	for i, q := range o.queue {
+		if q.delta {
+			deltas, last = append(deltas, q.data), i
+		}
+	}
+	if next.delta {
+		deltas, last = append(deltas, next.data), -1
+	}
+	if len(deltas) < 2 {
+		return 0
+	}
+	merged, err := mergeDeltas(deltas)
+	if err != nil {
+		log.Printf("Error merging queued deltas: %v", err)
+		return 0
+	}
+	kept := o.queue[:0]
+	o.size = 0
+	for i, q := range o.queue {
+		if i == last {
+			q.data = merged
+		} else if q.delta {
+			continue
+		}
+		kept = append(kept, q)
+		o.size += len(q.data)
+	}
+	clear(o.queue[len(kept):])
+	o.queue = kept
+	if last < 0 {
+		next.data = merged
+	}
+	return len(deltas) - 1
+}
+
+// mergeDeltas returns the marshaled ServerMessages of delta updates, oldest
+// first, as the one delta they amount to.
+func mergeDeltas(deltas [][]byte) ([]byte, error) {
+	var merged *pb.ServerMessage
+	for _, data := range deltas {
+		msg := &pb.ServerMessage{}
+		if err := proto.Unmarshal(data, msg); err != nil {
+			return nil, err
+		}
+		if merged == nil {
+			merged = msg
+		} else {
+			game.MergeDelta(merged.GetDeltaUpdate(), msg.GetDeltaUpdate())
+		}
+	}
+	return proto.Marshal(merged)
+}
+
+func (o *outboundStream) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *outboundStream) failLocked(err error) {
+	if o.err == nil {
+		o.err = err
+		close(o.failed)
+	}
+	clear(o.queue)
+	o.queue, o.size = nil, 0
+}
+
+// Err returns why sending failed, once failed is closed.
+func (o *outboundStream) Err() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.err
+}
+
+// send sends queued messages in order until the stream is closed and its
+// queue is empty, a send fails, or the stream's context ends.
+func (o *outboundStream) send() {
+	defer close(o.drained)
+	done := o.Context().Done()
+	for {
+		o.mu.Lock()
+		if o.err != nil || (o.closed && len(o.queue) == 0) {
+			o.mu.Unlock()
+			return
+		}
+		if len(o.queue) == 0 {
+			o.mu.Unlock()
+			select {
+			case <-o.wake:
+			case <-done:
+				o.mu.Lock()
+				o.failLocked(o.Context().Err())
+				o.mu.Unlock()
+				return
+			}
+			continue
+		}
+		next := o.queue[0]
+		o.queue[0] = queuedMessage{}
+		o.queue = o.queue[1:]
+		o.size -= len(next.data)
+		o.mu.Unlock()
+		if err := o.GameService_GameStreamServer.SendMsg(&preparedMessage{data: next.data}); err != nil {
+			o.mu.Lock()
+			o.failLocked(err)
+			o.mu.Unlock()
+			return
+		}
+	}
+}
+
+// close stops queueing and waits a little for what is queued, such as a
+// disconnect notice, to be sent before the stream ends. If that takes too long
+// the rest is discarded; a send still in progress is ended by the stream's
+// context, which gRPC cancels once the handler returns.
+func (o *outboundStream) close() {
+	o.mu.Lock()
+	o.closed = true
+	o.signal()
+	o.mu.Unlock()
+	select {
+	case <-o.drained:
+	case <-time.After(outboundDrainTimeout):
+		o.mu.Lock()
+		o.failLocked(errOutboundClosed)
+		o.mu.Unlock()
+	}
+}
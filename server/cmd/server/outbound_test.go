@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// stalledStream is a game stream whose client reads nothing until unblock is
+// closed or its context ends.
+type stalledStream struct {
+	pb.GameService_GameStreamServer
+	ctx     context.Context
+	unblock chan struct{}
+	sent    chan []byte
+}
+
+func newStalledStream(ctx context.Context) *stalledStream {
+	return &stalledStream{ctx: ctx, unblock: make(chan struct{}), sent: make(chan []byte, 1024)}
+}
+
+func (s *stalledStream) Context() context.Context { return s.ctx }
+
+func (s *stalledStream) SendMsg(m any) error {
+	select {
+	case <-s.unblock:
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+	s.sent <- m.(*preparedMessage).data
+	return nil
+}
+
+func chatMessage(text string) *pb.ServerMessage {
+	return &pb.ServerMessage{Message: &pb.ServerMessage_ChatMessage{ChatMessage: &pb.ChatMessage{MessageText: text}}}
+}
+
+func TestOutboundQueuesChatBurstPastBuffer(t *testing.T) {
+	stream := newStalledStream(context.Background())
+	out := newOutboundStream(stream, &serverMetrics{})
+	for i := 0; i < outboundBuffer*3; i++ {
+		if err := out.Send(chatMessage("burst")); err != nil {
+			t.Fatalf("chat message %d: %v", i, err)
+		}
+	}
+	close(stream.unblock)
+	for i := 0; i < outboundBuffer*3; i++ {
+		select {
+		case <-stream.sent:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only %d of %d chat messages sent", i, outboundBuffer*3)
+		}
+	}
+	out.close()
+}
+
+func TestOutboundDisconnectsStuckClient(t *testing.T) {
+	stream := newStalledStream(context.Background())
+	defer close(stream.unblock)
+	out := newOutboundStream(stream, &serverMetrics{})
+	big := chatMessage(string(make([]byte, 64<<10)))
+	var err error
+	for i := 0; err == nil && i < 2*outboundMaxBytes/(64<<10); i++ {
+		err = out.Send(big)
+	}
+	if err != errSlowConsumer {
+		t.Errorf("queueing past outboundMaxBytes: err = %v, want errSlowConsumer", err)
+	}
+}
+
+func TestOutboundSenderStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := newStalledStream(ctx)
+	out := newOutboundStream(stream, &serverMetrics{})
+	if err := out.Send(chatMessage("stuck")); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case <-out.drained:
+	case <-time.After(2 * time.Second):
+		t.Fatal("sender still running after the stream's context ended")
+	}
+	if out.Err() == nil {
+		t.Error("stream did not fail after its context ended")
+	}
+}
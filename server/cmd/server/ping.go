@@ -0,0 +1,44 @@
+package main
+
+import (
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+const (
+	pingInterval = 2 * time.Second
+	maxPingRTT   = 10 * time.Second // Longer round trips are stale or forged pongs
+)
+
+// publishPings sets whether every room copies players' smoothed RTTs into
+// the player data clients see.
+func (m *roomManager) publishPings(on bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.publishRTT = on
+	for _, r := range m.rooms {
+		r.state.PublishRTT(on)
+	}
+}
+
+// tickPings sends every player in the room a Ping once per pingInterval.
+func (r *room) tickPings(now time.Time) {
+	if now.Before(r.nextPing) {
+		return
+	}
+	r.nextPing = now.Add(pingInterval)
+	r.broadcast(&pb.ServerMessage{Message: &pb.ServerMessage_Ping{Ping: &pb.Ping{ServerTimeMs: now.UnixMilli()}}}, "ping")
+}
+
+// handlePong measures a player's round trip from the Ping their client
+// echoed, updating their smoothed RTT.
+func (s *gameServer) handlePong(sess *playerSession, pong *pb.Pong) {
+	rtt := time.Since(time.UnixMilli(pong.GetServerTimeMs()))
+	if rtt < 0 || rtt > maxPingRTT {
+		return
+	}
+	if _, changed, err := sess.room.state.RecordRTT(sess.playerID, rtt); err == nil && changed {
+		sess.room.broadcastInputChanges()
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"simple-grpc-game/server/internal/game"
+)
+
+const (
+	playerStoreTimeout  = 2 * time.Second  // Per store call; a slow store must not stall joins
+	playerStoreInterval = 10 * time.Second // How often connected players' positions are saved
+)
+
+// openPlayerStore opens the -player-store target: "memory", a redis:// or
+// rediss:// URL, or nothing for no store.
+func openPlayerStore(target string) (game.Store, error) {
+	switch {
+	case target == "":
+		return nil, nil
+	case target == "memory":
+		return game.NewMemoryStore(), nil
+	case strings.HasPrefix(target, "redis://"), strings.HasPrefix(target, "rediss://"):
+		ctx, cancel := context.WithTimeout(context.Background(), playerStoreTimeout)
+		defer cancel()
+		return game.NewRedisStore(ctx, target)
+	}
+	return nil, fmt.Errorf("player store %q is neither \"memory\" nor a redis:// URL", target)
+}
+
+// usesPlayerStore reports whether players' positions in a room are kept in
+// the store. Only persistent rooms outlive a server, so only theirs are.
+func (s *gameServer) usesPlayerStore(rm *room) bool {
+	return s.store != nil && rm.persistent
+}
+
+// expectStoredPlayer loads a joining player's record so they reappear where
+// they left the room. Store failures are logged and the player spawns
+// normally.
+func (s *gameServer) expectStoredPlayer(ctx context.Context, rm *room, username string) {
+	if !s.usesPlayerStore(rm) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, playerStoreTimeout)
+	defer cancel()
+	rec, ok, err := s.store.LoadPlayer(ctx, rm.id, username)
+	if err != nil {
+		log.Printf("Warning: Could not load player '%s' of room %s from the player store: %v", username, rm.id, err)
+		return
+	}
+	if ok {
+		rm.state.ExpectPlayer(rec.Username, rec.X, rec.Y, rec.SavedAt)
+	}
+}
+
+// storePlayer saves a player's position and session state, logging failures.
+func (s *gameServer) storePlayer(rm *room, playerID string, online bool) {
+	if !s.usesPlayerStore(rm) {
+		return
+	}
+	player, ok := rm.state.GetPlayer(playerID)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), playerStoreTimeout)
+	defer cancel()
+	rec := game.PlayerRecord{
+		Username: player.Username, RoomID: rm.id, X: player.XPos, Y: player.YPos,
+		PlayerID: playerID, Online: online, SavedAt: time.Now().UTC(),
+	}
+	if err := s.store.SavePlayer(ctx, rec); err != nil {
+		log.Printf("Warning: Could not save player %s ('%s') of room %s to the player store: %v", playerID, player.Username, rm.id, err)
+	}
+}
+
+// savePlayersPeriodically saves every connected player of persistent rooms,
+// so a crash loses at most one interval of movement.
+func (s *gameServer) savePlayersPeriodically() {
+	ticker := time.NewTicker(playerStoreInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, rm := range s.rooms.all() {
+			if !s.usesPlayerStore(rm) {
+				continue
+			}
+			for _, p := range rm.state.GetAllPlayers() {
+				if rm.isBot(p.Id) {
+					continue
+				}
+				s.storePlayer(rm, p.Id, true)
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"google.golang.org/grpc/encoding"
+	grpcproto "google.golang.org/grpc/encoding/proto"
+	"google.golang.org/grpc/mem"
+	"google.golang.org/protobuf/proto"
+)
+
+// preparedMessage is a message marshaled once for a broadcast or spectator
+// frame, so the streams it goes to all send the same bytes instead of each
+// marshaling it, which costs a broadcast to N players one marshal instead of
+// N. The bytes are never reused: gRPC may still be writing them after
+// SendMsg returns.
+type preparedMessage struct {
+	msg  proto.Message // For WebSocket JSON clients; broadcasts reuse it once they return
+	data []byte
+}
+
+func prepareMessage(msg proto.Message) (*preparedMessage, error) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &preparedMessage{msg: msg, data: data}, nil
+}
+
+// preparedCodec is gRPC's protobuf codec, except that it sends a
+// preparedMessage's bytes as they are. Game servers are started with it
+// (grpc.ForceServerCodecV2).
+type preparedCodec struct {
+	encoding.CodecV2
+}
+
+func newPreparedCodec() preparedCodec {
+	return preparedCodec{encoding.GetCodecV2(grpcproto.Name)}
+}
+
+func (c preparedCodec) Marshal(v any) (mem.BufferSlice, error) {
+	if pm, ok := v.(*preparedMessage); ok {
+		return mem.BufferSlice{mem.SliceBuffer(pm.data)}, nil
+	}
+	return c.CodecV2.Marshal(v)
+}
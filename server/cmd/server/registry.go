@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const registryInterval = 10 * time.Second // How often the server re-registers
+
+// registration is how the server lists itself in a server registry (see
+// cmd/registry).
+type registration struct {
+	registry string // Address of the registry
+	token    string
+	name     string
+	address  string // Where clients reach this server
+	region   string
+}
+
+// registerPeriodically keeps the server listed in the registry, with its
+// current player counts, until the process exits.
+func (s *gameServer) registerPeriodically(reg registration) {
+	conn, err := grpc.NewClient(reg.registry, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Printf("Warning: Invalid registry address %s: %v", reg.registry, err)
+		return
+	}
+	defer conn.Close()
+	client := pb.NewRegistryServiceClient(conn)
+	log.Printf("Registering as '%s' (%s) with the registry at %s", reg.name, reg.address, reg.registry)
+	failing := false
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), playerStoreTimeout)
+		_, err := client.RegisterServer(ctx, &pb.RegisterServerRequest{Server: s.listing(reg), Token: reg.token})
+		cancel()
+		if err != nil && !failing {
+			log.Printf("Warning: Registering with %s failed: %v", reg.registry, err)
+		} else if err == nil && failing {
+			log.Printf("Registered with %s again.", reg.registry)
+		}
+		failing = err != nil
+		time.Sleep(registryInterval)
+	}
+}
+
+// listing describes the server for server browsers.
+func (s *gameServer) listing(reg registration) *pb.ServerListing {
+	l := &pb.ServerListing{Name: reg.name, Address: reg.address, Region: reg.region}
+	for _, r := range s.rooms.all() {
+		l.PlayerCount += int32(r.state.PlayerCount())
+		if r.id == defaultRoomID {
+			l.MapName = r.mapName
+			l.MaxPlayers = int32(r.maxPlayers)
+		}
+	}
+	l.RoomCount = int32(len(s.rooms.list("", true)))
+	return l
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleReloadSignals reloads every room's map from disk on SIGHUP, so map
+// edits can be tried without restarting the server or dropping players.
+func (s *gameServer) handleReloadSignals() {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	for range sighup {
+		log.Printf("SIGHUP received, reloading maps...")
+		if err := s.rooms.reloadMaps(s.governor.interval()); err != nil {
+			log.Printf("Map reload finished with errors: %v", err)
+			continue
+		}
+		log.Printf("Map reload complete.")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// restRoutes map REST paths to unary methods, for tools without a gRPC
+// client. Path wildcards and query parameters fill request fields of the
+// same name; POST bodies are the request in protobuf's JSON mapping.
+//
+// This stands in for grpc-gateway on purpose. The gateway would need
+// google.api.http annotations, the googleapis protos and its code generator
+// in the proto build, and a new dependency, for a handful of routes; and its
+// handlers reach the service through a gRPC client or, in-process, without
+// the peer address and metadata. Here the routes call the same registered
+// handlers as gRPC-Web, on the same listener and behind the same origin
+// checks.
+var restRoutes = []struct {
+	pattern string
+	method  string
+}{
+	{"GET /v1/rooms", pb.GameService_ListRooms_FullMethodName},
+	{"POST /v1/rooms", pb.GameService_CreateRoom_FullMethodName},
+	{"GET /v1/rooms/{room_id}/snapshot", pb.GameService_GetFullSnapshot_FullMethodName},
+	{"GET /v1/leaderboard", pb.GameService_GetLeaderboard_FullMethodName},
+	{"GET /v1/assets", pb.GameService_GetAssetManifest_FullMethodName},
+	{"POST /v1/register", pb.GameService_Register_FullMethodName},
+	{"POST /v1/login", pb.GameService_Login_FullMethodName},
+	{"GET /v1/stats", pb.AdminService_GetServerStats_FullMethodName},
+	{"GET /v1/sanctions", pb.AdminService_ListSanctions_FullMethodName},
+}
+
+var pathWildcard = regexp.MustCompile(`\{(\w+)\}`)
+
+// restMux routes restRoutes to the registered methods; routes of services
+// that are not registered, such as the admin service without a token, are
+// left out.
+func (g *webGateway) restMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, route := range restRoutes {
+		m, ok := g.methods[route.method]
+		if !ok || m.unary == nil {
+			continue
+		}
+		var params []string
+		for _, match := range pathWildcard.FindAllStringSubmatch(route.pattern, -1) {
+			params = append(params, match[1])
+		}
+		mux.HandleFunc(route.pattern, func(w http.ResponseWriter, r *http.Request) {
+			values := make(map[string]string, len(params))
+			for _, name := range params {
+				values[name] = r.PathValue(name)
+			}
+			m.serveJSON(w, r, values)
+		})
+	}
+	return mux
+}
+
+// serveJSON answers a call in JSON: the request from the body, query
+// parameters and path values, the response in protobuf's JSON mapping with
+// every field, and errors as {"code": ..., "message": ...} with a matching
+// HTTP status.
+func (m webMethod) serveJSON(w http.ResponseWriter, r *http.Request, pathValues map[string]string) {
+	dec := func(v any) error {
+		msg := v.(proto.Message)
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webMaxMessage))
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "read body: %v", err)
+		}
+		if len(body) > 0 {
+			if err := protojson.Unmarshal(body, msg); err != nil {
+				return status.Errorf(codes.InvalidArgument, "bad JSON request: %v", err)
+			}
+		}
+		for name, values := range r.URL.Query() {
+			if err := setField(msg.ProtoReflect(), name, values[0]); err != nil {
+				return err
+			}
+		}
+		for name, value := range pathValues {
+			if err := setField(msg.ProtoReflect(), name, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	resp, err := m.unary.Handler(m.impl, callContext(r), dec, nil)
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		st := status.Convert(err)
+		w.WriteHeader(httpStatus(st.Code()))
+		json.NewEncoder(w).Encode(map[string]any{"code": st.Code(), "message": st.Message()})
+		return
+	}
+	data, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(resp.(proto.Message))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(data)
+}
+
+// setField sets a singular scalar field, by its proto or JSON name, from a
+// query parameter or path value.
+func setField(msg protoreflect.Message, name, value string) error {
+	fields := msg.Descriptor().Fields()
+	fd := fields.ByName(protoreflect.Name(name))
+	if fd == nil {
+		fd = fields.ByJSONName(name)
+	}
+	if fd == nil || fd.IsList() || fd.IsMap() {
+		return status.Errorf(codes.InvalidArgument, "unknown parameter %q", name)
+	}
+	var v protoreflect.Value
+	var err error
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		v = protoreflect.ValueOfString(value)
+	case protoreflect.BoolKind:
+		var b bool
+		b, err = strconv.ParseBool(value)
+		v = protoreflect.ValueOfBool(b)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		var n int64
+		n, err = strconv.ParseInt(value, 10, 32)
+		v = protoreflect.ValueOfInt32(int32(n))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		var n int64
+		n, err = strconv.ParseInt(value, 10, 64)
+		v = protoreflect.ValueOfInt64(n)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		var n uint64
+		n, err = strconv.ParseUint(value, 10, 32)
+		v = protoreflect.ValueOfUint32(uint32(n))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		var n uint64
+		n, err = strconv.ParseUint(value, 10, 64)
+		v = protoreflect.ValueOfUint64(n)
+	case protoreflect.FloatKind:
+		var f float64
+		f, err = strconv.ParseFloat(value, 32)
+		v = protoreflect.ValueOfFloat32(float32(f))
+	case protoreflect.DoubleKind:
+		var f float64
+		f, err = strconv.ParseFloat(value, 64)
+		v = protoreflect.ValueOfFloat64(f)
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(value)); ev != nil {
+			v = protoreflect.ValueOfEnum(ev.Number())
+		} else {
+			var n int64
+			n, err = strconv.ParseInt(value, 10, 32)
+			v = protoreflect.ValueOfEnum(protoreflect.EnumNumber(n))
+		}
+	default:
+		err = fmt.Errorf("only scalar fields can be set from the URL")
+	}
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "parameter %q: %v", name, err)
+	}
+	msg.Set(fd, v)
+	return nil
+}
+
+// httpStatus maps a gRPC code to the HTTP status REST callers get, as
+// grpc-gateway does.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Canceled:
+		return 499
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,894 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"path/filepath"
+	"simple-grpc-game/server/internal/game"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultRoomID       = "lobby"
+	worldRoomPrefix     = "world_" // World room IDs are the prefix plus the map name
+	defaultRoomMode     = "freeplay"
+	defaultMaxPlayers   = 8
+	maxPlayersLimit     = 32
+	lobbyMaxPlayers     = 64
+	defaultRoomLifetime = 1 * time.Hour
+	maxRoomLifetime     = 6 * time.Hour
+	emptyRoomGrace      = 30 * time.Second
+	maxRoomsPerOwner    = 3
+	maxRoomNameLength   = 32
+)
+
+// allowedModes lists the game modes a player-created room may use.
+var allowedModes = map[string]bool{
+	defaultRoomMode: true,
+	tagRoomMode:     true,
+	combatRoomMode:  true,
+}
+
+// room is an independent game instance with its own State and stream set.
+type room struct {
+	id         string
+	name       string
+	mapName    string
+	mode       string
+	maxPlayers int
+	password   string
+	owner      string // Account key of the creator; empty for server-owned rooms
+	createdAt  time.Time
+	expiresAt  time.Time // Zero means the room never expires
+	persistent bool      // Persistent rooms are never torn down
+
+	state         *game.State
+	metrics       *serverMetrics
+	muStreams     sync.Mutex
+	activeStreams map[string]pb.GameService_GameStreamServer
+	partialPeers  map[string]bool // Players accepting partial players in deltas; guarded by muStreams
+	joining       map[string]bool // Players holding a slot before their stream is added; guarded by muStreams
+	emptySince    time.Time       // Guarded by roomManager.mu
+	muChunks      sync.Mutex
+	chunkViews    map[string]map[chunkCoord]bool // Players streaming the map -> chunks they have
+	ticks         atomic.Uint64
+	chat          *chatHistory
+	captures      *captureRegistry
+	chatFeed      *chatFeed
+	spectators    spectatorSet
+	start         startGate
+	checksums     checksumLog
+	sleep         roomSleep
+	budget        roomBudget
+	items         roomItems
+	bots          roomBots
+	nextPing      time.Time // When the tick next pings the players
+	pause         roomPause
+
+	audit          bool
+	suspectStreams map[string]bool // Stream/player mismatches seen on the previous audit
+
+	tutorial *tutorial       // Set only for tutorial rooms
+	tag      *tagGame        // Set only for tag rooms
+	lag      lagCompensation // Set only for combat rooms; tag rooms keep theirs in tag
+
+	events game.EventSink // Structured event log; nil when disabled
+
+	cluster *cluster      // Set when persistent rooms are shared with other servers
+	remote  remotePlayers // Other servers' players; only persistent rooms have any
+}
+
+func newRoom(id, name, mapName, mapPath string, metrics *serverMetrics) (*room, error) {
+	gameState, err := game.NewStateFromFile(mapPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize game state for room %s: %w", id, err)
+	}
+	now := time.Now()
+	return &room{
+		id:            id,
+		name:          name,
+		mapName:       mapName,
+		mode:          defaultRoomMode,
+		maxPlayers:    defaultMaxPlayers,
+		createdAt:     now,
+		state:         gameState,
+		metrics:       metrics,
+		activeStreams: make(map[string]pb.GameService_GameStreamServer),
+		joining:       make(map[string]bool),
+		chunkViews:    make(map[string]map[chunkCoord]bool),
+		chat:          newChatHistory(pb.ChatChannel_CHAT_CHANNEL_ROOM, ""),
+		emptySince:    now,
+	}, nil
+}
+
+// info returns the public description of the room.
+func (r *room) info() *pb.RoomInfo {
+	ri := &pb.RoomInfo{
+		RoomId:            r.id,
+		Name:              r.name,
+		MapName:           r.mapName,
+		Mode:              r.mode,
+		PlayerCount:       int32(r.state.PlayerCount()),
+		MaxPlayers:        int32(r.maxPlayers),
+		PasswordProtected: r.password != "",
+		Teams:             int32(r.state.Teams()),
+	}
+	if !r.expiresAt.IsZero() {
+		ri.ExpiresAtUnix = r.expiresAt.Unix()
+	}
+	return ri
+}
+
+func (r *room) expired(now time.Time) bool {
+	return !r.expiresAt.IsZero() && now.After(r.expiresAt)
+}
+
+// checkPassword reports whether the supplied password grants access to the room.
+func (r *room) checkPassword(password string) bool {
+	if r.password == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(r.password), []byte(password)) == 1
+}
+
+// full reports whether the room has no free player slots.
+func (r *room) full() bool {
+	r.muStreams.Lock()
+	defer r.muStreams.Unlock()
+	return len(r.activeStreams)+len(r.joining) >= r.maxPlayers
+}
+
+// reserveSlot holds a player slot for a joining player, failing if the room
+// is full. Broadcasts skip the player until addStream, so nothing reaches
+// the client before its map.
+func (r *room) reserveSlot(playerID string) error {
+	r.muStreams.Lock()
+	defer r.muStreams.Unlock()
+	if len(r.activeStreams)+len(r.joining) >= r.maxPlayers {
+		return status.Errorf(codes.ResourceExhausted, "room %s is full", r.id)
+	}
+	r.joining[playerID] = true
+	return nil
+}
+
+// addStream registers the stream of a player holding a slot from reserveSlot.
+func (r *room) addStream(playerID string, stream pb.GameService_GameStreamServer) {
+	r.muStreams.Lock()
+	defer r.muStreams.Unlock()
+	delete(r.joining, playerID)
+	r.activeStreams[playerID] = stream
+	log.Printf("Stream added for player %s in room %s. Total streams: %d", playerID, r.id, len(r.activeStreams))
+}
+
+func (r *room) removeStream(playerID string) {
+	r.muStreams.Lock()
+	defer r.muStreams.Unlock()
+	delete(r.activeStreams, playerID)
+	delete(r.joining, playerID)
+	delete(r.partialPeers, playerID)
+	r.stopChunkView(playerID)
+	log.Printf("Stream removed for player %s in room %s. Total streams: %d", playerID, r.id, len(r.activeStreams))
+}
+
+// acceptPartialPlayers marks a player's client as able to apply partial
+// players, so later deltas it receives omit unchanged fields.
+func (r *room) acceptPartialPlayers(playerID string) {
+	r.muStreams.Lock()
+	defer r.muStreams.Unlock()
+	if r.partialPeers == nil {
+		r.partialPeers = make(map[string]bool)
+	}
+	r.partialPeers[playerID] = true
+}
+
+func (r *room) hasPartialPeers() bool {
+	r.muStreams.Lock()
+	defer r.muStreams.Unlock()
+	return len(r.partialPeers) > 0
+}
+
+func (r *room) streamCount() int {
+	r.muStreams.Lock()
+	defer r.muStreams.Unlock()
+	return len(r.activeStreams)
+}
+
+// streamIDs returns the IDs of the players with a stream in the room.
+func (r *room) streamIDs() []string {
+	r.muStreams.Lock()
+	defer r.muStreams.Unlock()
+	ids := make([]string, 0, len(r.activeStreams))
+	for id := range r.activeStreams {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// broadcast sends msg to every stream in the room, dropping streams that fail.
+func (r *room) broadcast(msg *pb.ServerMessage, what string) {
+	r.broadcastTo(msg, what, nil)
+}
+
+// broadcastTo sends msg to the streams whose player passes include (all if nil),
+// marshaling it once for all of them. msg may be reused once it returns.
+func (r *room) broadcastTo(msg *pb.ServerMessage, what string, include func(playerID string) bool) {
+	r.muStreams.Lock()
+	defer r.muStreams.Unlock()
+	if len(r.activeStreams) == 0 {
+		return
+	}
+	deadStreams := []string{}
+	var prepared *preparedMessage // Marshaled for the first stream included
+	for playerID, stream := range r.activeStreams {
+		if include != nil && !include(playerID) {
+			continue
+		}
+		if prepared == nil {
+			var err error
+			if prepared, err = prepareMessage(msg); err != nil {
+				log.Printf("Error encoding %s for room %s: %v", what, r.id, err)
+				return
+			}
+		}
+		if err := stream.SendMsg(prepared); err != nil {
+			log.Printf("Error sending %s to %s: %v. Marking.", what, playerID, err)
+			deadStreams = append(deadStreams, playerID)
+			r.metrics.streamErrors.Add(1)
+			r.captures.recordError(r.id, playerID, "sending %s: %v", what, err)
+			continue
+		}
+		r.recordSend(len(prepared.data))
+		r.captures.record("broadcast", what, r.id, playerID, msg, "")
+	}
+	for _, playerID := range deadStreams {
+		delete(r.activeStreams, playerID)
+		log.Printf("Dead stream removed during %s broadcast for %s in room %s. Total: %d", what, playerID, r.id, len(r.activeStreams))
+	}
+}
+
+// broadcastTileUpdates sends any runtime map changes to the room.
+func (r *room) broadcastTileUpdates() {
+	updates := r.state.TakeTileUpdates()
+	if len(updates) == 0 {
+		return
+	}
+	r.broadcast(&pb.ServerMessage{Message: &pb.ServerMessage_MapTileUpdate{MapTileUpdate: &pb.MapTileUpdate{Tiles: updates}}}, "tile update")
+}
+
+// broadcastScoreboard sends the room's scores if they changed since the last
+// tick, which includes players joining and leaving.
+func (r *room) broadcastScoreboard() {
+	if board, changed := r.state.TakeScoreboard(); changed {
+		r.broadcast(&pb.ServerMessage{Message: &pb.ServerMessage_Scoreboard{Scoreboard: board}}, "scoreboard")
+	}
+}
+
+// deltaMessages holds ServerMessage wrappers for delta broadcasts, which are
+// done with them once broadcastTo returns.
+var deltaMessages = sync.Pool{New: func() any {
+	return &pb.ServerMessage{Message: &pb.ServerMessage_DeltaUpdate{}}
+}}
+
+// broadcastDelta sends delta to the streams whose player passes include.
+func (r *room) broadcastDelta(delta *pb.DeltaUpdate, what string, include func(playerID string) bool) {
+	msg := deltaMessages.Get().(*pb.ServerMessage)
+	wrapper := msg.Message.(*pb.ServerMessage_DeltaUpdate)
+	wrapper.DeltaUpdate = delta
+	r.broadcastTo(msg, what, include)
+	wrapper.DeltaUpdate = nil
+	deltaMessages.Put(msg)
+}
+
+func (r *room) broadcastDeltaState() {
+	r.broadcastTileUpdates()
+	if !r.hasPartialPeers() {
+		delta, changed := r.state.GenerateDeltaUpdate()
+		if changed {
+			r.broadcastDelta(delta, "delta", nil)
+			if r.cluster != nil {
+				r.cluster.publishDelta(r, delta)
+			}
+		}
+		game.ReleaseDelta(delta)
+		return
+	}
+	full, partial, changed := r.state.GeneratePartialDeltaUpdate()
+	defer game.ReleaseDelta(full, partial)
+	if !changed {
+		return
+	}
+	if r.cluster != nil {
+		r.cluster.publishDelta(r, full)
+	}
+	// include runs with muStreams held, so partialPeers can be read directly.
+	r.broadcastDelta(full, "delta", func(playerID string) bool { return !r.partialPeers[playerID] })
+	r.broadcastDelta(partial, "partial delta", func(playerID string) bool { return r.partialPeers[playerID] })
+}
+
+func (r *room) broadcastChatMessage(playerID, senderUsername, messageText string) {
+	chatMsgProto := &pb.ChatMessage{
+		SenderUsername: senderUsername,
+		MessageText:    messageText,
+		Timestamp:      time.Now().Unix(),
+		PlayerId:       playerID,
+	}
+	r.chat.add(chatMsgProto)
+	r.chatFeed.publish(&pb.ChatMessage{
+		SenderUsername: senderUsername,
+		MessageText:    messageText,
+		Timestamp:      chatMsgProto.Timestamp,
+		PlayerId:       playerID,
+		RoomId:         r.id,
+	})
+	r.broadcast(&pb.ServerMessage{Message: &pb.ServerMessage_ChatMessage{ChatMessage: chatMsgProto}}, "chat")
+}
+
+// systemChatSender is the sender name of server notices in chat.
+const systemChatSender = "[Server]"
+
+// sendSystemChat sends a server notice to one player as a chat message. It is
+// not recorded in the room's history.
+func (r *room) sendSystemChat(playerID, text string) {
+	msg := &pb.ServerMessage{Message: &pb.ServerMessage_ChatMessage{ChatMessage: &pb.ChatMessage{
+		SenderUsername: systemChatSender,
+		MessageText:    text,
+		Timestamp:      time.Now().Unix(),
+	}}}
+	r.broadcastTo(msg, "system chat", func(id string) bool { return id == playerID })
+}
+
+// tick stops players whose input has timed out and broadcasts any resulting
+// change. interval is the current tick interval.
+func (r *room) tick(interval time.Duration) {
+	if r.sleeping(time.Now()) {
+		return
+	}
+	if r.paused() {
+		r.tickPings(time.Now())
+		return
+	}
+	stateChangedDuringTick := r.state.ApplySlides(time.Now())
+	if r.state.StopIdlePlayers(r.state.Tuning().MovementTimeout) {
+		stateChangedDuringTick = true
+	}
+	r.tickTutorial()
+	r.tickMatchStart(interval)
+	if r.tickTag() {
+		stateChangedDuringTick = true
+	}
+	r.streamMapChunks()
+	if r.audit {
+		r.state.Audit()
+		r.auditStreams()
+	}
+	if r.state.ExpireInvulnerability(time.Now()) {
+		stateChangedDuringTick = true
+	}
+	if r.state.ExpireEmotes(time.Now()) {
+		stateChangedDuringTick = true
+	}
+	if r.announceFalls() {
+		stateChangedDuringTick = true
+	}
+	if r.tickHealth(time.Now()) {
+		stateChangedDuringTick = true
+	}
+	if r.tickItems(time.Now()) {
+		stateChangedDuringTick = true
+	}
+	if r.state.TickNPCs(time.Now()) {
+		stateChangedDuringTick = true
+	}
+	if r.tickBots(time.Now()) {
+		stateChangedDuringTick = true
+	}
+	if stateChangedDuringTick || r.throttled() {
+		r.broadcastDeltaState()
+	}
+	r.broadcastScoreboard()
+	if tick := r.ticks.Add(1); tick%checksumEveryTicks == 0 {
+		r.broadcastChecksum(tick)
+	}
+	r.publishSpectatorFrame()
+	r.tickPings(time.Now())
+}
+
+// auditStreams logs players whose stream and state entries disagree on two
+// consecutive audits; a single mismatch is expected while a join or leave is
+// in progress.
+func (r *room) auditStreams() {
+	inState := make(map[string]bool)
+	for _, id := range r.state.GetAllPlayerIDs() {
+		inState[id] = true
+	}
+	r.muStreams.Lock()
+	mismatched := make(map[string]bool)
+	for id := range r.activeStreams {
+		if !inState[id] {
+			mismatched[id] = true
+		}
+	}
+	for id := range inState {
+		if _, ok := r.activeStreams[id]; !ok && !r.isBot(id) {
+			mismatched[id] = true
+		}
+	}
+	r.muStreams.Unlock()
+	for id := range mismatched {
+		if r.suspectStreams[id] {
+			log.Printf("AUDIT VIOLATION: room %s has a stale stream/state entry for player %s", r.id, id)
+		}
+	}
+	r.suspectStreams = mismatched
+}
+
+// respawn moves a player back to a spawn point and broadcasts the event.
+func (r *room) respawn(playerID string) error {
+	player, invulnerableUntil, err := r.state.RespawnPlayer(playerID)
+	if err != nil {
+		return err
+	}
+	r.broadcastRespawned(player.Id, player.XPos, player.YPos, invulnerableUntil)
+	r.broadcastDeltaState()
+	return nil
+}
+
+func (r *room) broadcastRespawned(playerID string, x, y float32, invulnerableUntil time.Time) {
+	r.broadcast(&pb.ServerMessage{Message: &pb.ServerMessage_PlayerRespawned{PlayerRespawned: &pb.PlayerRespawned{
+		PlayerId:                playerID,
+		XPos:                    x,
+		YPos:                    y,
+		InvulnerableUntilUnixMs: invulnerableUntil.UnixMilli(),
+	}}}, "respawn")
+}
+
+// announceFalls tells everyone about players respawned for walking off the
+// edge of the map since the last tick, reporting whether there were any.
+func (r *room) announceFalls() bool {
+	falls := r.state.TakeFalls()
+	for _, f := range falls {
+		r.broadcastRespawned(f.PlayerID, f.X, f.Y, f.InvulnerableUntil)
+	}
+	return len(falls) > 0
+}
+
+// initialMapMessage builds the InitialMapData for a player joining the room
+// (or rejoining its reloaded map). A chunked message carries no tiles; they
+// follow in MapChunk messages.
+func (r *room) initialMapMessage(playerID string, tickInterval time.Duration, chunked bool) (*pb.ServerMessage, error) {
+	mapGrid, mapW, mapH, tileSize, err := r.state.GetMapDataAndDimensions()
+	if err != nil {
+		return nil, err
+	}
+	worldW, worldH := r.state.GetWorldPixelDimensions()
+	initialMap := &pb.InitialMapData{TileWidth: int32(mapW), TileHeight: int32(mapH), WorldPixelHeight: worldH, WorldPixelWidth: worldW, TileSizePixels: int32(tileSize), AssignedPlayerId: playerID, TileDefinitions: r.state.TileDefinitions(), TickIntervalMs: int32(tickInterval.Milliseconds())}
+	initialMap.MapTitle, initialMap.MapAuthor = r.state.MapMetadata()
+	initialMap.MapName = r.mapName
+	initialMap.Wrap = r.state.WrapsAround()
+	initialMap.Edges = r.state.Edges()
+	if chunked {
+		initialMap.ChunkSize = mapChunkSize
+		return &pb.ServerMessage{Message: &pb.ServerMessage_InitialMapData{InitialMapData: initialMap}}, nil
+	}
+	initialMap.Rows = make([]*pb.MapRow, mapH)
+	initialMap.Layers = r.state.MapLayers()
+	for y, rowData := range mapGrid {
+		rowTiles := make([]int32, mapW)
+		for x, tileID := range rowData {
+			if x < len(rowTiles) {
+				rowTiles[x] = int32(tileID)
+			}
+		}
+		if y < len(initialMap.Rows) {
+			initialMap.Rows[y] = &pb.MapRow{Tiles: rowTiles}
+		}
+	}
+	return &pb.ServerMessage{Message: &pb.ServerMessage_InitialMapData{InitialMapData: initialMap}}, nil
+}
+
+// reloadMap swaps in a fresh copy of the room's map file and sends every
+// player the new InitialMapData, followed by the positions of anyone moved out
+// of a wall. On error the old map stays in place.
+func (r *room) reloadMap(mapPath string, tickInterval time.Duration) error {
+	relocated, err := r.state.ReloadMap(mapPath)
+	if err != nil {
+		return err
+	}
+	streaming := r.chunkStreamers()
+	r.muStreams.Lock()
+	deadStreams := []string{}
+	for playerID, stream := range r.activeStreams {
+		msg, err := r.initialMapMessage(playerID, tickInterval, streaming[playerID])
+		if err == nil {
+			err = stream.Send(msg)
+		}
+		if err != nil {
+			log.Printf("Error sending reloaded map to %s: %v. Marking.", playerID, err)
+			deadStreams = append(deadStreams, playerID)
+			r.metrics.streamErrors.Add(1)
+			continue
+		}
+		r.recordSend(proto.Size(msg))
+	}
+	for _, playerID := range deadStreams {
+		delete(r.activeStreams, playerID)
+	}
+	r.muStreams.Unlock()
+	r.resetChunkViews()
+	log.Printf("Room %s reloaded map '%s' (%d players relocated).", r.id, mapPath, len(relocated))
+	r.broadcastDeltaState()
+	return nil
+}
+
+// roomManager owns every room hosted by this process.
+type roomManager struct {
+	mu          sync.Mutex
+	rooms       map[string]*room
+	allowedMaps map[string]string // Map name -> file path
+	worlds      map[string]string // Map name -> ID of its persistent world room
+	reserved    map[string]int    // Owner -> rooms being created, counted towards their quota
+	metrics     *serverMetrics
+	audit       bool // Enable audit mode on every room
+	captures    *captureRegistry
+	chatFeed    *chatFeed
+	maxRewind   time.Duration                       // Cap on lag compensation for tags and attacks
+	latencyOf   func(playerID string) time.Duration // Recent input latency of a player
+	events      game.EventSink                      // Structured event log of every room; set at startup
+	saver       *worldSaver                         // Saves persistent rooms' worlds; nil when disabled
+	sleepAfter  time.Duration                       // Empty rooms stop ticking after this long; 0 never
+	budget      roomBudgetConfig                    // How much of the server each room may use
+	randomItems int                                 // Random items kept on every room's map
+	aiBudget    int                                 // Pathfinding tiles each room's NPCs may expand per tick; 0 is the default
+	publishRTT  bool                                // Show players' round trips in their player data
+	tuning      game.Tuning                         // Gameplay constants of every room, changed with SetConfig
+	cluster     *cluster                            // Shares persistent rooms with other servers; nil when disabled
+}
+
+// mapNameFromPath derives the public map name ("arena" for "maps/arena.png").
+func mapNameFromPath(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// newRoomManager creates the manager, its persistent default lobby on the
+// first map and a persistent world room for every other map.
+func newRoomManager(mapPaths []string, metrics *serverMetrics, audit bool) (*roomManager, error) {
+	if len(mapPaths) == 0 {
+		return nil, fmt.Errorf("at least one map is required")
+	}
+	m := &roomManager{
+		rooms:       make(map[string]*room),
+		allowedMaps: make(map[string]string),
+		worlds:      make(map[string]string),
+		reserved:    make(map[string]int),
+		metrics:     metrics,
+		audit:       audit,
+		captures:    newCaptureRegistry(),
+		chatFeed:    newChatFeed(),
+		tuning:      game.DefaultTuning(),
+	}
+	for _, path := range mapPaths {
+		m.allowedMaps[mapNameFromPath(path)] = path
+	}
+	lobbyMap := mapNameFromPath(mapPaths[0])
+	lobby, err := newRoom(defaultRoomID, "Lobby", lobbyMap, mapPaths[0], metrics)
+	if err != nil {
+		return nil, err
+	}
+	m.prepareRoom(lobby)
+	lobby.persistent = true
+	lobby.maxPlayers = lobbyMaxPlayers
+	m.rooms[lobby.id] = lobby
+	m.worlds[lobbyMap] = lobby.id
+
+	for _, path := range mapPaths[1:] {
+		mapName := mapNameFromPath(path)
+		if _, ok := m.worlds[mapName]; ok {
+			continue
+		}
+		world, err := newRoom(worldRoomPrefix+mapName, mapName, mapName, path, metrics)
+		if err != nil {
+			return nil, err
+		}
+		m.prepareRoom(world)
+		world.persistent = true
+		world.maxPlayers = lobbyMaxPlayers
+		m.rooms[world.id] = world
+		m.worlds[mapName] = world.id
+	}
+	return m, nil
+}
+
+// worldRoomID returns the ID of the persistent world room for a map. Errors
+// are gRPC status errors.
+func (m *roomManager) worldRoomID(mapName string) (string, error) {
+	id, ok := m.worlds[mapName]
+	if !ok {
+		return "", status.Errorf(codes.NotFound, "map %q is not hosted on this server", mapName)
+	}
+	return id, nil
+}
+
+// prepareRoom applies the manager's settings to a newly created room.
+func (m *roomManager) prepareRoom(r *room) {
+	r.captures = m.captures
+	r.chatFeed = m.chatFeed
+	r.sleep.after = m.sleepAfter
+	r.items.random = m.randomItems
+	r.state.SetAIBudget(m.aiBudget)
+	r.state.PublishRTT(m.publishRTT)
+	r.state.SetTuning(m.tuning)
+	r.budget.config = m.budget
+	r.cluster = m.cluster
+	if m.audit {
+		r.audit = true
+		r.state.EnableAudit()
+	}
+	if m.events != nil {
+		r.logEventsTo(m.events)
+	}
+}
+
+// joinable returns the room if it exists, has not expired and accepts the
+// password. Errors are gRPC status errors.
+func (m *roomManager) joinable(roomID, password string) (*room, error) {
+	if roomID == "" {
+		roomID = defaultRoomID
+	}
+	r, ok := m.get(roomID)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "room %s not found", roomID)
+	}
+	if r.expired(time.Now()) {
+		return nil, status.Errorf(codes.FailedPrecondition, "room %s has expired", roomID)
+	}
+	if !r.checkPassword(password) {
+		log.Printf("Rejected join to room %s: bad password.", roomID)
+		return nil, status.Errorf(codes.PermissionDenied, "invalid password for room %s", roomID)
+	}
+	return r, nil
+}
+
+// list describes the rooms open to new players, optionally only those on one
+// map. Tutorials, matches and expired rooms are left out.
+func (m *roomManager) list(mapName string, includeFull bool) []*pb.RoomInfo {
+	now := time.Now()
+	var infos []*pb.RoomInfo
+	for _, r := range m.all() {
+		if r.mode == tutorialRoomMode || r.mode == matchRoomMode || r.expired(now) {
+			continue
+		}
+		if mapName != "" && r.mapName != mapName {
+			continue
+		}
+		if !includeFull && r.full() {
+			continue
+		}
+		infos = append(infos, r.info())
+	}
+	return infos
+}
+
+// lobbyMap returns the name of the map the default lobby uses.
+func (m *roomManager) lobbyMap() string {
+	lobby, _ := m.get(defaultRoomID)
+	return lobby.mapName
+}
+
+func (m *roomManager) get(roomID string) (*room, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.rooms[roomID]
+	return r, ok
+}
+
+// all returns the rooms sorted by ID.
+func (m *roomManager) all() []*room {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rooms := make([]*room, 0, len(m.rooms))
+	for _, r := range m.rooms {
+		rooms = append(rooms, r)
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].id < rooms[j].id })
+	return rooms
+}
+
+// reloadMaps reloads the map of every room from disk. Rooms whose map fails
+// to load or validate keep their current map; the first error is returned.
+func (m *roomManager) reloadMaps(tickInterval time.Duration) error {
+	var firstErr error
+	m.mu.Lock()
+	saver := m.saver
+	m.mu.Unlock()
+	for _, r := range m.all() {
+		if err := r.reloadMap(m.allowedMaps[r.mapName], tickInterval); err != nil {
+			log.Printf("Failed to reload map of room %s, keeping the current one: %v", r.id, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else if saver != nil && r.persistent {
+			saver.mapLoaded(r, m.allowedMaps[r.mapName])
+		}
+	}
+	return firstErr
+}
+
+func newRoomID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("room_%d", time.Now().UnixNano())
+	}
+	return "room_" + hex.EncodeToString(b)
+}
+
+// inviteAlphabet leaves out characters that are easily confused when an
+// invite code is read out or retyped.
+const inviteAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newInviteCode returns a random 8-character code such as "K7QX-M2PA".
+func newInviteCode() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return newRoomID() // Still unguessable enough to keep strangers out
+	}
+	code := make([]byte, 0, 9)
+	for i, c := range b {
+		if i == 4 {
+			code = append(code, '-')
+		}
+		code = append(code, inviteAlphabet[int(c)%len(inviteAlphabet)])
+	}
+	return string(code)
+}
+
+// createRoom validates a CreateRoomRequest against the server limits and the
+// owner's quota, then starts a new room. Errors are gRPC status errors.
+func (m *roomManager) createRoom(owner string, req *pb.CreateRoomRequest) (*room, error) {
+	name := strings.TrimSpace(req.GetName())
+	if len(name) > maxRoomNameLength {
+		return nil, status.Errorf(codes.InvalidArgument, "room name exceeds %d characters", maxRoomNameLength)
+	}
+	mapName := req.GetMapName()
+	mapPath, ok := m.allowedMaps[mapName]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "map %q is not allowed", mapName)
+	}
+	mode := req.GetMode()
+	if mode == "" {
+		mode = defaultRoomMode
+	}
+	if !allowedModes[mode] {
+		return nil, status.Errorf(codes.InvalidArgument, "mode %q is not allowed", mode)
+	}
+	maxPlayers := int(req.GetMaxPlayers())
+	if maxPlayers == 0 {
+		maxPlayers = defaultMaxPlayers
+	}
+	if maxPlayers < 1 || maxPlayers > maxPlayersLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "max_players must be between 1 and %d", maxPlayersLimit)
+	}
+	password := req.GetPassword()
+	if req.GetInviteCode() {
+		if password != "" {
+			return nil, status.Error(codes.InvalidArgument, "set either password or invite_code, not both")
+		}
+		password = newInviteCode()
+	}
+	teams := int(req.GetTeams())
+	if teams != 0 && (teams < 2 || teams > game.MaxTeams) {
+		return nil, status.Errorf(codes.InvalidArgument, "teams must be 0 or between 2 and %d", game.MaxTeams)
+	}
+	lifetime := time.Duration(req.GetLifetimeSeconds()) * time.Second
+	if lifetime == 0 {
+		lifetime = defaultRoomLifetime
+	}
+	if lifetime < 0 || lifetime > maxRoomLifetime {
+		return nil, status.Errorf(codes.InvalidArgument, "lifetime must be between 1s and %v", maxRoomLifetime)
+	}
+
+	// Reserve the room against the quota while its map loads, so concurrent
+	// requests by one owner cannot all pass the check.
+	m.mu.Lock()
+	owned := m.reserved[owner]
+	for _, r := range m.rooms {
+		if r.owner == owner && r.mode != tutorialRoomMode {
+			owned++
+		}
+	}
+	if owned >= maxRoomsPerOwner {
+		m.mu.Unlock()
+		return nil, status.Errorf(codes.ResourceExhausted, "room quota of %d reached", maxRoomsPerOwner)
+	}
+	m.reserved[owner]++
+	m.mu.Unlock()
+
+	id := newRoomID()
+	if name == "" {
+		name = id
+	}
+	r, err := newRoom(id, name, mapName, mapPath, m.metrics)
+	if err != nil {
+		m.mu.Lock()
+		m.releaseLocked(owner)
+		m.mu.Unlock()
+		return nil, status.Errorf(gameErrorCode(err), "failed to create room: %v", err)
+	}
+	m.prepareRoom(r)
+	r.mode = mode
+	switch mode {
+	case tagRoomMode:
+		m.startTag(r)
+	case combatRoomMode:
+		m.startCombat(r)
+	}
+	if teams > 0 {
+		r.state.EnableTeams(teams)
+	}
+	r.maxPlayers = maxPlayers
+	r.password = password
+	r.owner = owner
+	r.expiresAt = r.createdAt.Add(lifetime)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.releaseLocked(owner)
+	m.rooms[id] = r
+	log.Printf("Room %s ('%s') created by %s: map=%s mode=%s max=%d teams=%d expires=%s",
+		id, name, owner, mapName, mode, maxPlayers, teams, r.expiresAt.Format(time.RFC3339))
+	return r, nil
+}
+
+// releaseLocked gives back an owner's quota reservation. Must be called with
+// m.mu held.
+func (m *roomManager) releaseLocked(owner string) {
+	if m.reserved[owner]--; m.reserved[owner] <= 0 {
+		delete(m.reserved, owner)
+	}
+}
+
+// reap tears down non-persistent rooms that have been empty for longer than
+// emptyRoomGrace, or that are past their lifetime and have no players left.
+// It returns the IDs of players still in rooms past their lifetime, whose
+// streams the caller ends so the rooms empty and go on the next reap.
+func (m *roomManager) reap(now time.Time) (expiredPlayers []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, r := range m.rooms {
+		if r.persistent {
+			continue
+		}
+		if r.streamCount() > 0 {
+			r.emptySince = time.Time{}
+			if r.expired(now) {
+				expiredPlayers = append(expiredPlayers, r.streamIDs()...)
+			}
+			continue
+		}
+		if r.emptySince.IsZero() {
+			r.emptySince = now
+		}
+		if r.expired(now) || now.Sub(r.emptySince) > emptyRoomGrace {
+			if r.mode == matchRoomMode && r.start.hasStarted() {
+				r.emitEvent(game.EventMatchEnded, "", map[string]any{"map": r.mapName, "duration": now.Sub(r.createdAt).Truncate(time.Second).String()})
+			}
+			delete(m.rooms, id)
+			r.spectators.close()
+			log.Printf("Room %s ('%s') torn down.", id, r.name)
+		}
+	}
+	return expiredPlayers
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"simple-grpc-game/server/internal/harness"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCreateRoomQuotaUnderConcurrency(t *testing.T) {
+	ts := startTestServer(t, serverConfig{mapPaths: []string{testMap(t)}})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for range 4 * maxRoomsPerOwner {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ts.game.rooms.createRoom("owner", &pb.CreateRoomRequest{MapName: "arena"}); err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if created != maxRoomsPerOwner {
+		t.Fatalf("created %d rooms, want the quota of %d", created, maxRoomsPerOwner)
+	}
+}
+
+func TestExpiredRoomEndsStreams(t *testing.T) {
+	ts := startTestServer(t, serverConfig{mapPaths: []string{testMap(t)}})
+	r, err := ts.game.rooms.createRoom("owner", &pb.CreateRoomRequest{MapName: "arena"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := ts.Join(t, &pb.ClientHello{DesiredUsername: "alice", RoomId: r.id})
+	alice.Expect(t, harness.HasPlayer("alice"))
+
+	ts.game.rooms.mu.Lock()
+	r.expiresAt = time.Now().Add(-time.Second)
+	ts.game.rooms.mu.Unlock()
+	ts.tick(1)
+	alice.Expect(t, harness.IsDisconnect())
+	for range 50 {
+		if _, ok := ts.game.rooms.get(r.id); !ok {
+			return
+		}
+		ts.tick(1)
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("expired room was not torn down once empty")
+}
+
+func TestJoiningPlayerHoldsSlotWithoutBroadcasts(t *testing.T) {
+	ts := startTestServer(t, serverConfig{mapPaths: []string{testMap(t)}})
+	lobby, _ := ts.game.rooms.get(defaultRoomID)
+	lobby.muStreams.Lock()
+	lobby.maxPlayers = 2
+	lobby.muStreams.Unlock()
+	alice := ts.Join(t, &pb.ClientHello{DesiredUsername: "alice"})
+	alice.Expect(t, harness.HasPlayer("alice"))
+
+	if err := lobby.reserveSlot("joining"); err != nil {
+		t.Fatal(err)
+	}
+	if ids := lobby.streamIDs(); len(ids) != 1 {
+		t.Errorf("broadcasts reach %v, want only alice before the joining stream is added", ids)
+	}
+	if _, err := ts.TryJoin(t, &pb.ClientHello{DesiredUsername: "bob"}); err == nil {
+		t.Error("join succeeded with every slot taken or reserved")
+	}
+	lobby.removeStream("joining")
+	ts.Join(t, &pb.ClientHello{DesiredUsername: "bob"})
+}
+
+func TestCreateRoomQuotaPerAccount(t *testing.T) {
+	ts := startTestServer(t, serverConfig{mapPaths: []string{testMap(t)}, accounts: "memory"})
+	ctx := context.Background()
+	for _, name := range []string{"alice", "bob"} {
+		acct, err := ts.game.Register(ctx, &pb.AccountRequest{Username: name, Password: "correct horse"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Both accounts share one address, yet each gets the full quota.
+		for i := range maxRoomsPerOwner {
+			req := &pb.CreateRoomRequest{MapName: "arena", SessionToken: acct.GetSessionToken()}
+			if _, err := ts.game.CreateRoom(ctx, req); err != nil {
+				t.Fatalf("%s's room %d: %v", name, i+1, err)
+			}
+		}
+		req := &pb.CreateRoomRequest{MapName: "arena", SessionToken: acct.GetSessionToken()}
+		if _, err := ts.game.CreateRoom(ctx, req); status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("%s's room over the quota: err = %v, want ResourceExhausted", name, err)
+		}
+	}
+	if _, err := ts.game.CreateRoom(ctx, &pb.CreateRoomRequest{MapName: "arena", SessionToken: "bogus"}); err == nil {
+		t.Error("room created with an invalid session token")
+	}
+}
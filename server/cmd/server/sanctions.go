@@ -0,0 +1,394 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultMuteDuration = 10 * time.Minute
+	defaultBanDuration  = 24 * time.Hour
+	maxSanctionDuration = 365 * 24 * time.Hour
+	// sanctionRefreshInterval limits how often the store checks the file for
+	// sanctions written by other servers.
+	sanctionRefreshInterval = time.Second
+)
+
+// sanction is a mute or ban. ExpiresAt is absolute and fixed by the server
+// that issued it: a restart or another server with a slightly different clock
+// ends it at (nearly) the same moment instead of restarting the duration.
+type sanction struct {
+	ID        string          `json:"id"`
+	Kind      pb.SanctionKind `json:"kind"`
+	Username  string          `json:"username,omitempty"`
+	Address   string          `json:"address,omitempty"`
+	Reason    string          `json:"reason,omitempty"`
+	IssuedAt  time.Time       `json:"issued_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+func (sc *sanction) matches(kind pb.SanctionKind, username, address string) bool {
+	if sc.Kind != kind {
+		return false
+	}
+	return (sc.Username != "" && strings.EqualFold(sc.Username, username)) ||
+		(sc.Address != "" && sc.Address == address)
+}
+
+func (sc *sanction) proto() *pb.Sanction {
+	return &pb.Sanction{
+		SanctionId:    sc.ID,
+		Kind:          sc.Kind,
+		Username:      sc.Username,
+		Address:       sc.Address,
+		Reason:        sc.Reason,
+		IssuedAtUnix:  sc.IssuedAt.Unix(),
+		ExpiresAtUnix: sc.ExpiresAt.Unix(),
+	}
+}
+
+// sanctionStore holds the active sanctions. With a backend they are
+// persisted there, and changes other servers make to the same backend are
+// picked up within sanctionRefreshInterval.
+type sanctionStore struct {
+	mu          sync.Mutex
+	sanctions   map[string]*sanction // By ID
+	backend     sanctionBackend      // Nil keeps sanctions in memory only
+	lastRefresh time.Time
+}
+
+// sanctionBackend persists sanctions where several servers can share them.
+// Each change is made on the backend's current contents, so servers never
+// undo each other's. Methods are called with sanctionStore.mu held.
+type sanctionBackend interface {
+	// load returns the saved sanctions. Unless force is set it may report
+	// them unchanged since the last load instead.
+	load(force bool) (saved []*sanction, changed bool, err error)
+	put(sc *sanction) error
+	remove(ids []string) error
+}
+
+// openSanctionStore opens the -sanctions-store target: a redis:// or
+// rediss:// URL, a file path, or nothing to keep sanctions in memory.
+func openSanctionStore(target string) (*sanctionStore, error) {
+	switch {
+	case target == "":
+		return newSanctionStore(nil), nil
+	case strings.HasPrefix(target, "redis://"), strings.HasPrefix(target, "rediss://"):
+		backend, err := openRedisSanctions(target)
+		if err != nil {
+			return nil, err
+		}
+		return newSanctionStore(backend), nil
+	}
+	if !fileLocking {
+		log.Printf("Warning: Sanctions file '%s' cannot be locked on this platform; do not share it between servers.", target)
+	}
+	return newSanctionStore(&fileSanctions{path: target}), nil
+}
+
+// newSanctionStore creates a store, loading sanctions from backend if set.
+func newSanctionStore(backend sanctionBackend) *sanctionStore {
+	st := &sanctionStore{sanctions: make(map[string]*sanction), backend: backend}
+	if backend != nil {
+		st.mu.Lock()
+		st.refreshLocked(true)
+		st.mu.Unlock()
+		log.Printf("Loaded %d sanctions", len(st.sanctions))
+	}
+	return st
+}
+
+// refreshLocked reloads the sanctions if another server changed them. Unless
+// force is set, the backend is checked at most once per
+// sanctionRefreshInterval. Must be called with st.mu held.
+func (st *sanctionStore) refreshLocked(force bool) {
+	if st.backend == nil || (!force && time.Since(st.lastRefresh) < sanctionRefreshInterval) {
+		return
+	}
+	st.lastRefresh = time.Now()
+	saved, changed, err := st.backend.load(force)
+	if err != nil {
+		log.Printf("Warning: Could not load sanctions: %v", err)
+		return
+	}
+	if !changed {
+		return
+	}
+	st.sanctions = make(map[string]*sanction, len(saved))
+	for _, sc := range saved {
+		st.sanctions[sc.ID] = sc
+	}
+}
+
+// issue records a sanction against a username or address. Errors are gRPC
+// status errors.
+func (st *sanctionStore) issue(req *pb.SanctionPlayerRequest) (*sanction, error) {
+	username, address := strings.TrimSpace(req.GetUsername()), strings.TrimSpace(req.GetAddress())
+	if (username == "") == (address == "") {
+		return nil, status.Error(codes.InvalidArgument, "set exactly one of username and address")
+	}
+	return st.add(req.GetKind(), username, address, time.Duration(req.GetDurationSeconds())*time.Second, req.GetReason())
+}
+
+// add records a sanction against a username, an address or both; zero
+// duration uses the kind's default. Errors are gRPC status errors.
+func (st *sanctionStore) add(kind pb.SanctionKind, username, address string, duration time.Duration, reason string) (*sanction, error) {
+	switch kind {
+	case pb.SanctionKind_SANCTION_MUTE:
+		if duration == 0 {
+			duration = defaultMuteDuration
+		}
+	case pb.SanctionKind_SANCTION_BAN:
+		if duration == 0 {
+			duration = defaultBanDuration
+		}
+	default:
+		return nil, status.Error(codes.InvalidArgument, "kind must be SANCTION_MUTE or SANCTION_BAN")
+	}
+	if duration < 0 || duration > maxSanctionDuration {
+		return nil, status.Errorf(codes.InvalidArgument, "duration must be between 1s and %v", maxSanctionDuration)
+	}
+	raw := make([]byte, 4)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, status.Errorf(codes.Internal, "generate sanction ID: %v", err)
+	}
+	now := time.Now().UTC()
+	sc := &sanction{
+		ID:        "san_" + hex.EncodeToString(raw),
+		Kind:      kind,
+		Username:  username,
+		Address:   address,
+		Reason:    reason,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(duration),
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.backend != nil {
+		if err := st.backend.put(sc); err != nil {
+			log.Printf("Warning: Could not save sanction %s: %v", sc.ID, err)
+		}
+		st.refreshLocked(true)
+	}
+	for id, old := range st.sanctions {
+		if !now.Before(old.ExpiresAt) {
+			delete(st.sanctions, id)
+		}
+	}
+	st.sanctions[sc.ID] = sc
+	return sc, nil
+}
+
+// lift removes a sanction before it expires. Errors are gRPC status errors.
+func (st *sanctionStore) lift(id string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.refreshLocked(true)
+	if _, ok := st.sanctions[id]; !ok {
+		return status.Errorf(codes.NotFound, "sanction %s not found", id)
+	}
+	st.removeLocked([]string{id})
+	return nil
+}
+
+// liftMatching removes every sanction of a kind against a username or
+// address, returning their IDs.
+func (st *sanctionStore) liftMatching(kind pb.SanctionKind, username, address string) []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.refreshLocked(true)
+	var lifted []string
+	for _, sc := range st.sortedLocked() {
+		if sc.matches(kind, username, address) {
+			lifted = append(lifted, sc.ID)
+		}
+	}
+	if len(lifted) > 0 {
+		st.removeLocked(lifted)
+	}
+	return lifted
+}
+
+// removeLocked deletes sanctions here and from the backend, logging
+// failures. Must be called with st.mu held.
+func (st *sanctionStore) removeLocked(ids []string) {
+	for _, id := range ids {
+		delete(st.sanctions, id)
+	}
+	if st.backend != nil {
+		if err := st.backend.remove(ids); err != nil {
+			log.Printf("Warning: Could not remove sanctions %v: %v", ids, err)
+		}
+	}
+}
+
+// list returns the active sanctions, soonest expiry first.
+func (st *sanctionStore) list() []*pb.Sanction {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.refreshLocked(false)
+	now := time.Now()
+	var out []*pb.Sanction
+	for _, sc := range st.sortedLocked() {
+		if now.Before(sc.ExpiresAt) {
+			out = append(out, sc.proto())
+		}
+	}
+	return out
+}
+
+// active returns the longest-running sanction of a kind that applies to the
+// player, if any.
+func (st *sanctionStore) active(kind pb.SanctionKind, username, address string) (*sanction, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.refreshLocked(false)
+	now := time.Now()
+	var found *sanction
+	for _, sc := range st.sanctions {
+		if now.Before(sc.ExpiresAt) && sc.matches(kind, username, address) &&
+			(found == nil || sc.ExpiresAt.After(found.ExpiresAt)) {
+			found = sc
+		}
+	}
+	return found, found != nil
+}
+
+func (st *sanctionStore) sortedLocked() []*sanction {
+	all := make([]*sanction, 0, len(st.sanctions))
+	for _, sc := range st.sanctions {
+		all = append(all, sc)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ExpiresAt.Before(all[j].ExpiresAt) })
+	return all
+}
+
+// fileSanctions keeps sanctions in a JSON file. Changes are made holding an
+// exclusive lock on path + ".lock" where the platform has one (see
+// lockFile), so servers sharing the file never undo each other's.
+type fileSanctions struct {
+	path    string
+	modTime time.Time // Of the file when last read or written
+}
+
+func (f *fileSanctions) load(force bool) ([]*sanction, bool, error) {
+	info, err := os.Stat(f.path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !force && info.ModTime().Equal(f.modTime) {
+		return nil, false, nil
+	}
+	saved, err := f.read()
+	if err != nil {
+		return nil, false, err
+	}
+	f.modTime = info.ModTime()
+	return saved, true, nil
+}
+
+func (f *fileSanctions) read() ([]*sanction, error) {
+	data, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved []*sanction
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", f.path, err)
+	}
+	return saved, nil
+}
+
+func (f *fileSanctions) put(sc *sanction) error {
+	return f.update(func(saved []*sanction) []*sanction { return append(saved, sc) })
+}
+
+func (f *fileSanctions) remove(ids []string) error {
+	return f.update(func(saved []*sanction) []*sanction {
+		return slices.DeleteFunc(saved, func(sc *sanction) bool { return slices.Contains(ids, sc.ID) })
+	})
+}
+
+// update rewrites the file with change applied to its current contents,
+// dropping expired sanctions, under the file lock.
+func (f *fileSanctions) update(change func([]*sanction) []*sanction) error {
+	unlock, err := lockFile(f.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("lock %s: %w", f.path, err)
+	}
+	defer unlock()
+	saved, err := f.read()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	saved = slices.DeleteFunc(change(saved), func(sc *sanction) bool { return !now.Before(sc.ExpiresAt) })
+	sort.Slice(saved, func(i, j int) bool { return saved[i].ExpiresAt.Before(saved[j].ExpiresAt) })
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := replaceFile(f.path, data); err != nil {
+		return err
+	}
+	if info, err := os.Stat(f.path); err == nil {
+		f.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// replaceFile atomically replaces path with data, through a uniquely named
+// temporary file so that processes writing the same path never share one.
+func replaceFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0o644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write %s: %w", tmp.Name(), err)
+	}
+	return nil
+}
+
+// sanctionError describes an active ban to the banned client.
+func sanctionError(sc *sanction) error {
+	msg := fmt.Sprintf("banned until %s", sc.ExpiresAt.UTC().Format(time.RFC3339))
+	if sc.Reason != "" {
+		msg += ": " + sc.Reason
+	}
+	return status.Error(codes.PermissionDenied, msg)
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package main
+
+// fileLocking reports whether lockFile excludes other processes.
+const fileLocking = false
+
+// lockFile does nothing where flock is unavailable: a file is only safe to
+// share between servers on Unix, or through a Redis sanctions store.
+func lockFile(path string) (unlock func(), err error) {
+	return func() {}, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisSanctionsKey        = "simple-grpc-game:sanctions"         // Hash of sanction ID -> JSON
+	redisSanctionsVersionKey = "simple-grpc-game:sanctions:version" // Incremented by every change
+	redisSanctionsTimeout    = 2 * time.Second
+)
+
+// redisSanctions keeps sanctions in a Redis hash shared by every server
+// pointed at the same database. Each change touches only its own sanctions,
+// so concurrent changes from several servers never undo each other's, and a
+// version counter lets servers skip reloading when nothing changed.
+type redisSanctions struct {
+	client  *redis.Client
+	version int64 // Of the sanctions last loaded; -1 before the first load
+}
+
+// openRedisSanctions connects to the Redis server at url and checks that it
+// answers.
+func openRedisSanctions(url string) (*redisSanctions, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), redisSanctionsTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect to Redis at %s: %w", opts.Addr, err)
+	}
+	log.Printf("Keeping sanctions in Redis at %s", opts.Addr)
+	return &redisSanctions{client: client, version: -1}, nil
+}
+
+func (r *redisSanctions) load(force bool) ([]*sanction, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisSanctionsTimeout)
+	defer cancel()
+	version, err := r.client.Get(ctx, redisSanctionsVersionKey).Int64()
+	if errors.Is(err, redis.Nil) {
+		version, err = 0, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !force && version == r.version {
+		return nil, false, nil
+	}
+	fields, err := r.client.HGetAll(ctx, redisSanctionsKey).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now()
+	saved := make([]*sanction, 0, len(fields))
+	var expired []string
+	for id, data := range fields {
+		sc := &sanction{}
+		if err := json.Unmarshal([]byte(data), sc); err != nil {
+			log.Printf("Warning: Skipping unreadable sanction %s in Redis: %v", id, err)
+			continue
+		}
+		if !now.Before(sc.ExpiresAt) {
+			expired = append(expired, id)
+			continue
+		}
+		saved = append(saved, sc)
+	}
+	if len(expired) > 0 {
+		// Dropped without a version change: no server enforces them anyway.
+		r.client.HDel(ctx, redisSanctionsKey, expired...)
+	}
+	r.version = version
+	return saved, true, nil
+}
+
+func (r *redisSanctions) put(sc *sanction) error {
+	data, err := json.Marshal(sc)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisSanctionsTimeout)
+	defer cancel()
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, redisSanctionsKey, sc.ID, data)
+		pipe.Incr(ctx, redisSanctionsVersionKey)
+		return nil
+	})
+	return err
+}
+
+func (r *redisSanctions) remove(ids []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisSanctionsTimeout)
+	defer cancel()
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, redisSanctionsKey, ids...)
+		pipe.Incr(ctx, redisSanctionsVersionKey)
+		return nil
+	})
+	return err
+}
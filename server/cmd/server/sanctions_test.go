@@ -0,0 +1,39 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// Servers sharing a sanctions file must not lose each other's sanctions.
+func TestSanctionStoresShareFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sanctions.json")
+	open := func() *sanctionStore {
+		st, err := openSanctionStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+	stores := []*sanctionStore{open(), open()}
+	const perStore = 20
+	var wg sync.WaitGroup
+	for _, st := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perStore {
+				if _, err := st.add(pb.SanctionKind_SANCTION_MUTE, "troll", "", 0, ""); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got := len(open().list()); got != len(stores)*perStore {
+		t.Fatalf("file holds %d sanctions, want %d", got, len(stores)*perStore)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"simple-grpc-game/server/internal/game"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const handoffTicketTTL = 30 * time.Second
+
+// shardFile is the -shards file every server of a sharded world shares: the
+// map whose world is split, the secret handoff tickets are signed with, and
+// the zones.
+type shardFile struct {
+	Map    string      `json:"map"`
+	Secret string      `json:"secret"`
+	Zones  []shardZone `json:"zones"`
+}
+
+// shardZone is a rectangle of the map, in tiles, and the address clients
+// reach its server at.
+type shardZone struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+}
+
+func (z *shardZone) contains(tileX, tileY int) bool {
+	return tileX >= z.X && tileX < z.X+z.Width && tileY >= z.Y && tileY < z.Y+z.Height
+}
+
+// sharding splits a map's world room between servers by zone. Each server
+// loads the whole map but hosts only the players in its own zone: a player
+// who walks out of it is handed off to the server of the zone they entered,
+// with a signed ticket that places them there.
+type sharding struct {
+	file     shardFile
+	self     *shardZone
+	roomID   string // World room of the sharded map
+	tileSize int
+
+	mu   sync.Mutex
+	used map[string]time.Time // Tickets already redeemed, until they expire
+}
+
+// handoffTicket is what a ticket vouches for.
+type handoffTicket struct {
+	Username string  `json:"u"`
+	Map      string  `json:"m"`
+	Zone     string  `json:"z"`
+	X        float32 `json:"x"`
+	Y        float32 `json:"y"`
+	Skin     string  `json:"s,omitempty"`
+	Expires  int64   `json:"e"` // Unix milliseconds
+}
+
+// loadSharding reads the -shards file and picks this server's zone; an empty
+// path disables sharding.
+func loadSharding(path, zoneID string, rooms *roomManager) (*sharding, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sh := &sharding{used: make(map[string]time.Time)}
+	if err := json.Unmarshal(data, &sh.file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if sh.file.Secret == "" {
+		return nil, errors.New("a secret to sign handoff tickets with is required")
+	}
+	for i := range sh.file.Zones {
+		z := &sh.file.Zones[i]
+		if z.ID == "" || z.Address == "" || z.Width <= 0 || z.Height <= 0 {
+			return nil, fmt.Errorf("zone %d needs an id, an address and a size", i)
+		}
+		if z.ID == zoneID {
+			sh.self = z
+		}
+	}
+	if sh.self == nil {
+		return nil, fmt.Errorf("no zone %q in %s; set -shard-zone to one of its zones", zoneID, path)
+	}
+	if sh.roomID, err = rooms.worldRoomID(sh.file.Map); err != nil {
+		return nil, fmt.Errorf("sharded map %q is not one of -maps", sh.file.Map)
+	}
+	rm, _ := rooms.get(sh.roomID)
+	if _, _, _, sh.tileSize, err = rm.state.GetMapDataAndDimensions(); err != nil {
+		return nil, err
+	}
+	log.Printf("Hosting zone %s of the %s world (%d zones)", sh.self.ID, sh.file.Map, len(sh.file.Zones))
+	return sh, nil
+}
+
+// zoneAt returns the zone a point of the map is in, or nil in a gap between
+// zones.
+func (sh *sharding) zoneAt(x, y float32) *shardZone {
+	tileX, tileY := int(x)/sh.tileSize, int(y)/sh.tileSize
+	for i := range sh.file.Zones {
+		if sh.file.Zones[i].contains(tileX, tileY) {
+			return &sh.file.Zones[i]
+		}
+	}
+	return nil
+}
+
+func (sh *sharding) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(sh.file.Secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// issue signs a ticket for a player leaving for another zone.
+func (sh *sharding) issue(t handoffTicket) string {
+	t.Map = sh.file.Map
+	t.Expires = time.Now().Add(handoffTicketTTL).UnixMilli()
+	data, _ := json.Marshal(t)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + sh.sign(payload)
+}
+
+// redeem checks a ticket presented to this server. Each ticket is good for
+// one join. Errors are gRPC status errors.
+func (sh *sharding) redeem(ticket string) (handoffTicket, error) {
+	var t handoffTicket
+	payload, sig, ok := strings.Cut(ticket, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(sh.sign(payload))) {
+		return t, status.Error(codes.Unauthenticated, "invalid handoff ticket")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || json.Unmarshal(data, &t) != nil {
+		return t, status.Error(codes.Unauthenticated, "invalid handoff ticket")
+	}
+	now := time.Now()
+	if now.UnixMilli() > t.Expires {
+		return t, status.Error(codes.Unauthenticated, "handoff ticket expired; join again")
+	}
+	if t.Zone != sh.self.ID || t.Map != sh.file.Map {
+		return t, status.Errorf(codes.FailedPrecondition, "handoff ticket is for zone %s, not this server's %s", t.Zone, sh.self.ID)
+	}
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	for used, expires := range sh.used {
+		if now.After(expires) {
+			delete(sh.used, used)
+		}
+	}
+	if _, ok := sh.used[sig]; ok {
+		return t, status.Error(codes.AlreadyExists, "handoff ticket already used")
+	}
+	sh.used[sig] = time.UnixMilli(t.Expires)
+	return t, nil
+}
+
+// handoffDisconnect ends a player's stream, telling the client where to
+// carry on.
+func handoffDisconnect(zone *shardZone, ticket string) disconnect {
+	return disconnect{
+		notice: &pb.DisconnectNotice{
+			Reason:  "handoff",
+			Message: "Crossing into zone " + zone.ID + ".",
+			Handoff: &pb.ZoneHandoff{ZoneId: zone.ID, Address: zone.Address, Ticket: ticket},
+		},
+		eventType: game.EventZoneHandoff,
+		event:     map[string]any{"zone": zone.ID},
+	}
+}
+
+// tickHandoffs hands off connected players who have left this server's zone
+// for another. Bots stay, and so do players in gaps between zones.
+func (s *gameServer) tickHandoffs() {
+	sh := s.shards
+	rm, ok := s.rooms.get(sh.roomID)
+	if !ok {
+		return
+	}
+	snapshot := rm.state.AcquirePlayerSnapshot()
+	defer snapshot.Release()
+	for _, p := range snapshot.Players {
+		zone := sh.zoneAt(p.GetXPos(), p.GetYPos())
+		if zone == nil || zone == sh.self || rm.isBot(p.GetId()) {
+			continue
+		}
+		ticket := sh.issue(handoffTicket{Username: p.GetUsername(), Zone: zone.ID, X: p.GetXPos(), Y: p.GetYPos(), Skin: p.GetSkin()})
+		s.kicks.kick(p.GetId(), handoffDisconnect(zone, ticket))
+	}
+}
+
+// redeemHandoff checks a ClientHello's handoff ticket, returning what it
+// vouches for. Errors are gRPC status errors.
+func (s *gameServer) redeemHandoff(ticket string) (*handoffTicket, error) {
+	if s.shards == nil {
+		return nil, status.Error(codes.FailedPrecondition, "this server hosts no sharded world")
+	}
+	t, err := s.shards.redeem(ticket)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// joinHandoff returns the sharded world room a handed off player joins.
+func (s *gameServer) joinHandoff() (*room, error) {
+	rm, ok := s.rooms.get(s.shards.roomID)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "room %s not found", s.shards.roomID)
+	}
+	return rm, nil
+}
+
+// expectHandoffPlayer places a handed off player where they crossed into
+// this server's zone, rather than at a stored position or a spawn point.
+func expectHandoffPlayer(rm *room, t *handoffTicket) {
+	if t != nil {
+		rm.state.ExpectPlayer(t.Username, t.X, t.Y, time.Now())
+	}
+}
+
+// GetZoneDirectory describes the sharded world, if any, and the servers
+// hosting its zones.
+func (s *gameServer) GetZoneDirectory(ctx context.Context, req *pb.ZoneDirectoryRequest) (*pb.ZoneDirectory, error) {
+	dir := &pb.ZoneDirectory{}
+	if s.shards == nil {
+		return dir, nil
+	}
+	dir.MapName = s.shards.file.Map
+	dir.ThisZoneId = s.shards.self.ID
+	for _, z := range s.shards.file.Zones {
+		dir.Zones = append(dir.Zones, &pb.Zone{Id: z.ID, Address: z.Address, X: int32(z.X), Y: int32(z.Y), Width: int32(z.Width), Height: int32(z.Height)})
+	}
+	return dir, nil
+}
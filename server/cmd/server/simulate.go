@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"log"
+	"simple-grpc-game/server/internal/game"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Limits for a single Simulate call.
+const (
+	maxSimulationPlayers = 16
+	maxSimulationTicks   = 1000
+)
+
+// Simulate runs a scripted scenario on a sandbox state that is never
+// registered with the room manager, so it cannot affect live players. Each
+// tick applies every held input once, then slides, just as the live tick
+// does. Timers (respawn cooldown, invulnerability) still use the wall clock.
+func (s *gameServer) Simulate(ctx context.Context, req *pb.SimulationRequest) (*pb.SimulationResult, error) {
+	if !s.devRPCs {
+		return nil, status.Error(codes.PermissionDenied, "simulation is disabled on this server")
+	}
+	if len(req.GetPlayerIds()) > maxSimulationPlayers {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d players may be simulated", maxSimulationPlayers)
+	}
+	total := 0
+	for _, step := range req.GetSteps() {
+		if step.GetTicks() < 0 {
+			return nil, status.Error(codes.InvalidArgument, "ticks must not be negative")
+		}
+		total += int(step.GetTicks())
+	}
+	if total > maxSimulationTicks {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d ticks may be simulated", maxSimulationTicks)
+	}
+
+	mapName := req.GetMapName()
+	if mapName == "" {
+		mapName = s.rooms.lobbyMap()
+	}
+	mapPath, ok := s.rooms.allowedMaps[mapName]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "map %q is not allowed", mapName)
+	}
+	sandbox, err := game.NewStateFromFile(mapPath)
+	if err != nil {
+		return nil, status.Errorf(gameErrorCode(err), "failed to load map: %v", err)
+	}
+	sandbox.EnableAudit()
+
+	players := make(map[string]bool)
+	for _, id := range req.GetPlayerIds() {
+		if id == "" || players[id] {
+			return nil, status.Errorf(codes.InvalidArgument, "player ids must be unique and non-empty")
+		}
+		players[id] = true
+		sandbox.AddPlayer(id, id)
+	}
+
+	result := &pb.SimulationResult{}
+	tick := 0
+	for i, step := range req.GetSteps() {
+		held := make(map[string]pb.PlayerInput_Direction)
+		for _, in := range step.GetInputs() {
+			if !players[in.GetPlayerId()] {
+				return nil, status.Errorf(codes.InvalidArgument, "step %d: unknown player %q", i, in.GetPlayerId())
+			}
+			held[in.GetPlayerId()] = in.GetDirection()
+		}
+		for t := 0; t < int(step.GetTicks()); t++ {
+			if err := ctx.Err(); err != nil {
+				return nil, status.FromContextError(err).Err()
+			}
+			simulateTick(sandbox, req.GetPlayerIds(), held)
+			tick++
+		}
+		result.Snapshots = append(result.Snapshots, &pb.SimulationSnapshot{
+			Tick:         int32(tick),
+			Players:      sandbox.GetAllPlayers(),
+			ChangedTiles: sandbox.TakeTileUpdates(),
+		})
+	}
+	if n := sandbox.AuditViolations(); n > 0 {
+		return nil, status.Errorf(codes.Internal, "simulation hit %d audit violations", n)
+	}
+	log.Printf("Simulated %d ticks with %d players on map %s", tick, len(players), mapName)
+	return result, nil
+}
+
+// simulateTick advances the sandbox by one tick. Players are processed in
+// request order so runs are reproducible.
+func simulateTick(state *game.State, playerIDs []string, held map[string]pb.PlayerInput_Direction) {
+	for _, id := range playerIDs {
+		state.ApplyInput(id, held[id])
+	}
+	now := time.Now()
+	state.ApplySlides(now)
+	state.ExpireInvulnerability(now)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+const defaultSleepAfter = 10 * time.Second
+
+// roomSleep lets a room nobody is in or watching stop simulating, so tick
+// cost follows the areas in play rather than every hosted world. Everything
+// time-based (invulnerability, slides) works from the clock, so a woken room
+// catches up on its first tick without replaying the ticks it skipped.
+type roomSleep struct {
+	after      time.Duration // Quiet time before sleeping; 0 never sleeps
+	quietSince time.Time     // Only used by the room's tick
+	asleep     atomic.Bool
+}
+
+// sleepWhenIdle makes rooms sleep after being empty for after; 0 keeps
+// every room ticking.
+func (m *roomManager) sleepWhenIdle(after time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sleepAfter = after
+	for _, r := range m.rooms {
+		r.sleep.after = after
+	}
+}
+
+// sleeping reports whether the room should skip this tick, logging when it
+// falls asleep or wakes up.
+func (r *room) sleeping(now time.Time) bool {
+	sl := &r.sleep
+	if sl.after <= 0 {
+		return false
+	}
+	if r.state.PlayerCount() > 0 || r.spectators.watching() {
+		sl.quietSince = time.Time{}
+		if sl.asleep.Swap(false) {
+			log.Printf("Room %s woke up.", r.id)
+		}
+		return false
+	}
+	if sl.quietSince.IsZero() {
+		sl.quietSince = now
+	}
+	if now.Sub(sl.quietSince) < sl.after {
+		return false
+	}
+	if !sl.asleep.Swap(true) {
+		log.Printf("Room %s has been empty for %v; sleeping until someone joins.", r.id, sl.after)
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GetFullSnapshot implements the unary RPC returning the complete current
+// state of a room, so reconnecting clients can resync in one round trip.
+func (s *gameServer) GetFullSnapshot(ctx context.Context, req *pb.FullSnapshotRequest) (*pb.FullSnapshot, error) {
+	roomID := req.GetRoomId()
+	if roomID == "" {
+		roomID = defaultRoomID
+	}
+	rm, ok := s.rooms.get(roomID)
+	if !ok || rm.expired(time.Now()) {
+		return nil, status.Errorf(codes.NotFound, "room %s not found", roomID)
+	}
+	if !rm.checkPassword(req.GetRoomPassword()) {
+		log.Printf("Rejected snapshot of room %s: bad password.", roomID)
+		return nil, status.Errorf(codes.PermissionDenied, "invalid password for room %s", roomID)
+	}
+	return rm.snapshot(s.governor.interval()), nil
+}
+
+// snapshot captures the room's map and players. The tick counter is read
+// first, so the snapshot reflects at least that many completed ticks.
+func (r *room) snapshot(tickInterval time.Duration) *pb.FullSnapshot {
+	tick := r.ticks.Load()
+	players, tiles, tileSize := r.state.Snapshot()
+	rows := make([]*pb.MapRow, len(tiles))
+	for y, row := range tiles {
+		rowTiles := make([]int32, len(row))
+		for x, t := range row {
+			rowTiles[x] = int32(t)
+		}
+		rows[y] = &pb.MapRow{Tiles: rowTiles}
+	}
+	return &pb.FullSnapshot{
+		Room:           r.info(),
+		Tick:           tick,
+		Rows:           rows,
+		TileSizePixels: int32(tileSize),
+		Players:        players,
+		Items:          r.state.Items(),
+		Npcs:           r.state.NPCs(),
+		TickIntervalMs: int32(tickInterval.Milliseconds()),
+	}
+}
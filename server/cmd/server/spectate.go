@@ -0,0 +1,184 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"sync"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	maxTrailLength  = 64 // Positions kept per player for ghost trails
+	spectatorBuffer = 8  // Frames queued per spectator before new ones are dropped
+)
+
+// spectator is one Spectate stream's subscription to a room.
+type spectator struct {
+	frames      chan *preparedMessage // SpectatorFrames; closed when the room is torn down
+	trailLength int
+}
+
+// spectatorSet sends each of a room's spectators a frame per tick. Player
+// positions for ghost trails are only recorded while a spectator wants them,
+// so rooms nobody watches pay nothing and player streams never carry trails.
+type spectatorSet struct {
+	mu       sync.Mutex
+	watchers map[*spectator]bool
+	trails   map[string][]*pb.TrailPoint // Player ID -> recent positions, oldest first
+	closed   bool
+}
+
+func (sp *spectatorSet) add(trailLength int) (*spectator, bool) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.closed {
+		return nil, false
+	}
+	if sp.watchers == nil {
+		sp.watchers = make(map[*spectator]bool)
+	}
+	w := &spectator{frames: make(chan *preparedMessage, spectatorBuffer), trailLength: trailLength}
+	sp.watchers[w] = true
+	return w, true
+}
+
+// watching reports whether anyone is spectating.
+func (sp *spectatorSet) watching() bool {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return len(sp.watchers) > 0
+}
+
+func (sp *spectatorSet) remove(w *spectator) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	delete(sp.watchers, w)
+}
+
+// close ends every spectator stream of a room that is being torn down.
+func (sp *spectatorSet) close() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.closed = true
+	for w := range sp.watchers {
+		close(w.frames)
+	}
+	sp.watchers = nil
+}
+
+// recordLocked appends the players' positions to their trails, dropping the
+// trails of players who have left. Must be called with sp.mu held.
+func (sp *spectatorSet) recordLocked(players []*pb.Player, tick uint64) {
+	trails := make(map[string][]*pb.TrailPoint, len(players))
+	for _, p := range players {
+		trail := sp.trails[p.Id]
+		if n := len(trail); n == 0 || trail[n-1].XPos != p.XPos || trail[n-1].YPos != p.YPos {
+			trail = append(trail, &pb.TrailPoint{XPos: p.XPos, YPos: p.YPos, Tick: tick})
+			if len(trail) > maxTrailLength {
+				trail = trail[len(trail)-maxTrailLength:]
+			}
+		}
+		trails[p.Id] = trail
+	}
+	sp.trails = trails
+}
+
+// trailsLocked returns the last n points of each player's trail.
+// Must be called with sp.mu held.
+func (sp *spectatorSet) trailsLocked(players []*pb.Player, n int) []*pb.PlayerTrail {
+	out := make([]*pb.PlayerTrail, 0, len(players))
+	for _, p := range players {
+		points := sp.trails[p.Id]
+		if len(points) > n {
+			points = points[len(points)-n:]
+		}
+		out = append(out, &pb.PlayerTrail{PlayerId: p.Id, Points: points})
+	}
+	return out
+}
+
+// publishSpectatorFrame sends the room's players, and the trails each
+// spectator asked for, after a tick. Each frame is marshaled once for every
+// spectator with the same trail length. Spectators too slow to keep up miss
+// frames rather than holding up the tick.
+func (r *room) publishSpectatorFrame() {
+	sp := &r.spectators
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if len(sp.watchers) == 0 {
+		sp.trails = nil
+		return
+	}
+	tick := r.ticks.Load()
+	players := r.state.GetAllPlayers()
+	sort.Slice(players, func(i, j int) bool { return players[i].Id < players[j].Id })
+	npcs := r.state.NPCs()
+	wantTrails := false
+	for w := range sp.watchers {
+		wantTrails = wantTrails || w.trailLength > 0
+	}
+	if wantTrails {
+		sp.recordLocked(players, tick)
+	} else {
+		sp.trails = nil
+	}
+	frames := make(map[int]*preparedMessage) // Trail length -> frame
+	for w := range sp.watchers {
+		prepared, ok := frames[w.trailLength]
+		if !ok {
+			frame := &pb.SpectatorFrame{Tick: tick, Players: players, Npcs: npcs}
+			if w.trailLength > 0 {
+				frame.Trails = sp.trailsLocked(players, w.trailLength)
+			}
+			var err error
+			if prepared, err = prepareMessage(frame); err != nil {
+				log.Printf("Error encoding spectator frame for room %s: %v", r.id, err)
+				return
+			}
+			frames[w.trailLength] = prepared
+		}
+		select {
+		case w.frames <- prepared:
+		default:
+		}
+	}
+}
+
+// Spectate implements the server-streaming RPC for watching a room without
+// joining it.
+func (s *gameServer) Spectate(req *pb.SpectateRequest, stream pb.GameService_SpectateServer) error {
+	rm, err := s.rooms.joinable(req.GetRoomId(), req.GetRoomPassword())
+	if err != nil {
+		return err
+	}
+	trailLength := int(req.GetTrailLength())
+	if trailLength < 0 {
+		return status.Error(codes.InvalidArgument, "trail_length must not be negative")
+	}
+	trailLength = min(trailLength, maxTrailLength)
+	w, ok := rm.spectators.add(trailLength)
+	if !ok {
+		return status.Errorf(codes.NotFound, "room %s not found", rm.id)
+	}
+	defer rm.spectators.remove(w)
+	log.Printf("Spectator joined room %s (trail length %d).", rm.id, trailLength)
+	defer log.Printf("Spectator left room %s.", rm.id)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case frame, ok := <-w.frames:
+			if !ok {
+				return status.Errorf(codes.Unavailable, "room %s was closed", rm.id)
+			}
+			if err := stream.SendMsg(frame); err != nil {
+				return err
+			}
+			rm.recordSend(len(frame.data))
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// GetServerStats returns uptime, load and bandwidth, the headline numbers of
+// the status page, for dashboards to poll.
+func (a *adminServer) GetServerStats(ctx context.Context, req *pb.GetServerStatsRequest) (*pb.ServerStats, error) {
+	if err := a.authorize(ctx, scopeReadStatus); err != nil {
+		return nil, err
+	}
+	s := a.game
+	stats := &pb.ServerStats{
+		UptimeSeconds:  int64(time.Since(s.startTime).Seconds()),
+		StartedAtUnix:  s.startTime.Unix(),
+		TickIntervalMs: int32(s.governor.interval().Milliseconds()),
+		BytesSent:      s.metrics.bytesSent.Load(),
+		MessagesSent:   s.metrics.messagesSent.Load(),
+		StreamErrors:   s.metrics.streamErrors.Load(),
+
+		UncompressedBytes: s.metrics.payloadBytes.Load(),
+		CompressedBytes:   s.metrics.compressedBytes.Load(),
+		CpuSeconds:        processCPUSeconds(),
+		SnapshotsDropped:  s.metrics.snapshotsDropped.Load(),
+		SlowDisconnects:   s.metrics.slowDisconnects.Load(),
+	}
+	rooms := s.rooms.all()
+	stats.Rooms = int32(len(rooms))
+	for _, rm := range rooms {
+		stats.Players += int32(rm.state.PlayerCount())
+	}
+	if ticks := s.tickHistory.snapshot(); len(ticks) > 0 {
+		var total, longest time.Duration
+		for _, d := range ticks {
+			total += d
+			longest = max(longest, d)
+		}
+		stats.AvgTickMicros = (total / time.Duration(len(ticks))).Microseconds()
+		stats.MaxTickMicros = longest.Microseconds()
+	}
+	if trend := s.history.snapshot(); len(trend) > 0 {
+		stats.BytesPerSecond = int64(float64(trend[len(trend)-1].BytesSent) / metricsSampleInterval.Seconds())
+	}
+	return stats, nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// processCPUSeconds reports no CPU time where getrusage is unavailable.
+func processCPUSeconds() float64 {
+	return 0
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"net/http"
+	"simple-grpc-game/server/internal/game"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	tickHistorySize  = 600 // One minute of samples at the default tick rate
+	mapPreviewScale  = 4   // Pixels per tile in the map preview
+	tickGraphWidth   = 600
+	tickGraphHeight  = 120
+	statusPageMaxAge = 5 // Seconds between automatic page refreshes
+)
+
+// tickHistory is a fixed-size ring of recent tick durations.
+type tickHistory struct {
+	mu      sync.Mutex
+	samples [tickHistorySize]time.Duration
+	next    int
+	count   int
+}
+
+func (h *tickHistory) record(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.samples[h.next] = d
+	h.next = (h.next + 1) % tickHistorySize
+	if h.count < tickHistorySize {
+		h.count++
+	}
+}
+
+// snapshot returns the recorded samples, oldest first.
+func (h *tickHistory) snapshot() []time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]time.Duration, 0, h.count)
+	start := (h.next - h.count + tickHistorySize) % tickHistorySize
+	for i := 0; i < h.count; i++ {
+		out = append(out, h.samples[(start+i)%tickHistorySize])
+	}
+	return out
+}
+
+// svgPoints renders values as SVG polyline points, spreading them over slots
+// horizontal positions and scaling them so maxV reaches the top of the graph.
+func svgPoints(values []float64, slots int, maxV float64) string {
+	if maxV <= 0 {
+		maxV = 1
+	}
+	var b strings.Builder
+	for i, v := range values {
+		x := float64(i) * tickGraphWidth / float64(slots)
+		y := tickGraphHeight - v/maxV*tickGraphHeight
+		fmt.Fprintf(&b, "%.1f,%.1f ", x, y)
+	}
+	return b.String()
+}
+
+// tickGraphPoints renders samples as SVG polyline points scaled to the graph,
+// returning the points and the maximum sample used for scaling.
+func tickGraphPoints(samples []time.Duration, budget time.Duration) (string, time.Duration) {
+	maxD := budget // Always show the budget line within the graph
+	values := make([]float64, len(samples))
+	for i, d := range samples {
+		if d > maxD {
+			maxD = d
+		}
+		values[i] = float64(d)
+	}
+	return svgPoints(values, tickHistorySize, float64(maxD)), maxD
+}
+
+// trendGraphPoints renders the player count and bandwidth history.
+func trendGraphPoints(samples []metricsSample) (players string, maxPlayers int, bandwidth string, maxKBps float64) {
+	pv := make([]float64, len(samples))
+	bv := make([]float64, len(samples))
+	for i, sm := range samples {
+		pv[i] = float64(sm.Players)
+		if sm.Players > maxPlayers {
+			maxPlayers = sm.Players
+		}
+		bv[i] = float64(sm.BytesSent) / 1024 / metricsSampleInterval.Seconds()
+		if bv[i] > maxKBps {
+			maxKBps = bv[i]
+		}
+	}
+	return svgPoints(pv, metricsHistorySize, float64(maxPlayers)), maxPlayers,
+		svgPoints(bv, metricsHistorySize, maxKBps), maxKBps
+}
+
+type statusRoom struct {
+	ID, Name, Map, Mode string
+	Players, MaxPlayers int
+	Expires             string
+	Asleep              bool
+	Paused              bool
+	TickPercent         float64 // Share of the tick interval spent ticking the room
+	KBPerSec            float64
+	OverBudget          bool
+	Throttled           bool
+	PlayerRows          []statusPlayer
+}
+
+type statusPlayer struct {
+	ID, Username string
+	X, Y         float32
+	Latency      latencySummary // Zero Samples if the client does not sync its clock
+	RTT          time.Duration  // Smoothed ping round trip; zero until measured
+}
+
+type statusPage struct {
+	Now         string
+	Uptime      time.Duration
+	RefreshSecs int
+	Rooms       []statusRoom
+	TotalPlayer int
+	SampleCount int
+	GraphPoints string
+	GraphMax    time.Duration
+	BudgetY     float64
+	GraphWidth  int
+	GraphHeight int
+	LastTick    time.Duration
+	TrendCount  int
+	TrendSpan   time.Duration
+	PlayerLine  string
+	MaxPlayers  int
+	BytesLine   string
+	MaxKBps     float64
+	Interval    time.Duration
+	Slowdowns   int64
+	Speedups    int64
+	Desyncs     int64
+	Payload     int64 // gRPC bytes sent before compression
+	Compressed  int64
+	Dropped     int64 // Stale deltas dropped for slow clients
+	SlowKicks   int64
+}
+
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta http-equiv="refresh" content="{{.RefreshSecs}}">
+<title>Game server status</title>
+<style>body{font-family:monospace;background:#111;color:#ddd}table{border-collapse:collapse}td,th{padding:2px 8px;border-bottom:1px solid #333;text-align:left}img{image-rendering:pixelated;border:1px solid #444}</style>
+</head><body>
+<h1>Game server status</h1>
+<p>{{.Now}} &middot; uptime {{.Uptime}} &middot; {{.TotalPlayer}} players in {{len .Rooms}} rooms</p>
+<p>tick interval {{.Interval}} &middot; {{.Slowdowns}} slowdowns &middot; {{.Speedups}} speedups &middot; {{.Desyncs}} desync reports</p>
+<p>gRPC sent {{.Payload}} bytes, {{.Compressed}} after compression</p>
+<p>{{.Dropped}} stale snapshots dropped for slow clients &middot; {{.SlowKicks}} clients disconnected as too slow</p>
+<h2>Tick duration (last {{.SampleCount}} samples, max {{.GraphMax}}, last {{.LastTick}})</h2>
+<svg width="{{.GraphWidth}}" height="{{.GraphHeight}}" style="background:#222">
+<line x1="0" y1="{{.BudgetY}}" x2="{{.GraphWidth}}" y2="{{.BudgetY}}" stroke="#a33" stroke-dasharray="4"/>
+<polyline fill="none" stroke="#4c4" points="{{.GraphPoints}}"/>
+</svg>
+<h2>Trends ({{.TrendCount}} samples over {{.TrendSpan}}; players max {{.MaxPlayers}}, bandwidth max {{printf "%.1f" .MaxKBps}} KB/s)</h2>
+<svg width="{{.GraphWidth}}" height="{{.GraphHeight}}" style="background:#222">
+<polyline fill="none" stroke="#4af" points="{{.PlayerLine}}"/>
+<polyline fill="none" stroke="#fa4" points="{{.BytesLine}}"/>
+</svg>
+<p><a href="/metrics/history">history JSON</a></p>
+{{range .Rooms}}
+<h2>Room {{.ID}} &ndash; {{.Name}}</h2>
+<p>map {{.Map}} &middot; mode {{.Mode}} &middot; {{.Players}}/{{.MaxPlayers}} players{{if .Expires}} &middot; expires {{.Expires}}{{end}}{{if .Asleep}} &middot; asleep{{end}}{{if .Paused}} &middot; <strong>paused</strong>{{end}}</p>
+<p>tick {{printf "%.1f" .TickPercent}}% &middot; {{printf "%.1f" .KBPerSec}} KB/s{{if .Throttled}} &middot; <strong>throttled: over budget</strong>{{else if .OverBudget}} &middot; <strong>over budget</strong>{{end}}</p>
+<img src="/map.png?room={{.ID}}" alt="map preview">
+<table><tr><th>ID</th><th>Username</th><th>X</th><th>Y</th><th>RTT</th><th>Input latency p50</th><th>p95</th><th>max</th><th>samples</th></tr>
+{{range .PlayerRows}}<tr><td>{{.ID}}</td><td>{{.Username}}</td><td>{{printf "%.0f" .X}}</td><td>{{printf "%.0f" .Y}}</td><td>{{if .RTT}}{{.RTT}}{{else}}&ndash;{{end}}</td>{{with .Latency}}{{if .Samples}}<td>&le;{{.P50}}</td><td>&le;{{.P95}}</td><td>{{.Max}}</td><td>{{.Samples}}</td>{{else}}<td colspan="4">not synced</td>{{end}}{{end}}</tr>
+{{end}}</table>
+{{end}}
+</body></html>
+`))
+
+// statusHandler serves the read-only HTML status page.
+func (s *gameServer) statusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	samples := s.tickHistory.snapshot()
+	interval := s.governor.interval()
+	points, maxD := tickGraphPoints(samples, interval)
+	page := statusPage{
+		Now:         time.Now().Format(time.RFC3339),
+		Uptime:      time.Since(s.startTime).Truncate(time.Second),
+		RefreshSecs: statusPageMaxAge,
+		SampleCount: len(samples),
+		GraphPoints: points,
+		GraphMax:    maxD,
+		BudgetY:     tickGraphHeight - float64(interval)/float64(maxD)*tickGraphHeight,
+		GraphWidth:  tickGraphWidth,
+		GraphHeight: tickGraphHeight,
+		Interval:    interval,
+		Slowdowns:   s.governor.slowdowns.Load(),
+		Speedups:    s.governor.speedups.Load(),
+		Desyncs:     s.metrics.desyncReports.Load(),
+		Payload:     s.metrics.payloadBytes.Load(),
+		Compressed:  s.metrics.compressedBytes.Load(),
+		Dropped:     s.metrics.snapshotsDropped.Load(),
+		SlowKicks:   s.metrics.slowDisconnects.Load(),
+	}
+	if len(samples) > 0 {
+		page.LastTick = samples[len(samples)-1]
+	}
+	trend := s.history.snapshot()
+	page.TrendCount = len(trend)
+	if len(trend) > 1 {
+		page.TrendSpan = trend[len(trend)-1].Time.Sub(trend[0].Time).Truncate(time.Second)
+	}
+	page.PlayerLine, page.MaxPlayers, page.BytesLine, page.MaxKBps = trendGraphPoints(trend)
+	for _, rm := range s.rooms.all() {
+		sr := statusRoom{ID: rm.id, Name: rm.name, Map: rm.mapName, Mode: rm.mode, MaxPlayers: rm.maxPlayers, Asleep: rm.sleep.asleep.Load(), Paused: rm.paused()}
+		sr.TickPercent = float64(rm.budget.lastTickPermille.Load()) / 10
+		sr.KBPerSec = float64(rm.budget.lastBytesPerSec.Load()) / 1024
+		sr.OverBudget = rm.budget.over.Load()
+		sr.Throttled = rm.throttled()
+		if !rm.expiresAt.IsZero() {
+			sr.Expires = rm.expiresAt.Format(time.RFC3339)
+		}
+		snap := rm.state.AcquirePlayerSnapshot()
+		for _, p := range snap.Players {
+			row := statusPlayer{ID: p.Id, Username: p.Username, X: p.XPos, Y: p.YPos, RTT: rm.state.PlayerRTT(p.Id).Round(time.Millisecond)}
+			row.Latency, _ = s.inputLatencySummary(p.Id)
+			sr.PlayerRows = append(sr.PlayerRows, row)
+		}
+		snap.Release()
+		sr.Players = len(sr.PlayerRows)
+		page.TotalPlayer += sr.Players
+		page.Rooms = append(page.Rooms, sr)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusTemplate.Execute(w, page); err != nil {
+		log.Printf("Error rendering status page: %v", err)
+	}
+}
+
+// mapTileColors is the preview palette, mirroring the PNG map format.
+var mapTileColors = map[game.TileType]color.RGBA{
+	game.TileTypeEmpty:            {255, 255, 255, 255},
+	game.TileTypeWall:             {0, 0, 0, 255},
+	game.TileTypeSpawn:            {0, 255, 0, 255},
+	game.TileTypeTeleporter:       {255, 0, 255, 255},
+	game.TileTypeMud:              {139, 69, 19, 255},
+	game.TileTypeIce:              {173, 216, 230, 255},
+	game.TileTypeDoorClosed:       {0, 0, 160, 255},
+	game.TileTypeDoorOpen:         {150, 150, 255, 255},
+	game.TileTypeSwitch:           {255, 255, 0, 255},
+	game.TileTypeDestructibleWall: {128, 128, 128, 255},
+}
+
+// mapPreviewHandler renders a room's map with its players as a PNG.
+func (s *gameServer) mapPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	rm, ok := s.rooms.get(r.URL.Query().Get("room"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	grid, mapW, mapH, tileSize, err := rm.state.GetMapDataAndDimensions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	img := image.NewRGBA(image.Rect(0, 0, mapW*mapPreviewScale, mapH*mapPreviewScale))
+	for y := 0; y < mapH*mapPreviewScale; y++ {
+		for x := 0; x < mapW*mapPreviewScale; x++ {
+			c, known := mapTileColors[grid[y/mapPreviewScale][x/mapPreviewScale]]
+			if !known {
+				c = color.RGBA{128, 128, 128, 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	playerColor := color.RGBA{255, 0, 0, 255}
+	snap := rm.state.AcquirePlayerSnapshot()
+	defer snap.Release()
+	for _, p := range snap.Players {
+		cx := int(p.XPos) * mapPreviewScale / tileSize
+		cy := int(p.YPos) * mapPreviewScale / tileSize
+		for dy := -2; dy <= 2; dy++ {
+			for dx := -2; dx <= 2; dx++ {
+				img.SetRGBA(cx+dx, cy+dy, playerColor)
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "image/png")
+	if err := png.Encode(w, img); err != nil {
+		log.Printf("Error encoding map preview: %v", err)
+	}
+}
+
+// serveAdminHTTP starts the admin HTTP listener with the status page.
+// requireStatusScope guards an admin page with the read-status scope when
+// status authentication is enabled.
+func (s *gameServer) requireStatusScope(h http.HandlerFunc) http.HandlerFunc {
+	if !s.statusAuth {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authorizeBearer(r.Header.Values("Authorization"), s.adminToken, s.tokens, scopeReadStatus); err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, status.Convert(err).Message(), httpStatusFor(err))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// httpStatusFor maps an authorization error to an HTTP status code.
+func httpStatusFor(err error) int {
+	if status.Code(err) == codes.PermissionDenied {
+		return http.StatusForbidden
+	}
+	return http.StatusUnauthorized
+}
+
+func (s *gameServer) serveAdminHTTP(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.requireStatusScope(s.statusHandler))
+	mux.HandleFunc("/map.png", s.requireStatusScope(s.mapPreviewHandler))
+	mux.HandleFunc("/metrics/history", s.requireStatusScope(s.historyHandler))
+	log.Printf("Starting admin HTTP server on %s...", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Admin HTTP server stopped: %v", err)
+	}
+}
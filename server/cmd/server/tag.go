@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"simple-grpc-game/server/internal/game"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+const (
+	tagRoomMode      = "tag"
+	defaultMaxRewind = 250 * time.Millisecond
+	tagBackCooldown  = 2 * time.Second // The new "it" cannot tag back the player who tagged them for this long
+	tagPoints        = 1               // Score for tagging someone
+)
+
+// tagGame runs a game of tag: whoever is "it" passes it on by touching another
+// player. Touches are judged lag-compensated, against where the others were
+// when "it" saw them: their positions rewound by "it"'s latency, up to
+// maxRewind. Only the room's tick touches it.
+type tagGame struct {
+	lag         lagCompensation
+	it          string
+	taggedBy    string
+	immuneUntil time.Time                    // taggedBy cannot be tagged back before this
+	last        atomic.Pointer[pb.TagUpdate] // Latest announcement, for players joining later
+}
+
+// startTag turns a new room into a tag room.
+func (m *roomManager) startTag(r *room) {
+	r.tag = &tagGame{lag: m.lagCompensation()}
+	r.state.EnablePositionHistory()
+}
+
+// step picks a first "it" once two players are present, or passes it on to
+// a touched player, reporting whether "it" changed.
+func (t *tagGame) step(state *game.State, now time.Time) (rewind time.Duration, changed bool) {
+	if _, ok := state.GetPlayer(t.it); !ok {
+		ids := state.GetAllPlayerIDs()
+		if len(ids) < 2 {
+			t.it = ""
+			return 0, false
+		}
+		sort.Strings(ids)
+		t.it, t.taggedBy = ids[0], ""
+		return 0, true
+	}
+	rewind = t.lag.rewindFor(t.it, 0, now)
+	for _, id := range state.Touching(t.it, rewind) {
+		if id == t.taggedBy && now.Before(t.immuneUntil) {
+			continue
+		}
+		t.it, t.taggedBy = id, t.it
+		t.immuneUntil = now.Add(tagBackCooldown)
+		return rewind, true
+	}
+	return 0, false
+}
+
+// tickTag records positions for lag compensation and announces a new "it",
+// reporting whether the players changed.
+func (r *room) tickTag() bool {
+	if r.tag == nil {
+		return false
+	}
+	now := time.Now()
+	r.state.RecordPositions(now)
+	rewind, changed := r.tag.step(r.state, now)
+	if !changed {
+		return false
+	}
+	it, taggedBy := r.tag.it, r.tag.taggedBy
+	r.state.MarkIt(it)
+	text := fmt.Sprintf("%s is it!", r.usernameOf(it))
+	if taggedBy != "" {
+		r.state.AwardPoints(taggedBy, tagPoints, game.ScoreTag)
+		text = fmt.Sprintf("%s tagged %s. %s", r.usernameOf(taggedBy), r.usernameOf(it), text)
+	}
+	log.Printf("Tag room %s: %s (rewind %v)", r.id, text, rewind)
+	update := &pb.TagUpdate{
+		ItPlayerId:       it,
+		TaggedByPlayerId: taggedBy,
+		RewindMs:         int32(rewind.Milliseconds()),
+		ItSinceServerMs:  now.UnixMilli(),
+	}
+	r.tag.last.Store(update)
+	r.broadcast(&pb.ServerMessage{Message: &pb.ServerMessage_TagUpdate{TagUpdate: update}}, "tag")
+	r.broadcast(&pb.ServerMessage{Message: &pb.ServerMessage_ChatMessage{ChatMessage: &pb.ChatMessage{
+		SenderUsername: systemChatSender,
+		MessageText:    text,
+		Timestamp:      now.Unix(),
+	}}}, "tag chat")
+	return true
+}
+
+// tagMessage returns the latest tag announcement for a joining player, if
+// the room plays tag and its "it" is still there.
+func (r *room) tagMessage() (*pb.ServerMessage, bool) {
+	if r.tag == nil {
+		return nil, false
+	}
+	update := r.tag.last.Load()
+	if update == nil {
+		return nil, false
+	}
+	if _, ok := r.state.GetPlayer(update.ItPlayerId); !ok {
+		return nil, false
+	}
+	return &pb.ServerMessage{Message: &pb.ServerMessage_TagUpdate{TagUpdate: update}}, true
+}
+
+func (r *room) usernameOf(playerID string) string {
+	if p, ok := r.state.GetPlayer(playerID); ok {
+		return p.Username
+	}
+	return playerID
+}
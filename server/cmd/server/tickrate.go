@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// tickLevels are the tick intervals the governor steps through, fastest
+// first, at the default base interval; SetConfig can scale them.
+var tickLevels = []time.Duration{tickRate, 150 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 400 * time.Millisecond}
+
+const (
+	overloadTicks = 20 // Consecutive ticks over the interval before slowing down
+	recoverTicks  = 50 // Consecutive ticks with headroom before speeding up
+	// recoverHeadroom is the fraction of the next faster interval a tick must
+	// fit in to count towards recovery; well below 1 to avoid flapping.
+	recoverHeadroom = 0.5
+)
+
+// tickGovernor lowers the simulation frequency when ticks consistently
+// overrun their interval, and restores it once load drops, rather than letting
+// the ticker fall behind.
+type tickGovernor struct {
+	mu          sync.Mutex
+	level       int           // Index into tickLevels
+	over, under int           // Consecutive overloaded / comfortable ticks
+	base        time.Duration // Interval at full speed; zero is tickRate
+
+	slowdowns atomic.Int64
+	speedups  atomic.Int64
+}
+
+// interval returns the current tick interval.
+func (g *tickGovernor) interval() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.levelLocked(g.level)
+}
+
+// levelLocked returns the interval of a level, scaled to the base interval.
+// Must be called with g.mu held.
+func (g *tickGovernor) levelLocked(level int) time.Duration {
+	if g.base == 0 {
+		return tickLevels[level]
+	}
+	return time.Duration(int64(tickLevels[level]) * int64(g.base) / int64(tickRate))
+}
+
+// baseInterval returns the interval at full speed.
+func (g *tickGovernor) baseInterval() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.levelLocked(0)
+}
+
+// setBase changes the interval at full speed, scaling the slower levels to
+// match; the tick loop picks it up after its next tick.
+func (g *tickGovernor) setBase(d time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.base = d
+	g.over, g.under = 0, 0
+}
+
+// observe records a tick duration and returns the new interval if it changed.
+func (g *tickGovernor) observe(elapsed time.Duration) (time.Duration, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	current := g.levelLocked(g.level)
+	if elapsed > current {
+		g.over++
+		g.under = 0
+	} else if g.level > 0 && float64(elapsed) < float64(g.levelLocked(g.level-1))*recoverHeadroom {
+		g.under++
+		g.over = 0
+	} else {
+		g.over, g.under = 0, 0
+	}
+
+	switch {
+	case g.over >= overloadTicks && g.level < len(tickLevels)-1:
+		g.level++
+		g.slowdowns.Add(1)
+	case g.under >= recoverTicks:
+		g.level--
+		g.speedups.Add(1)
+	default:
+		return current, false
+	}
+	g.over, g.under = 0, 0
+	log.Printf("Tick interval changed from %v to %v (last tick %v; %d slowdowns, %d speedups)",
+		current, g.levelLocked(g.level), elapsed, g.slowdowns.Load(), g.speedups.Load())
+	return g.levelLocked(g.level), true
+}
+
+// tickRateMessage advertises the tick interval to clients.
+func tickRateMessage(interval time.Duration) *pb.ServerMessage {
+	return &pb.ServerMessage{Message: &pb.ServerMessage_TickRateUpdate{TickRateUpdate: &pb.TickRateUpdate{
+		TickIntervalMs: int32(interval.Milliseconds()),
+	}}}
+}
+
+// runTickLoop ticks the game, adjusting the ticker whenever the governor or
+// an operator changes the interval and telling every connected client about
+// it.
+func (s *gameServer) runTickLoop() {
+	current := s.governor.interval()
+	ticker := time.NewTicker(current)
+	defer ticker.Stop()
+	for range ticker.C {
+		elapsed := s.gameTick()
+		s.governor.observe(elapsed)
+		if interval := s.governor.interval(); interval != current {
+			current = interval
+			ticker.Reset(interval)
+			msg := tickRateMessage(interval)
+			for _, r := range s.rooms.all() {
+				r.broadcast(msg, "tick_rate")
+			}
+		}
+	}
+}
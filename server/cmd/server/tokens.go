@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// API token scopes. The admin scope allows everything.
+const (
+	scopeReadStatus = "read-status"
+	scopeChatBridge = "chat-bridge"
+	scopeKick       = "kick"
+	scopeAdmin      = "admin"
+)
+
+var validScopes = map[string]bool{scopeReadStatus: true, scopeChatBridge: true, scopeKick: true, scopeAdmin: true}
+
+// tokenLastUsedSaveInterval limits how often last-used times alone cause a save.
+const tokenLastUsedSaveInterval = time.Minute
+
+// apiToken is an issued token. Only a hash of its secret is kept.
+type apiToken struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Scopes     []string  `json:"scopes"`
+	SecretHash string    `json:"secret_hash"` // Hex SHA-256 of the secret
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at,omitempty"`
+	Revoked    bool      `json:"revoked,omitempty"`
+}
+
+func (t *apiToken) allows(scope string) bool {
+	return slices.Contains(t.Scopes, scope) || slices.Contains(t.Scopes, scopeAdmin)
+}
+
+func (t *apiToken) proto() *pb.ApiToken {
+	pt := &pb.ApiToken{
+		TokenId:       t.ID,
+		Name:          t.Name,
+		Scopes:        append([]string(nil), t.Scopes...),
+		CreatedAtUnix: t.CreatedAt.Unix(),
+		Revoked:       t.Revoked,
+	}
+	if !t.LastUsedAt.IsZero() {
+		pt.LastUsedUnix = t.LastUsedAt.Unix()
+	}
+	return pt
+}
+
+// tokenStore holds the API tokens issued to integrations and optionally
+// persists them to disk.
+type tokenStore struct {
+	mu        sync.Mutex
+	tokens    map[string]*apiToken // By secret hash
+	path      string               // Empty disables persistence
+	lastSaved time.Time
+}
+
+// newTokenStore creates a store, loading previously issued tokens from path if set.
+func newTokenStore(path string) *tokenStore {
+	st := &tokenStore{tokens: make(map[string]*apiToken), path: path, lastSaved: time.Now()}
+	if path == "" {
+		return st
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: Could not read API tokens '%s': %v", path, err)
+		}
+		return st
+	}
+	var saved []*apiToken
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Printf("Warning: Could not parse API tokens '%s': %v", path, err)
+		return st
+	}
+	for _, t := range saved {
+		st.tokens[t.SecretHash] = t
+	}
+	log.Printf("Loaded %d API tokens from '%s'", len(saved), path)
+	return st
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// issue creates a token with the given scopes, returning it and its secret.
+// Errors are gRPC status errors.
+func (st *tokenStore) issue(name string, scopes []string) (*apiToken, string, error) {
+	if name == "" {
+		return nil, "", status.Error(codes.InvalidArgument, "a token name is required")
+	}
+	if len(scopes) == 0 {
+		return nil, "", status.Error(codes.InvalidArgument, "at least one scope is required")
+	}
+	for _, sc := range scopes {
+		if !validScopes[sc] {
+			return nil, "", status.Errorf(codes.InvalidArgument, "unknown scope %q", sc)
+		}
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", status.Errorf(codes.Internal, "generate token: %v", err)
+	}
+	secret := "gt_" + hex.EncodeToString(raw)
+	t := &apiToken{
+		ID:         "tok_" + hex.EncodeToString(raw[:4]),
+		Name:       name,
+		Scopes:     slices.Compact(slices.Sorted(slices.Values(scopes))),
+		SecretHash: hashSecret(secret),
+		CreatedAt:  time.Now(),
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.tokens[t.SecretHash] = t
+	st.saveLocked()
+	return t, secret, nil
+}
+
+// revoke disables a token for good. Errors are gRPC status errors.
+func (st *tokenStore) revoke(id string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, t := range st.tokens {
+		if t.ID == id {
+			t.Revoked = true
+			st.saveLocked()
+			return nil
+		}
+	}
+	return status.Errorf(codes.NotFound, "token %s not found", id)
+}
+
+// list returns every token, oldest first.
+func (st *tokenStore) list() []*pb.ApiToken {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	all := make([]*apiToken, 0, len(st.tokens))
+	for _, t := range st.tokens {
+		all = append(all, t)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].CreatedAt.Before(all[j].CreatedAt) })
+	out := make([]*pb.ApiToken, len(all))
+	for i, t := range all {
+		out[i] = t.proto()
+	}
+	return out
+}
+
+// check looks up a presented secret and verifies it grants scope, recording
+// the use. Errors are gRPC status errors.
+func (st *tokenStore) check(secret, scope string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	t, ok := st.tokens[hashSecret(secret)]
+	if !ok || t.Revoked {
+		return status.Error(codes.Unauthenticated, "invalid or revoked token")
+	}
+	if !t.allows(scope) {
+		return status.Errorf(codes.PermissionDenied, "token %s lacks the %s scope", t.ID, scope)
+	}
+	t.LastUsedAt = time.Now()
+	if time.Since(st.lastSaved) >= tokenLastUsedSaveInterval {
+		st.saveLocked()
+	}
+	return nil
+}
+
+// saveLocked writes the tokens atomically via a temporary file, logging
+// failures. Must be called with st.mu held.
+func (st *tokenStore) saveLocked() {
+	if st.path == "" {
+		return
+	}
+	st.lastSaved = time.Now()
+	all := make([]*apiToken, 0, len(st.tokens))
+	for _, t := range st.tokens {
+		all = append(all, t)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].CreatedAt.Before(all[j].CreatedAt) })
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err == nil {
+		tmp := st.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o600); err == nil {
+			err = os.Rename(tmp, st.path)
+		} else {
+			err = fmt.Errorf("write %s: %w", tmp, err)
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: Could not save API tokens: %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"simple-grpc-game/server/internal/game"
+	"sync"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	tutorialRoomMode  = "tutorial"
+	tutorialLifetime  = 30 * time.Minute
+	maxTutorialRooms  = 32
+	tutorialZoneID    = "tutorial_target"
+	tutorialMinSteps1 = 4 // Walking distance, in tiles, to the first marker
+	tutorialMinSteps2 = 6 // ... and from the first marker to the second
+)
+
+// tutorialTrigger is what completes a tutorial step.
+type tutorialTrigger int
+
+const (
+	triggerZone tutorialTrigger = iota // Entering the step's zone
+	triggerRespawn
+	triggerChat
+)
+
+type tutorialStep struct {
+	text    string
+	trigger tutorialTrigger
+	zone    game.Zone // For triggerZone
+}
+
+// tutorial tracks the scripted objectives of a single-player tutorial room.
+// It has no steps until begin is called for the room's player.
+type tutorial struct {
+	mu      sync.Mutex
+	steps   []tutorialStep
+	current int
+}
+
+// begin builds the script for a player who has just spawned, placing
+// walk-to markers at reachable tiles near them. Marker steps are skipped if
+// the map has no suitable tiles.
+func (t *tutorial) begin(state *game.State, player *pb.Player) {
+	var steps []tutorialStep
+	if x, y, ok := state.ReachableTile(player.XPos, player.YPos, tutorialMinSteps1); ok {
+		steps = append(steps, tutorialStep{
+			text:    "Use WASD or the arrow keys to walk to the marked spot.",
+			trigger: triggerZone,
+			zone:    markerZone(x, y),
+		})
+		_, _, _, tileSize, _ := state.GetMapDataAndDimensions()
+		cx, cy := float32(x*tileSize+tileSize/2), float32(y*tileSize+tileSize/2)
+		if x2, y2, ok := state.ReachableTile(cx, cy, tutorialMinSteps2); ok {
+			steps = append(steps, tutorialStep{
+				text:    "Nice! Now head for the next marker.",
+				trigger: triggerZone,
+				zone:    markerZone(x2, y2),
+			})
+		}
+	}
+	steps = append(steps,
+		tutorialStep{text: "Stuck? Press R to respawn at a spawn point.", trigger: triggerRespawn},
+		tutorialStep{text: "Press T, type a message and press Enter to chat.", trigger: triggerChat},
+	)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.steps = steps
+	t.current = 0
+}
+
+// markerZone is the zone around a marker tile; players are several tiles
+// wide, so the zone is padded by one tile on each side.
+func markerZone(x, y int) game.Zone {
+	return game.Zone{ID: tutorialZoneID, MinX: x - 1, MinY: y - 1, MaxX: x + 1, MaxY: y + 1}
+}
+
+// prompt returns the message for the current step.
+func (t *tutorial) prompt() *pb.TutorialPrompt {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current >= len(t.steps) {
+		return &pb.TutorialPrompt{
+			TotalSteps: int32(len(t.steps)),
+			Text:       "Tutorial complete! Join without --tutorial to play with others.",
+			Completed:  true,
+		}
+	}
+	step := t.steps[t.current]
+	p := &pb.TutorialPrompt{Step: int32(t.current + 1), TotalSteps: int32(len(t.steps)), Text: step.text}
+	if step.trigger == triggerZone {
+		p.HasTarget = true
+		p.TargetTileX = int32((step.zone.MinX + step.zone.MaxX) / 2)
+		p.TargetTileY = int32((step.zone.MinY + step.zone.MaxY) / 2)
+	}
+	return p
+}
+
+// currentZone returns the zone of the current step, if it has one.
+func (t *tutorial) currentZone() (game.Zone, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current >= len(t.steps) || t.steps[t.current].trigger != triggerZone {
+		return game.Zone{}, false
+	}
+	return t.steps[t.current].zone, true
+}
+
+// observe advances the script if the trigger completes the current step,
+// reporting whether it did.
+func (t *tutorial) observe(trigger tutorialTrigger) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current >= len(t.steps) || t.steps[t.current].trigger != trigger {
+		return false
+	}
+	t.current++
+	return true
+}
+
+// startTutorial attaches a script to the room for its player and sends the
+// first prompt.
+func (r *room) startTutorial(player *pb.Player) {
+	r.tutorial.begin(r.state, player)
+	r.syncTutorialZone()
+	r.sendTutorialPrompt()
+}
+
+// tutorialEvent feeds a player action into the room's tutorial, if any.
+func (r *room) tutorialEvent(trigger tutorialTrigger) {
+	if r.tutorial == nil || !r.tutorial.observe(trigger) {
+		return
+	}
+	r.syncTutorialZone()
+	r.sendTutorialPrompt()
+}
+
+// tickTutorial checks the zone events of the last tick against the script.
+// Other rooms only discard them; objective zones are scored by the state.
+func (r *room) tickTutorial() {
+	events := r.state.TakeZoneEvents()
+	if r.tutorial == nil {
+		return
+	}
+	for _, ev := range events {
+		if ev.Entered && ev.ZoneID == tutorialZoneID {
+			r.tutorialEvent(triggerZone)
+		}
+	}
+}
+
+// syncTutorialZone installs the current step's zone in the room state.
+func (r *room) syncTutorialZone() {
+	if zone, ok := r.tutorial.currentZone(); ok {
+		if err := r.state.AddZone(zone); err != nil {
+			log.Printf("Tutorial room %s: %v", r.id, err)
+		}
+		return
+	}
+	r.state.RemoveZone(tutorialZoneID)
+}
+
+func (r *room) sendTutorialPrompt() {
+	prompt := r.tutorial.prompt()
+	if prompt.Completed {
+		log.Printf("Tutorial room %s completed.", r.id)
+	}
+	r.broadcast(&pb.ServerMessage{Message: &pb.ServerMessage_TutorialPrompt{TutorialPrompt: prompt}}, "tutorial")
+}
+
+// createTutorial starts a private single-player room on the lobby map. Errors
+// are gRPC status errors.
+func (m *roomManager) createTutorial(owner string) (*room, error) {
+	m.mu.Lock()
+	tutorials := 0
+	for _, r := range m.rooms {
+		if r.mode == tutorialRoomMode {
+			tutorials++
+		}
+	}
+	m.mu.Unlock()
+	if tutorials >= maxTutorialRooms {
+		return nil, status.Errorf(codes.ResourceExhausted, "too many tutorials in progress, try again later")
+	}
+
+	lobby, _ := m.get(defaultRoomID)
+	id := newRoomID()
+	r, err := newRoom(id, fmt.Sprintf("Tutorial %s", id), lobby.mapName, m.allowedMaps[lobby.mapName], m.metrics)
+	if err != nil {
+		return nil, status.Errorf(gameErrorCode(err), "failed to create tutorial: %v", err)
+	}
+	m.prepareRoom(r)
+	r.mode = tutorialRoomMode
+	r.tutorial = &tutorial{}
+	r.maxPlayers = 1
+	r.password = newRoomID() // Never shared, so nobody else can join
+	r.owner = owner
+	r.expiresAt = r.createdAt.Add(tutorialLifetime)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rooms[id] = r
+	log.Printf("Tutorial room %s created for %s.", id, owner)
+	return r, nil
+}
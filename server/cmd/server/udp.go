@@ -0,0 +1,264 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	udpMaxDatagram   = 1200             // Largest snapshot datagram, to stay under common path MTUs
+	udpPeerTimeout   = 10 * time.Second // Snapshots stop this long after a client's last UdpHello
+	udpReadBuffer    = 512              // Largest UdpHello read
+	udpEntryOverhead = 3                // Tag and length of each player in a snapshot
+	udpKeyframeTicks = 50               // Most ticks between keyframes
+	udpFrameHistory  = 32               // Ticks of sent snapshots kept as possible baselines
+	udpMoveEpsilon   = 0.5              // Pixels a player must move to be resent
+)
+
+// udpTransport sends position snapshots over UDP to clients that opted in,
+// alongside their GameStream. Datagrams are unreliable and unordered, so
+// a lost one holds nothing up; the stream's deltas stay the source of truth
+// for everything, positions included. Snapshots are deltas against the last
+// tick each client acknowledged, with periodic keyframes.
+type udpTransport struct {
+	conn *net.UDPConn
+	port int
+
+	mu       sync.Mutex
+	byToken  map[string]*udpPeer
+	byPlayer map[string]*udpPeer
+}
+
+// udpPeer is a player offered snapshots; addr is set once its UdpHello
+// arrives. The fields after ackTick are only used by the tick loop.
+type udpPeer struct {
+	playerID  string
+	token     string
+	host      net.IP // GameStream peer; only UdpHellos from it are accepted
+	addr      *net.UDPAddr
+	lastHello time.Time
+	ackTick   uint64 // Newest tick the client acknowledged
+
+	roomID       string
+	lastTick     uint64     // Last room tick sent, so idle rooms are not resent
+	lastKeyframe uint64     // Tick of the last keyframe sent
+	frames       []udpFrame // Recent snapshots as the client will hold them, oldest first
+}
+
+// udpFrame is the positions a client holds after applying a tick's snapshot.
+type udpFrame struct {
+	tick      uint64
+	positions map[string]*pb.UdpPlayerPosition
+}
+
+// listenUDP opens the snapshot socket on addr.
+func listenUDP(addr string) (*udpTransport, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &udpTransport{
+		conn:     conn,
+		port:     conn.LocalAddr().(*net.UDPAddr).Port,
+		byToken:  make(map[string]*udpPeer),
+		byPlayer: make(map[string]*udpPeer),
+	}, nil
+}
+
+// offer issues a player a token and returns the UdpOffer to send on its
+// stream. host is the stream's peer address: snapshots only go to that host,
+// so a leaked token cannot redirect them. A replayed join gets a fresh token,
+// replacing the old one.
+func (u *udpTransport) offer(playerID, host string) *pb.ServerMessage {
+	b := make([]byte, 16)
+	rand.Read(b)
+	peer := &udpPeer{playerID: playerID, token: hex.EncodeToString(b), host: net.ParseIP(host)}
+	u.mu.Lock()
+	if old, ok := u.byPlayer[playerID]; ok {
+		delete(u.byToken, old.token)
+	}
+	u.byPlayer[playerID] = peer
+	u.byToken[peer.token] = peer
+	u.mu.Unlock()
+	return &pb.ServerMessage{Message: &pb.ServerMessage_UdpOffer{UdpOffer: &pb.UdpOffer{Port: int32(u.port), Token: peer.token}}}
+}
+
+// forget stops snapshots to a player that left.
+func (u *udpTransport) forget(playerID string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if peer, ok := u.byPlayer[playerID]; ok {
+		delete(u.byToken, peer.token)
+		delete(u.byPlayer, playerID)
+	}
+}
+
+// serve reads UdpHello datagrams, recording where each client's snapshots go.
+func (u *udpTransport) serve() {
+	log.Printf("Serving UDP position snapshots on %s", u.conn.LocalAddr())
+	buf := make([]byte, udpReadBuffer)
+	for {
+		n, addr, err := u.conn.ReadFromUDP(buf)
+		if err != nil {
+			log.Printf("UDP snapshot socket stopped: %v", err)
+			return
+		}
+		var hello pb.UdpHello
+		if proto.Unmarshal(buf[:n], &hello) != nil {
+			continue
+		}
+		u.mu.Lock()
+		if peer, ok := u.byToken[hello.GetToken()]; ok && peer.host.Equal(addr.IP) {
+			if peer.addr == nil || peer.addr.String() != addr.String() {
+				log.Printf("Player %s takes UDP snapshots at %s.", peer.playerID, addr)
+			}
+			peer.addr = addr
+			peer.lastHello = time.Now()
+			peer.ackTick = max(peer.ackTick, hello.GetAckTick())
+		}
+		u.mu.Unlock()
+	}
+}
+
+// sendSnapshots sends each room's positions to the players in it with a live
+// UDP address, once per room tick.
+func (u *udpTransport) sendSnapshots(rooms []*room) {
+	now := time.Now()
+	// serve updates addr and ackTick, so they are copied under the lock.
+	type livePeer struct {
+		*udpPeer
+		addr *net.UDPAddr
+		ack  uint64
+	}
+	u.mu.Lock()
+	live := make(map[string]livePeer, len(u.byPlayer))
+	for id, peer := range u.byPlayer {
+		if peer.addr != nil && now.Sub(peer.lastHello) < udpPeerTimeout {
+			live[id] = livePeer{udpPeer: peer, addr: peer.addr, ack: peer.ackTick}
+		}
+	}
+	u.mu.Unlock()
+	if len(live) == 0 {
+		return
+	}
+	for _, r := range rooms {
+		tick := r.ticks.Load()
+		snapshot := r.state.AcquirePlayerSnapshot()
+		for _, p := range snapshot.Players {
+			peer, ok := live[p.GetId()]
+			if !ok || (peer.roomID == r.id && peer.lastTick == tick) {
+				continue
+			}
+			if peer.roomID != r.id {
+				// Ticks count separately in each room.
+				peer.roomID, peer.frames = r.id, nil
+			}
+			peer.lastTick = tick
+			base, players := peer.nextFrame(tick, peer.ack, snapshot.Players)
+			if base == 0 || len(players) > 0 {
+				u.send(peer.addr, snapshotDatagrams(tick, base, now, players))
+			}
+		}
+		snapshot.Release()
+	}
+}
+
+// nextFrame works out a peer's snapshot of players for a tick: the base tick
+// (0 for a keyframe) and the players to send. It records the frame the client
+// will hold, unless there is nothing to send.
+func (p *udpPeer) nextFrame(tick, ack uint64, players []*pb.Player) (uint64, []*pb.UdpPlayerPosition) {
+	var baseline *udpFrame
+	if tick-p.lastKeyframe < udpKeyframeTicks {
+		for i := range p.frames {
+			if p.frames[i].tick == ack {
+				baseline = &p.frames[i]
+			}
+		}
+	}
+	frame := udpFrame{tick: tick, positions: make(map[string]*pb.UdpPlayerPosition, len(players))}
+	var changed []*pb.UdpPlayerPosition
+	for _, pl := range players {
+		pos := &pb.UdpPlayerPosition{Id: pl.GetId(), XPos: pl.GetXPos(), YPos: pl.GetYPos(), CurrentAnimationState: pl.GetCurrentAnimationState()}
+		if baseline != nil {
+			if old, ok := baseline.positions[pos.Id]; ok && !moved(old, pos) {
+				frame.positions[pos.Id] = old
+				continue
+			}
+		}
+		frame.positions[pos.Id] = pos
+		changed = append(changed, pos)
+	}
+	base := uint64(0)
+	if baseline != nil {
+		base = baseline.tick
+		if len(changed) == 0 {
+			return base, nil
+		}
+	} else {
+		p.lastKeyframe = tick
+	}
+	if len(p.frames) == udpFrameHistory {
+		p.frames = append(p.frames[:0], p.frames[1:]...)
+	}
+	p.frames = append(p.frames, frame)
+	return base, changed
+}
+
+// moved reports whether a player changed enough since a client's copy to be
+// resent.
+func moved(old, cur *pb.UdpPlayerPosition) bool {
+	return old.CurrentAnimationState != cur.CurrentAnimationState ||
+		math.Abs(float64(old.XPos-cur.XPos)) > udpMoveEpsilon ||
+		math.Abs(float64(old.YPos-cur.YPos)) > udpMoveEpsilon
+}
+
+func (u *udpTransport) send(addr *net.UDPAddr, datagrams [][]byte) {
+	for _, d := range datagrams {
+		if _, err := u.conn.WriteToUDP(d, addr); err != nil {
+			log.Printf("UDP snapshot to %s failed: %v", addr, err)
+			return
+		}
+	}
+}
+
+// snapshotDatagrams encodes positions as UdpSnapshots of at most
+// udpMaxDatagram bytes each.
+func snapshotDatagrams(tick, base uint64, now time.Time, players []*pb.UdpPlayerPosition) [][]byte {
+	newSnapshot := func() *pb.UdpSnapshot {
+		return &pb.UdpSnapshot{Tick: tick, BaseTick: base, ServerTimeMs: now.UnixMilli()}
+	}
+	snaps := []*pb.UdpSnapshot{newSnapshot()}
+	header := proto.Size(snaps[0]) + 6 // With room for parts
+	size := header
+	for _, pos := range players {
+		entry := proto.Size(pos) + udpEntryOverhead
+		if snap := snaps[len(snaps)-1]; len(snap.Players) > 0 && size+entry > udpMaxDatagram {
+			snaps = append(snaps, newSnapshot())
+			size = header
+		}
+		snap := snaps[len(snaps)-1]
+		snap.Players = append(snap.Players, pos)
+		size += entry
+	}
+	datagrams := make([][]byte, 0, len(snaps))
+	for _, snap := range snaps {
+		snap.Parts = uint32(len(snaps))
+		if data, err := proto.Marshal(snap); err == nil {
+			datagrams = append(datagrams, data)
+		}
+	}
+	return datagrams
+}
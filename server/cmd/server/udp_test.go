@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func udpPlayers(xs ...float32) []*pb.Player {
+	players := make([]*pb.Player, len(xs))
+	for i, x := range xs {
+		players[i] = &pb.Player{Id: fmt.Sprintf("p%d", i+1), XPos: x, YPos: 100}
+	}
+	return players
+}
+
+func TestUDPNextFrameBaselines(t *testing.T) {
+	p := &udpPeer{}
+	base, changed := p.nextFrame(1, 0, udpPlayers(100, 200))
+	if base != 0 || len(changed) != 2 {
+		t.Fatalf("first frame: base %d with %d players, want a keyframe of 2", base, len(changed))
+	}
+
+	// Acked tick 1: only the player that moved is sent, against tick 1.
+	base, changed = p.nextFrame(2, 1, udpPlayers(110, 200))
+	if base != 1 || len(changed) != 1 || changed[0].Id != "p1" {
+		t.Fatalf("delta frame: base %d, changed %v, want p1 against tick 1", base, changed)
+	}
+
+	// Movement under udpMoveEpsilon is not resent, and nothing is recorded.
+	base, changed = p.nextFrame(3, 2, udpPlayers(110+udpMoveEpsilon/2, 200))
+	if base != 2 || changed != nil {
+		t.Errorf("idle frame: base %d, changed %v, want nothing against tick 2", base, changed)
+	}
+	if last := p.frames[len(p.frames)-1].tick; last != 2 {
+		t.Errorf("idle frame was recorded: last frame is tick %d", last)
+	}
+
+	// A client still on tick 1 gets p1 again, measured from its copy.
+	base, changed = p.nextFrame(4, 1, udpPlayers(110, 200))
+	if base != 1 || len(changed) != 1 || changed[0].Id != "p1" {
+		t.Errorf("frame against an older ack: base %d, changed %v, want p1 against tick 1", base, changed)
+	}
+}
+
+func TestUDPNextFrameKeyframes(t *testing.T) {
+	p := &udpPeer{}
+	p.nextFrame(1, 0, udpPlayers(100))
+
+	if base, changed := p.nextFrame(2, 99, udpPlayers(100)); base != 0 || len(changed) != 1 {
+		t.Errorf("unknown ack: base %d with %d players, want a keyframe", base, len(changed))
+	}
+
+	tick := uint64(2)
+	for ; tick < 2+udpKeyframeTicks-1; tick++ {
+		if base, _ := p.nextFrame(tick+1, tick, udpPlayers(float32(tick*10))); base == 0 {
+			t.Fatalf("keyframe at tick %d, before udpKeyframeTicks", tick+1)
+		}
+	}
+	if base, changed := p.nextFrame(tick+1, tick, udpPlayers(float32(tick*10))); base != 0 || len(changed) != 1 {
+		t.Errorf("tick %d: base %d, want a keyframe every %d ticks", tick+1, base, udpKeyframeTicks)
+	}
+	if len(p.frames) > udpFrameHistory {
+		t.Errorf("%d frames kept, want at most %d", len(p.frames), udpFrameHistory)
+	}
+}
+
+func TestUDPSnapshotDatagramsSplit(t *testing.T) {
+	positions := make([]*pb.UdpPlayerPosition, 200)
+	for i := range positions {
+		positions[i] = &pb.UdpPlayerPosition{Id: fmt.Sprintf("player-%03d", i), XPos: float32(i), YPos: 1, CurrentAnimationState: pb.AnimationState_RUNNING_UP}
+	}
+	datagrams := snapshotDatagrams(7, 5, time.Now(), positions)
+	if len(datagrams) < 2 {
+		t.Fatalf("%d datagrams for 200 players, want the snapshot split", len(datagrams))
+	}
+	total := 0
+	for _, d := range datagrams {
+		if len(d) > udpMaxDatagram {
+			t.Errorf("datagram of %d bytes, over udpMaxDatagram", len(d))
+		}
+		snap := &pb.UdpSnapshot{}
+		if err := proto.Unmarshal(d, snap); err != nil {
+			t.Fatal(err)
+		}
+		if snap.Tick != 7 || snap.BaseTick != 5 || snap.Parts != uint32(len(datagrams)) {
+			t.Errorf("datagram header = tick %d base %d parts %d", snap.Tick, snap.BaseTick, snap.Parts)
+		}
+		total += len(snap.Players)
+	}
+	if total != len(positions) {
+		t.Errorf("%d players across datagrams, want %d", total, len(positions))
+	}
+}
+
+func TestUDPHelloOnlyFromStreamHost(t *testing.T) {
+	u, err := listenUDP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer u.conn.Close()
+	go u.serve()
+	foreign := u.offer("p1", "192.0.2.1").GetUdpOffer().GetToken()
+	local := u.offer("p2", "127.0.0.1").GetUdpOffer().GetToken()
+
+	client, err := net.DialUDP("udp", nil, u.conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for _, token := range []string{foreign, local} {
+		data, _ := proto.Marshal(&pb.UdpHello{Token: token})
+		if _, err := client.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	addrOf := func(id string) *net.UDPAddr {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		return u.byPlayer[id].addr
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for addrOf("p2") == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("hello from the stream's host was not accepted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if addr := addrOf("p1"); addr != nil {
+		t.Errorf("hello from %s redirected snapshots for a player streaming from 192.0.2.1", addr)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"simple-grpc-game/server/internal/game"
+)
+
+const webhookBuffer = 256 // Events queued for delivery before new ones are dropped
+
+// defaultWebhookEvents are the event types webhooks get unless
+// -webhook-events says otherwise.
+var defaultWebhookEvents = []string{
+	game.EventPlayerJoined, game.EventPlayerLeft,
+	game.EventMatchStarted, game.EventMatchEnded,
+	game.EventServerError,
+}
+
+// webhooks is a game.EventSink that POSTs chosen events as JSON to URLs, for
+// piping activity into chat. Discord and Slack webhook URLs get a message in
+// their own format; other URLs get the event itself.
+type webhooks struct {
+	targets []*webhookTarget
+	types   map[string]bool
+}
+
+// webhookTarget delivers events to one URL in the background, one attempt
+// each, so a slow URL holds up no other; while it is behind, new events are
+// dropped and counted.
+type webhookTarget struct {
+	url     string
+	client  *http.Client
+	events  chan game.Event
+	dropped atomic.Int64
+}
+
+// newWebhooks starts delivering events of the given types to the
+// comma-separated URLs; an empty list disables webhooks.
+func newWebhooks(urls string, types []string) (*webhooks, error) {
+	if urls == "" {
+		return nil, nil
+	}
+	w := &webhooks{types: make(map[string]bool)}
+	client := &http.Client{Timeout: notifierTimeout}
+	for _, raw := range strings.Split(urls, ",") {
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook %q must be an http or https URL", raw)
+		}
+		w.targets = append(w.targets, &webhookTarget{url: u.String(), client: client, events: make(chan game.Event, webhookBuffer)})
+	}
+	for _, t := range types {
+		w.types[strings.TrimSpace(t)] = true
+	}
+	for _, t := range w.targets {
+		go t.run()
+	}
+	return w, nil
+}
+
+// Emit queues an event without blocking if webhooks want its type.
+func (w *webhooks) Emit(e game.Event) {
+	if !w.types[e.Type] {
+		return
+	}
+	for _, t := range w.targets {
+		select {
+		case t.events <- e:
+		default:
+			if t.dropped.Add(1)%100 == 1 {
+				log.Printf("Warning: Webhook %s is behind; %d events dropped so far", t.url, t.dropped.Load())
+			}
+		}
+	}
+}
+
+// Name and Notify let webhooks receive alerts, as server_error events.
+func (w *webhooks) Name() string { return "event webhooks" }
+func (w *webhooks) Notify(a alert) error {
+	w.Emit(game.Event{Time: a.Time, Type: game.EventServerError, Fields: map[string]any{"rule": a.Rule, "message": a.Message}})
+	return nil
+}
+
+func (t *webhookTarget) run() {
+	for e := range t.events {
+		if err := postJSON(t.client, t.url, webhookBody(t.url, e)); err != nil {
+			log.Printf("Webhook %s failed for %s event: %v", t.url, e.Type, err)
+		}
+	}
+}
+
+// webhookBody formats an event for a webhook URL.
+func webhookBody(target string, e game.Event) any {
+	u, _ := url.Parse(target)
+	switch {
+	case strings.HasSuffix(u.Hostname(), "discord.com") || strings.HasSuffix(u.Hostname(), "discordapp.com"):
+		return map[string]string{"content": describeEvent(e)}
+	case u.Hostname() == "hooks.slack.com":
+		return map[string]string{"text": describeEvent(e)}
+	}
+	return e
+}
+
+// describeEvent is a one-line summary of an event for chat.
+func describeEvent(e game.Event) string {
+	who := e.PlayerID
+	if name, ok := e.Fields["username"].(string); ok && name != "" {
+		who = name
+	}
+	switch e.Type {
+	case game.EventPlayerJoined:
+		return fmt.Sprintf(":inbox_tray: **%s** joined %s", who, e.Room)
+	case game.EventPlayerLeft:
+		return fmt.Sprintf(":outbox_tray: **%s** left %s", who, e.Room)
+	case game.EventMatchStarted:
+		return fmt.Sprintf(":crossed_swords: Match %s started with %v players", e.Room, e.Fields["players"])
+	case game.EventMatchEnded:
+		return fmt.Sprintf(":checkered_flag: Match %s ended after %v", e.Room, e.Fields["duration"])
+	case game.EventServerError:
+		return fmt.Sprintf(":rotating_light: **%v**: %v", e.Fields["rule"], e.Fields["message"])
+	}
+	return fmt.Sprintf("%s %s %s %v", e.Type, e.Room, who, e.Fields)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// webSocketPath is the short WebSocket endpoint of GameStream, for web and
+// mobile clients that do not speak gRPC.
+const webSocketPath = "/ws"
+
+// webSocketCodec frames messages on a WebSocket: binary protobuf by default,
+// or protobuf's JSON mapping in text messages for clients without protobuf.
+type webSocketCodec struct {
+	text      bool
+	marshal   func(proto.Message) ([]byte, error)
+	unmarshal func([]byte, proto.Message) error
+}
+
+var (
+	protoCodec = webSocketCodec{marshal: proto.Marshal, unmarshal: proto.Unmarshal}
+	jsonCodec  = webSocketCodec{
+		text:      true,
+		marshal:   protojson.Marshal,
+		unmarshal: protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal,
+	}
+)
+
+// encode marshals a message, reusing a broadcast's prepared bytes when they
+// are in this codec's format.
+func (c webSocketCodec) encode(m any) ([]byte, error) {
+	if pm, ok := m.(*preparedMessage); ok {
+		if !c.text {
+			return pm.data, nil
+		}
+		if m = pm.msg; pm.msg == nil {
+			// Player streams queue only the bytes (see outboundStream).
+			msg := &pb.ServerMessage{}
+			if err := proto.Unmarshal(pm.data, msg); err != nil {
+				return nil, err
+			}
+			m = msg
+		}
+	}
+	return c.marshal(m.(proto.Message))
+}
+
+// pickSubprotocol accepts the origin, which ServeHTTP has already checked,
+// and echoes one subprotocol, which browsers require if they offered any: "json" if offered,
+// otherwise the first.
+func pickSubprotocol(config *websocket.Config, _ *http.Request) error {
+	switch {
+	case slices.Contains(config.Protocol, "json"):
+		config.Protocol = []string{"json"}
+	case len(config.Protocol) > 0:
+		config.Protocol = config.Protocol[:1]
+	}
+	return nil
+}
+
+// codecFor picks JSON for connections that asked for the "json" subprotocol
+// or ?format=json, and binary protobuf otherwise.
+func codecFor(conn *websocket.Conn) webSocketCodec {
+	if conn.Request().URL.Query().Get("format") == "json" || slices.Contains(conn.Config().Protocol, "json") {
+		return jsonCodec
+	}
+	return protoCodec
+}
+
+// serveWebSocket runs a streaming call over a WebSocket until the handler
+// returns, then sends its status and closes. Every message but the last is
+// one request or response in the connection's codec; the last is a text
+// message with the final status as {"code": ..., "message": ...}.
+func (m webMethod) serveWebSocket(conn *websocket.Conn) {
+	defer conn.Close()
+	conn.MaxPayloadBytes = webMaxMessage
+	ctx, cancel := context.WithCancel(callContext(conn.Request()))
+	defer cancel()
+	s := &webSocketStream{ctx: ctx, cancel: cancel, conn: conn, codec: codecFor(conn)}
+	err := status.Error(codes.Unimplemented, "unary methods are served over gRPC-Web, not WebSockets")
+	if m.stream != nil {
+		err = m.stream.Handler(m.impl, s)
+	}
+	st := status.Convert(err)
+	final, _ := json.Marshal(map[string]any{"code": st.Code(), "message": st.Message()})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	websocket.Message.Send(conn, string(final))
+}
+
+// webSocketStream is a streaming call over a WebSocket. Sends may come from
+// several goroutines, so they are serialized.
+type webSocketStream struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	conn   *websocket.Conn
+	codec  webSocketCodec
+	mu     sync.Mutex
+}
+
+func (s *webSocketStream) Context() context.Context     { return s.ctx }
+func (s *webSocketStream) SetHeader(metadata.MD) error  { return nil }
+func (s *webSocketStream) SendHeader(metadata.MD) error { return nil }
+func (s *webSocketStream) SetTrailer(metadata.MD)       {}
+
+func (s *webSocketStream) SendMsg(m any) error {
+	data, err := s.codec.encode(m)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.codec.text {
+		return websocket.Message.Send(s.conn, string(data))
+	}
+	return websocket.Message.Send(s.conn, data)
+}
+
+// RecvMsg reads the next message; once the client disconnects it returns
+// io.EOF and cancels the call's context, as gRPC does.
+func (s *webSocketStream) RecvMsg(m any) error {
+	var data []byte
+	if err := websocket.Message.Receive(s.conn, &data); err != nil {
+		s.cancel()
+		return io.EOF
+	}
+	if err := s.codec.unmarshal(data, m.(proto.Message)); err != nil {
+		return status.Errorf(codes.InvalidArgument, "bad message: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"simple-grpc-game/server/internal/game"
+)
+
+const defaultWorldSaveInterval = 30 * time.Second
+
+// savedWorld is the file a persistent room's world is saved in.
+type savedWorld struct {
+	RoomID  string              `json:"room_id"`
+	MapName string              `json:"map_name"`
+	MapHash string              `json:"map_hash"` // Of the map file the world was loaded from
+	SavedAt time.Time           `json:"saved_at"`
+	World   *game.WorldSnapshot `json:"world"`
+}
+
+// worldSaver periodically saves the worlds of persistent rooms (lobby and map
+// worlds) so a restart or crash loses at most one interval of tile changes
+// and player positions. A save is only restored onto the map file it was
+// made from: after the map is edited, its room starts fresh.
+type worldSaver struct {
+	dir       string
+	mu        sync.Mutex
+	mapHashes map[string]string // Room ID -> hash of its map file when last loaded
+}
+
+func worldSnapshotPath(dir, roomID string) string {
+	return filepath.Join(dir, roomID+".world.json")
+}
+
+func mapFileHash(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// persistWorlds restores every persistent room's saved world from dir and
+// saves them there every interval from then on.
+func (m *roomManager) persistWorlds(dir string, interval time.Duration) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("Warning: Could not create world snapshot directory '%s': %v", dir, err)
+	}
+	if interval <= 0 {
+		interval = defaultWorldSaveInterval
+	}
+	ws := &worldSaver{dir: dir, mapHashes: make(map[string]string)}
+	for _, r := range m.all() {
+		if r.persistent {
+			ws.mapLoaded(r, m.allowedMaps[r.mapName])
+			ws.restore(r)
+		}
+	}
+	m.mu.Lock()
+	m.saver = ws
+	m.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			for _, r := range m.all() {
+				if r.persistent {
+					ws.save(r)
+				}
+			}
+		}
+	}()
+}
+
+// mapLoaded records the map file a room's world now comes from.
+func (ws *worldSaver) mapLoaded(r *room, mapPath string) {
+	hash, err := mapFileHash(mapPath)
+	if err != nil {
+		log.Printf("Warning: Could not hash map '%s' of room %s: %v", mapPath, r.id, err)
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.mapHashes[r.id] = hash
+}
+
+// restore applies a room's saved world, if it has one for its current map.
+func (ws *worldSaver) restore(r *room) {
+	path := worldSnapshotPath(ws.dir, r.id)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: Could not read world snapshot '%s': %v", path, err)
+		}
+		return
+	}
+	var saved savedWorld
+	if err := json.Unmarshal(data, &saved); err != nil || saved.World == nil {
+		log.Printf("Warning: Could not parse world snapshot '%s': %v", path, err)
+		return
+	}
+	ws.mu.Lock()
+	hash := ws.mapHashes[r.id]
+	ws.mu.Unlock()
+	if saved.MapHash != hash {
+		log.Printf("Room %s: map file changed since the world was saved at %s; starting fresh.", r.id, saved.SavedAt.Format(time.RFC3339))
+		return
+	}
+	if err := r.state.RestoreWorld(saved.World); err != nil {
+		log.Printf("Warning: Could not restore world of room %s: %v", r.id, err)
+		return
+	}
+	log.Printf("Room %s: world restored from %s.", r.id, saved.SavedAt.Format(time.RFC3339))
+}
+
+// save writes a room's world atomically via a temporary file, logging failures.
+func (ws *worldSaver) save(r *room) {
+	ws.mu.Lock()
+	hash := ws.mapHashes[r.id]
+	ws.mu.Unlock()
+	data, err := json.Marshal(savedWorld{
+		RoomID:  r.id,
+		MapName: r.mapName,
+		MapHash: hash,
+		SavedAt: time.Now().UTC(),
+		World:   r.state.SaveWorld(),
+	})
+	path := worldSnapshotPath(ws.dir, r.id)
+	if err == nil {
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, path)
+		} else {
+			err = fmt.Errorf("write %s: %w", tmp, err)
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: Could not save world of room %s: %v", r.id, err)
+	}
+}
@@ -0,0 +1,425 @@
+// Command tuiclient plays the game in a terminal: it draws the map around
+// the player with text and ANSI escape codes and moves with the arrow keys or
+// WASD. It needs nothing beyond a Unix terminal with stty, so it is a quick
+// way to check a server without the Python client.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	inputInterval  = time.Second / 20
+	frameInterval  = time.Second / 15
+	keyHold        = 250 * time.Millisecond // A key press moves this long; terminals send no key releases
+	chatLines      = 3
+	statusLines    = 2 + chatLines
+	defaultColumns = 80
+	defaultRows    = 24
+)
+
+// world is what the client knows of its room.
+type world struct {
+	mu       sync.Mutex
+	myID     string
+	mapName  string
+	tiles    [][]int32
+	defs     map[int32]*pb.TileDefinition
+	tileSize float32
+	players  map[string]*pb.Player
+	items    map[string]*pb.Item
+	npcs     map[string]*pb.NPC
+	chat     []string
+	notice   string // Why the server ended the stream
+}
+
+func (w *world) setMap(m *pb.InitialMapData) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.myID, w.mapName, w.tileSize = m.AssignedPlayerId, m.MapName, float32(m.TileSizePixels)
+	w.tiles = make([][]int32, m.TileHeight)
+	for y := range w.tiles {
+		w.tiles[y] = make([]int32, m.TileWidth)
+		if y < len(m.Rows) {
+			copy(w.tiles[y], m.Rows[y].Tiles)
+		}
+	}
+	w.defs = make(map[int32]*pb.TileDefinition, len(m.TileDefinitions))
+	for _, d := range m.TileDefinitions {
+		w.defs[d.TileId] = d
+	}
+	if !m.Resumed {
+		w.players, w.items, w.npcs = map[string]*pb.Player{}, map[string]*pb.Item{}, map[string]*pb.NPC{}
+	}
+}
+
+func (w *world) setChunk(c *pb.MapChunk, size int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for dy, row := range c.Rows {
+		y := int(c.ChunkY)*size + dy
+		if y < len(w.tiles) {
+			copy(w.tiles[y][min(len(w.tiles[y]), int(c.ChunkX)*size):], row.Tiles)
+		}
+	}
+}
+
+func (w *world) applyDelta(d *pb.DeltaUpdate) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, p := range d.UpdatedPlayers {
+		w.players[p.Id] = p
+	}
+	for _, id := range d.RemovedPlayerIds {
+		delete(w.players, id)
+	}
+	for _, it := range d.SpawnedItems {
+		w.items[it.Id] = it
+	}
+	for _, id := range d.RemovedItemIds {
+		delete(w.items, id)
+	}
+	for _, n := range d.UpdatedNpcs {
+		w.npcs[n.Id] = n
+	}
+	for _, id := range d.RemovedNpcIds {
+		delete(w.npcs, id)
+	}
+}
+
+func (w *world) setTiles(u *pb.MapTileUpdate) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, t := range u.Tiles {
+		if t.Y >= 0 && int(t.Y) < len(w.tiles) && t.X >= 0 && int(t.X) < len(w.tiles[t.Y]) {
+			w.tiles[t.Y][t.X] = t.Tile
+		}
+	}
+}
+
+func (w *world) addChat(line string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.chat = append(w.chat, line)
+	if len(w.chat) > chatLines {
+		w.chat = w.chat[len(w.chat)-chatLines:]
+	}
+}
+
+// tileRune draws a tile: # for walls, $ for pickups, ^ for hazards, ~ for
+// slow or slippery ground and . for floor.
+func (w *world) tileRune(id int32) rune {
+	d, ok := w.defs[id]
+	switch {
+	case !ok:
+		return '?'
+	case !d.Walkable:
+		return '#'
+	case d.Points > 0:
+		return '$'
+	case d.Damage > 0:
+		return '^'
+	case d.Slippery || (d.SpeedMultiplier > 0 && d.SpeedMultiplier < 1):
+		return '~'
+	}
+	return '.'
+}
+
+// render draws the view around the player into a screenful of text.
+func (w *world) render(cols, rows int) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	viewRows := rows - statusLines
+	grid := make([][]rune, viewRows)
+	for y := range grid {
+		grid[y] = []rune(strings.Repeat(" ", cols))
+	}
+	me := w.players[w.myID]
+	var cx, cy int
+	if me != nil && w.tileSize > 0 {
+		cx, cy = int(me.XPos/w.tileSize), int(me.YPos/w.tileSize)
+	}
+	x0, y0 := cx-cols/2, cy-viewRows/2
+	for vy := 0; vy < viewRows; vy++ {
+		y := y0 + vy
+		if y < 0 || y >= len(w.tiles) {
+			continue
+		}
+		for vx := 0; vx < cols; vx++ {
+			if x := x0 + vx; x >= 0 && x < len(w.tiles[y]) {
+				grid[vy][vx] = w.tileRune(w.tiles[y][x])
+			}
+		}
+	}
+	plot := func(px, py float32, r rune) {
+		if w.tileSize == 0 {
+			return
+		}
+		vx, vy := int(px/w.tileSize)-x0, int(py/w.tileSize)-y0
+		if vy >= 0 && vy < viewRows && vx >= 0 && vx < cols {
+			grid[vy][vx] = r
+		}
+	}
+	for _, it := range w.items {
+		plot(it.XPos, it.YPos, '*')
+	}
+	for _, n := range w.npcs {
+		plot(n.XPos, n.YPos, 'n')
+	}
+	ids := make([]string, 0, len(w.players))
+	for id := range w.players {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		p := w.players[id]
+		if id == w.myID {
+			continue
+		}
+		r := 'P'
+		if name := []rune(p.DisplayName); len(name) > 0 {
+			r = name[0]
+		}
+		plot(p.XPos, p.YPos, r)
+	}
+	if me != nil {
+		plot(me.XPos, me.YPos, '@')
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for _, row := range grid {
+		b.WriteString(string(row))
+		b.WriteString("\x1b[K\r\n")
+	}
+	status := fmt.Sprintf("%s | %d players | arrows/WASD move, q quits", w.mapName, len(w.players))
+	if me != nil {
+		status = fmt.Sprintf("%s (%.0f,%.0f) %d/%d HP | ", me.DisplayName, me.XPos, me.YPos, me.Health, me.MaxHealth) + status
+	}
+	b.WriteString(truncate(status, cols) + "\x1b[K\r\n")
+	b.WriteString(strings.Repeat("-", cols) + "\r\n")
+	for i := 0; i < chatLines; i++ {
+		if i < len(w.chat) {
+			b.WriteString(truncate(w.chat[i], cols))
+		}
+		b.WriteString("\x1b[K")
+		if i < chatLines-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	return b.String()
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// keys turns raw terminal bytes into the direction held, if any.
+type keys struct {
+	mu    sync.Mutex
+	dir   pb.PlayerInput_Direction
+	since time.Time
+	quit  chan struct{}
+}
+
+func (k *keys) press(dir pb.PlayerInput_Direction) {
+	k.mu.Lock()
+	k.dir, k.since = dir, time.Now()
+	k.mu.Unlock()
+}
+
+func (k *keys) held() pb.PlayerInput_Direction {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if time.Since(k.since) > keyHold {
+		return pb.PlayerInput_UNKNOWN
+	}
+	return k.dir
+}
+
+// read handles key presses until q or the end of input.
+func (k *keys) read() {
+	in := bufio.NewReader(os.Stdin)
+	defer close(k.quit)
+	for {
+		c, err := in.ReadByte()
+		if err != nil {
+			return
+		}
+		switch c {
+		case 'q', 'Q', 3: // 3 is Ctrl-C in raw mode
+			return
+		case 'w', 'W':
+			k.press(pb.PlayerInput_UP)
+		case 's', 'S':
+			k.press(pb.PlayerInput_DOWN)
+		case 'a', 'A':
+			k.press(pb.PlayerInput_LEFT)
+		case 'd', 'D':
+			k.press(pb.PlayerInput_RIGHT)
+		case 0x1b: // Arrow keys arrive as ESC [ A-D
+			if b, _ := in.ReadByte(); b != '[' {
+				continue
+			}
+			switch b, _ := in.ReadByte(); b {
+			case 'A':
+				k.press(pb.PlayerInput_UP)
+			case 'B':
+				k.press(pb.PlayerInput_DOWN)
+			case 'D':
+				k.press(pb.PlayerInput_LEFT)
+			case 'C':
+				k.press(pb.PlayerInput_RIGHT)
+			}
+		}
+	}
+}
+
+// stty runs stty on the terminal, returning its output.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// terminalSize returns the terminal's columns and rows.
+func terminalSize() (int, int) {
+	var rows, cols int
+	if out, err := stty("size"); err == nil {
+		if _, err := fmt.Sscan(out, &rows, &cols); err == nil && rows > statusLines && cols > 0 {
+			return cols, rows
+		}
+	}
+	return defaultColumns, defaultRows
+}
+
+func main() {
+	addrFlag := flag.String("addr", "localhost:50051", "Game server to join")
+	nameFlag := flag.String("name", "tui", "Username to join as")
+	mapFlag := flag.String("map", "", "Map world to join instead of the lobby")
+	roomFlag := flag.String("room", "", "Room to join instead of the lobby")
+	passwordFlag := flag.String("password", "", "Password of -room")
+	flag.Parse()
+
+	conn, err := grpc.NewClient(*addrFlag, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("Invalid server address: %v", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := pb.NewGameServiceClient(conn).GameStream(ctx)
+	if err != nil {
+		log.Fatalf("Connecting to %s failed: %v", *addrFlag, err)
+	}
+	hello := &pb.ClientHello{DesiredUsername: *nameFlag, MapName: *mapFlag, RoomId: *roomFlag, RoomPassword: *passwordFlag, SupportsMapChunks: true}
+	if err := stream.Send(&pb.ClientMessage{Payload: &pb.ClientMessage_ClientHello{ClientHello: hello}}); err != nil {
+		log.Fatalf("Joining failed: %v", err)
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		log.Fatalf("Joining failed: %v", err)
+	}
+	if first.GetInitialMapData() == nil {
+		log.Fatalf("Joining failed: the server sent %T before the map", first.GetMessage())
+	}
+	w := &world{}
+	w.setMap(first.GetInitialMapData())
+	chunkSize := int(first.GetInitialMapData().GetChunkSize())
+
+	saved, err := stty("-g")
+	if err != nil {
+		log.Fatalf("stdin is not a terminal: %v", err)
+	}
+	stty("raw", "-echo")
+	fmt.Print("\x1b[?1049h\x1b[?25l\x1b[2J") // Alternate screen, hidden cursor
+	defer func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		stty(saved)
+		w.mu.Lock()
+		if w.notice != "" {
+			fmt.Println(w.notice)
+		}
+		w.mu.Unlock()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				w.mu.Lock()
+				if w.notice == "" && ctx.Err() == nil {
+					w.notice = fmt.Sprintf("Disconnected: %v", err)
+				}
+				w.mu.Unlock()
+				return
+			}
+			switch {
+			case msg.GetDeltaUpdate() != nil:
+				w.applyDelta(msg.GetDeltaUpdate())
+			case msg.GetInitialMapData() != nil:
+				w.setMap(msg.GetInitialMapData())
+				chunkSize = int(msg.GetInitialMapData().GetChunkSize())
+			case msg.GetMapChunk() != nil:
+				w.setChunk(msg.GetMapChunk(), chunkSize)
+			case msg.GetMapTileUpdate() != nil:
+				w.setTiles(msg.GetMapTileUpdate())
+			case msg.GetChatMessage() != nil:
+				c := msg.GetChatMessage()
+				w.addChat(c.SenderUsername + ": " + c.MessageText)
+			case msg.GetAnnouncement() != nil:
+				w.addChat("[server] " + msg.GetAnnouncement().GetText())
+			case msg.GetDisconnectNotice() != nil:
+				w.mu.Lock()
+				w.notice = "Disconnected by the server: " + msg.GetDisconnectNotice().GetMessage()
+				w.mu.Unlock()
+			case msg.GetPing() != nil:
+				stream.Send(&pb.ClientMessage{Payload: &pb.ClientMessage_Pong{Pong: &pb.Pong{ServerTimeMs: msg.GetPing().GetServerTimeMs()}}})
+			}
+		}
+	}()
+
+	k := &keys{quit: make(chan struct{})}
+	go k.read()
+	input := time.NewTicker(inputInterval)
+	defer input.Stop()
+	frame := time.NewTicker(frameInterval)
+	defer frame.Stop()
+	cols, rows := terminalSize()
+	for seq := uint32(1); ; {
+		select {
+		case <-k.quit:
+			return
+		case <-done:
+			return
+		case <-input.C:
+			if dir := k.held(); dir != pb.PlayerInput_UNKNOWN {
+				stream.Send(&pb.ClientMessage{Payload: &pb.ClientMessage_PlayerInput{PlayerInput: &pb.PlayerInput{Direction: dir, Seq: seq}}})
+				seq++
+			}
+		case <-frame.C:
+			fmt.Print(w.render(cols, rows))
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Package accounts registers players and logs them in, and keeps their
+// stats and last positions between sessions.
+package accounts
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// SessionTTL is how long a login stays valid.
+const SessionTTL = 30 * 24 * time.Hour
+
+const minPasswordLength = 8
+
+var (
+	ErrInvalidUsername    = errors.New("username must be 3 to 20 letters, digits, '_' or '-'")
+	ErrWeakPassword       = fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	ErrUsernameTaken      = errors.New("username is already registered")
+	ErrInvalidCredentials = errors.New("wrong username or password")
+	ErrInvalidSession     = errors.New("session token is invalid or expired")
+	ErrNotFound           = errors.New("not found")
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,20}$`)
+
+// Account is a registered player with their lifetime stats.
+type Account struct {
+	ID           int64
+	Username     string
+	CreatedAt    time.Time
+	LastSeen     time.Time // End of the last session; zero before the first
+	Sessions     int
+	PlaySeconds  int64
+	Score        int64
+	TilesVisited int64
+}
+
+// SessionStats are what a finished game session adds to an account.
+type SessionStats struct {
+	Played       time.Duration
+	Score        int64
+	TilesVisited int64
+}
+
+// Metric is a stat leaderboards rank accounts by.
+type Metric int
+
+const (
+	MetricScore Metric = iota
+	MetricTimePlayed
+	MetricTilesVisited
+)
+
+// Position is where an account's player was when they left a room.
+type Position struct {
+	RoomID string
+	X, Y   float32
+}
+
+// Store is where accounts are kept. Usernames are unique ignoring case.
+type Store interface {
+	// CreateAccount returns ErrUsernameTaken if the username is registered.
+	CreateAccount(ctx context.Context, username, passwordHash string) (Account, error)
+	// AccountByUsername returns ErrNotFound if there is no such account.
+	AccountByUsername(ctx context.Context, username string) (Account, string, error)
+	CreateSession(ctx context.Context, accountID int64, tokenHash string, expires time.Time) error
+	// SessionAccount returns ErrNotFound for unknown or expired sessions.
+	SessionAccount(ctx context.Context, tokenHash string) (Account, error)
+	LastPosition(ctx context.Context, accountID int64, roomID string) (Position, bool, error)
+	// EndSession adds a finished game session to the account's stats and,
+	// if pos names a room, remembers where the player left it.
+	EndSession(ctx context.Context, accountID int64, stats SessionStats, pos Position) error
+	// Leaderboard returns accounts ordered by a metric, highest first, with
+	// ties ordered by username.
+	Leaderboard(ctx context.Context, metric Metric, offset, limit int) ([]Account, error)
+}
+
+// Service implements registration and login on top of a Store.
+type Service struct {
+	store Store
+}
+
+func NewService(store Store) *Service {
+	return &Service{store: store}
+}
+
+// Register creates an account and logs in to it.
+func (s *Service) Register(ctx context.Context, username, password string) (Account, string, error) {
+	if !usernamePattern.MatchString(username) {
+		return Account{}, "", ErrInvalidUsername
+	}
+	if len(password) < minPasswordLength {
+		return Account{}, "", ErrWeakPassword
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return Account{}, "", err
+	}
+	acct, err := s.store.CreateAccount(ctx, username, hash)
+	if err != nil {
+		return Account{}, "", err
+	}
+	token, err := s.startSession(ctx, acct.ID)
+	return acct, token, err
+}
+
+// Login checks a password and returns a new session token.
+func (s *Service) Login(ctx context.Context, username, password string) (Account, string, error) {
+	acct, hash, err := s.store.AccountByUsername(ctx, username)
+	if errors.Is(err, ErrNotFound) {
+		// Spend the same time as a wrong password, so timing does not reveal
+		// which usernames exist.
+		checkPassword(password, dummyPasswordHash)
+		return Account{}, "", ErrInvalidCredentials
+	}
+	if err != nil {
+		return Account{}, "", err
+	}
+	if !checkPassword(password, hash) {
+		return Account{}, "", ErrInvalidCredentials
+	}
+	token, err := s.startSession(ctx, acct.ID)
+	return acct, token, err
+}
+
+// Authenticate returns the account a session token belongs to.
+func (s *Service) Authenticate(ctx context.Context, token string) (Account, error) {
+	acct, err := s.store.SessionAccount(ctx, tokenHash(token))
+	if errors.Is(err, ErrNotFound) {
+		return Account{}, ErrInvalidSession
+	}
+	return acct, err
+}
+
+// Registered reports whether a username belongs to an account.
+func (s *Service) Registered(ctx context.Context, username string) (bool, error) {
+	_, _, err := s.store.AccountByUsername(ctx, username)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// LastPosition returns where the account's player left a room, if known.
+func (s *Service) LastPosition(ctx context.Context, accountID int64, roomID string) (Position, bool, error) {
+	return s.store.LastPosition(ctx, accountID, roomID)
+}
+
+// EndSession records a finished game session; see Store.EndSession.
+func (s *Service) EndSession(ctx context.Context, accountID int64, stats SessionStats, pos Position) error {
+	return s.store.EndSession(ctx, accountID, stats, pos)
+}
+
+// Leaderboard returns a page of accounts ranked by a metric; see Store.Leaderboard.
+func (s *Service) Leaderboard(ctx context.Context, metric Metric, offset, limit int) ([]Account, error) {
+	return s.store.Leaderboard(ctx, metric, offset, limit)
+}
+
+func (s *Service) startSession(ctx context.Context, accountID int64) (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	if err := s.store.CreateSession(ctx, accountID, tokenHash(token), time.Now().Add(SessionTTL)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// tokenHash is what stores keep instead of a session token.
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
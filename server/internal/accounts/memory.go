@@ -0,0 +1,143 @@
+package accounts
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps accounts in the server process, for development servers
+// without a database. Everything is lost on restart.
+type MemoryStore struct {
+	mu        sync.Mutex
+	nextID    int64
+	accounts  map[int64]*memoryAccount
+	byName    map[string]int64 // Lowercase username -> account ID
+	sessions  map[string]memorySession
+	positions map[int64]map[string]Position // Account ID -> room ID -> position
+}
+
+type memoryAccount struct {
+	Account
+	passwordHash string
+}
+
+type memorySession struct {
+	accountID int64
+	expires   time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		accounts:  make(map[int64]*memoryAccount),
+		byName:    make(map[string]int64),
+		sessions:  make(map[string]memorySession),
+		positions: make(map[int64]map[string]Position),
+	}
+}
+
+func (m *MemoryStore) CreateAccount(_ context.Context, username, passwordHash string) (Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name := strings.ToLower(username)
+	if _, taken := m.byName[name]; taken {
+		return Account{}, ErrUsernameTaken
+	}
+	m.nextID++
+	a := &memoryAccount{Account: Account{ID: m.nextID, Username: username, CreatedAt: time.Now()}, passwordHash: passwordHash}
+	m.accounts[a.ID] = a
+	m.byName[name] = a.ID
+	return a.Account, nil
+}
+
+func (m *MemoryStore) AccountByUsername(_ context.Context, username string) (Account, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := m.byName[strings.ToLower(username)]
+	if !ok {
+		return Account{}, "", ErrNotFound
+	}
+	a := m.accounts[id]
+	return a.Account, a.passwordHash, nil
+}
+
+func (m *MemoryStore) CreateSession(_ context.Context, accountID int64, tokenHash string, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for hash, sess := range m.sessions {
+		if now.After(sess.expires) {
+			delete(m.sessions, hash)
+		}
+	}
+	m.sessions[tokenHash] = memorySession{accountID: accountID, expires: expires}
+	return nil
+}
+
+func (m *MemoryStore) SessionAccount(_ context.Context, tokenHash string) (Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sess, ok := m.sessions[tokenHash]
+	if !ok || time.Now().After(sess.expires) {
+		return Account{}, ErrNotFound
+	}
+	return m.accounts[sess.accountID].Account, nil
+}
+
+func (m *MemoryStore) LastPosition(_ context.Context, accountID int64, roomID string) (Position, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pos, ok := m.positions[accountID][roomID]
+	return pos, ok, nil
+}
+
+func (m *MemoryStore) EndSession(_ context.Context, accountID int64, stats SessionStats, pos Position) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accounts[accountID]
+	if !ok {
+		return ErrNotFound
+	}
+	a.Sessions++
+	a.PlaySeconds += int64(stats.Played / time.Second)
+	a.Score += stats.Score
+	a.TilesVisited += stats.TilesVisited
+	a.LastSeen = time.Now()
+	if pos.RoomID != "" {
+		if m.positions[accountID] == nil {
+			m.positions[accountID] = make(map[string]Position)
+		}
+		m.positions[accountID][pos.RoomID] = pos
+	}
+	return nil
+}
+
+func (m *MemoryStore) Leaderboard(_ context.Context, metric Metric, offset, limit int) ([]Account, error) {
+	m.mu.Lock()
+	all := make([]Account, 0, len(m.accounts))
+	for _, a := range m.accounts {
+		all = append(all, a.Account)
+	}
+	m.mu.Unlock()
+	value := func(a Account) int64 {
+		switch metric {
+		case MetricTimePlayed:
+			return a.PlaySeconds
+		case MetricTilesVisited:
+			return a.TilesVisited
+		}
+		return a.Score
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if vi, vj := value(all[i]), value(all[j]); vi != vj {
+			return vi > vj
+		}
+		return strings.ToLower(all[i].Username) < strings.ToLower(all[j].Username)
+	})
+	if offset >= len(all) {
+		return nil, nil
+	}
+	return all[offset:min(offset+limit, len(all))], nil
+}
@@ -0,0 +1,28 @@
+CREATE TABLE accounts (
+    id            BIGSERIAL PRIMARY KEY,
+    username      TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen     TIMESTAMPTZ,
+    sessions      INTEGER NOT NULL DEFAULT 0,
+    play_seconds  BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX accounts_username_key ON accounts (lower(username));
+
+CREATE TABLE account_sessions (
+    token_hash TEXT PRIMARY KEY,
+    account_id BIGINT NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX account_sessions_expires_at_idx ON account_sessions (expires_at);
+
+CREATE TABLE account_positions (
+    account_id BIGINT NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+    room_id    TEXT NOT NULL,
+    x          REAL NOT NULL,
+    y          REAL NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (account_id, room_id)
+);
@@ -0,0 +1,7 @@
+ALTER TABLE accounts
+    ADD COLUMN score         BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN tiles_visited BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX accounts_score_idx ON accounts (score DESC, lower(username));
+CREATE INDEX accounts_play_seconds_idx ON accounts (play_seconds DESC, lower(username));
+CREATE INDEX accounts_tiles_visited_idx ON accounts (tiles_visited DESC, lower(username));
@@ -0,0 +1,105 @@
+package game
+
+import (
+	"log"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// playerFingerprint captures the mutable fields of a tracked player so audit
+// mode can detect changes made without holding the State lock.
+type playerFingerprint struct {
+	data          *pb.Player
+	x, y          float32
+	anim          pb.AnimationState
+	invulnerable  bool
+	lastDirection pb.PlayerInput_Direction
+	lastInput     time.Time
+}
+
+func fingerprintOf(tp *trackedPlayer) playerFingerprint {
+	return playerFingerprint{
+		data:          tp.PlayerData,
+		x:             tp.PlayerData.XPos,
+		y:             tp.PlayerData.YPos,
+		anim:          tp.PlayerData.CurrentAnimationState,
+		invulnerable:  tp.PlayerData.Invulnerable,
+		lastDirection: tp.LastDirection,
+		lastInput:     tp.LastInputTime,
+	}
+}
+
+// EnableAudit turns on audit mode: every write-locked State method verifies
+// that tracked players were not changed since the previous locked mutation
+// (e.g. through a pointer leaked out of the lock) and that positions
+// are inside the world. Violations are logged and counted. Audit mode costs
+// O(players) per mutation and is meant for development servers.
+func (s *State) EnableAudit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audit = true
+	s.sealAllLocked()
+	log.Printf("State audit mode enabled.")
+}
+
+// AuditViolations returns the number of violations detected so far.
+func (s *State) AuditViolations() int64 {
+	return s.auditViolations.Load()
+}
+
+// Audit runs the invariant checks outside of any mutation, for periodic use
+// from the tick loop. It is a no-op unless audit mode is enabled.
+func (s *State) Audit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("Audit")()
+}
+
+// auditLocked verifies invariants before a locked operation and returns the
+// function that re-seals the fingerprints once the operation finishes. Use as
+// `defer s.auditLocked("Op")()` right after acquiring the write lock.
+func (s *State) auditLocked(op string) func() {
+	if !s.audit {
+		return func() {}
+	}
+	s.verifyLocked(op)
+	return s.sealAllLocked
+}
+
+func (s *State) sealAllLocked() {
+	sealed := make(map[string]playerFingerprint, len(s.players))
+	for id, tp := range s.players {
+		sealed[id] = fingerprintOf(tp)
+	}
+	s.sealed = sealed
+}
+
+func (s *State) violation(format string, args ...any) {
+	s.auditViolations.Add(1)
+	log.Printf("AUDIT VIOLATION: "+format, args...)
+}
+
+func (s *State) verifyLocked(op string) {
+	for id, tp := range s.players {
+		fp, ok := s.sealed[id]
+		if !ok {
+			s.violation("player %s was added outside a locked mutation (detected before %s)", id, op)
+			continue
+		}
+		if fp.data != tp.PlayerData {
+			s.violation("player %s data pointer was replaced without the lock (detected before %s)", id, op)
+		} else if fp != fingerprintOf(tp) {
+			s.violation("player %s was mutated without the lock (detected before %s)", id, op)
+		}
+		x, y := tp.PlayerData.XPos, tp.PlayerData.YPos
+		if x < s.worldMinX || x > s.worldMaxX || y < s.worldMinY || y > s.worldMaxY {
+			s.violation("player %s is outside the world at (%.1f, %.1f) (detected before %s)", id, x, y, op)
+		}
+	}
+	for id := range s.sealed {
+		if _, ok := s.players[id]; !ok {
+			s.violation("player %s was removed outside a locked mutation (detected before %s)", id, op)
+		}
+	}
+}
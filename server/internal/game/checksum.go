@@ -0,0 +1,49 @@
+package game
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+// Checksum hashes the state clients mirror, so they can detect that their
+// copy diverged: the players as last sent in a delta, sorted by ID with
+// positions rounded to whole pixels, and the tile grid. Call it right after
+// broadcasting pending changes. The encoding is documented on the
+// StateChecksum message, as clients must reproduce it exactly.
+func (s *State) Checksum() (players uint32, playerCount int, tiles uint32) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.lastBroadcastPlayers))
+	for id := range s.lastBroadcastPlayers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	h := fnv.New32a()
+	var buf [8]byte
+	for _, id := range ids {
+		p := s.lastBroadcastPlayers[id]
+		h.Write([]byte(id))
+		h.Write([]byte{0})
+		binary.LittleEndian.PutUint32(buf[0:4], uint32(quantize(p.XPos)))
+		binary.LittleEndian.PutUint32(buf[4:8], uint32(quantize(p.YPos)))
+		h.Write(buf[:])
+	}
+	players = h.Sum32()
+
+	h.Reset()
+	for _, row := range s.worldMap {
+		for _, t := range row {
+			binary.LittleEndian.PutUint32(buf[0:4], uint32(int32(t)))
+			h.Write(buf[0:4])
+		}
+	}
+	return players, len(ids), h.Sum32()
+}
+
+// quantize rounds a position to whole pixels, halves up, so clients in other
+// languages round the same way.
+func quantize(v float32) int32 {
+	return int32(math.Floor(float64(v) + 0.5))
+}
@@ -0,0 +1,52 @@
+package game
+
+import pb "simple-grpc-game/gen/go/game"
+
+// MapChunk returns the current tiles and visual layers of the size x size
+// chunk at the given chunk coordinates, clipped to the map. It reports false
+// if the chunk lies outside the map.
+func (s *State) MapChunk(chunkX, chunkY, size int) (*pb.MapChunk, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	x0, y0 := chunkX*size, chunkY*size
+	if size <= 0 || chunkX < 0 || chunkY < 0 || x0 >= s.mapTileWidth || y0 >= s.mapTileHeight {
+		return nil, false
+	}
+	x1, y1 := min(x0+size, s.mapTileWidth), min(y0+size, s.mapTileHeight)
+
+	chunk := &pb.MapChunk{ChunkX: int32(chunkX), ChunkY: int32(chunkY), Rows: make([]*pb.MapRow, 0, y1-y0)}
+	for y := y0; y < y1; y++ {
+		row := make([]int32, x1-x0)
+		for x := x0; x < x1; x++ {
+			row[x-x0] = int32(s.worldMap[y][x])
+		}
+		chunk.Rows = append(chunk.Rows, &pb.MapRow{Tiles: row})
+	}
+	for _, l := range s.layers {
+		rows := make([]*pb.MapRow, 0, y1-y0)
+		for y := y0; y < y1; y++ {
+			rows = append(rows, &pb.MapRow{Tiles: append([]int32(nil), l.tiles[y][x0:x1]...)})
+		}
+		chunk.Layers = append(chunk.Layers, &pb.MapLayer{Kind: l.kind, Rows: rows})
+	}
+	return chunk, true
+}
+
+// MapSize returns the map dimensions in tiles without copying the grid.
+func (s *State) MapSize() (width, height int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.mapTileWidth, s.mapTileHeight
+}
+
+// PlayerTile returns the tile under a player's center.
+func (s *State) PlayerTile(playerID string) (x, y int, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tp, exists := s.players[playerID]
+	if !exists {
+		return 0, 0, false
+	}
+	c := s.tileAt(tp.PlayerData.XPos, tp.PlayerData.YPos)
+	return c.X, c.Y, true
+}
@@ -0,0 +1,76 @@
+package game
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	DestructibleWallHealth = 3                      // Hits a destructible wall takes before breaking
+	BumpCooldown           = 250 * time.Millisecond // Minimum time between two bumps by one player
+)
+
+// initTileHealth gives every destructible wall its starting health.
+func initTileHealth(tileMap [][]TileType) map[tileCoord]int {
+	health := make(map[tileCoord]int)
+	for y, row := range tileMap {
+		for x, t := range row {
+			if t == TileTypeDestructibleWall {
+				health[tileCoord{X: x, Y: y}] = DestructibleWallHealth
+			}
+		}
+	}
+	return health
+}
+
+// damageTileLocked removes health from a destructible tile, turning it into
+// floor when it reaches zero. It reports whether the tile broke. Must be
+// called with the lock held.
+func (s *State) damageTileLocked(c tileCoord, amount int) bool {
+	hp, ok := s.tileHealth[c]
+	if !ok {
+		return false
+	}
+	hp -= amount
+	if hp > 0 {
+		s.tileHealth[c] = hp
+		return false
+	}
+	delete(s.tileHealth, c)
+	s.setTileLocked(c, TileTypeEmpty)
+	log.Printf("Destructible wall at (%d, %d) destroyed.", c.X, c.Y)
+	return true
+}
+
+// DamageTile applies damage to the destructible tile at tile coordinates
+// (x, y). It reports whether the tile broke. Attacks and bumps, which hold
+// the lock already, use damageTileLocked.
+func (s *State) DamageTile(x, y, amount int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("DamageTile")()
+	return s.damageTileLocked(tileCoord{X: x, Y: y}, amount)
+}
+
+// bumpLocked damages the destructible walls a player ran into while trying to
+// move to (x, y), at most once per BumpCooldown. Must be called with the lock held.
+func (s *State) bumpLocked(tp *trackedPlayer, x, y float32) {
+	now := time.Now()
+	if now.Sub(tp.LastBump) < BumpCooldown {
+		return
+	}
+	hit := false
+	startX, endX, startY, endY := s.playerTilesLocked(x, y)
+	for ty := startY; ty <= endY; ty++ {
+		for tx := startX; tx <= endX; tx++ {
+			c := s.wrapTileLocked(tileCoord{X: tx, Y: ty})
+			if _, destructible := s.tileHealth[c]; destructible {
+				s.damageTileLocked(c, 1)
+				hit = true
+			}
+		}
+	}
+	if hit {
+		tp.LastBump = now
+	}
+}
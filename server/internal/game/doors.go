@@ -0,0 +1,85 @@
+package game
+
+import "log"
+
+// toggleDoorGroupLocked opens a closed door group or closes an open one. A
+// group is only closed if no player is standing in any of its doorways.
+// Must be called with the lock held.
+func (s *State) toggleDoorGroupLocked(group uint8) {
+	doors := s.doorGroups[group]
+	if len(doors) == 0 {
+		return
+	}
+	first := doors[0]
+	if s.worldMap[first.Y][first.X] == TileTypeDoorClosed {
+		for _, c := range doors {
+			s.setTileLocked(c, TileTypeDoorOpen)
+		}
+		log.Printf("Door group %d opened.", group)
+		return
+	}
+	for _, c := range doors {
+		if s.tileOccupiedLocked(c) {
+			log.Printf("Door group %d blocked, staying open.", group)
+			return
+		}
+	}
+	for _, c := range doors {
+		s.setTileLocked(c, TileTypeDoorClosed)
+	}
+	log.Printf("Door group %d closed.", group)
+}
+
+// checkSwitchLocked toggles a door group when a player steps onto its switch.
+// Standing still on a switch does not re-trigger it. Must be called with the
+// lock held.
+func (s *State) checkSwitchLocked(tp *trackedPlayer) {
+	here := s.tileAt(tp.PlayerData.XPos, tp.PlayerData.YPos)
+	group, isSwitch := s.switchGroups[here]
+	if !isSwitch {
+		tp.OnSwitch = nil
+		return
+	}
+	if tp.OnSwitch != nil && *tp.OnSwitch == here {
+		return
+	}
+	tp.OnSwitch = &here
+	s.toggleDoorGroupLocked(group)
+}
+
+// Interact toggles every door group with a door touching the area just around
+// the player. It returns ErrNothingToInteract if no door was found.
+func (s *State) Interact(playerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("Interact")()
+	tp, exists := s.players[playerID]
+	if !exists {
+		return ErrPlayerNotFound
+	}
+	ts := float32(s.tileSize)
+	minTile := s.tileAt(tp.PlayerData.XPos-s.tuning.HalfWidth-ts, tp.PlayerData.YPos-s.tuning.HalfHeight-ts)
+	maxTile := s.tileAt(tp.PlayerData.XPos+s.tuning.HalfWidth+ts, tp.PlayerData.YPos+s.tuning.HalfHeight+ts)
+	near := map[tileCoord]bool{}
+	for y := minTile.Y; y <= maxTile.Y; y++ {
+		for x := minTile.X; x <= maxTile.X; x++ {
+			near[s.wrapTileLocked(tileCoord{X: x, Y: y})] = true
+		}
+	}
+	groups := map[uint8]bool{}
+	for group, doors := range s.doorGroups {
+		for _, c := range doors {
+			if near[c] {
+				groups[group] = true
+				break
+			}
+		}
+	}
+	if len(groups) == 0 {
+		return ErrNothingToInteract
+	}
+	for group := range groups {
+		s.toggleDoorGroupLocked(group)
+	}
+	return nil
+}
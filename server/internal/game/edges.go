@@ -0,0 +1,98 @@
+package game
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// EdgePolicy is what happens to a player who reaches the edge of the map.
+type EdgePolicy int
+
+const (
+	EdgeClamp EdgePolicy = iota // The edge is a wall
+	EdgeWrap                    // Toroidal world: re-enter on the opposite edge
+	EdgeFall                    // Walking off the edge respawns the player
+)
+
+func (e EdgePolicy) String() string {
+	switch e {
+	case EdgeWrap:
+		return "wrap"
+	case EdgeFall:
+		return "fall"
+	default:
+		return "clamp"
+	}
+}
+
+// ParseEdgePolicy parses a map's "edges" setting; empty means clamp.
+func ParseEdgePolicy(s string) (EdgePolicy, error) {
+	switch s {
+	case "", "clamp":
+		return EdgeClamp, nil
+	case "wrap":
+		return EdgeWrap, nil
+	case "fall":
+		return EdgeFall, nil
+	}
+	return EdgeClamp, fmt.Errorf("unknown edge policy %q (want clamp, wrap or fall)", s)
+}
+
+func (e EdgePolicy) proto() pb.EdgePolicy {
+	switch e {
+	case EdgeWrap:
+		return pb.EdgePolicy_EDGE_WRAP
+	case EdgeFall:
+		return pb.EdgePolicy_EDGE_FALL
+	default:
+		return pb.EdgePolicy_EDGE_CLAMP
+	}
+}
+
+// Edges returns the map's edge policy.
+func (s *State) Edges() pb.EdgePolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.edges.proto()
+}
+
+// Fall reports a player who walked off the edge of a "fall" map and was
+// respawned.
+type Fall struct {
+	PlayerID          string
+	X, Y              float32
+	InvulnerableUntil time.Time
+}
+
+// TakeFalls returns the falls since the previous call, in the order they
+// happened, and clears the queue.
+func (s *State) TakeFalls() []Fall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("TakeFalls")()
+	falls := s.falls
+	s.falls = nil
+	return falls
+}
+
+// fallLocked respawns a player who left the world, as RespawnPlayer does but
+// without the cooldown. Must be called with the lock held.
+func (s *State) fallLocked(playerID string, tp *trackedPlayer) {
+	x, y := s.pickSpawnLocked(playerID)
+	s.placePlayerLocked(playerID, tp, x, y)
+	now := time.Now()
+	tp.PlayerData.CurrentAnimationState = pb.AnimationState_IDLE
+	tp.PlayerData.Invulnerable = true
+	tp.LastDirection = pb.PlayerInput_UNKNOWN
+	tp.SlideDirection = pb.PlayerInput_UNKNOWN
+	tp.ArrivedPad, tp.OnSwitch = nil, nil
+	tp.InvulnerableUntil = now.Add(RespawnInvulnerability)
+	s.checkZonesLocked(playerID, tp)
+	s.falls = append(s.falls, Fall{PlayerID: playerID, X: x, Y: y, InvulnerableUntil: tp.InvulnerableUntil})
+	s.emitLocked(EventRespawned, playerID, map[string]any{"cause": "fall", "x": x, "y": y})
+	log.Printf("Player %s ('%s') fell off the map and respawned at (%.1f, %.1f)",
+		playerID, tp.PlayerData.Username, x, y)
+}
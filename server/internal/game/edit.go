@@ -0,0 +1,86 @@
+package game
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// SetTile changes the tile at tile coordinates (x, y) while players are
+// connected, e.g. from the admin map editor; clients learn about it through
+// TakeTileUpdates. The tile type must be defined on this map. Teleporters, doors and switches need a group and cannot be
+// placed this way, but may be overwritten: a pad's partner loses its link and
+// a door leaves its group. Players left inside a new wall are moved to a spawn
+// point; their IDs are returned.
+func (s *State) SetTile(x, y int, t TileType) (relocated []string, err error) {
+	switch t {
+	case TileTypeTeleporter, TileTypeDoorClosed, TileTypeDoorOpen, TileTypeSwitch:
+		return nil, fmt.Errorf("%w: %s tiles need a group and cannot be placed live", ErrInvalidTile, t)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("SetTile")()
+	if _, ok := s.tileProps[t]; !ok {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidTile, t)
+	}
+	if x < 0 || x >= s.mapTileWidth || y < 0 || y >= s.mapTileHeight {
+		return nil, fmt.Errorf("%w: (%d, %d)", ErrOutOfBounds, x, y)
+	}
+	c := tileCoord{X: x, Y: y}
+	old := s.worldMap[y][x]
+	if old == t {
+		return nil, nil
+	}
+	s.unlinkTileLocked(c, old)
+	s.setTileLocked(c, t)
+	delete(s.tileHealth, c)
+	if t == TileTypeDestructibleWall {
+		s.tileHealth[c] = DestructibleWallHealth
+	}
+	if old == TileTypeSpawn || t == TileTypeSpawn {
+		s.spawnPoints = findSpawnPoints(s.worldMap, s.tileSize)
+		s.nextSpawn = 0
+	}
+	log.Printf("Tile (%d, %d) changed from %s to %s.", x, y, old, t)
+
+	if s.propertiesOf(t).Walkable {
+		return nil, nil
+	}
+	ids := make([]string, 0, len(s.players))
+	for id := range s.players {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		tp := s.players[id]
+		if s.relocateIfStuckLocked(id, tp, "map edit") {
+			relocated = append(relocated, id)
+			s.checkZonesLocked(id, tp)
+		}
+	}
+	return relocated, nil
+}
+
+// unlinkTileLocked removes a grouped tile that is about to be overwritten from
+// its teleporter pair, door group or switch table. Must be called with the
+// lock held.
+func (s *State) unlinkTileLocked(c tileCoord, old TileType) {
+	switch old {
+	case TileTypeTeleporter:
+		if partner, ok := s.teleportLinks[c]; ok {
+			delete(s.teleportLinks, partner)
+		}
+		delete(s.teleportLinks, c)
+	case TileTypeDoorClosed, TileTypeDoorOpen:
+		for group, doors := range s.doorGroups {
+			for i, d := range doors {
+				if d == c {
+					s.doorGroups[group] = append(doors[:i:i], doors[i+1:]...)
+					break
+				}
+			}
+		}
+	case TileTypeSwitch:
+		delete(s.switchGroups, c)
+	}
+}
@@ -0,0 +1,92 @@
+package game
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+const (
+	EmoteDuration         = 2 * time.Second
+	EmoteCooldown         = time.Second
+	EmoteRange    float32 = 480 // How close a player must be to see an emote
+)
+
+// emoteAnimations maps each emote to the animation state that shows it.
+var emoteAnimations = map[pb.EmoteKind]pb.AnimationState{
+	pb.EmoteKind_EMOTE_WAVE:  pb.AnimationState_WAVING,
+	pb.EmoteKind_EMOTE_DANCE: pb.AnimationState_DANCING,
+	pb.EmoteKind_EMOTE_LAUGH: pb.AnimationState_LAUGHING,
+}
+
+// Emote plays an emote: the player's animation state shows it until
+// EmoteDuration passes or they move. It returns when the emote ends and the
+// players within EmoteRange, the emoting player included, sorted. Errors are
+// ErrPlayerNotFound, ErrPlayerDead, ErrUnknownEmote and ErrEmoteCooldown.
+func (s *State) Emote(playerID string, kind pb.EmoteKind) (time.Time, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("Emote")()
+	tp, ok := s.players[playerID]
+	if !ok {
+		return time.Time{}, nil, ErrPlayerNotFound
+	}
+	if !tp.DeadUntil.IsZero() {
+		return time.Time{}, nil, ErrPlayerDead
+	}
+	anim, known := emoteAnimations[kind]
+	if !known {
+		return time.Time{}, nil, ErrUnknownEmote
+	}
+	now := time.Now()
+	if now.Sub(tp.LastEmote) < EmoteCooldown {
+		return time.Time{}, nil, ErrEmoteCooldown
+	}
+	tp.LastEmote = now
+	tp.EmoteUntil = now.Add(EmoteDuration)
+	tp.PlayerData.CurrentAnimationState = anim
+	s.emitLocked(EventEmoted, playerID, map[string]any{"kind": kind.String()})
+
+	x, y := tp.PlayerData.XPos, tp.PlayerData.YPos
+	var nearby []string
+	for id, other := range s.players {
+		ox, oy := s.nearestLocked(x, y, other.PlayerData.XPos, other.PlayerData.YPos)
+		if math.Hypot(float64(ox-x), float64(oy-y)) <= float64(EmoteRange) {
+			nearby = append(nearby, id)
+		}
+	}
+	sort.Strings(nearby)
+	return tp.EmoteUntil, nearby, nil
+}
+
+// isEmoting reports whether an animation state is an emote.
+func isEmoting(anim pb.AnimationState) bool {
+	for _, a := range emoteAnimations {
+		if a == anim {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpireEmotes returns players whose emote ended to the idle animation,
+// reporting whether any player changed.
+func (s *State) ExpireEmotes(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("ExpireEmotes")()
+	changed := false
+	for _, tp := range s.players {
+		if tp.EmoteUntil.IsZero() || now.Before(tp.EmoteUntil) {
+			continue
+		}
+		tp.EmoteUntil = time.Time{}
+		if isEmoting(tp.PlayerData.CurrentAnimationState) {
+			tp.PlayerData.CurrentAnimationState = pb.AnimationState_IDLE
+			changed = true
+		}
+	}
+	return changed
+}
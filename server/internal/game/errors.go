@@ -0,0 +1,48 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by State methods. Callers should compare with errors.Is.
+var (
+	ErrPlayerNotFound    = errors.New("player not found")
+	ErrMapInvalid        = errors.New("invalid map")
+	ErrBlockedByWall     = errors.New("movement blocked by wall")
+	ErrBlockedByPlayer   = errors.New("movement blocked by another player")
+	ErrRespawnCooldown   = errors.New("respawn on cooldown")
+	ErrNothingToInteract = errors.New("nothing to interact with")
+	ErrOutOfBounds       = errors.New("tile out of bounds")
+	ErrInvalidTile       = errors.New("invalid tile type")
+	ErrInvalidTeam       = errors.New("no such team")
+	ErrPlayerDead        = errors.New("player is dead")
+	ErrAttackCooldown    = errors.New("attack on cooldown")
+	ErrPositionBlocked   = errors.New("position is blocked")
+	ErrNoPath            = errors.New("no path")
+	ErrPathBudget        = errors.New("pathfinding budget exhausted")
+	ErrUnknownEmote      = errors.New("unknown emote")
+	ErrEmoteCooldown     = errors.New("emote on cooldown")
+	ErrInvalidSkin       = errors.New("no such skin")
+	ErrInvalidTuning     = errors.New("invalid tuning")
+)
+
+// MapError reports a map or map layer file that could not be loaded. It
+// matches ErrMapInvalid and unwraps to the underlying cause, if any.
+type MapError struct {
+	Path   string
+	Reason string
+	Err    error
+}
+
+func (e *MapError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("map '%s': %s: %v", e.Path, e.Reason, e.Err)
+	}
+	return fmt.Sprintf("map '%s': %s", e.Path, e.Reason)
+}
+
+func (e *MapError) Unwrap() error { return e.Err }
+
+// Is makes every MapError match ErrMapInvalid.
+func (e *MapError) Is(target error) bool { return target == ErrMapInvalid }
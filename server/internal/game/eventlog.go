@@ -0,0 +1,59 @@
+package game
+
+import "time"
+
+// Event types of the structured game event log. The server adds its own,
+// such as EventKicked, for things State does not see.
+const (
+	EventPlayerJoined   = "player_joined"
+	EventPlayerLeft     = "player_left"
+	EventMoveBlocked    = "move_blocked" // Once per bump, not for every input held against a wall
+	EventCollided       = "collided"     // A move blocked by another player
+	EventRespawned      = "respawned"
+	EventKicked         = "kicked"
+	EventSpeedViolation = "speed_violation" // Movement inputs refused for arriving too fast
+	EventDesync         = "desync"          // A client's state did not match a checksum
+	EventScored         = "scored"
+	EventDamaged        = "damaged"
+	EventDied           = "died"
+	EventPickedUp       = "picked_up"
+	EventEmoted         = "emoted"
+	EventPaused         = "paused" // An admin froze the room; no player ID
+	EventResumed        = "resumed"
+	EventMatchStarted   = "match_started" // A match room's start tick arrived; no player ID
+	EventMatchEnded     = "match_ended"   // A match room was torn down
+	EventServerError    = "server_error"  // An operator alert fired; no room or player
+	EventZoneHandoff    = "zone_handoff"  // A player left for another server's zone of a sharded world
+)
+
+// Event is one append-only entry of the game event log, for analytics and
+// for reconstructing what happened around a reported issue.
+type Event struct {
+	Time     time.Time      `json:"time"`
+	Type     string         `json:"type"`
+	Room     string         `json:"room,omitempty"` // Filled in by the server
+	PlayerID string         `json:"player_id,omitempty"`
+	Fields   map[string]any `json:"fields,omitempty"`
+}
+
+// EventSink receives game events. State calls Emit with its lock held, so a
+// sink must not block or call back into the State.
+type EventSink interface {
+	Emit(e Event)
+}
+
+// SetEventSink starts sending the State's events to sink; nil stops them.
+func (s *State) SetEventSink(sink EventSink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = sink
+}
+
+// emitLocked sends an event to the sink, if there is one.
+// Must be called with the lock held.
+func (s *State) emitLocked(eventType, playerID string, fields map[string]any) {
+	if s.events == nil {
+		return
+	}
+	s.events.Emit(Event{Time: time.Now(), Type: eventType, PlayerID: playerID, Fields: fields})
+}
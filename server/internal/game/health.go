@@ -0,0 +1,128 @@
+package game
+
+import (
+	"log"
+	"math"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+const (
+	MaxHealth         int32 = 100
+	DeathRespawnDelay       = 3 * time.Second // Time a dead player waits before respawning
+)
+
+// Causes of damage, as reported in Death and EventDamaged.
+const (
+	DamageAttack = "attack"
+	DamageHazard = "hazard"
+)
+
+// Death reports a player whose health reached zero.
+type Death struct {
+	PlayerID  string
+	KillerID  string // Empty for hazards
+	Cause     string
+	RespawnAt time.Time
+}
+
+// Respawn reports a dead player brought back at a spawn point.
+type Respawn struct {
+	PlayerID          string
+	X, Y              float32
+	InvulnerableUntil time.Time
+}
+
+// ApplyHazards deals the damage of the tiles players stand on for the time
+// since the previous call, reporting whether any player's health changed.
+func (s *State) ApplyHazards(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("ApplyHazards")()
+	changed := false
+	for id, tp := range s.players {
+		last := tp.LastHazard
+		tp.LastHazard = now
+		if last.IsZero() || !tp.DeadUntil.IsZero() || tp.PlayerData.Invulnerable || tp.PlayerData.Shielded {
+			tp.HazardCarry = 0
+			continue
+		}
+		perSecond := s.terrainAtLocked(tp.PlayerData.XPos, tp.PlayerData.YPos).Damage
+		if perSecond <= 0 {
+			tp.HazardCarry = 0
+			continue
+		}
+		tp.HazardCarry += float32(perSecond) * float32(now.Sub(last).Seconds())
+		whole := float32(math.Floor(float64(tp.HazardCarry)))
+		if whole < 1 {
+			continue
+		}
+		tp.HazardCarry -= whole
+		s.damageLocked(id, tp, int32(whole), DamageHazard, "", now)
+		changed = true
+	}
+	return changed
+}
+
+// damageLocked takes health from a live, vulnerable player, killing them at
+// zero. Must be called with the lock held.
+func (s *State) damageLocked(playerID string, tp *trackedPlayer, amount int32, cause, sourceID string, now time.Time) {
+	if amount <= 0 || !tp.DeadUntil.IsZero() || tp.PlayerData.Invulnerable || tp.PlayerData.Shielded {
+		return
+	}
+	tp.PlayerData.Health = max(tp.PlayerData.Health-amount, 0)
+	s.emitLocked(EventDamaged, playerID, map[string]any{"amount": amount, "cause": cause, "source_player_id": sourceID, "health": tp.PlayerData.Health})
+	if tp.PlayerData.Health > 0 {
+		return
+	}
+	tp.DeadUntil = now.Add(DeathRespawnDelay)
+	tp.PlayerData.CurrentAnimationState = pb.AnimationState_DEAD
+	tp.LastDirection = pb.PlayerInput_UNKNOWN
+	tp.SlideDirection = pb.PlayerInput_UNKNOWN
+	tp.HazardCarry = 0
+	clearPowerUpsLocked(tp)
+	tp.EmoteUntil = time.Time{}
+	s.deaths = append(s.deaths, Death{PlayerID: playerID, KillerID: sourceID, Cause: cause, RespawnAt: tp.DeadUntil})
+	s.emitLocked(EventDied, playerID, map[string]any{"cause": cause, "killer_player_id": sourceID, "x": tp.PlayerData.XPos, "y": tp.PlayerData.YPos})
+	log.Printf("Player %s ('%s') died (%s)", playerID, tp.PlayerData.Username, cause)
+}
+
+// TakeDeaths returns the deaths since the previous call, in the order they
+// happened, and clears the queue.
+func (s *State) TakeDeaths() []Death {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("TakeDeaths")()
+	deaths := s.deaths
+	s.deaths = nil
+	return deaths
+}
+
+// RespawnDead brings back the players whose respawn delay has ended at a
+// spawn point, with full health and the usual invulnerability window.
+func (s *State) RespawnDead(now time.Time) []Respawn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("RespawnDead")()
+	var respawned []Respawn
+	for id, tp := range s.players {
+		if tp.DeadUntil.IsZero() || now.Before(tp.DeadUntil) {
+			continue
+		}
+		x, y := s.pickSpawnLocked(id)
+		s.placePlayerLocked(id, tp, x, y)
+		tp.DeadUntil = time.Time{}
+		tp.PlayerData.Health = tp.PlayerData.MaxHealth
+		tp.PlayerData.CurrentAnimationState = pb.AnimationState_IDLE
+		tp.PlayerData.Invulnerable = true
+		tp.InvulnerableUntil = now.Add(RespawnInvulnerability)
+		tp.LastRespawn = now
+		tp.ArrivedPad, tp.OnSwitch = nil, nil
+		s.checkZonesLocked(id, tp)
+		respawned = append(respawned, Respawn{PlayerID: id, X: x, Y: y, InvulnerableUntil: tp.InvulnerableUntil})
+		s.emitLocked(EventRespawned, id, map[string]any{"cause": "death", "x": x, "y": y})
+		log.Printf("Player %s ('%s') respawned at (%.1f, %.1f) after dying", id, tp.PlayerData.Username, x, y)
+	}
+	return respawned
+}
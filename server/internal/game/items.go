@@ -0,0 +1,215 @@
+package game
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	CoinPoints             = 1
+	HeartHealth      int32 = 25
+	ItemRespawnDelay       = 30 * time.Second // Map items come back this long after being picked up
+	randomItemTries        = 50               // Random tiles tried before giving up on placing an item
+)
+
+// itemKinds maps the item names of JSON maps to their kinds.
+var itemKinds = map[string]pb.ItemKind{
+	"coin":   pb.ItemKind_ITEM_COIN,
+	"heart":  pb.ItemKind_ITEM_HEART,
+	"key":    pb.ItemKind_ITEM_KEY,
+	"speed":  pb.ItemKind_ITEM_SPEED,
+	"ghost":  pb.ItemKind_ITEM_GHOST,
+	"shield": pb.ItemKind_ITEM_SHIELD,
+}
+
+// mapItem is an item placed by the map, on the center of a tile.
+type mapItem struct {
+	kind pb.ItemKind
+	tile tileCoord
+}
+
+// placedItem is an item lying on the map.
+type placedItem struct {
+	data *pb.Item
+	spot *mapItem // Where the map placed it, if it did; the item respawns there
+}
+
+type itemRespawn struct {
+	spot *mapItem
+	at   time.Time
+}
+
+// spawnItemLocked puts an item on the center of a tile and queues it for the
+// next delta. Must be called with the lock held.
+func (s *State) spawnItemLocked(kind pb.ItemKind, c tileCoord, spot *mapItem) {
+	s.nextItemID++
+	half := float32(s.tileSize) / 2
+	data := &pb.Item{
+		Id:   fmt.Sprintf("item_%d", s.nextItemID),
+		Kind: kind,
+		XPos: float32(c.X*s.tileSize) + half,
+		YPos: float32(c.Y*s.tileSize) + half,
+	}
+	s.items[data.Id] = &placedItem{data: data, spot: spot}
+	s.spawnedItems = append(s.spawnedItems, proto.Clone(data).(*pb.Item))
+}
+
+// removeItemLocked takes an item off the map and queues its removal for the
+// next delta. Must be called with the lock held.
+func (s *State) removeItemLocked(id string) {
+	delete(s.items, id)
+	s.removedItems = append(s.removedItems, id)
+}
+
+// resetItemsLocked removes every item and places the items of the loaded map.
+// Must be called with the lock held.
+func (s *State) resetItemsLocked(spots []mapItem) {
+	if s.items == nil {
+		s.items = make(map[string]*placedItem)
+	}
+	ids := make([]string, 0, len(s.items))
+	for id := range s.items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		s.removeItemLocked(id)
+	}
+	s.itemRespawns = nil
+	for i := range spots {
+		s.spawnItemLocked(spots[i].kind, spots[i].tile, &spots[i])
+	}
+}
+
+// CollectItems respawns map items whose delay has ended and gives players the
+// items they overlap, reporting whether anything changed. A heart is left for
+// players at full health.
+func (s *State) CollectItems(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("CollectItems")()
+	changed := false
+	pending := s.itemRespawns[:0]
+	for _, r := range s.itemRespawns {
+		if now.Before(r.at) {
+			pending = append(pending, r)
+			continue
+		}
+		s.spawnItemLocked(r.spot.kind, r.spot.tile, r.spot)
+		changed = true
+	}
+	s.itemRespawns = pending
+	if len(s.items) == 0 {
+		return changed
+	}
+
+	ids := make([]string, 0, len(s.players))
+	for id := range s.players {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids) // Ties go to the same player on every run
+	for _, playerID := range ids {
+		tp := s.players[playerID]
+		if !tp.DeadUntil.IsZero() {
+			continue
+		}
+		for id, it := range s.items {
+			x, y := s.nearestLocked(tp.PlayerData.XPos, tp.PlayerData.YPos, it.data.XPos, it.data.YPos)
+			if abs32(x-tp.PlayerData.XPos) > s.tuning.HalfWidth || abs32(y-tp.PlayerData.YPos) > s.tuning.HalfHeight {
+				continue
+			}
+			if !s.pickUpLocked(playerID, tp, it.data.Kind, now) {
+				continue
+			}
+			s.removeItemLocked(id)
+			if it.spot != nil {
+				s.itemRespawns = append(s.itemRespawns, itemRespawn{spot: it.spot, at: now.Add(ItemRespawnDelay)})
+			}
+			changed = true
+		}
+	}
+	return changed
+}
+
+// pickUpLocked applies an item to a player, reporting whether they took it.
+// Must be called with the lock held.
+func (s *State) pickUpLocked(playerID string, tp *trackedPlayer, kind pb.ItemKind, now time.Time) bool {
+	switch kind {
+	case pb.ItemKind_ITEM_COIN:
+		s.awardLocked(playerID, tp, CoinPoints, ScorePickup)
+	case pb.ItemKind_ITEM_HEART:
+		if tp.PlayerData.Health >= tp.PlayerData.MaxHealth {
+			return false
+		}
+		tp.PlayerData.Health = min(tp.PlayerData.Health+HeartHealth, tp.PlayerData.MaxHealth)
+	case pb.ItemKind_ITEM_KEY:
+		tp.PlayerData.Keys++
+	default:
+		if !s.grantPowerUpLocked(tp, kind, now) {
+			return false
+		}
+	}
+	s.emitLocked(EventPickedUp, playerID, map[string]any{"kind": kind.String()})
+	return true
+}
+
+// SpawnRandomItem places an item on a random walkable tile where a player
+// could stand and no item lies yet, reporting false if none was found. Random
+// items do not respawn once picked up.
+func (s *State) SpawnRandomItem(kind pb.ItemKind) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("SpawnRandomItem")()
+	taken := make(map[tileCoord]bool, len(s.items))
+	for _, it := range s.items {
+		taken[s.tileAt(it.data.XPos, it.data.YPos)] = true
+	}
+	half := float32(s.tileSize) / 2
+	for range randomItemTries {
+		c := tileCoord{X: rand.IntN(s.mapTileWidth), Y: rand.IntN(s.mapTileHeight)}
+		if taken[c] || s.checkMapCollision(float32(c.X*s.tileSize)+half, float32(c.Y*s.tileSize)+half) {
+			continue
+		}
+		s.spawnItemLocked(kind, c, nil)
+		return true
+	}
+	log.Printf("Warning: Could not find a free tile for a random %s.", kind)
+	return false
+}
+
+// RandomItemCount returns the number of items on the map that it did not
+// place.
+func (s *State) RandomItemCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := 0
+	for _, it := range s.items {
+		if it.spot == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Items returns copies of the items on the map, sorted by ID.
+func (s *State) Items() []*pb.Item {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.itemsLocked()
+}
+
+func (s *State) itemsLocked() []*pb.Item {
+	items := make([]*pb.Item, 0, len(s.items))
+	for _, it := range s.items {
+		items = append(items, proto.Clone(it.data).(*pb.Item))
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Id < items[j].Id })
+	return items
+}
@@ -0,0 +1,105 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// mapLayer is a purely visual layer loaded alongside the collision map.
+type mapLayer struct {
+	kind  pb.MapLayerKind
+	tiles [][]int32 // Tileset sprite index per cell, 0 = empty
+}
+
+// visualLayerFiles maps each optional visual layer to the suffix of its PNG,
+// e.g. "map.png" -> "map.ground.png". The collision layer is the map itself.
+var visualLayerFiles = []struct {
+	kind   pb.MapLayerKind
+	suffix string
+}{
+	{pb.MapLayerKind_MAP_LAYER_GROUND, "ground"},
+	{pb.MapLayerKind_MAP_LAYER_DECORATION, "decoration"},
+	{pb.MapLayerKind_MAP_LAYER_OVERHEAD, "overhead"},
+}
+
+// layerPath returns the path of the given layer's PNG for a map file.
+func layerPath(mapPath, suffix string) string {
+	ext := filepath.Ext(mapPath)
+	return strings.TrimSuffix(mapPath, ext) + "." + suffix + ext
+}
+
+// loadMapLayers loads whichever visual layer files exist next to the map.
+// Missing files are skipped; a layer whose size differs from the collision
+// map is an error.
+func loadMapLayers(mapPath string, width, height int) ([]mapLayer, error) {
+	var layers []mapLayer
+	for _, lf := range visualLayerFiles {
+		path := layerPath(mapPath, lf.suffix)
+		tiles, err := loadLayerFromPNG(path, width, height)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, mapLayer{kind: lf.kind, tiles: tiles})
+		log.Printf("Loaded %s layer from '%s'.", lf.suffix, path)
+	}
+	return layers, nil
+}
+
+// loadLayerFromPNG reads a visual layer: the red channel of each pixel is the
+// tileset sprite index, and fully transparent pixels are empty.
+func loadLayerFromPNG(filePath string, width, height int) ([][]int32, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, &MapError{Path: filePath, Reason: "failed to open layer", Err: err}
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, &MapError{Path: filePath, Reason: "failed to decode layer", Err: err}
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() != width || bounds.Dy() != height {
+		return nil, &MapError{Path: filePath, Reason: fmt.Sprintf("layer is %dx%d, map is %dx%d", bounds.Dx(), bounds.Dy(), width, height)}
+	}
+
+	tiles := make([][]int32, height)
+	for y := 0; y < height; y++ {
+		tiles[y] = make([]int32, width)
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			if c.A == 0 {
+				continue
+			}
+			tiles[y][x] = int32(c.R)
+		}
+	}
+	return tiles, nil
+}
+
+// MapLayers returns the map's visual layers for InitialMapData.
+func (s *State) MapLayers() []*pb.MapLayer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	layers := make([]*pb.MapLayer, 0, len(s.layers))
+	for _, l := range s.layers {
+		rows := make([]*pb.MapRow, len(l.tiles))
+		for y, row := range l.tiles {
+			rows[y] = &pb.MapRow{Tiles: append([]int32(nil), row...)}
+		}
+		layers = append(layers, &pb.MapLayer{Kind: l.kind, Rows: rows})
+	}
+	return layers
+}
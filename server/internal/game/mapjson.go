@@ -0,0 +1,318 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// jsonMap is the structured JSON map format:
+//
+//	{
+//	  "name": "Arena", "author": "someone", "tile_size": 32, "edges": "clamp",
+//	  "tiles": [[1, 1, 1], [1, 0, 1], [1, 1, 1]],
+//	  "spawn_points": [{"x": 1, "y": 1}],
+//	  "groups": [{"x": 4, "y": 2, "group": 1}],
+//	  "tile_properties": [{"tile_id": 4, "speed_multiplier": 0.3}],
+//	  "objectives": [{"id": "summit", "min_x": 1, "min_y": 1, "max_x": 1, "max_y": 1, "points": 5}],
+//	  "items": [{"x": 1, "y": 1, "kind": "coin"}],
+//	  "npcs": [{"x": 1, "y": 1, "kind": "slime", "behavior": "patrol", "facing": "right"}]
+//	}
+//
+// Tiles are TileType IDs, row by row. Spawn points and groups use tile
+// coordinates; every teleporter, door and switch tile needs a group.
+// Tile properties override the defaults field by field. Edges are "clamp"
+// (the default; the edge is a wall), "wrap" (the world is toroidal: walking
+// off an edge re-enters on the opposite one) or "fall" (walking off an edge
+// respawns the player). "wrap": true is a shorthand for "edges": "wrap".
+// Objectives are zones, in inclusive tile coordinates, that each player
+// scores once. Items ("coin", "heart", "key" or the "speed", "ghost" and
+// "shield" power-ups) lie on the center of their walkable tile and come back
+// a while after being picked up. NPCs start on the center of their tile with
+// a behavior ("idle", the default, "patrol", "wander" or "monster", which
+// patrols and chases players who come near) and a facing ("up", "down",
+// "left" or "right"; patrols walk that way first); they block players unless
+// "passable" is set.
+type jsonMap struct {
+	Name           string             `json:"name"`
+	Author         string             `json:"author"`
+	TileSize       int                `json:"tile_size"`
+	Edges          string             `json:"edges"`
+	Wrap           bool               `json:"wrap"`
+	Tiles          [][]int            `json:"tiles"`
+	SpawnPoints    []jsonTile         `json:"spawn_points"`
+	Groups         []jsonTile         `json:"groups"`
+	TileProperties []jsonTileProperty `json:"tile_properties"`
+	Objectives     []jsonObjective    `json:"objectives"`
+	Items          []jsonItem         `json:"items"`
+	NPCs           []jsonNPC          `json:"npcs"`
+}
+
+type jsonNPC struct {
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	Kind     string `json:"kind"`
+	Behavior string `json:"behavior"`
+	Facing   string `json:"facing"`
+	Passable bool   `json:"passable"`
+}
+
+// facings maps the facing names of JSON maps to directions.
+var facings = map[string]pb.PlayerInput_Direction{
+	"":      pb.PlayerInput_DOWN,
+	"up":    pb.PlayerInput_UP,
+	"down":  pb.PlayerInput_DOWN,
+	"left":  pb.PlayerInput_LEFT,
+	"right": pb.PlayerInput_RIGHT,
+}
+
+type jsonItem struct {
+	X    int    `json:"x"`
+	Y    int    `json:"y"`
+	Kind string `json:"kind"`
+}
+
+type jsonObjective struct {
+	ID     string `json:"id"`
+	MinX   int    `json:"min_x"`
+	MinY   int    `json:"min_y"`
+	MaxX   int    `json:"max_x"`
+	MaxY   int    `json:"max_y"`
+	Points int64  `json:"points"`
+}
+
+type jsonTile struct {
+	X     int `json:"x"`
+	Y     int `json:"y"`
+	Group int `json:"group"`
+}
+
+type jsonTileProperty struct {
+	TileID          int      `json:"tile_id"`
+	Walkable        *bool    `json:"walkable"`
+	SpeedMultiplier *float32 `json:"speed_multiplier"`
+	Slippery        *bool    `json:"slippery"` // Shorthand for an ice-like friction
+	Friction        *float32 `json:"friction"`
+	Damage          *int32   `json:"damage"`
+	TextureID       *int32   `json:"texture_id"`
+	TintRGB         *uint32  `json:"tint_rgb"`
+	Points          *int32   `json:"points"`
+}
+
+func loadJSONMap(filePath string) (*mapData, error) {
+	raw, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, &MapError{Path: filePath, Reason: "failed to open", Err: err}
+	}
+	var jm jsonMap
+	if err := json.Unmarshal(raw, &jm); err != nil {
+		return nil, &MapError{Path: filePath, Reason: "invalid JSON", Err: err}
+	}
+	loaded, err := jm.build()
+	if err != nil {
+		return nil, &MapError{Path: filePath, Reason: err.Error()}
+	}
+	log.Printf("Loaded JSON map '%s' (%q by %q), dimensions: %d x %d tiles of %dpx.",
+		filePath, jm.Name, jm.Author, loaded.width, loaded.height, loaded.tileSize)
+	return loaded, nil
+}
+
+func (jm *jsonMap) build() (*mapData, error) {
+	if jm.TileSize <= 0 {
+		return nil, fmt.Errorf("tile_size must be positive")
+	}
+	height := len(jm.Tiles)
+	if height == 0 || len(jm.Tiles[0]) == 0 {
+		return nil, fmt.Errorf("tiles must not be empty")
+	}
+	width := len(jm.Tiles[0])
+	props, err := applyTileProperties(jm.TileProperties)
+	if err != nil {
+		return nil, err
+	}
+	edges, err := ParseEdgePolicy(jm.Edges)
+	if err != nil {
+		return nil, err
+	}
+	if jm.Wrap {
+		if edges != EdgeWrap && jm.Edges != "" {
+			return nil, fmt.Errorf("wrap conflicts with edges %q", jm.Edges)
+		}
+		edges = EdgeWrap
+	}
+	d := &mapData{
+		tiles:        make([][]TileType, height),
+		width:        width,
+		height:       height,
+		tileSize:     jm.TileSize,
+		name:         jm.Name,
+		author:       jm.Author,
+		edges:        edges,
+		teleportPads: make(map[uint8][]tileCoord),
+		doorGroups:   make(map[uint8][]tileCoord),
+		switchGroups: make(map[tileCoord]uint8),
+		tileProps:    props,
+	}
+	for y, row := range jm.Tiles {
+		if len(row) != width {
+			return nil, fmt.Errorf("row %d has %d tiles, want %d", y, len(row), width)
+		}
+		d.tiles[y] = make([]TileType, width)
+		for x, id := range row {
+			if !knownTile(TileType(id), props) {
+				return nil, fmt.Errorf("unknown tile ID %d at (%d, %d)", id, x, y)
+			}
+			d.tiles[y][x] = TileType(id)
+		}
+	}
+	inBounds := func(t jsonTile) bool { return t.X >= 0 && t.X < width && t.Y >= 0 && t.Y < height }
+
+	for _, sp := range jm.SpawnPoints {
+		if !inBounds(sp) {
+			return nil, fmt.Errorf("spawn point (%d, %d) is outside the map", sp.X, sp.Y)
+		}
+		d.tiles[sp.Y][sp.X] = TileTypeSpawn
+	}
+
+	grouped := make(map[tileCoord]bool)
+	for _, g := range jm.Groups {
+		if !inBounds(g) {
+			return nil, fmt.Errorf("group tile (%d, %d) is outside the map", g.X, g.Y)
+		}
+		if g.Group < 1 || g.Group > 254 {
+			return nil, fmt.Errorf("group at (%d, %d) must be between 1 and 254", g.X, g.Y)
+		}
+		c, group := tileCoord{X: g.X, Y: g.Y}, uint8(g.Group)
+		switch d.tiles[g.Y][g.X] {
+		case TileTypeTeleporter:
+			d.teleportPads[group] = append(d.teleportPads[group], c)
+		case TileTypeDoorClosed, TileTypeDoorOpen:
+			d.doorGroups[group] = append(d.doorGroups[group], c)
+		case TileTypeSwitch:
+			d.switchGroups[c] = group
+		default:
+			return nil, fmt.Errorf("tile (%d, %d) is %s and cannot have a group", g.X, g.Y, d.tiles[g.Y][g.X])
+		}
+		grouped[c] = true
+	}
+	for y, row := range d.tiles {
+		for x, t := range row {
+			switch t {
+			case TileTypeTeleporter, TileTypeDoorClosed, TileTypeDoorOpen, TileTypeSwitch:
+				if !grouped[tileCoord{X: x, Y: y}] {
+					return nil, fmt.Errorf("%s at (%d, %d) has no group", t, x, y)
+				}
+			}
+		}
+	}
+
+	for _, o := range jm.Objectives {
+		z := Zone{ID: o.ID, MinX: o.MinX, MinY: o.MinY, MaxX: o.MaxX, MaxY: o.MaxY, Points: o.Points}
+		if z.ID == "" || z.MinX > z.MaxX || z.MinY > z.MaxY || z.MinX < 0 || z.MinY < 0 || z.MaxX >= width || z.MaxY >= height {
+			return nil, fmt.Errorf("objective %q must be a non-empty area inside the map", o.ID)
+		}
+		if z.Points <= 0 {
+			return nil, fmt.Errorf("objective %q must be worth points", o.ID)
+		}
+		d.objectives = append(d.objectives, z)
+	}
+
+	merged := mergeTileProperties(props)
+	for _, it := range jm.Items {
+		kind, ok := itemKinds[it.Kind]
+		if !ok {
+			return nil, fmt.Errorf("item at (%d, %d) has unknown kind %q", it.X, it.Y, it.Kind)
+		}
+		if !inBounds(jsonTile{X: it.X, Y: it.Y}) {
+			return nil, fmt.Errorf("item (%d, %d) is outside the map", it.X, it.Y)
+		}
+		if !merged[d.tiles[it.Y][it.X]].Walkable {
+			return nil, fmt.Errorf("item (%d, %d) is on a %s, which is not walkable", it.X, it.Y, d.tiles[it.Y][it.X])
+		}
+		d.items = append(d.items, mapItem{kind: kind, tile: tileCoord{X: it.X, Y: it.Y}})
+	}
+
+	for _, n := range jm.NPCs {
+		if n.Kind == "" {
+			return nil, fmt.Errorf("NPC at (%d, %d) has no kind", n.X, n.Y)
+		}
+		if n.Behavior == "" {
+			n.Behavior = "idle"
+		}
+		if _, ok := behaviors[n.Behavior]; !ok {
+			return nil, fmt.Errorf("NPC %q has unknown behavior %q", n.Kind, n.Behavior)
+		}
+		facing, ok := facings[n.Facing]
+		if !ok {
+			return nil, fmt.Errorf("NPC %q has unknown facing %q", n.Kind, n.Facing)
+		}
+		if !inBounds(jsonTile{X: n.X, Y: n.Y}) {
+			return nil, fmt.Errorf("NPC %q (%d, %d) is outside the map", n.Kind, n.X, n.Y)
+		}
+		d.npcs = append(d.npcs, mapNPC{kind: n.Kind, tile: tileCoord{X: n.X, Y: n.Y}, behavior: n.Behavior, facing: facing, solid: !n.Passable})
+	}
+
+	return d, nil
+}
+
+// applyTileProperties returns the properties of each listed tile type: its
+// defaults with the given fields overridden.
+func applyTileProperties(list []jsonTileProperty) (map[TileType]TileProperty, error) {
+	props := make(map[TileType]TileProperty, len(list))
+	for _, tp := range list {
+		if tp.TileID < 0 {
+			return nil, fmt.Errorf("tile_id %d must not be negative", tp.TileID)
+		}
+		t := TileType(tp.TileID)
+		p := defaultPropertiesOf(t)
+		if tp.Walkable != nil {
+			p.Walkable = *tp.Walkable
+		}
+		if tp.SpeedMultiplier != nil {
+			if *tp.SpeedMultiplier < 0 {
+				return nil, fmt.Errorf("speed_multiplier of tile %d must not be negative", tp.TileID)
+			}
+			p.SpeedMultiplier = *tp.SpeedMultiplier
+		}
+		if tp.Slippery != nil {
+			switch {
+			case *tp.Slippery && !p.slippery():
+				p.Friction = iceFriction
+			case !*tp.Slippery:
+				p.Friction = 1
+			}
+		}
+		if tp.Friction != nil {
+			if *tp.Friction < 0 || *tp.Friction > 1 {
+				return nil, fmt.Errorf("friction of tile %d must be between 0 and 1", tp.TileID)
+			}
+			p.Friction = *tp.Friction
+		}
+		if tp.Damage != nil {
+			if *tp.Damage < 0 {
+				return nil, fmt.Errorf("damage of tile %d must not be negative", tp.TileID)
+			}
+			p.Damage = *tp.Damage
+		}
+		if tp.TextureID != nil {
+			p.TextureID = *tp.TextureID
+		}
+		if tp.TintRGB != nil {
+			if *tp.TintRGB > 0xFFFFFF {
+				return nil, fmt.Errorf("tint_rgb of tile %d must be 0xRRGGBB", tp.TileID)
+			}
+			p.TintRGB = *tp.TintRGB
+		}
+		if tp.Points != nil {
+			if *tp.Points < 0 {
+				return nil, fmt.Errorf("points of tile %d must not be negative", tp.TileID)
+			}
+			p.Points = *tp.Points
+		}
+		props[t] = p
+	}
+	return props, nil
+}
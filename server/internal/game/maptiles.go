@@ -0,0 +1,60 @@
+package game
+
+import (
+	"sort"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// setTileLocked changes a tile at runtime and marks it dirty so the change is
+// included in the next TakeTileUpdates. Must be called with the lock held.
+func (s *State) setTileLocked(c tileCoord, t TileType) {
+	if c.X < 0 || c.X >= s.mapTileWidth || c.Y < 0 || c.Y >= s.mapTileHeight {
+		return
+	}
+	if s.worldMap[c.Y][c.X] == t {
+		return
+	}
+	s.worldMap[c.Y][c.X] = t
+	s.dirtyTiles[c] = struct{}{}
+	s.clearPathCacheLocked()
+}
+
+// TakeTileUpdates returns the tiles changed since the previous call, ordered
+// row-major, and clears the dirty set. It returns nil if nothing changed.
+func (s *State) TakeTileUpdates() []*pb.TileUpdate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("TakeTileUpdates")()
+	if len(s.dirtyTiles) == 0 {
+		return nil
+	}
+	updates := make([]*pb.TileUpdate, 0, len(s.dirtyTiles))
+	for c := range s.dirtyTiles {
+		updates = append(updates, &pb.TileUpdate{X: int32(c.X), Y: int32(c.Y), Tile: int32(s.worldMap[c.Y][c.X])})
+	}
+	sort.Slice(updates, func(i, j int) bool {
+		if updates[i].Y != updates[j].Y {
+			return updates[i].Y < updates[j].Y
+		}
+		return updates[i].X < updates[j].X
+	})
+	s.dirtyTiles = make(map[tileCoord]struct{})
+	return updates
+}
+
+// tileOccupiedLocked reports whether any player's bounding box overlaps the
+// tile. Must be called with the lock held.
+func (s *State) tileOccupiedLocked(c tileCoord) bool {
+	ts := float32(s.tileSize)
+	left, top := float32(c.X)*ts, float32(c.Y)*ts
+	right, bottom := left+ts, top+ts
+	for _, tp := range s.players {
+		px, py := tp.PlayerData.XPos, tp.PlayerData.YPos
+		if px-s.tuning.HalfWidth < right && px+s.tuning.HalfWidth > left &&
+			py-s.tuning.HalfHeight < bottom && py+s.tuning.HalfHeight > top {
+			return true
+		}
+	}
+	return false
+}
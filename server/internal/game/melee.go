@@ -0,0 +1,109 @@
+package game
+
+import (
+	"sort"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+const (
+	AttackDamage   int32   = 20
+	AttackCooldown         = 500 * time.Millisecond
+	AttackRange    float32 = 48 // How far in front of the attacker's edge the hit box reaches
+	Knockback      float32 = 48 // How far a hit pushes the target away from the attacker
+)
+
+// AttackResult describes a melee attack: the way the attacker swung, the
+// players it hit, sorted, and how many destructible walls it broke.
+type AttackResult struct {
+	Direction pb.PlayerInput_Direction
+	Hit       []string
+	Broken    int
+}
+
+// Attack swings at the box of AttackRange in front of the attacker, in the
+// direction they last moved, damaging and knocking back every player whose
+// bounding box overlapped it rewind ago (see EnablePositionHistory), except
+// teammates and invulnerable, shielded or dead players. Destructible walls
+// under the box take a hit each, as from a bump. Errors are
+// ErrPlayerNotFound, ErrPlayerDead and ErrAttackCooldown.
+func (s *State) Attack(attackerID string, rewind time.Duration) (AttackResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("Attack")()
+	self, ok := s.players[attackerID]
+	if !ok {
+		return AttackResult{}, ErrPlayerNotFound
+	}
+	if !self.DeadUntil.IsZero() {
+		return AttackResult{}, ErrPlayerDead
+	}
+	now := time.Now()
+	if now.Sub(self.LastAttack) < AttackCooldown {
+		return AttackResult{}, ErrAttackCooldown
+	}
+	self.LastAttack = now
+	facing := self.Facing
+	if facing == pb.PlayerInput_UNKNOWN {
+		facing = pb.PlayerInput_DOWN
+	}
+	result := AttackResult{Direction: facing}
+
+	// The hit box spans the attacker's width (or height) and reaches
+	// AttackRange beyond their edge in the facing direction.
+	x, y := self.PlayerData.XPos, self.PlayerData.YPos
+	dx, dy := directionVector(facing, 1)
+	centerX := x + dx*(s.tuning.HalfWidth+AttackRange/2)
+	centerY := y + dy*(s.tuning.HalfHeight+AttackRange/2)
+	halfW, halfH := s.tuning.HalfWidth, s.tuning.HalfHeight
+	if dx != 0 {
+		halfW = AttackRange / 2
+	} else {
+		halfH = AttackRange / 2
+	}
+	for id, tp := range s.players {
+		if id == attackerID || teammates(self, tp) || tp.PlayerData.Invulnerable || tp.PlayerData.Shielded || !tp.DeadUntil.IsZero() {
+			continue
+		}
+		ox, oy := s.positionAtLocked(tp, now.Add(-rewind))
+		ox, oy = s.nearestLocked(centerX, centerY, ox, oy)
+		if abs32(ox-centerX) >= halfW+s.tuning.HalfWidth || abs32(oy-centerY) >= halfH+s.tuning.HalfHeight {
+			continue
+		}
+		s.damageLocked(id, tp, AttackDamage, DamageAttack, attackerID, now)
+		if tp.DeadUntil.IsZero() {
+			s.knockBackLocked(id, tp, facing)
+		}
+		result.Hit = append(result.Hit, id)
+	}
+	sort.Strings(result.Hit)
+
+	startX, endX := s.tileSpanLocked(centerX-halfW, centerX+halfW)
+	startY, endY := s.tileSpanLocked(centerY-halfH, centerY+halfH)
+	for ty := startY; ty <= endY; ty++ {
+		for tx := startX; tx <= endX; tx++ {
+			if s.damageTileLocked(s.wrapTileLocked(tileCoord{X: tx, Y: ty}), 1) {
+				result.Broken++
+			}
+		}
+	}
+	return result, nil
+}
+
+// knockBackLocked pushes a player Knockback pixels in a direction, in move
+// sized steps, stopping at the first wall or player in the way, or once the
+// player jumps (a teleporter, an edge).
+// Must be called with the lock held.
+func (s *State) knockBackLocked(playerID string, tp *trackedPlayer, dir pb.PlayerInput_Direction) {
+	for moved := float32(0); moved < Knockback; moved += s.tuning.MoveSpeed {
+		dx, dy := directionVector(dir, min(s.tuning.MoveSpeed, Knockback-moved))
+		x, y := tp.PlayerData.XPos, tp.PlayerData.YPos
+		if s.tryMoveLocked(playerID, tp, dx, dy) != nil {
+			return
+		}
+		if tp.PlayerData.XPos != x+dx || tp.PlayerData.YPos != y+dy {
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package game
+
+import (
+	"math"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+const (
+	MonsterSight  float32 = 240 // How close a player must come for a monster to chase them
+	monsterReplan         = time.Second
+)
+
+// Monster patrols until a player comes within Sight, then chases the nearest
+// one along a path around walls, planning again every second, when its
+// target changes or when it is blocked. Without a path (none exists, or the
+// tick's AI budget is spent) it heads straight for the player.
+type Monster struct {
+	Sight float32
+
+	patrol  Patrol
+	target  string
+	path    []Waypoint
+	planned time.Time
+}
+
+func (m *Monster) Next(npc NPCView) pb.PlayerInput_Direction {
+	t, ok := m.nearest(npc)
+	if !ok {
+		m.target, m.path = "", nil
+		return m.patrol.Next(npc)
+	}
+	if t.ID != m.target || npc.Blocked || len(m.path) == 0 || npc.Now.Sub(m.planned) >= monsterReplan {
+		m.target, m.planned = t.ID, npc.Now
+		path, found := npc.PathTo(t.X, t.Y)
+		if !found {
+			m.path = nil
+			return towards(npc.X, npc.Y, t.X, t.Y)
+		}
+		m.path = path
+	}
+	for len(m.path) > 0 && abs32(m.path[0].X-npc.X) < NPCMoveSpeed && abs32(m.path[0].Y-npc.Y) < NPCMoveSpeed {
+		m.path = m.path[1:]
+	}
+	if len(m.path) == 0 {
+		return towards(npc.X, npc.Y, t.X, t.Y) // On the target's tile
+	}
+	return towards(npc.X, npc.Y, m.path[0].X, m.path[0].Y)
+}
+
+// nearest returns the closest player within sight, if any.
+func (m *Monster) nearest(npc NPCView) (NPCTarget, bool) {
+	var best NPCTarget
+	bestDist := float64(m.Sight)
+	found := false
+	for _, t := range npc.Players {
+		if d := math.Hypot(float64(t.X-npc.X), float64(t.Y-npc.Y)); d <= bestDist {
+			best, bestDist, found = t, d, true
+		}
+	}
+	return best, found
+}
+
+// towards returns the direction that closes the larger of the horizontal and
+// vertical gaps from (x, y) to (toX, toY), or UNKNOWN once within half a step.
+func towards(x, y, toX, toY float32) pb.PlayerInput_Direction {
+	dx, dy := toX-x, toY-y
+	if abs32(dx) < NPCMoveSpeed/2 && abs32(dy) < NPCMoveSpeed/2 {
+		return pb.PlayerInput_UNKNOWN
+	}
+	if abs32(dx) >= abs32(dy) {
+		if dx < 0 {
+			return pb.PlayerInput_LEFT
+		}
+		return pb.PlayerInput_RIGHT
+	}
+	if dy < 0 {
+		return pb.PlayerInput_UP
+	}
+	return pb.PlayerInput_DOWN
+}
@@ -0,0 +1,78 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MaxDisplayNameLength = 20       // In characters
+	defaultDisplayName   = "Player" // For empty or rejected names
+)
+
+// blockedNameWords are the words display names may not contain, after
+// folding case and common letter substitutions.
+var blockedNameWords = []string{
+	"fuck", "shit", "cunt", "bitch", "nigger", "nigga", "faggot", "whore", "slut", "rape", "nazi",
+}
+
+// nameFolds undoes the digit and symbol substitutions used to dodge filters.
+var nameFolds = strings.NewReplacer("0", "o", "1", "i", "!", "i", "3", "e", "4", "a", "@", "a", "5", "s", "$", "s", "7", "t")
+
+// CleanDisplayName turns a requested name into one fit to show: printable
+// characters only, runs of spaces collapsed, at most MaxDisplayNameLength
+// characters. Empty names and names containing a blocked word become
+// "Player".
+func CleanDisplayName(name string) string {
+	name = strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return unicode.IsSpace(r) || !unicode.IsPrint(r)
+	}), " ")
+	if utf8.RuneCountInString(name) > MaxDisplayNameLength {
+		name = strings.TrimSpace(string([]rune(name)[:MaxDisplayNameLength]))
+	}
+	if name == "" || profane(name) {
+		return defaultDisplayName
+	}
+	return name
+}
+
+// profane reports whether a name contains a blocked word, ignoring case,
+// substitutions and anything but letters in between.
+func profane(name string) bool {
+	folded := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) {
+			return r
+		}
+		return -1
+	}, nameFolds.Replace(strings.ToLower(name)))
+	for _, w := range blockedNameWords {
+		if strings.Contains(folded, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueDisplayNameLocked returns name, or name with the lowest number from 2
+// up that no other player of the State shows, ignoring case. Must be called
+// with the lock held.
+func (s *State) uniqueDisplayNameLocked(playerID, name string) string {
+	taken := make(map[string]bool, len(s.players))
+	for id, tp := range s.players {
+		if id != playerID {
+			taken[strings.ToLower(tp.PlayerData.DisplayName)] = true
+		}
+	}
+	candidate := name
+	for n := 2; taken[strings.ToLower(candidate)]; n++ {
+		suffix := fmt.Sprintf(" %d", n)
+		base := []rune(name)
+		if keep := MaxDisplayNameLength - len(suffix); len(base) > keep {
+			base = base[:keep]
+		}
+		candidate = strings.TrimSpace(string(base)) + suffix
+	}
+	return candidate
+}
@@ -0,0 +1,299 @@
+package game
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// NPCMoveSpeed is how far an NPC moves per tick, in pixels.
+const NPCMoveSpeed float32 = PlayerMoveSpeed / 2
+
+// NPCView is what a Behavior sees of its NPC and the world each tick.
+type NPCView struct {
+	ID, Kind string
+	X, Y     float32
+	Facing   pb.PlayerInput_Direction // Last direction the NPC tried to move in
+	Blocked  bool                     // The last move was blocked by a wall, player or NPC
+	Now      time.Time
+	Players  []NPCTarget // Live players NPCs may go after, sorted by ID
+	// PathTo finds a path from the NPC to a point, as FindPath does, within
+	// the tick's AI budget; it reports false if there is no path or once the
+	// budget is spent.
+	PathTo func(x, y float32) ([]Waypoint, bool)
+}
+
+// NPCTarget is a player as seen by NPC behaviors, at the position nearest
+// the NPC on wrapping maps.
+type NPCTarget struct {
+	ID   string
+	X, Y float32
+}
+
+// Behavior drives an NPC. Each NPC has its own Behavior, so implementations
+// may keep state between ticks; Next is called with the State lock held and
+// must not call back into the State.
+type Behavior interface {
+	// Next returns the direction to move in this tick; UNKNOWN stands still.
+	Next(npc NPCView) pb.PlayerInput_Direction
+}
+
+// Idle never moves; vendors and the like stand where the map put them.
+type Idle struct{}
+
+func (Idle) Next(NPCView) pb.PlayerInput_Direction { return pb.PlayerInput_UNKNOWN }
+
+// Patrol walks in a straight line and turns around whenever it is blocked.
+type Patrol struct{}
+
+func (Patrol) Next(npc NPCView) pb.PlayerInput_Direction {
+	if npc.Blocked {
+		return oppositeDirection(npc.Facing)
+	}
+	return npc.Facing
+}
+
+// Wander walks in a random direction, picking a new one every few seconds or
+// when blocked, and pauses now and then.
+type Wander struct {
+	dir  pb.PlayerInput_Direction
+	turn time.Time
+}
+
+func (w *Wander) Next(npc NPCView) pb.PlayerInput_Direction {
+	if npc.Blocked || !npc.Now.Before(w.turn) {
+		w.dir = pb.PlayerInput_Direction(rand.IntN(5)) // UNKNOWN pauses
+		w.turn = npc.Now.Add(time.Duration(1+rand.IntN(3)) * time.Second)
+	}
+	return w.dir
+}
+
+// behaviors builds the Behavior of each name JSON maps may use.
+var behaviors = map[string]func() Behavior{
+	"idle":    func() Behavior { return Idle{} },
+	"patrol":  func() Behavior { return Patrol{} },
+	"wander":  func() Behavior { return &Wander{} },
+	"monster": func() Behavior { return &Monster{Sight: MonsterSight} },
+}
+
+func oppositeDirection(dir pb.PlayerInput_Direction) pb.PlayerInput_Direction {
+	switch dir {
+	case pb.PlayerInput_UP:
+		return pb.PlayerInput_DOWN
+	case pb.PlayerInput_DOWN:
+		return pb.PlayerInput_UP
+	case pb.PlayerInput_LEFT:
+		return pb.PlayerInput_RIGHT
+	case pb.PlayerInput_RIGHT:
+		return pb.PlayerInput_LEFT
+	}
+	return pb.PlayerInput_UNKNOWN
+}
+
+// runningAnimation returns the animation of moving in a direction.
+func runningAnimation(dir pb.PlayerInput_Direction) pb.AnimationState {
+	switch dir {
+	case pb.PlayerInput_UP:
+		return pb.AnimationState_RUNNING_UP
+	case pb.PlayerInput_DOWN:
+		return pb.AnimationState_RUNNING_DOWN
+	case pb.PlayerInput_LEFT:
+		return pb.AnimationState_RUNNING_LEFT
+	case pb.PlayerInput_RIGHT:
+		return pb.AnimationState_RUNNING_RIGHT
+	}
+	return pb.AnimationState_IDLE
+}
+
+// mapNPC is an NPC placed by the map, on the center of a tile.
+type mapNPC struct {
+	kind     string
+	tile     tileCoord
+	behavior string
+	facing   pb.PlayerInput_Direction
+	solid    bool
+}
+
+// trackedNPC is an NPC in the State.
+type trackedNPC struct {
+	data     *pb.NPC
+	behavior Behavior
+	facing   pb.PlayerInput_Direction
+	blocked  bool
+}
+
+// AddNPC places an NPC centered at (x, y), facing a direction, and returns
+// its ID. The position must be free of walls and solid characters.
+func (s *State) AddNPC(kind string, x, y float32, facing pb.PlayerInput_Direction, solid bool, behavior Behavior) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("AddNPC")()
+	if s.checkMapCollision(x, y) || (solid && s.checkPlayerCollision("", x, y)) {
+		return "", ErrPositionBlocked
+	}
+	return s.addNPCLocked(kind, x, y, facing, solid, behavior), nil
+}
+
+func (s *State) addNPCLocked(kind string, x, y float32, facing pb.PlayerInput_Direction, solid bool, behavior Behavior) string {
+	if s.npcs == nil {
+		s.npcs = make(map[string]*trackedNPC)
+	}
+	s.nextNPCID++
+	id := fmt.Sprintf("npc_%d", s.nextNPCID)
+	s.npcs[id] = &trackedNPC{
+		data:     &pb.NPC{Id: id, Kind: kind, XPos: x, YPos: y, CurrentAnimationState: pb.AnimationState_IDLE, Solid: solid},
+		behavior: behavior,
+		facing:   facing,
+	}
+	return id
+}
+
+// RemoveNPC removes an NPC, reporting whether it existed.
+func (s *State) RemoveNPC(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("RemoveNPC")()
+	if _, ok := s.npcs[id]; !ok {
+		return false
+	}
+	delete(s.npcs, id)
+	return true
+}
+
+// resetNPCsLocked removes every NPC and places the NPCs of the loaded map.
+// Must be called with the lock held.
+func (s *State) resetNPCsLocked(placed []mapNPC) {
+	clear(s.npcs)
+	half := float32(s.tileSize) / 2
+	for _, n := range placed {
+		s.addNPCLocked(n.kind, float32(n.tile.X*s.tileSize)+half, float32(n.tile.Y*s.tileSize)+half, n.facing, n.solid, behaviors[n.behavior]())
+	}
+}
+
+// TickNPCs asks every NPC's behavior where to go and moves it, in ID order,
+// reporting whether any NPC changed.
+func (s *State) TickNPCs(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("TickNPCs")()
+	ids := make([]string, 0, len(s.npcs))
+	for id := range s.npcs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	budget := s.aiBudget
+	if budget <= 0 {
+		budget = DefaultAIBudget
+	}
+	changed := false
+	for _, id := range ids {
+		n := s.npcs[id]
+		x, y := n.data.XPos, n.data.YPos
+		dir := n.behavior.Next(NPCView{
+			ID: id, Kind: n.data.Kind, X: x, Y: y,
+			Facing: n.facing, Blocked: n.blocked, Now: now,
+			Players: s.npcTargetsLocked(x, y),
+			PathTo: func(toX, toY float32) ([]Waypoint, bool) {
+				path, found, ok := s.findPathLocked(x, y, toX, toY, &budget)
+				return path, found && ok
+			},
+		})
+		anim := n.data.CurrentAnimationState
+		s.moveNPCLocked(id, n, dir)
+		if n.data.XPos != x || n.data.YPos != y || n.data.CurrentAnimationState != anim {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// npcTargetsLocked returns the live, vulnerable, visible players, sorted by
+// ID, at their positions nearest (x, y). Must be called with the lock held.
+func (s *State) npcTargetsLocked(x, y float32) []NPCTarget {
+	targets := make([]NPCTarget, 0, len(s.players))
+	for id, tp := range s.players {
+		if !tp.DeadUntil.IsZero() || tp.PlayerData.Invulnerable || tp.PlayerData.Ghost {
+			continue
+		}
+		px, py := s.nearestLocked(x, y, tp.PlayerData.XPos, tp.PlayerData.YPos)
+		targets = append(targets, NPCTarget{ID: id, X: px, Y: py})
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].ID < targets[j].ID })
+	return targets
+}
+
+// moveNPCLocked moves an NPC one step in a direction if the destination is
+// free of walls and, for solid NPCs, of players and other solid NPCs. NPCs
+// stop at the edges of the map rather than falling off. Must be called with
+// the lock held.
+func (s *State) moveNPCLocked(id string, n *trackedNPC, dir pb.PlayerInput_Direction) {
+	if dir == pb.PlayerInput_UNKNOWN {
+		n.blocked = false
+		n.data.CurrentAnimationState = pb.AnimationState_IDLE
+		return
+	}
+	n.facing = dir
+	dx, dy := directionVector(dir, NPCMoveSpeed)
+	var x, y float32
+	if s.edges == EdgeWrap {
+		x, y = s.wrapPositionLocked(n.data.XPos+dx, n.data.YPos+dy)
+	} else {
+		x = clamp(n.data.XPos+dx, s.worldMinX+s.tuning.HalfWidth, s.worldMaxX-s.tuning.HalfWidth)
+		y = clamp(n.data.YPos+dy, s.worldMinY+s.tuning.HalfHeight, s.worldMaxY-s.tuning.HalfHeight)
+	}
+	n.blocked = (x == n.data.XPos && y == n.data.YPos) || s.checkMapCollision(x, y) ||
+		(n.data.Solid && s.checkPlayerCollision(id, x, y))
+	if n.blocked {
+		n.data.CurrentAnimationState = pb.AnimationState_IDLE
+		return
+	}
+	n.data.XPos, n.data.YPos = x, y
+	n.data.CurrentAnimationState = runningAnimation(dir)
+}
+
+// generateNPCDeltaLocked adds the NPCs that appeared or changed since the
+// last delta, and those removed, reporting whether there were any. Must be
+// called with the lock held.
+func (s *State) generateNPCDeltaLocked(delta *pb.DeltaUpdate) bool {
+	if s.lastBroadcastNPCs == nil {
+		s.lastBroadcastNPCs = make(map[string]*pb.NPC)
+	}
+	changed := false
+	for id, n := range s.npcs {
+		if last, ok := s.lastBroadcastNPCs[id]; ok && proto.Equal(last, n.data) {
+			continue
+		}
+		s.lastBroadcastNPCs[id] = proto.Clone(n.data).(*pb.NPC)
+		delta.UpdatedNpcs = append(delta.UpdatedNpcs, proto.Clone(n.data).(*pb.NPC))
+		changed = true
+	}
+	for id := range s.lastBroadcastNPCs {
+		if _, ok := s.npcs[id]; !ok {
+			delta.RemovedNpcIds = append(delta.RemovedNpcIds, id)
+			delete(s.lastBroadcastNPCs, id)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// NPCs returns copies of every NPC, sorted by ID.
+func (s *State) NPCs() []*pb.NPC {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.npcsLocked()
+}
+
+func (s *State) npcsLocked() []*pb.NPC {
+	npcs := make([]*pb.NPC, 0, len(s.npcs))
+	for _, n := range s.npcs {
+		npcs = append(npcs, proto.Clone(n.data).(*pb.NPC))
+	}
+	sort.Slice(npcs, func(i, j int) bool { return npcs[i].Id < npcs[j].Id })
+	return npcs
+}
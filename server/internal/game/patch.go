@@ -0,0 +1,136 @@
+package game
+
+import (
+	"slices"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+const (
+	fieldPosition  = uint32(pb.PlayerField_PLAYER_FIELD_POSITION)
+	fieldAnimation = uint32(pb.PlayerField_PLAYER_FIELD_ANIMATION)
+	fieldMetadata  = uint32(pb.PlayerField_PLAYER_FIELD_METADATA)
+	fieldHealth    = uint32(pb.PlayerField_PLAYER_FIELD_HEALTH)
+)
+
+// changedFields returns the PlayerField bits that differ between two copies
+// of a player. A change only to a field without a bit yields zero, which
+// sends the complete player, so new Player fields are never lost.
+func changedFields(old, cur *pb.Player) uint32 {
+	var mask uint32
+	if old.XPos != cur.XPos || old.YPos != cur.YPos {
+		mask |= fieldPosition
+	}
+	if old.CurrentAnimationState != cur.CurrentAnimationState {
+		mask |= fieldAnimation
+	}
+	if old.Username != cur.Username || old.DisplayName != cur.DisplayName || old.Skin != cur.Skin || old.RttMs != cur.RttMs || old.Invulnerable != cur.Invulnerable || old.It != cur.It || old.Team != cur.Team || old.Keys != cur.Keys ||
+		old.SpeedBoost != cur.SpeedBoost || old.Ghost != cur.Ghost || old.Shielded != cur.Shielded {
+		mask |= fieldMetadata
+	}
+	if old.Health != cur.Health || old.MaxHealth != cur.MaxHealth {
+		mask |= fieldHealth
+	}
+	return mask
+}
+
+// partialPlayer returns a copy of p holding only the fields in mask. A zero
+// mask copies every field.
+func partialPlayer(p *pb.Player, mask uint32) *pb.Player {
+	out := acquirePlayer()
+	if mask == uint32(pb.PlayerField_PLAYER_FIELD_ALL) {
+		copyPlayer(out, p)
+		return out
+	}
+	out.Id, out.ChangedFields = p.Id, mask
+	copyFields(out, p, mask)
+	return out
+}
+
+// copyFields copies the fields in mask from src to dst.
+func copyFields(dst, src *pb.Player, mask uint32) {
+	if mask&fieldPosition != 0 {
+		dst.XPos, dst.YPos = src.XPos, src.YPos
+	}
+	if mask&fieldAnimation != 0 {
+		dst.CurrentAnimationState = src.CurrentAnimationState
+	}
+	if mask&fieldMetadata != 0 {
+		dst.Username, dst.Invulnerable, dst.It, dst.Team, dst.Keys = src.Username, src.Invulnerable, src.It, src.Team, src.Keys
+		dst.SpeedBoost, dst.Ghost, dst.Shielded = src.SpeedBoost, src.Ghost, src.Shielded
+		dst.DisplayName, dst.Skin, dst.Color, dst.RttMs = src.DisplayName, src.Skin, src.Color, src.RttMs
+	}
+	if mask&fieldHealth != 0 {
+		dst.Health, dst.MaxHealth = src.Health, src.MaxHealth
+	}
+}
+
+// MergeDelta folds newer, the delta broadcast after older, into older, so
+// that a client applying the result ends up where applying both would leave
+// it. Streams use it to drop a stale delta without losing its changes.
+// Anything updated in both takes newer's state, partial players combining
+// their fields; anything newer removes is dropped from older's updates. A
+// player removed in older and added again in newer (a leave, then a rejoin
+// under the same ID) is only updated: newer has them complete, replacing
+// whatever the client held, so the result never both removes and updates an ID.
+// older is modified and returned.
+func MergeDelta(older, newer *pb.DeltaUpdate) *pb.DeltaUpdate {
+	left := toSet(newer.RemovedPlayerIds)
+	players := make([]*pb.Player, 0, len(older.UpdatedPlayers)+len(newer.UpdatedPlayers))
+	index := make(map[string]int)
+	for _, p := range older.UpdatedPlayers {
+		if !left[p.Id] {
+			index[p.Id] = len(players)
+			players = append(players, p)
+		}
+	}
+	for _, p := range newer.UpdatedPlayers {
+		i, ok := index[p.Id]
+		switch {
+		case !ok:
+			index[p.Id] = len(players)
+			players = append(players, p)
+		case p.ChangedFields == 0:
+			players[i] = p
+		default:
+			copyFields(players[i], p, p.ChangedFields)
+			if players[i].ChangedFields != 0 {
+				players[i].ChangedFields |= p.ChangedFields
+			}
+		}
+	}
+	older.UpdatedPlayers = players
+	rejoined := make(map[string]bool, len(newer.UpdatedPlayers))
+	for _, p := range newer.UpdatedPlayers {
+		rejoined[p.Id] = true
+	}
+	older.RemovedPlayerIds = slices.DeleteFunc(older.RemovedPlayerIds, func(id string) bool { return rejoined[id] })
+	older.RemovedPlayerIds = append(older.RemovedPlayerIds, newer.RemovedPlayerIds...)
+	for _, id := range newer.TeleportedPlayerIds {
+		if !slices.Contains(older.TeleportedPlayerIds, id) {
+			older.TeleportedPlayerIds = append(older.TeleportedPlayerIds, id)
+		}
+	}
+
+	gone := toSet(newer.RemovedItemIds)
+	older.SpawnedItems = slices.DeleteFunc(older.SpawnedItems, func(it *pb.Item) bool { return gone[it.Id] })
+	older.SpawnedItems = append(older.SpawnedItems, newer.SpawnedItems...)
+	older.RemovedItemIds = append(older.RemovedItemIds, newer.RemovedItemIds...)
+
+	gone = toSet(newer.RemovedNpcIds)
+	for _, n := range newer.UpdatedNpcs {
+		gone[n.Id] = true // Replaced by newer's state
+	}
+	older.UpdatedNpcs = slices.DeleteFunc(older.UpdatedNpcs, func(n *pb.NPC) bool { return gone[n.Id] })
+	older.UpdatedNpcs = append(older.UpdatedNpcs, newer.UpdatedNpcs...)
+	older.RemovedNpcIds = append(older.RemovedNpcIds, newer.RemovedNpcIds...)
+	return older
+}
+
+func toSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
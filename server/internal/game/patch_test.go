@@ -0,0 +1,116 @@
+package game
+
+import (
+	"testing"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// testState returns a State on a walled 8x8 map with one spawn point.
+func testState(tb testing.TB) *State {
+	tb.Helper()
+	s, err := NewStateFromFile("testdata/arena.json")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return s
+}
+
+func TestChangedFields(t *testing.T) {
+	base := &pb.Player{Id: "p1", Username: "ann", XPos: 10, YPos: 10, CurrentAnimationState: pb.AnimationState_IDLE}
+	tests := []struct {
+		name string
+		edit func(p *pb.Player)
+		want uint32
+	}{
+		{"unchanged", func(p *pb.Player) {}, 0},
+		{"moved", func(p *pb.Player) { p.XPos = 11 }, fieldPosition},
+		{"animated", func(p *pb.Player) { p.CurrentAnimationState = pb.AnimationState_RUNNING_RIGHT }, fieldAnimation},
+		{"renamed", func(p *pb.Player) { p.Username = "bob" }, fieldMetadata},
+		{"moved and animated", func(p *pb.Player) {
+			p.YPos = 20
+			p.CurrentAnimationState = pb.AnimationState_RUNNING_DOWN
+		}, fieldPosition | fieldAnimation},
+	}
+	for _, tt := range tests {
+		cur := &pb.Player{}
+		copyPlayer(cur, base)
+		tt.edit(cur)
+		if got := changedFields(base, cur); got != tt.want {
+			t.Errorf("%s: changedFields = %b, want %b", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPartialPlayer(t *testing.T) {
+	p := &pb.Player{Id: "p1", Username: "ann", XPos: 10, YPos: 20, CurrentAnimationState: pb.AnimationState_RUNNING_LEFT}
+	got := partialPlayer(p, fieldPosition)
+	if got.Id != "p1" || got.XPos != 10 || got.YPos != 20 || got.ChangedFields != fieldPosition {
+		t.Errorf("position-only copy = %v", got)
+	}
+	if got.Username != "" || got.CurrentAnimationState != 0 {
+		t.Errorf("position-only copy carries unmasked fields: %v", got)
+	}
+	if full := partialPlayer(p, 0); full.Username != "ann" || full.ChangedFields != 0 {
+		t.Errorf("zero mask copy = %v, want the complete player", full)
+	}
+}
+
+func TestGeneratePartialDeltaUpdate(t *testing.T) {
+	s := testState(t)
+	s.AddPlayer("p1", "ann")
+
+	_, partial, changed := s.GeneratePartialDeltaUpdate()
+	if !changed || len(partial.UpdatedPlayers) != 1 {
+		t.Fatalf("first delta: changed=%v players=%v", changed, partial.UpdatedPlayers)
+	}
+	if p := partial.UpdatedPlayers[0]; p.ChangedFields != 0 || p.Username != "ann" {
+		t.Errorf("new player sent as %v, want the complete player", p)
+	}
+
+	if _, _, changed := s.GeneratePartialDeltaUpdate(); changed {
+		t.Error("delta reported a change with nothing moving")
+	}
+
+	if _, err := s.ApplyInput("p1", pb.PlayerInput_RIGHT); err != nil {
+		t.Fatal(err)
+	}
+	full, partial, changed := s.GeneratePartialDeltaUpdate()
+	if !changed || len(partial.UpdatedPlayers) != 1 {
+		t.Fatalf("move delta: changed=%v players=%v", changed, partial.UpdatedPlayers)
+	}
+	p := partial.UpdatedPlayers[0]
+	if p.Id != "p1" || p.ChangedFields&fieldPosition == 0 || p.XPos != full.UpdatedPlayers[0].XPos {
+		t.Errorf("moved player sent as %v, want its new position", p)
+	}
+	if p.Username != "" {
+		t.Errorf("moved player resent its username: %v", p)
+	}
+	if full.UpdatedPlayers[0].Username != "ann" {
+		t.Errorf("full delta lost the username: %v", full.UpdatedPlayers[0])
+	}
+}
+
+func TestMergeDeltaLeaveThenRejoin(t *testing.T) {
+	older := &pb.DeltaUpdate{
+		UpdatedPlayers:   []*pb.Player{{Id: "p2", XPos: 5}},
+		RemovedPlayerIds: []string{"p1"},
+	}
+	newer := &pb.DeltaUpdate{UpdatedPlayers: []*pb.Player{{Id: "p1", Username: "ann", XPos: 40}}}
+	merged := MergeDelta(older, newer)
+	if len(merged.RemovedPlayerIds) != 0 {
+		t.Errorf("rejoined player still removed: %v", merged.RemovedPlayerIds)
+	}
+	if len(merged.UpdatedPlayers) != 2 || merged.UpdatedPlayers[1].Id != "p1" || merged.UpdatedPlayers[1].XPos != 40 {
+		t.Errorf("updated players = %v, want p2 and the rejoined p1", merged.UpdatedPlayers)
+	}
+
+	// Leaving again after the rejoin removes them for good.
+	merged = MergeDelta(merged, &pb.DeltaUpdate{RemovedPlayerIds: []string{"p1"}})
+	if len(merged.UpdatedPlayers) != 1 || merged.UpdatedPlayers[0].Id != "p2" {
+		t.Errorf("updated players after leaving again = %v, want only p2", merged.UpdatedPlayers)
+	}
+	if len(merged.RemovedPlayerIds) != 1 || merged.RemovedPlayerIds[0] != "p1" {
+		t.Errorf("removed players after leaving again = %v, want p1", merged.RemovedPlayerIds)
+	}
+}
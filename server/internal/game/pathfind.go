@@ -0,0 +1,226 @@
+package game
+
+import (
+	"container/heap"
+	"slices"
+)
+
+const (
+	// DefaultAIBudget is the number of tiles NPC pathfinding may expand per
+	// tick, across every NPC of a State, unless changed with SetAIBudget.
+	DefaultAIBudget = 4000
+	pathCacheSize   = 1024 // Searches remembered until the map changes
+)
+
+// pathKey identifies a search by its start and goal tiles.
+type pathKey struct {
+	from, to tileCoord
+}
+
+// pathResult is a finished search: a path, or nil with found false.
+type pathResult struct {
+	path  []Waypoint
+	found bool
+}
+
+// Waypoint is the pixel center of a tile on a path.
+type Waypoint struct {
+	X, Y float32
+}
+
+// SetAIBudget sets how many tiles NPC pathfinding may expand per tick; once
+// it is spent, searches fail until the next tick and behaviors fall back to
+// simpler moves. Zero or less restores DefaultAIBudget.
+func (s *State) SetAIBudget(tiles int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("SetAIBudget")()
+	if tiles <= 0 {
+		tiles = DefaultAIBudget
+	}
+	s.aiBudget = tiles
+}
+
+// FindPath returns the shortest path, as the tile centers to walk through,
+// from the tile under one point to the tile under another, keeping to tiles
+// whose center a player's bounding box fits on; the path excludes the
+// starting tile. The destination tile need not fit a bounding box, since a
+// player standing off-center may be reachable only there. The error is
+// ErrNoPath if there is no such path. Results are cached until the map
+// changes, so AI, admin tools and map checks may call it freely.
+func (s *State) FindPath(from, to Waypoint) ([]Waypoint, error) {
+	return s.FindPathWithin(from, to, 0)
+}
+
+// FindPathWithin is FindPath giving up with ErrPathBudget after expanding
+// maxTiles tiles; zero or less searches the whole map. Cached results cost
+// nothing.
+func (s *State) FindPathWithin(from, to Waypoint, maxTiles int) ([]Waypoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if maxTiles <= 0 {
+		maxTiles = s.mapTileWidth * s.mapTileHeight
+	}
+	path, found, ok := s.findPathLocked(from.X, from.Y, to.X, to.Y, &maxTiles)
+	switch {
+	case !ok:
+		return nil, ErrPathBudget
+	case !found:
+		return nil, ErrNoPath
+	}
+	return path, nil
+}
+
+// Reachable reports whether a player standing at one point could walk to
+// another.
+func (s *State) Reachable(from, to Waypoint) bool {
+	_, err := s.FindPath(from, to)
+	return err == nil
+}
+
+// UnreachableSpawns returns the spawn points a player at the first one could
+// not walk to, e.g. after a map edit walled some off.
+func (s *State) UnreachableSpawns() []Waypoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var unreachable []Waypoint
+	for i := 1; i < len(s.spawnPoints); i++ {
+		from, to := s.spawnPoints[0], s.spawnPoints[i]
+		budget := s.mapTileWidth * s.mapTileHeight
+		if _, found, _ := s.findPathLocked(from.X, from.Y, to.X, to.Y, &budget); !found {
+			unreachable = append(unreachable, Waypoint(to))
+		}
+	}
+	return unreachable
+}
+
+// clearPathCacheLocked forgets every search after the tiles changed. Must be
+// called with the write lock held.
+func (s *State) clearPathCacheLocked() {
+	s.pathMu.Lock()
+	defer s.pathMu.Unlock()
+	clear(s.pathCache)
+}
+
+// findPathLocked searches for a path as FindPath does, returning a copy of
+// the cached result if there is one and otherwise expanding at most *budget
+// tiles and deducting those it expands. ok is false if the budget ran out
+// first. Must be called with the lock held, for reading at least.
+func (s *State) findPathLocked(fromX, fromY, toX, toY float32, budget *int) (path []Waypoint, found, ok bool) {
+	start, goal := s.tileAt(fromX, fromY), s.tileAt(toX, toY)
+	if !s.inMapLocked(start) || !s.inMapLocked(goal) {
+		return nil, false, true
+	}
+	if start == goal {
+		return nil, true, true
+	}
+	key := pathKey{from: start, to: goal}
+	s.pathMu.Lock()
+	cached, hit := s.pathCache[key]
+	s.pathMu.Unlock()
+	if hit {
+		return slices.Clone(cached.path), cached.found, true
+	}
+	path, found, ok = s.searchLocked(start, goal, budget)
+	if !ok {
+		return nil, false, false
+	}
+	s.pathMu.Lock()
+	if s.pathCache == nil || len(s.pathCache) >= pathCacheSize {
+		s.pathCache = make(map[pathKey]pathResult)
+	}
+	s.pathCache[key] = pathResult{path: path, found: found}
+	s.pathMu.Unlock()
+	return slices.Clone(path), found, true
+}
+
+// searchLocked runs A* from start to goal over the tiles a bounding box fits
+// on, with the Manhattan distance as its heuristic. Must be called with the
+// lock held, for reading at least.
+func (s *State) searchLocked(start, goal tileCoord, budget *int) (path []Waypoint, found, ok bool) {
+	half := float32(s.tileSize) / 2
+	center := func(c tileCoord) Waypoint {
+		return Waypoint{X: float32(c.X*s.tileSize) + half, Y: float32(c.Y*s.tileSize) + half}
+	}
+	standable := func(c tileCoord) bool {
+		if c == goal {
+			return true
+		}
+		w := center(c)
+		return s.inMapLocked(c) && !s.checkMapCollision(w.X, w.Y)
+	}
+
+	cameFrom := map[tileCoord]tileCoord{}
+	cost := map[tileCoord]int{start: 0}
+	open := &pathQueue{{tile: start, priority: manhattan(start, goal)}}
+	for open.Len() > 0 {
+		if *budget <= 0 {
+			return nil, false, false
+		}
+		*budget--
+		cur := heap.Pop(open).(pathNode)
+		if cur.tile == goal {
+			var path []Waypoint
+			for c := goal; c != start; c = cameFrom[c] {
+				path = append(path, center(c))
+			}
+			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+				path[i], path[j] = path[j], path[i]
+			}
+			return path, true, true
+		}
+		if cur.priority > cost[cur.tile]+manhattan(cur.tile, goal) {
+			continue // Superseded by a cheaper entry
+		}
+		for _, d := range [4]tileCoord{{X: 0, Y: -1}, {X: 0, Y: 1}, {X: -1, Y: 0}, {X: 1, Y: 0}} {
+			next := tileCoord{X: cur.tile.X + d.X, Y: cur.tile.Y + d.Y}
+			if !standable(next) {
+				continue
+			}
+			c := cost[cur.tile] + 1
+			if old, seen := cost[next]; seen && old <= c {
+				continue
+			}
+			cost[next] = c
+			cameFrom[next] = cur.tile
+			heap.Push(open, pathNode{tile: next, priority: c + manhattan(next, goal)})
+		}
+	}
+	return nil, false, true
+}
+
+// inMapLocked reports whether a tile lies on the map. Must be called with
+// the lock held.
+func (s *State) inMapLocked(c tileCoord) bool {
+	return c.X >= 0 && c.X < s.mapTileWidth && c.Y >= 0 && c.Y < s.mapTileHeight
+}
+
+func manhattan(a, b tileCoord) int {
+	dx, dy := a.X-b.X, a.Y-b.Y
+	if dx < 0 {
+		dx = -dx
+	}
+	if dy < 0 {
+		dy = -dy
+	}
+	return dx + dy
+}
+
+type pathNode struct {
+	tile     tileCoord
+	priority int // Cost so far plus the heuristic
+}
+
+// pathQueue is a min-heap of pathNodes by priority.
+type pathQueue []pathNode
+
+func (q pathQueue) Len() int           { return len(q) }
+func (q pathQueue) Less(i, j int) bool { return q[i].priority < q[j].priority }
+func (q pathQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *pathQueue) Push(x any)        { *q = append(*q, x.(pathNode)) }
+func (q *pathQueue) Pop() any {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
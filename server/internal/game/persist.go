@@ -0,0 +1,130 @@
+package game
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// savedPlayerTTL is how long a saved position waits for its player to rejoin.
+const savedPlayerTTL = 24 * time.Hour
+
+// WorldSnapshot is the part of a State that should survive a server restart:
+// the tile grid with its runtime changes (doors, broken walls, edits), the
+// health of damaged walls and where each player was.
+type WorldSnapshot struct {
+	Width      int           `json:"width"`
+	Height     int           `json:"height"`
+	Tiles      [][]TileType  `json:"tiles"`
+	TileHealth []SavedTileHP `json:"tile_health,omitempty"`
+	Players    []SavedPlayer `json:"players,omitempty"`
+}
+
+// SavedTileHP is the remaining health of a destructible tile.
+type SavedTileHP struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Health int `json:"health"`
+}
+
+// SavedPlayer is a player's position, keyed by username since player IDs do
+// not survive a restart.
+type SavedPlayer struct {
+	Username string    `json:"username"`
+	X        float32   `json:"x"`
+	Y        float32   `json:"y"`
+	SavedAt  time.Time `json:"saved_at"`
+}
+
+// SaveWorld captures the State for persistence. Saved players who have not
+// rejoined since the last restore are kept, so a second restart before they
+// return does not lose them.
+func (s *State) SaveWorld() *WorldSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ws := &WorldSnapshot{Width: s.mapTileWidth, Height: s.mapTileHeight, Tiles: make([][]TileType, len(s.worldMap))}
+	for y, row := range s.worldMap {
+		ws.Tiles[y] = append([]TileType(nil), row...)
+	}
+	for c, hp := range s.tileHealth {
+		if hp < DestructibleWallHealth {
+			ws.TileHealth = append(ws.TileHealth, SavedTileHP{X: c.X, Y: c.Y, Health: hp})
+		}
+	}
+	sort.Slice(ws.TileHealth, func(i, j int) bool {
+		a, b := ws.TileHealth[i], ws.TileHealth[j]
+		return a.Y < b.Y || (a.Y == b.Y && a.X < b.X)
+	})
+	now := time.Now()
+	seen := make(map[string]bool)
+	for _, tp := range s.players {
+		name := strings.ToLower(tp.PlayerData.Username)
+		if !seen[name] {
+			seen[name] = true
+			ws.Players = append(ws.Players, SavedPlayer{Username: tp.PlayerData.Username, X: tp.PlayerData.XPos, Y: tp.PlayerData.YPos, SavedAt: now})
+		}
+	}
+	for name, sp := range s.returning {
+		if !seen[name] {
+			ws.Players = append(ws.Players, sp)
+		}
+	}
+	sort.Slice(ws.Players, func(i, j int) bool { return ws.Players[i].Username < ws.Players[j].Username })
+	return ws
+}
+
+// RestoreWorld applies a saved snapshot to a freshly loaded map of the same
+// size. Saved players get their position back when a player with the same
+// username joins, if it is still free.
+func (s *State) RestoreWorld(ws *WorldSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("RestoreWorld")()
+	if ws.Width != s.mapTileWidth || ws.Height != s.mapTileHeight || len(ws.Tiles) != s.mapTileHeight {
+		return fmt.Errorf("snapshot is %dx%d tiles, map is %dx%d", ws.Width, ws.Height, s.mapTileWidth, s.mapTileHeight)
+	}
+	for y, row := range ws.Tiles {
+		if len(row) != s.mapTileWidth {
+			return fmt.Errorf("snapshot row %d has %d tiles, map is %d wide", y, len(row), s.mapTileWidth)
+		}
+	}
+	for y, row := range ws.Tiles {
+		for x, t := range row {
+			s.setTileLocked(tileCoord{X: x, Y: y}, t)
+		}
+	}
+	s.tileHealth = initTileHealth(s.worldMap)
+	for _, hp := range ws.TileHealth {
+		c := tileCoord{X: hp.X, Y: hp.Y}
+		if _, ok := s.tileHealth[c]; ok && hp.Health > 0 {
+			s.tileHealth[c] = hp.Health
+		}
+	}
+	s.returning = make(map[string]SavedPlayer)
+	for _, sp := range ws.Players {
+		if time.Since(sp.SavedAt) < savedPlayerTTL {
+			s.returning[strings.ToLower(sp.Username)] = sp
+		}
+	}
+	log.Printf("World restored: %d changed tiles, %d damaged walls, %d players to return.",
+		len(s.dirtyTiles), len(ws.TileHealth), len(s.returning))
+	return nil
+}
+
+// returningPositionLocked returns a rejoining player's saved position, if
+// they have one and it is free, and forgets it. Must be called with the lock
+// held.
+func (s *State) returningPositionLocked(playerID, username string) (float32, float32, bool) {
+	name := strings.ToLower(username)
+	sp, ok := s.returning[name]
+	if !ok {
+		return 0, 0, false
+	}
+	delete(s.returning, name)
+	if !s.canOccupy(playerID, sp.X, sp.Y) {
+		return 0, 0, false
+	}
+	return sp.X, sp.Y, true
+}
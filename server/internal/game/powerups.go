@@ -0,0 +1,60 @@
+package game
+
+import (
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+const (
+	PowerUpDuration              = 10 * time.Second // How long a power-up lasts; picking it up again restarts it
+	SpeedBoostMultiplier float32 = 1.5
+)
+
+// grantPowerUpLocked starts or restarts a power-up on a player, reporting
+// false for kinds that are not power-ups. Must be called with the lock held.
+func (s *State) grantPowerUpLocked(tp *trackedPlayer, kind pb.ItemKind, now time.Time) bool {
+	until := now.Add(PowerUpDuration)
+	switch kind {
+	case pb.ItemKind_ITEM_SPEED:
+		tp.BoostUntil = until
+		tp.PlayerData.SpeedBoost = true
+	case pb.ItemKind_ITEM_GHOST:
+		tp.GhostUntil = until
+		tp.PlayerData.Ghost = true
+	case pb.ItemKind_ITEM_SHIELD:
+		tp.ShieldUntil = until
+		tp.PlayerData.Shielded = true
+	default:
+		return false
+	}
+	return true
+}
+
+// clearPowerUpsLocked ends every power-up of a player. Must be called with
+// the lock held.
+func clearPowerUpsLocked(tp *trackedPlayer) {
+	tp.BoostUntil, tp.GhostUntil, tp.ShieldUntil = time.Time{}, time.Time{}, time.Time{}
+	tp.PlayerData.SpeedBoost, tp.PlayerData.Ghost, tp.PlayerData.Shielded = false, false, false
+}
+
+// ExpirePowerUps ends the power-ups whose time is up, reporting whether any
+// player changed.
+func (s *State) ExpirePowerUps(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("ExpirePowerUps")()
+	changed := false
+	expire := func(active *bool, until time.Time) {
+		if *active && !now.Before(until) {
+			*active = false
+			changed = true
+		}
+	}
+	for _, tp := range s.players {
+		expire(&tp.PlayerData.SpeedBoost, tp.BoostUntil)
+		expire(&tp.PlayerData.Ghost, tp.GhostUntil)
+		expire(&tp.PlayerData.Shielded, tp.ShieldUntil)
+	}
+	return changed
+}
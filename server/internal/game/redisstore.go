@@ -0,0 +1,59 @@
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix namespaces the game's keys in a shared Redis database.
+const redisKeyPrefix = "simple-grpc-game:player:"
+
+// RedisStore is a Store in Redis. Records are JSON strings that Redis expires
+// a day after they were last saved, and every server pointed at the same
+// database sees the same records.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore connects to the Redis server at url, such as
+// "redis://localhost:6379/0", and checks that it answers.
+func NewRedisStore(ctx context.Context, url string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect to Redis at %s: %w", opts.Addr, err)
+	}
+	return &RedisStore{client: client}, nil
+}
+
+func (r *RedisStore) SavePlayer(ctx context.Context, rec PlayerRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, redisKeyPrefix+playerRecordKey(rec.RoomID, rec.Username), data, savedPlayerTTL).Err()
+}
+
+func (r *RedisStore) LoadPlayer(ctx context.Context, roomID, username string) (PlayerRecord, bool, error) {
+	data, err := r.client.Get(ctx, redisKeyPrefix+playerRecordKey(roomID, username)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return PlayerRecord{}, false, nil
+	}
+	if err != nil {
+		return PlayerRecord{}, false, err
+	}
+	var rec PlayerRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return PlayerRecord{}, false, fmt.Errorf("parse record: %w", err)
+	}
+	return rec, time.Since(rec.SavedAt) < savedPlayerTTL, nil
+}
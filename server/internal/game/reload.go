@@ -0,0 +1,59 @@
+package game
+
+import (
+	"log"
+	"sort"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// ReloadMap loads the map file again and swaps it in atomically. The new map
+// is fully loaded and validated first, so on error the current map stays in
+// place. Players left inside a wall or outside the new bounds are moved to a
+// spawn point; their IDs are returned. Trigger zones are kept, except the
+// objectives of the old map, which are replaced by the new map's.
+func (s *State) ReloadMap(mapPath string) (relocated []string, err error) {
+	loaded, err := loadMap(mapPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("ReloadMap")()
+	s.setMapLocked(loaded)
+
+	ids := make([]string, 0, len(s.players))
+	for id := range s.players {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		tp := s.players[id]
+		// Pads and switches refer to tiles of the old map.
+		tp.ArrivedPad, tp.OnSwitch = nil, nil
+		tp.SlideDirection = pb.PlayerInput_UNKNOWN
+		if s.relocateIfStuckLocked(id, tp, "map reload") {
+			relocated = append(relocated, id)
+		}
+		s.checkZonesLocked(id, tp)
+	}
+	log.Printf("Map '%s' reloaded: %d x %d tiles, %d spawn points, %d players relocated.",
+		mapPath, s.mapTileWidth, s.mapTileHeight, len(s.spawnPoints), len(relocated))
+	return relocated, nil
+}
+
+// relocateIfStuckLocked moves a player left inside a wall or outside the world
+// by a map change to a spawn point, reporting whether it did.
+// Must be called with the lock held.
+func (s *State) relocateIfStuckLocked(playerID string, tp *trackedPlayer, cause string) bool {
+	x, y := tp.PlayerData.XPos, tp.PlayerData.YPos
+	if s.inWorldLocked(x, y) && !s.checkMapCollision(x, y) {
+		return false
+	}
+	spawnX, spawnY := s.pickSpawnLocked(playerID)
+	s.placePlayerLocked(playerID, tp, spawnX, spawnY)
+	log.Printf("Player %s ('%s') relocated to (%.1f, %.1f) after %s",
+		playerID, tp.PlayerData.Username, spawnX, spawnY, cause)
+	return true
+}
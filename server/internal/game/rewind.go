@@ -0,0 +1,110 @@
+package game
+
+import (
+	"sort"
+	"time"
+)
+
+// Position history for lag compensation: rooms that need it record every
+// player's position each tick, so contact can be judged against where a
+// high-latency player saw the others rather than where they are now.
+
+const (
+	// positionHistoryLength is how much history is kept, whatever rewind
+	// window the server allows.
+	positionHistoryLength = time.Second
+	// TouchReach is the largest gap, in pixels, between two players' bounding
+	// boxes that still counts as a touch; players cannot overlap.
+	TouchReach float32 = 4
+)
+
+type positionSample struct {
+	at   time.Time
+	x, y float32
+}
+
+// EnablePositionHistory makes RecordPositions keep position history.
+func (s *State) EnablePositionHistory() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keepHistory = true
+}
+
+// RecordPositions adds every player's current position to their history and
+// drops samples older than positionHistoryLength. It does nothing unless
+// position history is enabled.
+func (s *State) RecordPositions(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("RecordPositions")()
+	if !s.keepHistory {
+		return
+	}
+	cutoff := now.Add(-positionHistoryLength)
+	for _, tp := range s.players {
+		i := sort.Search(len(tp.History), func(i int) bool { return !tp.History[i].at.Before(cutoff) })
+		tp.History = append(tp.History[i:], positionSample{at: now, x: tp.PlayerData.XPos, y: tp.PlayerData.YPos})
+	}
+}
+
+// positionAtLocked returns where a player was at time t: the last recorded
+// sample at or before t, the oldest sample if t predates the history, or the
+// current position if t is after the last sample. Must be called with the
+// lock held.
+func (s *State) positionAtLocked(tp *trackedPlayer, t time.Time) (float32, float32) {
+	h := tp.History
+	if len(h) == 0 || !t.Before(h[len(h)-1].at) {
+		return tp.PlayerData.XPos, tp.PlayerData.YPos
+	}
+	i := sort.Search(len(h), func(i int) bool { return h[i].at.After(t) }) - 1
+	if i < 0 {
+		i = 0
+	}
+	return h[i].x, h[i].y
+}
+
+// Touching returns the IDs, sorted, of the players whose bounding box was
+// within TouchReach of playerID's current one rewind ago. Invulnerable,
+// shielded or dead players and teammates cannot be touched.
+func (s *State) Touching(playerID string, rewind time.Duration) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	self, ok := s.players[playerID]
+	if !ok {
+		return nil
+	}
+	at := time.Now().Add(-rewind)
+	x, y := self.PlayerData.XPos, self.PlayerData.YPos
+	reachX, reachY := 2*s.tuning.HalfWidth+TouchReach, 2*s.tuning.HalfHeight+TouchReach
+	var touched []string
+	for id, tp := range s.players {
+		if id == playerID || tp.PlayerData.Invulnerable || tp.PlayerData.Shielded || !tp.DeadUntil.IsZero() || teammates(self, tp) {
+			continue
+		}
+		ox, oy := s.positionAtLocked(tp, at)
+		ox, oy = s.nearestLocked(x, y, ox, oy)
+		if abs32(ox-x) <= reachX && abs32(oy-y) <= reachY {
+			touched = append(touched, id)
+		}
+	}
+	sort.Strings(touched)
+	return touched
+}
+
+// MarkIt flags playerID as "it" in the next delta and clears the flag of
+// everyone else; an empty ID clears it for all.
+func (s *State) MarkIt(playerID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("MarkIt")()
+	for id, tp := range s.players {
+		tp.PlayerData.It = id == playerID
+	}
+}
+
+func abs32(v float32) float32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,58 @@
+package game
+
+import "time"
+
+// rttWeight is how much a new round trip moves a player's smoothed RTT, the
+// same 1/8 TCP uses, so one slow pong does not make a connection look bad.
+const rttWeight = 0.125
+
+// PublishRTT sets whether players' smoothed RTTs are copied into their
+// Player.rtt_ms for every client to see; otherwise they are only kept for
+// the server's own use.
+func (s *State) PublishRTT(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("PublishRTT")()
+	s.publishRTT = on
+	for _, tp := range s.players {
+		tp.PlayerData.RttMs = 0
+		if on {
+			tp.PlayerData.RttMs = int32(tp.RTT.Milliseconds())
+		}
+	}
+}
+
+// RecordRTT folds a measured round trip into the player's smoothed RTT and
+// returns it; the first measurement is taken as is. changed reports whether
+// the player's published rtt_ms changed, so a delta is due. The error is
+// ErrPlayerNotFound if the player is not in the state.
+func (s *State) RecordRTT(playerID string, rtt time.Duration) (smoothed time.Duration, changed bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("RecordRTT")()
+	tp, ok := s.players[playerID]
+	if !ok {
+		return 0, false, ErrPlayerNotFound
+	}
+	if tp.RTT == 0 {
+		tp.RTT = rtt
+	} else {
+		tp.RTT += time.Duration(rttWeight * float64(rtt-tp.RTT))
+	}
+	if ms := int32(tp.RTT.Milliseconds()); s.publishRTT && tp.PlayerData.RttMs != ms {
+		tp.PlayerData.RttMs = ms
+		changed = true
+	}
+	return tp.RTT, changed, nil
+}
+
+// PlayerRTT returns the player's smoothed round trip, or zero if none has
+// been measured.
+func (s *State) PlayerRTT(playerID string) time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if tp, ok := s.players[playerID]; ok {
+		return tp.RTT
+	}
+	return 0
+}
@@ -0,0 +1,113 @@
+package game
+
+import (
+	"sort"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// Reasons points are awarded, as logged in EventScored.
+const (
+	ScorePickup    = "pickup"
+	ScoreTag       = "tag"
+	ScoreObjective = "objective"
+	ScoreKill      = "kill"
+)
+
+// AwardPoints adds points to a player's score, if they are still in the
+// State. Game modes call it for their own reasons; pickups and objective
+// zones are scored by the State itself.
+func (s *State) AwardPoints(playerID string, points int64, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("AwardPoints")()
+	if tp, ok := s.players[playerID]; ok {
+		s.awardLocked(playerID, tp, points, reason)
+	}
+}
+
+// awardLocked adds points to a player's score. Must be called with the lock
+// held.
+func (s *State) awardLocked(playerID string, tp *trackedPlayer, points int64, reason string) {
+	if points == 0 {
+		return
+	}
+	tp.Score += points
+	s.scoresChanged = true
+	s.emitLocked(EventScored, playerID, map[string]any{"points": points, "reason": reason, "score": tp.Score})
+}
+
+// collectLocked picks up the tile under a player's center if it is worth
+// points, turning it into floor. Must be called with the lock held.
+func (s *State) collectLocked(playerID string, tp *trackedPlayer) {
+	c := s.tileAt(tp.PlayerData.XPos, tp.PlayerData.YPos)
+	if c.X < 0 || c.X >= s.mapTileWidth || c.Y < 0 || c.Y >= s.mapTileHeight {
+		return
+	}
+	points := s.propertiesOf(s.worldMap[c.Y][c.X]).Points
+	if points <= 0 {
+		return
+	}
+	s.setTileLocked(c, TileTypeEmpty)
+	s.awardLocked(playerID, tp, int64(points), ScorePickup)
+}
+
+// scoreObjectiveLocked awards an objective zone's points the first time a
+// player enters it. Must be called with the lock held.
+func (s *State) scoreObjectiveLocked(playerID string, tp *trackedPlayer, z Zone) {
+	if z.Points == 0 || tp.Objectives[z.ID] {
+		return
+	}
+	if tp.Objectives == nil {
+		tp.Objectives = make(map[string]bool)
+	}
+	tp.Objectives[z.ID] = true
+	s.awardLocked(playerID, tp, z.Points, ScoreObjective)
+}
+
+// Scoreboard returns every player's score, highest first, ties by username,
+// and in rooms with teams the total of each team.
+func (s *State) Scoreboard() *pb.Scoreboard {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.scoreboardLocked()
+}
+
+// TakeScoreboard returns the scoreboard if it changed since the previous
+// call, reporting whether it did.
+func (s *State) TakeScoreboard() (*pb.Scoreboard, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.scoresChanged {
+		return nil, false
+	}
+	s.scoresChanged = false
+	return s.scoreboardLocked(), true
+}
+
+func (s *State) scoreboardLocked() *pb.Scoreboard {
+	board := &pb.Scoreboard{Entries: make([]*pb.ScoreEntry, 0, len(s.players))}
+	for id, tp := range s.players {
+		board.Entries = append(board.Entries, &pb.ScoreEntry{PlayerId: id, Username: tp.PlayerData.Username, Score: tp.Score, Team: tp.PlayerData.Team})
+	}
+	for t := 1; t <= s.teams; t++ {
+		board.Teams = append(board.Teams, &pb.TeamScore{Team: int32(t)})
+	}
+	for _, e := range board.Entries {
+		if e.Team > 0 && int(e.Team) <= s.teams {
+			board.Teams[e.Team-1].Score += e.Score
+			board.Teams[e.Team-1].Players++
+		}
+	}
+	sort.Slice(board.Entries, func(i, j int) bool {
+		a, b := board.Entries[i], board.Entries[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Username != b.Username {
+			return a.Username < b.Username
+		}
+		return a.PlayerId < b.PlayerId
+	})
+	return board
+}
@@ -0,0 +1,65 @@
+package game
+
+import "slices"
+
+// skinOrder lists the skins players may choose, in the order players who
+// choose none are given them.
+var skinOrder = []string{"yellow", "cyan", "magenta", "green", "orange", "white", "red", "blue"}
+
+// skinColors maps each skin to the 0xRRGGBB tint clients draw it with.
+var skinColors = map[string]uint32{
+	"yellow":  0xFFFF00,
+	"cyan":    0x00FFFF,
+	"magenta": 0xFF00FF,
+	"green":   0x00FF00,
+	"orange":  0xFFA500,
+	"white":   0xFFFFFF,
+	"red":     0xE63C3C,
+	"blue":    0x3C6EE6,
+}
+
+// Skins returns the IDs of the skins players may choose.
+func Skins() []string {
+	return slices.Clone(skinOrder)
+}
+
+// ValidSkin reports whether a skin ID is one players may choose.
+func ValidSkin(skin string) bool {
+	_, ok := skinColors[skin]
+	return ok
+}
+
+// SetSkin changes a player's skin. Errors are ErrPlayerNotFound and
+// ErrInvalidSkin.
+func (s *State) SetSkin(playerID, skin string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("SetSkin")()
+	tp, ok := s.players[playerID]
+	if !ok {
+		return ErrPlayerNotFound
+	}
+	color, valid := skinColors[skin]
+	if !valid {
+		return ErrInvalidSkin
+	}
+	tp.PlayerData.Skin, tp.PlayerData.Color = skin, color
+	return nil
+}
+
+// leastUsedSkinLocked returns the skin the fewest players wear, the earliest
+// in skinOrder on ties, so players who choose none still look different.
+// Must be called with the lock held.
+func (s *State) leastUsedSkinLocked() string {
+	worn := make(map[string]int, len(skinOrder))
+	for _, tp := range s.players {
+		worn[tp.PlayerData.Skin]++
+	}
+	best := skinOrder[0]
+	for _, skin := range skinOrder[1:] {
+		if worn[skin] < worn[best] {
+			best = skin
+		}
+	}
+	return best
+}
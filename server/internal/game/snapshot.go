@@ -0,0 +1,51 @@
+package game
+
+import (
+	"sync"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// PlayerSnapshot is a pooled, reusable buffer of player copies for hot paths
+// that read every player each tick. Players in it are only valid until
+// Release.
+type PlayerSnapshot struct {
+	Players []*pb.Player
+}
+
+var playerSnapshotPool = sync.Pool{New: func() any { return &PlayerSnapshot{} }}
+
+// AcquirePlayerSnapshot takes a snapshot of the state's players, reusing a
+// pooled buffer.
+func (s *State) AcquirePlayerSnapshot() *PlayerSnapshot {
+	ps := playerSnapshotPool.Get().(*PlayerSnapshot)
+	ps.Players = s.AppendPlayers(ps.Players[:0])
+	return ps
+}
+
+// Release returns the snapshot to the pool. It must not be used afterwards.
+func (ps *PlayerSnapshot) Release() {
+	playerSnapshotPool.Put(ps)
+}
+
+// playerPool holds the player copies of released deltas, for the next ones.
+var playerPool = sync.Pool{New: func() any { return &pb.Player{} }}
+
+// acquirePlayer returns an empty player, reusing a released one if it can.
+func acquirePlayer() *pb.Player {
+	return playerPool.Get().(*pb.Player)
+}
+
+// ReleaseDelta returns the updated players of deltas from GenerateDeltaUpdate
+// or GeneratePartialDeltaUpdate to a pool the next deltas take copies from, so
+// a room broadcasting every tick stops allocating them. Neither the deltas'
+// players nor anything still holding them may be used afterwards.
+func ReleaseDelta(deltas ...*pb.DeltaUpdate) {
+	for _, delta := range deltas {
+		for _, p := range delta.GetUpdatedPlayers() {
+			p.Reset()
+			playerPool.Put(p)
+		}
+		delta.UpdatedPlayers = nil
+	}
+}
@@ -0,0 +1,60 @@
+package game
+
+import (
+	"fmt"
+	"testing"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+const benchPlayers = 32
+
+// benchState returns a State with benchPlayers players.
+func benchState(b *testing.B) *State {
+	b.Helper()
+	s := testState(b)
+	for i := range benchPlayers {
+		id := fmt.Sprintf("player_%d", i)
+		s.AddPlayer(id, id)
+	}
+	return s
+}
+
+// moveAll nudges every player so the next delta carries all of them.
+func moveAll(s *State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tp := range s.players {
+		tp.PlayerData.XPos++
+	}
+}
+
+func BenchmarkGenerateDeltaUpdate(b *testing.B) {
+	s := benchState(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		moveAll(s)
+		delta, _ := s.GenerateDeltaUpdate()
+		ReleaseDelta(delta)
+	}
+}
+
+func BenchmarkAppendPlayers(b *testing.B) {
+	s := benchState(b)
+	var buf []*pb.Player
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		buf = s.AppendPlayers(buf[:0])
+	}
+}
+
+func BenchmarkAcquirePlayerSnapshot(b *testing.B) {
+	s := benchState(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		s.AcquirePlayerSnapshot().Release()
+	}
+}
@@ -8,11 +8,15 @@ import (
 	"image/color"
 	_ "image/png" // Import for PNG decoding (register decoder)
 	"log"         // Go 1.21+ needed for maps.Clone
+	"math"
 	"os"
+	"path/filepath"
 
 	// "strconv" // No longer needed for map loading
-	// "strings" // No longer needed for map loading
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	pb "simple-grpc-game/gen/go/game" // Adjust import path if needed
@@ -25,16 +29,27 @@ const (
 	PlayerHalfWidth  float32 = 64.0
 	PlayerHalfHeight float32 = 64.0
 	PlayerMoveSpeed  float32 = 16.0
-	DefaultTileSize  int     = 32
 	MapFilePath      string  = "map.png" // Default map file name
 	movementTimeout          = 200 * time.Millisecond
+
+	RespawnInvulnerability = 2 * time.Second // Grace window after a respawn
+	RespawnCooldown        = 3 * time.Second // Minimum time between respawn requests
 )
 
 type TileType int32
 
 const (
-	TileTypeEmpty TileType = 0
-	TileTypeWall  TileType = 1
+	TileTypeEmpty            TileType = 0
+	TileTypeWall             TileType = 1
+	TileTypeSpawn            TileType = 2 // Walkable tile where players may spawn
+	TileTypeTeleporter       TileType = 3 // Walkable pad linked to another pad
+	TileTypeMud              TileType = 4 // Slows players down
+	TileTypeIce              TileType = 5 // Speeds players up and keeps them sliding
+	TileTypeDoorClosed       TileType = 6 // Blocks movement until opened
+	TileTypeDoorOpen         TileType = 7
+	TileTypeSwitch           TileType = 8  // Toggles the doors of its group when stepped on
+	TileTypeDestructibleWall TileType = 9  // Wall that breaks after enough hits
+	TileTypeCoin             TileType = 10 // Pickup worth points; becomes floor once collected
 )
 
 func (t TileType) String() string { /* ... (no change) ... */
@@ -43,15 +58,57 @@ func (t TileType) String() string { /* ... (no change) ... */
 		return "Empty"
 	case TileTypeWall:
 		return "Wall"
+	case TileTypeSpawn:
+		return "Spawn"
+	case TileTypeTeleporter:
+		return "Teleporter"
+	case TileTypeMud:
+		return "Mud"
+	case TileTypeIce:
+		return "Ice"
+	case TileTypeDoorClosed:
+		return "DoorClosed"
+	case TileTypeDoorOpen:
+		return "DoorOpen"
+	case TileTypeSwitch:
+		return "Switch"
+	case TileTypeDestructibleWall:
+		return "DestructibleWall"
+	case TileTypeCoin:
+		return "Coin"
 	default:
 		return fmt.Sprintf("Unknown(%d)", t)
 	}
 }
 
 type trackedPlayer struct {
-	PlayerData    *pb.Player
-	LastInputTime time.Time
-	LastDirection pb.PlayerInput_Direction
+	PlayerData        *pb.Player
+	LastInputTime     time.Time
+	LastDirection     pb.PlayerInput_Direction
+	LastRespawn       time.Time
+	InvulnerableUntil time.Time
+	TeleportReadyAt   time.Time                // Teleporters are ignored until this time
+	ArrivedPad        *tileCoord               // Pad the player arrived on; ignored until they step off
+	SlideDirection    pb.PlayerInput_Direction // Direction of travel while on slippery ground
+	OnSwitch          *tileCoord               // Switch the player is standing on, if any
+	LastBump          time.Time                // Last time the player damaged a wall by bumping it
+	InZones           map[string]bool          // Trigger zones the player is inside
+	History           []positionSample         // Recent positions, oldest first, if the state keeps history
+	Blocked           bool                     // The last move was blocked; later blocked moves log no event
+	Visited           map[tileCoord]struct{}   // Tiles stood on since joining
+	Score             int64                    // Points awarded by the room's game mode
+	Objectives        map[string]bool          // Objective zones the player has scored
+	DeadUntil         time.Time                // Zero while alive; the player respawns after it
+	LastHazard        time.Time                // When hazard damage was last applied
+	HazardCarry       float32                  // Hazard damage not yet applied, under one hit point
+	LastAttack        time.Time
+	Facing            pb.PlayerInput_Direction // Last direction moved in; attacks go this way
+	BoostUntil        time.Time                // Power-up timers; see PlayerData.SpeedBoost, Ghost and Shielded
+	GhostUntil        time.Time
+	ShieldUntil       time.Time
+	LastEmote         time.Time
+	EmoteUntil        time.Time     // Zero unless emoting; moving ends the emote early
+	RTT               time.Duration // Smoothed round trip from pings; zero until measured
 }
 
 type State struct { // ... (no change) ...
@@ -66,18 +123,110 @@ type State struct { // ... (no change) ...
 	worldMinY            float32
 	worldMaxY            float32
 	lastBroadcastPlayers map[string]*pb.Player
+	teleported           map[string]struct{} // Players moved discontinuously since the last delta
+	spawnPoints          []spawnPoint
+	nextSpawn            int                       // Round-robin cursor into spawnPoints
+	teleportLinks        map[tileCoord]tileCoord   // Pad -> destination pad
+	doorGroups           map[uint8][]tileCoord     // Group ID -> door tiles
+	switchGroups         map[tileCoord]uint8       // Switch tile -> door group it toggles
+	dirtyTiles           map[tileCoord]struct{}    // Tiles changed since the last TakeTileUpdates
+	tileHealth           map[tileCoord]int         // Remaining hits of destructible tiles
+	layers               []mapLayer                // Visual layers
+	tileProps            map[TileType]TileProperty // Tile definitions
+	zones                map[string]Zone           // Trigger zones by ID
+	zoneEvents           []ZoneEvent               // Queued until TakeZoneEvents
+	mapObjectives        []string                  // IDs of the zones the current map defines
+	mapName, mapAuthor   string                    // Map metadata, if the format has any
+	edges                EdgePolicy                // What happens at the edges of the map
+	falls                []Fall                    // Queued until TakeFalls
+	deaths               []Death                   // Queued until TakeDeaths
+	items                map[string]*placedItem    // Items on the map by ID
+	nextItemID           int
+	itemRespawns         []itemRespawn          // Picked up map items waiting to come back
+	spawnedItems         []*pb.Item             // Items added since the last delta
+	removedItems         []string               // Items removed since the last delta
+	npcs                 map[string]*trackedNPC // Non-player characters by ID
+	nextNPCID            int
+	lastBroadcastNPCs    map[string]*pb.NPC
+	aiBudget             int // Pathfinding tiles NPCs may expand per tick; see SetAIBudget
+	pathMu               sync.Mutex
+	pathCache            map[pathKey]pathResult // Finished searches, until the tiles change; guarded by pathMu
+	keepHistory          bool                   // Record position history for lag compensation
+	events               EventSink              // Structured event log; nil disables it
+	returning            map[string]SavedPlayer // Restored positions by lowercase username, until the player rejoins
+	scoresChanged        bool                   // The scoreboard changed since the last TakeScoreboard
+	teams                int                    // Number of teams; 0 if players play alone
+	publishRTT           bool                   // Copy smoothed RTTs into Player.rtt_ms
+	tuning               Tuning                 // Movement and hitbox constants; see SetTuning
+
+	// Audit mode (see EnableAudit)
+	audit           bool
+	sealed          map[string]playerFingerprint
+	auditViolations atomic.Int64
+}
+
+// mapData is the result of loading a map file.
+type mapData struct {
+	tiles        [][]TileType
+	width        int
+	height       int
+	tileSize     int // Pixel size of a tile
+	layers       []mapLayer
+	name, author string
+	edges        EdgePolicy
+	tileProps    map[TileType]TileProperty // Overrides of the default tile properties
+	teleportPads map[uint8][]tileCoord     // Pair ID -> pads sharing it
+	doorGroups   map[uint8][]tileCoord     // Group ID -> door tiles
+	switchGroups map[tileCoord]uint8       // Switch tile -> door group
+	objectives   []Zone                    // Objective zones defined by the map
+	items        []mapItem                 // Items placed by the map
+	npcs         []mapNPC                  // NPCs placed by the map
+}
+
+// spawnPoint is the pixel-space center of a spawn tile.
+type spawnPoint struct {
+	X, Y float32
+}
+
+// pngTileSize is the tile size of PNG maps, which carry no metadata.
+const pngTileSize = 32
+
+// loadMap loads and validates a map file, choosing the format by extension:
+// JSON (.json), Tiled exports (.tmx, .tmj) or a PNG plus optional visual layer
+// PNGs.
+func loadMap(filePath string) (*mapData, error) {
+	var loaded *mapData
+	var err error
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".json":
+		loaded, err = loadJSONMap(filePath)
+	case ".tmx", ".tmj":
+		loaded, err = loadTiledMap(filePath)
+	default:
+		loaded, err = loadMapFromPNG(filePath)
+		if err == nil {
+			loaded.layers, err = loadMapLayers(filePath, loaded.width, loaded.height)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := validateMap(filePath, loaded); err != nil {
+		return nil, err
+	}
+	return loaded, nil
 }
 
-func loadMapFromPNG(filePath string) ([][]TileType, int, int, error) {
+func loadMapFromPNG(filePath string) (*mapData, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return nil, 0, 0, fmt.Errorf("failed to open map file '%s': %w", filePath, err)
+		return nil, &MapError{Path: filePath, Reason: "failed to open", Err: err}
 	}
 	defer file.Close()
 
 	img, format, err := image.Decode(file)
 	if err != nil {
-		return nil, 0, 0, fmt.Errorf("failed to decode image file '%s': %w", filePath, err)
+		return nil, &MapError{Path: filePath, Reason: "failed to decode image", Err: err}
 	}
 	if format != "png" {
 		log.Printf("Warning: Map file '%s' is format '%s', not png.", filePath, format)
@@ -89,10 +238,13 @@ func loadMapFromPNG(filePath string) ([][]TileType, int, int, error) {
 	height := bounds.Dy() // Height in pixels = height in tiles
 
 	if width <= 0 || height <= 0 {
-		return nil, 0, 0, fmt.Errorf("map image '%s' has invalid dimensions (%dx%d)", filePath, width, height)
+		return nil, &MapError{Path: filePath, Reason: fmt.Sprintf("invalid dimensions (%dx%d)", width, height)}
 	}
 
 	tileMap := make([][]TileType, height)
+	teleportPads := make(map[uint8][]tileCoord)
+	doorGroups := make(map[uint8][]tileCoord)
+	switchGroups := make(map[tileCoord]uint8)
 	for y := 0; y < height; y++ {
 		tileMap[y] = make([]TileType, width)
 		for x := 0; x < width; x++ {
@@ -107,6 +259,23 @@ func loadMapFromPNG(filePath string) ([][]TileType, int, int, error) {
 				tileMap[y][x] = TileTypeWall
 			} else if rgbaColor.R == 255 && rgbaColor.G == 255 && rgbaColor.B == 255 { // White = Empty
 				tileMap[y][x] = TileTypeEmpty
+			} else if rgbaColor.R == 0 && rgbaColor.G == 255 && rgbaColor.B == 0 { // Green = Spawn
+				tileMap[y][x] = TileTypeSpawn
+			} else if rgbaColor.R == 255 && rgbaColor.G == 0 && rgbaColor.B > 0 && rgbaColor.B < 255 { // Red + blue channel = Teleporter, B is the pair ID
+				tileMap[y][x] = TileTypeTeleporter
+				teleportPads[rgbaColor.B] = append(teleportPads[rgbaColor.B], tileCoord{X: x, Y: y})
+			} else if rgbaColor.R == 0 && rgbaColor.G == 0 && rgbaColor.B > 0 && rgbaColor.B < 255 { // Blue channel only = closed Door, B is the group ID
+				tileMap[y][x] = TileTypeDoorClosed
+				doorGroups[rgbaColor.B] = append(doorGroups[rgbaColor.B], tileCoord{X: x, Y: y})
+			} else if rgbaColor.R == 255 && rgbaColor.G == 255 && rgbaColor.B > 0 && rgbaColor.B < 255 { // Yellow = Switch, B is the door group ID
+				tileMap[y][x] = TileTypeSwitch
+				switchGroups[tileCoord{X: x, Y: y}] = rgbaColor.B
+			} else if rgbaColor.R == 128 && rgbaColor.G == 128 && rgbaColor.B == 128 { // Grey = Destructible wall
+				tileMap[y][x] = TileTypeDestructibleWall
+			} else if rgbaColor.R == 139 && rgbaColor.G == 69 && rgbaColor.B == 19 { // Brown = Mud
+				tileMap[y][x] = TileTypeMud
+			} else if rgbaColor.R == 173 && rgbaColor.G == 216 && rgbaColor.B == 230 { // Light blue = Ice
+				tileMap[y][x] = TileTypeIce
 				// } else if rgbaColor.R == 255 && rgbaColor.G == 0 && rgbaColor.B == 0 { // Example: Red = Lava (future)
 				//     tileMap[y][x] = TileTypeLava
 			} else {
@@ -118,59 +287,243 @@ func loadMapFromPNG(filePath string) ([][]TileType, int, int, error) {
 	}
 
 	log.Printf("Loaded map from PNG '%s', dimensions: %d x %d tiles.", filePath, width, height)
-	return tileMap, width, height, nil
+	return &mapData{tiles: tileMap, width: width, height: height, tileSize: pngTileSize, teleportPads: teleportPads, doorGroups: doorGroups, switchGroups: switchGroups}, nil
 }
 
-// NewState creates and initializes a new game state manager.
+// NewState creates and initializes a new game state manager using the default map.
 func NewState() (*State, error) {
-	// Load map from PNG
-	loadedMap, width, height, err := loadMapFromPNG(MapFilePath)
+	return NewStateFromFile(MapFilePath)
+}
+
+// NewStateFromFile creates and initializes a game state manager for the given map file.
+func NewStateFromFile(mapPath string) (*State, error) {
+	loaded, err := loadMap(mapPath)
 	if err != nil {
-		// Return error instead of Fatalf
-		return nil, fmt.Errorf("error loading map PNG: %w", err)
+		return nil, err
 	}
 
-	// Calculate world boundaries based on loaded map and tile size
-	tileSize := DefaultTileSize
-	worldPixelWidth := float32(width * tileSize)
-	worldPixelHeight := float32(height * tileSize)
-
 	newState := &State{
 		players:              make(map[string]*trackedPlayer),
-		worldMap:             loadedMap,
-		mapTileWidth:         width,
-		mapTileHeight:        height,
-		tileSize:             tileSize,
-		worldMinX:            0.0,
-		worldMaxX:            worldPixelWidth,
-		worldMinY:            0.0,
-		worldMaxY:            worldPixelHeight,
 		lastBroadcastPlayers: make(map[string]*pb.Player),
+		teleported:           make(map[string]struct{}),
+		tuning:               DefaultTuning(),
 	}
+	newState.setMapLocked(loaded)
 
-	log.Printf("Game state initialized. World boundaries: X(%.1f, %.1f), Y(%.1f, %.1f)",
-		newState.worldMinX, newState.worldMaxX, newState.worldMinY, newState.worldMaxY)
+	log.Printf("Game state initialized. World boundaries: X(%.1f, %.1f), Y(%.1f, %.1f), %d spawn points",
+		newState.worldMinX, newState.worldMaxX, newState.worldMinY, newState.worldMaxY, len(newState.spawnPoints))
 
 	return newState, nil
 }
 
+// setMapLocked installs a loaded map, resetting all map-derived state.
+// Must be called with the lock held (or before the State is shared).
+func (s *State) setMapLocked(loaded *mapData) {
+	s.worldMap = loaded.tiles
+	s.clearPathCacheLocked()
+	s.mapTileWidth, s.mapTileHeight = loaded.width, loaded.height
+	s.tileSize = loaded.tileSize
+
+	// Calculate world boundaries based on loaded map and tile size
+	s.worldMinX, s.worldMaxX = 0.0, float32(loaded.width*loaded.tileSize)
+	s.worldMinY, s.worldMaxY = 0.0, float32(loaded.height*loaded.tileSize)
+
+	s.spawnPoints = findSpawnPoints(loaded.tiles, loaded.tileSize)
+	s.nextSpawn = 0
+	s.teleportLinks = linkTeleportPads(loaded.teleportPads)
+	s.doorGroups = loaded.doorGroups
+	s.switchGroups = loaded.switchGroups
+	s.dirtyTiles = make(map[tileCoord]struct{})
+	s.tileHealth = initTileHealth(loaded.tiles)
+	s.layers = loaded.layers
+	s.tileProps = mergeTileProperties(loaded.tileProps)
+	s.mapName, s.mapAuthor = loaded.name, loaded.author
+	s.edges = loaded.edges
+	for _, id := range s.mapObjectives {
+		delete(s.zones, id)
+	}
+	s.mapObjectives = nil
+	s.resetItemsLocked(loaded.items)
+	s.resetNPCsLocked(loaded.npcs)
+	for _, z := range loaded.objectives {
+		if s.zones == nil {
+			s.zones = make(map[string]Zone)
+		}
+		s.zones[z.ID] = z
+		s.mapObjectives = append(s.mapObjectives, z.ID)
+	}
+}
+
+// findSpawnPoints collects the centers of all spawn tiles in row-major order.
+func findSpawnPoints(tileMap [][]TileType, tileSize int) []spawnPoint {
+	points := []spawnPoint{}
+	for y, row := range tileMap {
+		for x, tile := range row {
+			if tile == TileTypeSpawn {
+				points = append(points, spawnPoint{
+					X: float32(x*tileSize) + float32(tileSize)/2,
+					Y: float32(y*tileSize) + float32(tileSize)/2,
+				})
+			}
+		}
+	}
+	return points
+}
+
+// --- Spawning ---
+
+// canOccupy reports whether a player could stand at the given position.
+// Must be called with the lock held.
+func (s *State) canOccupy(playerID string, x, y float32) bool {
+	if !s.inWorldLocked(x, y) {
+		return false
+	}
+	return !s.checkMapCollision(x, y) && !s.checkPlayerCollision(playerID, x, y)
+}
+
+// pickSpawnLocked selects the next unoccupied spawn point round-robin. If the
+// map has no free spawn tile it falls back to the first free walkable tile.
+// Must be called with the lock held.
+func (s *State) pickSpawnLocked(playerID string) (float32, float32) {
+	for i := 0; i < len(s.spawnPoints); i++ {
+		idx := (s.nextSpawn + i) % len(s.spawnPoints)
+		sp := s.spawnPoints[idx]
+		if s.canOccupy(playerID, sp.X, sp.Y) {
+			s.nextSpawn = idx + 1
+			return sp.X, sp.Y
+		}
+	}
+	half := float32(s.tileSize) / 2
+	for ty := 0; ty < s.mapTileHeight; ty++ {
+		for tx := 0; tx < s.mapTileWidth; tx++ {
+			x := float32(tx*s.tileSize) + half
+			y := float32(ty*s.tileSize) + half
+			if s.canOccupy(playerID, x, y) {
+				return x, y
+			}
+		}
+	}
+	log.Printf("Warning: No free spawn location for %s, spawning at world origin.", playerID)
+	return s.worldMinX + s.tuning.HalfWidth, s.worldMinY + s.tuning.HalfHeight
+}
+
 // --- Player Management ---
-func (s *State) AddPlayer(playerID string, username string, startX, startY float32) *pb.Player { /* ... (no change) ... */
+
+// AddPlayer adds a player at a free spawn point. Their display name is the
+// username as cleaned by CleanDisplayName, numbered if another player of the
+// State shows that name already. They wear the skin fewest players wear
+// until SetSkin changes it.
+func (s *State) AddPlayer(playerID string, username string) *pb.Player {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	startX = clamp(startX, s.worldMinX+PlayerHalfWidth, s.worldMaxX-PlayerHalfWidth)
-	startY = clamp(startY, s.worldMinY+PlayerHalfHeight, s.worldMaxY-PlayerHalfHeight)
-	playerData := &pb.Player{Id: playerID, Username: username, XPos: startX, YPos: startY, CurrentAnimationState: pb.AnimationState_IDLE}
+	defer s.auditLocked("AddPlayer")()
+	startX, startY, returning := s.returningPositionLocked(playerID, username)
+	if !returning {
+		startX, startY = s.pickSpawnLocked(playerID)
+	}
+	playerData := &pb.Player{Id: playerID, Username: username, XPos: startX, YPos: startY, CurrentAnimationState: pb.AnimationState_IDLE, Health: MaxHealth, MaxHealth: MaxHealth}
+	playerData.DisplayName = s.uniqueDisplayNameLocked(playerID, CleanDisplayName(username))
+	playerData.Skin = s.leastUsedSkinLocked()
+	playerData.Color = skinColors[playerData.Skin]
 	tracked := &trackedPlayer{PlayerData: playerData, LastInputTime: time.Now(), LastDirection: pb.PlayerInput_UNKNOWN}
+	s.assignTeamLocked(tracked)
 	s.players[playerID] = tracked
+	s.visitLocked(tracked)
+	s.scoresChanged = true
+	s.emitLocked(EventPlayerJoined, playerID, map[string]any{"username": username, "x": startX, "y": startY, "returning": returning})
 	log.Printf("Player %s ('%s') added at (%.1f, %.1f)", playerID, username, startX, startY)
 	return playerData
 }
+
+// RespawnPlayer moves a player to a free spawn point and grants a brief
+// invulnerability window, during which the player does not collide with others.
+// It returns the updated player and the end of the window, or
+// ErrPlayerNotFound / ErrRespawnCooldown.
+func (s *State) RespawnPlayer(playerID string) (player *pb.Player, invulnerableUntil time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("RespawnPlayer")()
+	tp, exists := s.players[playerID]
+	if !exists {
+		return nil, time.Time{}, ErrPlayerNotFound
+	}
+	if !tp.DeadUntil.IsZero() {
+		return nil, time.Time{}, ErrPlayerDead // Respawned by RespawnDead when the delay ends
+	}
+	now := time.Now()
+	if now.Sub(tp.LastRespawn) < RespawnCooldown {
+		return nil, time.Time{}, ErrRespawnCooldown
+	}
+	x, y := s.pickSpawnLocked(playerID)
+	s.placePlayerLocked(playerID, tp, x, y)
+	tp.PlayerData.CurrentAnimationState = pb.AnimationState_IDLE
+	tp.PlayerData.Invulnerable = true
+	tp.LastDirection = pb.PlayerInput_UNKNOWN
+	tp.LastRespawn = now
+	tp.InvulnerableUntil = now.Add(RespawnInvulnerability)
+	s.checkZonesLocked(playerID, tp)
+	s.emitLocked(EventRespawned, playerID, map[string]any{"cause": "request", "x": x, "y": y})
+	log.Printf("Player %s respawned at (%.1f, %.1f)", playerID, x, y)
+	return proto.Clone(tp.PlayerData).(*pb.Player), tp.InvulnerableUntil, nil
+}
+
+// TeleportPlayer moves a player straight to (x, y), for operators. The point
+// must be inside the world and free of walls and other players, or the error
+// is ErrPositionBlocked; ErrPlayerNotFound if there is no such player.
+func (s *State) TeleportPlayer(playerID string, x, y float32) (*pb.Player, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("TeleportPlayer")()
+	tp, exists := s.players[playerID]
+	if !exists {
+		return nil, ErrPlayerNotFound
+	}
+	if !s.inWorldLocked(x, y) || s.checkMapCollision(x, y) || s.checkPlayerCollision(playerID, x, y) {
+		return nil, ErrPositionBlocked
+	}
+	s.placePlayerLocked(playerID, tp, x, y)
+	tp.PlayerData.CurrentAnimationState = pb.AnimationState_IDLE
+	tp.LastDirection = pb.PlayerInput_UNKNOWN
+	s.checkZonesLocked(playerID, tp)
+	log.Printf("Player %s ('%s') teleported to (%.1f, %.1f)", playerID, tp.PlayerData.Username, x, y)
+	return proto.Clone(tp.PlayerData).(*pb.Player), nil
+}
+
+// placePlayerLocked moves a player discontinuously, flagging the move in the
+// next delta so clients snap instead of interpolating across the map. Every
+// jump (teleporter, respawn, relocation) must go through here.
+// Must be called with the lock held.
+func (s *State) placePlayerLocked(playerID string, tp *trackedPlayer, x, y float32) {
+	tp.PlayerData.XPos, tp.PlayerData.YPos = x, y
+	s.teleported[playerID] = struct{}{}
+	s.visitLocked(tp)
+}
+
+// ExpireInvulnerability clears invulnerability windows that have ended,
+// reporting whether any player changed.
+func (s *State) ExpireInvulnerability(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("ExpireInvulnerability")()
+	changed := false
+	for _, tp := range s.players {
+		if tp.PlayerData.Invulnerable && now.After(tp.InvulnerableUntil) {
+			tp.PlayerData.Invulnerable = false
+			changed = true
+		}
+	}
+	return changed
+}
+
 func (s *State) RemovePlayer(playerID string) { /* ... (no change) ... */
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, exists := s.players[playerID]; exists {
+	defer s.auditLocked("RemovePlayer")()
+	if tp, exists := s.players[playerID]; exists {
 		delete(s.players, playerID)
+		delete(s.teleported, playerID)
+		s.scoresChanged = true
+		s.emitLocked(EventPlayerLeft, playerID, map[string]any{"username": tp.PlayerData.Username})
 		log.Printf("Player %s removed.", playerID)
 	}
 }
@@ -183,30 +536,68 @@ func (s *State) GetPlayer(playerID string) (*pb.Player, bool) { /* ... (no chang
 	if !exists {
 		return nil, false
 	}
-	pc := *tp.PlayerData
-	return &pc, true
+	return proto.Clone(tp.PlayerData).(*pb.Player), true
+}
+
+// GetAllPlayers returns copies of every player with their animation state
+// derived from their current direction.
+func (s *State) GetAllPlayers() []*pb.Player {
+	return s.AppendPlayers(nil)
 }
-func (s *State) GetAllPlayers() []*pb.Player { /* ... (no change) ... */
+
+// AppendPlayers appends copies of every player to dst, like GetAllPlayers, and
+// returns the extended slice. Players in dst's spare capacity (left there by an
+// earlier call on the same buffer) are overwritten in place instead of
+// allocating new ones, so a reused buffer makes steady-state snapshots
+// allocation-free. See PlayerSnapshot.
+func (s *State) AppendPlayers(dst []*pb.Player) []*pb.Player {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	pl := make([]*pb.Player, 0, len(s.players))
 	for _, tp := range s.players {
-		anim := pb.AnimationState_IDLE
-		switch tp.LastDirection {
-		case pb.PlayerInput_UP:
-			anim = pb.AnimationState_RUNNING_UP
-		case pb.PlayerInput_DOWN:
-			anim = pb.AnimationState_RUNNING_DOWN
-		case pb.PlayerInput_LEFT:
-			anim = pb.AnimationState_RUNNING_LEFT
-		case pb.PlayerInput_RIGHT:
-			anim = pb.AnimationState_RUNNING_RIGHT
+		if n := len(dst); n < cap(dst) {
+			dst = dst[:n+1]
+			if dst[n] == nil {
+				dst[n] = &pb.Player{}
+			}
+		} else {
+			dst = append(dst, &pb.Player{})
+		}
+		pc := dst[len(dst)-1]
+		copyPlayer(pc, tp.PlayerData)
+		if tp.DeadUntil.IsZero() {
+			pc.CurrentAnimationState = animationFor(tp.LastDirection)
 		}
-		pc := *tp.PlayerData
-		pc.CurrentAnimationState = anim
-		pl = append(pl, &pc)
 	}
-	return pl
+	return dst
+}
+
+// animationFor maps a movement direction to its running animation.
+func animationFor(dir pb.PlayerInput_Direction) pb.AnimationState {
+	switch dir {
+	case pb.PlayerInput_UP:
+		return pb.AnimationState_RUNNING_UP
+	case pb.PlayerInput_DOWN:
+		return pb.AnimationState_RUNNING_DOWN
+	case pb.PlayerInput_LEFT:
+		return pb.AnimationState_RUNNING_LEFT
+	case pb.PlayerInput_RIGHT:
+		return pb.AnimationState_RUNNING_RIGHT
+	}
+	return pb.AnimationState_IDLE
+}
+
+// copyPlayer overwrites dst with the contents of src without allocating a new
+// message.
+func copyPlayer(dst, src *pb.Player) {
+	dst.Reset()
+	proto.Merge(dst, src)
+}
+
+// PlayerCount returns the number of players currently in the state.
+func (s *State) PlayerCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.players)
 }
 func (s *State) GetAllPlayerIDs() []string { /* ... (no change) ... */
 	s.mu.RLock()
@@ -217,15 +608,27 @@ func (s *State) GetAllPlayerIDs() []string { /* ... (no change) ... */
 	}
 	return ids
 }
-func (s *State) GetTrackedPlayer(playerID string) (*trackedPlayer, bool) { /* ... (no change) ... */
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	tp, exists := s.players[playerID]
-	return tp, exists
+
+// StopIdlePlayers stops every moving player whose last input is older than
+// timeout, reporting whether any was stopped.
+func (s *State) StopIdlePlayers(timeout time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("StopIdlePlayers")()
+	changed := false
+	for _, tp := range s.players {
+		if tp.LastDirection != pb.PlayerInput_UNKNOWN && time.Since(tp.LastInputTime) > timeout {
+			tp.LastDirection = pb.PlayerInput_UNKNOWN
+			changed = true
+		}
+	}
+	return changed
 }
+
 func (s *State) UpdatePlayerDirection(playerID string, dir pb.PlayerInput_Direction) bool { /* ... (no change) ... */
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	defer s.auditLocked("UpdatePlayerDirection")()
 	tp, exists := s.players[playerID]
 	if !exists {
 		return false
@@ -239,106 +642,229 @@ func (s *State) UpdatePlayerDirection(playerID string, dir pb.PlayerInput_Direct
 }
 
 // --- Input & Movement ---
-func (s *State) ApplyInput(playerID string, direction pb.PlayerInput_Direction) (*pb.Player, bool) { /* ... (no change) ... */
+
+// ApplyInput records a player's input and moves them one step. It returns
+// ErrPlayerNotFound with a nil player if the player does not exist. Otherwise
+// the updated player is always returned, and a blocked move is reported as
+// ErrBlockedByWall or ErrBlockedByPlayer.
+func (s *State) ApplyInput(playerID string, direction pb.PlayerInput_Direction) (*pb.Player, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("ApplyInput")()
+	return s.applyInputLocked(playerID, direction)
+}
+
+// ApplyInputPredicted is ApplyInput also reporting whether the outcome
+// differs from what a client predicting its own movement would show: a step
+// of the tuned move speed in the input's direction, or standing still. Walls,
+// players, terrain, power-ups, teleporters and death all make it differ.
+func (s *State) ApplyInputPredicted(playerID string, direction pb.PlayerInput_Direction) (player *pb.Player, mispredicted bool, err error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	defer s.auditLocked("ApplyInputPredicted")()
+	tp, exists := s.players[playerID]
+	if !exists {
+		return nil, false, ErrPlayerNotFound
+	}
+	dx, dy := directionVector(direction, s.tuning.MoveSpeed)
+	wantX, wantY := tp.PlayerData.XPos+dx, tp.PlayerData.YPos+dy
+	player, err = s.applyInputLocked(playerID, direction)
+	return player, err != nil || player.XPos != wantX || player.YPos != wantY, err
+}
+
+// applyInputLocked implements ApplyInput. Must be called with the lock held.
+func (s *State) applyInputLocked(playerID string, direction pb.PlayerInput_Direction) (*pb.Player, error) {
 	trackedP, exists := s.players[playerID]
 	if !exists {
-		return nil, false
+		return nil, ErrPlayerNotFound
+	}
+	if !trackedP.DeadUntil.IsZero() {
+		return proto.Clone(trackedP.PlayerData).(*pb.Player), ErrPlayerDead
 	}
 	trackedP.LastInputTime = time.Now()
 	trackedP.LastDirection = direction
-	currentX := trackedP.PlayerData.XPos
-	currentY := trackedP.PlayerData.YPos
-	potentialX := currentX
-	potentialY := currentY
 	moved := false
+	var moveErr error
 	intendedAnimation := pb.AnimationState_IDLE
 	if direction != pb.PlayerInput_UNKNOWN {
+		trackedP.Facing = direction
+		trackedP.EmoteUntil = time.Time{}
 		switch direction {
 		case pb.PlayerInput_UP:
-			potentialY -= PlayerMoveSpeed
 			intendedAnimation = pb.AnimationState_RUNNING_UP
 		case pb.PlayerInput_DOWN:
-			potentialY += PlayerMoveSpeed
 			intendedAnimation = pb.AnimationState_RUNNING_DOWN
 		case pb.PlayerInput_LEFT:
-			potentialX -= PlayerMoveSpeed
 			intendedAnimation = pb.AnimationState_RUNNING_LEFT
 		case pb.PlayerInput_RIGHT:
-			potentialX += PlayerMoveSpeed
 			intendedAnimation = pb.AnimationState_RUNNING_RIGHT
 		}
-		potentialX = clamp(potentialX, s.worldMinX+PlayerHalfWidth, s.worldMaxX-PlayerHalfWidth)
-		potentialY = clamp(potentialY, s.worldMinY+PlayerHalfHeight, s.worldMaxY-PlayerHalfHeight)
-		canMove := true
-		if s.checkMapCollision(potentialX, potentialY) {
-			canMove = false
-		} else if s.checkPlayerCollision(playerID, potentialX, potentialY) {
-			canMove = false
+		speed := s.tuning.MoveSpeed * s.terrainAtLocked(trackedP.PlayerData.XPos, trackedP.PlayerData.YPos).SpeedMultiplier
+		if trackedP.PlayerData.SpeedBoost {
+			speed *= SpeedBoostMultiplier
 		}
-		if canMove {
-			trackedP.PlayerData.XPos = potentialX
-			trackedP.PlayerData.YPos = potentialY
-			moved = true
+		dx, dy := directionVector(direction, speed)
+		moveErr = s.tryMoveLocked(playerID, trackedP, dx, dy)
+		moved = moveErr == nil
+		if moved && s.terrainAtLocked(trackedP.PlayerData.XPos, trackedP.PlayerData.YPos).slippery() {
+			trackedP.SlideDirection = direction
+		} else {
+			trackedP.SlideDirection = pb.PlayerInput_UNKNOWN
 		}
 	} else {
 		intendedAnimation = pb.AnimationState_IDLE
 	}
 	if moved || direction != pb.PlayerInput_UNKNOWN {
 		trackedP.PlayerData.CurrentAnimationState = intendedAnimation
-	} else {
+	} else if trackedP.EmoteUntil.IsZero() {
 		trackedP.PlayerData.CurrentAnimationState = pb.AnimationState_IDLE
 	}
-	playerCopy := *trackedP.PlayerData
-	return &playerCopy, true
+	return proto.Clone(trackedP.PlayerData).(*pb.Player), moveErr
+}
+
+// directionVector returns the movement delta for a direction at the given speed.
+func directionVector(direction pb.PlayerInput_Direction, speed float32) (float32, float32) {
+	switch direction {
+	case pb.PlayerInput_UP:
+		return 0, -speed
+	case pb.PlayerInput_DOWN:
+		return 0, speed
+	case pb.PlayerInput_LEFT:
+		return -speed, 0
+	case pb.PlayerInput_RIGHT:
+		return speed, 0
+	}
+	return 0, 0
+}
+
+// tryMoveLocked moves a player by (dx, dy) if the clamped destination is free
+// of walls and other players, then resolves teleporters. It returns
+// ErrBlockedByWall or ErrBlockedByPlayer if the player did not move. Must be
+// called with the lock held.
+func (s *State) tryMoveLocked(playerID string, tp *trackedPlayer, dx, dy float32) error {
+	var potentialX, potentialY float32
+	switch s.edges {
+	case EdgeWrap:
+		potentialX, potentialY = s.wrapPositionLocked(tp.PlayerData.XPos+dx, tp.PlayerData.YPos+dy)
+	case EdgeFall:
+		potentialX, potentialY = tp.PlayerData.XPos+dx, tp.PlayerData.YPos+dy
+		if !s.inWorldLocked(potentialX, potentialY) {
+			s.fallLocked(playerID, tp) // Stepped over the edge
+			return nil
+		}
+	default:
+		potentialX = clamp(tp.PlayerData.XPos+dx, s.worldMinX+s.tuning.HalfWidth, s.worldMaxX-s.tuning.HalfWidth)
+		potentialY = clamp(tp.PlayerData.YPos+dy, s.worldMinY+s.tuning.HalfHeight, s.worldMaxY-s.tuning.HalfHeight)
+	}
+	if s.checkMapCollision(potentialX, potentialY) {
+		s.bumpLocked(tp, potentialX, potentialY)
+		if !tp.Blocked {
+			tp.Blocked = true
+			s.emitLocked(EventMoveBlocked, playerID, map[string]any{"x": tp.PlayerData.XPos, "y": tp.PlayerData.YPos, "to_x": potentialX, "to_y": potentialY})
+		}
+		return ErrBlockedByWall
+	}
+	if otherID, hit := s.collidingPlayerLocked(playerID, potentialX, potentialY); hit {
+		if !tp.Blocked {
+			tp.Blocked = true
+			s.emitLocked(EventCollided, playerID, map[string]any{"other_player_id": otherID, "x": tp.PlayerData.XPos, "y": tp.PlayerData.YPos})
+		}
+		return ErrBlockedByPlayer
+	}
+	tp.Blocked = false
+	if s.edges == EdgeWrap && (potentialX != tp.PlayerData.XPos+dx || potentialY != tp.PlayerData.YPos+dy) {
+		s.teleported[playerID] = struct{}{} // Crossed an edge of a wrapping world
+	}
+	tp.PlayerData.XPos = potentialX
+	tp.PlayerData.YPos = potentialY
+	s.visitLocked(tp)
+	s.checkTeleportLocked(playerID, tp)
+	s.checkSwitchLocked(tp)
+	s.collectLocked(playerID, tp)
+	s.checkZonesLocked(playerID, tp)
+	return nil
 }
 
 // --- Collision Detection ---
 func (s *State) checkMapCollision(centerX, centerY float32) bool { /* ... (no change) ... */
-	minX := centerX - PlayerHalfWidth
-	maxX := centerX + PlayerHalfWidth
-	minY := centerY - PlayerHalfHeight
-	maxY := centerY + PlayerHalfHeight
-	epsilon := float32(0.001)
-	startTileX := int(minX / float32(s.tileSize))
-	endTileX := int((maxX - epsilon) / float32(s.tileSize))
-	startTileY := int(minY / float32(s.tileSize))
-	endTileY := int((maxY - epsilon) / float32(s.tileSize))
-	for ty := startTileY; ty <= endTileY; ty++ {
-		for tx := startTileX; tx <= endTileX; tx++ {
-			if tx < 0 || tx >= s.mapTileWidth || ty < 0 || ty >= s.mapTileHeight {
+	startX, endX, startY, endY := s.playerTilesLocked(centerX, centerY)
+	for ty := startY; ty <= endY; ty++ {
+		for tx := startX; tx <= endX; tx++ {
+			c := s.wrapTileLocked(tileCoord{X: tx, Y: ty})
+			if c.X < 0 || c.X >= s.mapTileWidth || c.Y < 0 || c.Y >= s.mapTileHeight {
 				return true
 			}
-			if s.worldMap[ty][tx] == TileTypeWall {
+			if !s.propertiesOf(s.worldMap[c.Y][c.X]).Walkable {
 				return true
 			}
 		}
 	}
 	return false
 }
+
+// playerTilesLocked returns the range of tiles (possibly out of bounds, and
+// to be wrapped on wrapping maps) covered by a player bounding box centered
+// at the given position. Collision checks loop over it rather than build a
+// slice, as they run for every move.
+func (s *State) playerTilesLocked(centerX, centerY float32) (startX, endX, startY, endY int) {
+	startX, endX = s.tileSpanLocked(centerX-s.tuning.HalfWidth, centerX+s.tuning.HalfWidth)
+	startY, endY = s.tileSpanLocked(centerY-s.tuning.HalfHeight, centerY+s.tuning.HalfHeight)
+	return startX, endX, startY, endY
+}
+
+// tileSpanLocked returns the first and last tile indexes, possibly out of
+// bounds, that the pixel span [lo, hi) touches along one axis.
+func (s *State) tileSpanLocked(lo, hi float32) (int, int) {
+	epsilon := float32(0.001)
+	ts := float64(s.tileSize)
+	// Floor rather than truncate: on wrapping maps the box may start left of or above the origin
+	return int(math.Floor(float64(lo) / ts)), int(math.Floor(float64(hi-epsilon) / ts))
+}
 func (s *State) checkPlayerCollision(playerID string, potentialX, potentialY float32) bool { /* ... (no change) ... */
-	moveLeft := potentialX - PlayerHalfWidth
-	moveRight := potentialX + PlayerHalfWidth
-	moveTop := potentialY - PlayerHalfHeight
-	moveBottom := potentialY + PlayerHalfHeight
+	_, hit := s.collidingPlayerLocked(playerID, potentialX, potentialY)
+	return hit
+}
+
+// collidingPlayerLocked returns the player or solid NPC a move to the given
+// position would collide with, if any; playerID may also be an NPC's ID.
+// Must be called with the lock held.
+func (s *State) collidingPlayerLocked(playerID string, potentialX, potentialY float32) (string, bool) {
+	moveLeft := potentialX - s.tuning.HalfWidth
+	moveRight := potentialX + s.tuning.HalfWidth
+	moveTop := potentialY - s.tuning.HalfHeight
+	moveBottom := potentialY + s.tuning.HalfHeight
+	self, ok := s.players[playerID]
+	if ok && (self.PlayerData.Invulnerable || self.PlayerData.Ghost) {
+		return "", false
+	}
 	for otherID, otherTrackedPlayer := range s.players {
-		if otherID == playerID {
+		if otherID == playerID || otherTrackedPlayer.PlayerData.Invulnerable || otherTrackedPlayer.PlayerData.Ghost || !otherTrackedPlayer.DeadUntil.IsZero() {
 			continue
 		}
-		otherX := otherTrackedPlayer.PlayerData.XPos
-		otherY := otherTrackedPlayer.PlayerData.YPos
-		otherLeft := otherX - PlayerHalfWidth
-		otherRight := otherX + PlayerHalfWidth
-		otherTop := otherY - PlayerHalfHeight
-		otherBottom := otherY + PlayerHalfHeight
+		if ok && teammates(self, otherTrackedPlayer) {
+			continue // Teammates pass through each other
+		}
+		otherX, otherY := s.nearestLocked(potentialX, potentialY, otherTrackedPlayer.PlayerData.XPos, otherTrackedPlayer.PlayerData.YPos)
+		otherLeft := otherX - s.tuning.HalfWidth
+		otherRight := otherX + s.tuning.HalfWidth
+		otherTop := otherY - s.tuning.HalfHeight
+		otherBottom := otherY + s.tuning.HalfHeight
 		xOverlap := (moveLeft < otherRight) && (moveRight > otherLeft)
 		yOverlap := (moveTop < otherBottom) && (moveBottom > otherTop)
 		if xOverlap && yOverlap {
-			return true
+			return otherID, true
 		}
 	}
-	return false
+	for npcID, n := range s.npcs {
+		if npcID == playerID || !n.data.Solid {
+			continue
+		}
+		otherX, otherY := s.nearestLocked(potentialX, potentialY, n.data.XPos, n.data.YPos)
+		if abs32(otherX-potentialX) < 2*s.tuning.HalfWidth && abs32(otherY-potentialY) < 2*s.tuning.HalfHeight {
+			return npcID, true
+		}
+	}
+	return "", false
 }
 
 // --- Map Data Access ---
@@ -346,10 +872,23 @@ func (s *State) GetMapDataAndDimensions() ([][]TileType, int, int, int, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	if s.worldMap == nil || s.mapTileHeight == 0 || s.mapTileWidth == 0 {
-		return nil, 0, 0, 0, fmt.Errorf("map data not loaded or invalid")
+		return nil, 0, 0, 0, ErrMapInvalid
+	}
+	// Copy the grid: tiles can change at runtime (doors) after the lock is released.
+	grid := make([][]TileType, len(s.worldMap))
+	for y, row := range s.worldMap {
+		grid[y] = append([]TileType(nil), row...)
 	}
-	return s.worldMap, s.mapTileWidth, s.mapTileHeight, s.tileSize, nil
+	return grid, s.mapTileWidth, s.mapTileHeight, s.tileSize, nil
 }
+
+// MapMetadata returns the map's name and author, empty if the format has none.
+func (s *State) MapMetadata() (name, author string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.mapName, s.mapAuthor
+}
+
 func (s *State) GetWorldPixelDimensions() (float32, float32) { /* ... (no change) ... */
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -360,28 +899,78 @@ func (s *State) GetWorldPixelDimensions() (float32, float32) { /* ... (no change
 func (s *State) GenerateDeltaUpdate() (*pb.DeltaUpdate, bool) { /* ... (no change) ... */
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	delta := &pb.DeltaUpdate{UpdatedPlayers: make([]*pb.Player, 0), RemovedPlayerIds: make([]string, 0)}
+	defer s.auditLocked("GenerateDeltaUpdate")()
+	delta := &pb.DeltaUpdate{}
+	changed := s.generateDeltaLocked(delta, nil)
+	return delta, changed
+}
+
+// GeneratePartialDeltaUpdate is GenerateDeltaUpdate for rooms with clients
+// that accept partial players: along with the full delta it returns the same
+// delta with each previously broadcast player cut down to its changed fields.
+func (s *State) GeneratePartialDeltaUpdate() (full, partial *pb.DeltaUpdate, changed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("GeneratePartialDeltaUpdate")()
+	full, partial = &pb.DeltaUpdate{}, &pb.DeltaUpdate{}
+	changed = s.generateDeltaLocked(full, partial)
+	partial.RemovedPlayerIds = full.RemovedPlayerIds
+	partial.TeleportedPlayerIds = full.TeleportedPlayerIds
+	partial.SpawnedItems, partial.RemovedItemIds = full.SpawnedItems, full.RemovedItemIds
+	partial.UpdatedNpcs, partial.RemovedNpcIds = full.UpdatedNpcs, full.RemovedNpcIds
+	return full, partial, changed
+}
+
+// generateDeltaLocked fills delta with the changes since the last broadcast,
+// and partial (if not nil) with the changed fields of each updated player.
+// Only changed players are copied, into players from ReleaseDelta's pool, and
+// the last broadcast copies are updated in place, so a tick where nobody
+// changed allocates nothing.
+// Must be called with the lock held.
+func (s *State) generateDeltaLocked(delta, partial *pb.DeltaUpdate) bool {
 	changed := false
-	currentPlayerStateSnapshot := make(map[string]*pb.Player)
 	for id, trackedP := range s.players {
-		currentPlayerClone := proto.Clone(trackedP.PlayerData).(*pb.Player)
-		currentPlayerStateSnapshot[id] = currentPlayerClone
 		lastP, existsInLast := s.lastBroadcastPlayers[id]
-		if !existsInLast || !proto.Equal(lastP, currentPlayerClone) {
-			delta.UpdatedPlayers = append(delta.UpdatedPlayers, currentPlayerClone)
+		if !existsInLast || !proto.Equal(lastP, trackedP.PlayerData) {
+			if partial != nil {
+				mask := uint32(pb.PlayerField_PLAYER_FIELD_ALL)
+				if existsInLast {
+					mask = changedFields(lastP, trackedP.PlayerData)
+				}
+				partial.UpdatedPlayers = append(partial.UpdatedPlayers, partialPlayer(trackedP.PlayerData, mask))
+			}
+			if !existsInLast {
+				lastP = &pb.Player{}
+				s.lastBroadcastPlayers[id] = lastP
+			}
+			copyPlayer(lastP, trackedP.PlayerData)
+			updated := acquirePlayer()
+			copyPlayer(updated, trackedP.PlayerData)
+			delta.UpdatedPlayers = append(delta.UpdatedPlayers, updated)
 			changed = true
+			if _, jumped := s.teleported[id]; jumped {
+				delta.TeleportedPlayerIds = append(delta.TeleportedPlayerIds, id)
+			}
 		}
 	}
+	sort.Strings(delta.TeleportedPlayerIds)
+	clear(s.teleported)
+	if len(s.spawnedItems) > 0 || len(s.removedItems) > 0 {
+		delta.SpawnedItems, delta.RemovedItemIds = s.spawnedItems, s.removedItems
+		s.spawnedItems, s.removedItems = nil, nil
+		changed = true
+	}
 	for id := range s.lastBroadcastPlayers {
 		if _, existsInCurrent := s.players[id]; !existsInCurrent {
 			delta.RemovedPlayerIds = append(delta.RemovedPlayerIds, id)
+			delete(s.lastBroadcastPlayers, id)
 			changed = true
 		}
 	}
-	if changed {
-		s.lastBroadcastPlayers = currentPlayerStateSnapshot
+	if s.generateNPCDeltaLocked(delta) {
+		changed = true
 	}
-	return delta, changed
+	return changed
 }
 func (s *State) GetInitialStateDelta() *pb.DeltaUpdate { /* ... (no change) ... */
 	s.mu.RLock()
@@ -391,9 +980,28 @@ func (s *State) GetInitialStateDelta() *pb.DeltaUpdate { /* ... (no change) ...
 		playerClone := proto.Clone(trackedP.PlayerData).(*pb.Player)
 		initialDelta.UpdatedPlayers = append(initialDelta.UpdatedPlayers, playerClone)
 	}
+	initialDelta.SpawnedItems = s.itemsLocked()
+	initialDelta.UpdatedNpcs = s.npcsLocked()
 	return initialDelta
 }
 
+// Snapshot returns copies of every player and of the current tile grid, along
+// with the tile size, taken under a single lock so they are consistent.
+func (s *State) Snapshot() (players []*pb.Player, tiles [][]TileType, tileSize int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	players = make([]*pb.Player, 0, len(s.players))
+	for _, trackedP := range s.players {
+		players = append(players, proto.Clone(trackedP.PlayerData).(*pb.Player))
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].Id < players[j].Id })
+	tiles = make([][]TileType, len(s.worldMap))
+	for y, row := range s.worldMap {
+		tiles[y] = append([]TileType(nil), row...)
+	}
+	return players, tiles, s.tileSize
+}
+
 // --- Utility ---
 func clamp(value, min, max float32) float32 { /* ... (no change) ... */
 	if value < min {
@@ -0,0 +1,41 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+func TestCheckMapCollision(t *testing.T) {
+	s := testState(t)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.checkMapCollision(120, 120) {
+		t.Error("open floor collides")
+	}
+	if !s.checkMapCollision(60, 120) {
+		t.Error("overlapping the left wall does not collide")
+	}
+	if allocs := testing.AllocsPerRun(100, func() { s.checkMapCollision(120, 120) }); allocs != 0 {
+		t.Errorf("checkMapCollision allocates %v times per call", allocs)
+	}
+}
+
+func TestStopIdlePlayers(t *testing.T) {
+	s := testState(t)
+	s.AddPlayer("p1", "ann")
+	if _, err := s.ApplyInput("p1", pb.PlayerInput_RIGHT); err != nil {
+		t.Fatal(err)
+	}
+	if s.StopIdlePlayers(time.Hour) {
+		t.Error("stopped a player whose input has not timed out")
+	}
+	time.Sleep(time.Millisecond)
+	if !s.StopIdlePlayers(0) {
+		t.Error("did not stop a player whose input timed out")
+	}
+	if s.StopIdlePlayers(0) {
+		t.Error("stopped an already idle player again")
+	}
+}
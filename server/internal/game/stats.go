@@ -0,0 +1,31 @@
+package game
+
+import "math"
+
+// PlayerStats are what a player achieved since joining, for leaderboards.
+type PlayerStats struct {
+	Score        int64 // Points awarded by the room's game mode
+	TilesVisited int   // Distinct tiles the player has stood on
+}
+
+// visitLocked records the tile under a player's center as visited.
+// Must be called with the lock held.
+func (s *State) visitLocked(tp *trackedPlayer) {
+	ts := float64(s.tileSize)
+	c := tileCoord{X: int(math.Floor(float64(tp.PlayerData.XPos) / ts)), Y: int(math.Floor(float64(tp.PlayerData.YPos) / ts))}
+	if tp.Visited == nil {
+		tp.Visited = make(map[tileCoord]struct{})
+	}
+	tp.Visited[c] = struct{}{}
+}
+
+// Stats returns a player's stats since joining.
+func (s *State) Stats(playerID string) (PlayerStats, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tp, ok := s.players[playerID]
+	if !ok {
+		return PlayerStats{}, false
+	}
+	return PlayerStats{Score: tp.Score, TilesVisited: len(tp.Visited)}, true
+}
@@ -0,0 +1,82 @@
+package game
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PlayerRecord is what a Store keeps about a player between sessions: where
+// they last were in a room and the state of their last session.
+type PlayerRecord struct {
+	Username string    `json:"username"`
+	RoomID   string    `json:"room_id"`
+	X        float32   `json:"x"`
+	Y        float32   `json:"y"`
+	PlayerID string    `json:"player_id"` // Of the last session
+	Online   bool      `json:"online"`    // Whether the session was still connected when saved
+	SavedAt  time.Time `json:"saved_at"`
+}
+
+// Store keeps player records outside the server, keyed by room and
+// case-insensitive username, so they can survive restarts and be shared by
+// several servers. Records expire after a day without being saved.
+type Store interface {
+	SavePlayer(ctx context.Context, rec PlayerRecord) error
+	// LoadPlayer returns the player's record in a room, if there is one.
+	LoadPlayer(ctx context.Context, roomID, username string) (PlayerRecord, bool, error)
+}
+
+// playerRecordKey is the key a record is stored under within a store.
+func playerRecordKey(roomID, username string) string {
+	return roomID + ":" + strings.ToLower(username)
+}
+
+// MemoryStore is a Store within the server process: records outlive player
+// sessions but not the server.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]PlayerRecord
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]PlayerRecord)}
+}
+
+func (m *MemoryStore) SavePlayer(_ context.Context, rec PlayerRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for key, old := range m.records {
+		if now.Sub(old.SavedAt) >= savedPlayerTTL {
+			delete(m.records, key)
+		}
+	}
+	m.records[playerRecordKey(rec.RoomID, rec.Username)] = rec
+	return nil
+}
+
+func (m *MemoryStore) LoadPlayer(_ context.Context, roomID, username string) (PlayerRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec, ok := m.records[playerRecordKey(roomID, username)]
+	if !ok || time.Since(rec.SavedAt) >= savedPlayerTTL {
+		return PlayerRecord{}, false, nil
+	}
+	return rec, true, nil
+}
+
+// ExpectPlayer gives a player's position back when they next join under
+// the same username, like a restored world does, if it is still free then.
+func (s *State) ExpectPlayer(username string, x, y float32, savedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(savedAt) >= savedPlayerTTL {
+		return
+	}
+	if s.returning == nil {
+		s.returning = make(map[string]SavedPlayer)
+	}
+	s.returning[strings.ToLower(username)] = SavedPlayer{Username: username, X: x, Y: y, SavedAt: savedAt}
+}
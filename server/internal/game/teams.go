@@ -0,0 +1,92 @@
+package game
+
+import "log"
+
+// MaxTeams is the most teams a State can split its players into.
+const MaxTeams = 4
+
+// EnableTeams splits players into n balanced teams, 2 to MaxTeams: every
+// player joining from now on is put in the smallest team. Players already in
+// the State are not assigned. It reports false for an invalid n.
+func (s *State) EnableTeams(n int) bool {
+	if n < 2 || n > MaxTeams {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.teams = n
+	return true
+}
+
+// Teams returns the number of teams, or 0 if players play alone.
+func (s *State) Teams() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.teams
+}
+
+// ChooseTeam moves a player to the team they asked for, unless that would
+// leave the teams more than one player apart. It returns the player's team
+// either way, or ErrPlayerNotFound / ErrInvalidTeam.
+func (s *State) ChooseTeam(playerID string, team int32) (int32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("ChooseTeam")()
+	tp, ok := s.players[playerID]
+	if !ok {
+		return 0, ErrPlayerNotFound
+	}
+	if s.teams == 0 || team < 1 || int(team) > s.teams {
+		return tp.PlayerData.Team, ErrInvalidTeam
+	}
+	if team == tp.PlayerData.Team {
+		return team, nil
+	}
+	sizes := s.teamSizesLocked()
+	sizes[tp.PlayerData.Team]--
+	sizes[team]++
+	smallest, largest := sizes[1], sizes[1]
+	for t := 2; t <= s.teams; t++ {
+		smallest, largest = min(smallest, sizes[t]), max(largest, sizes[t])
+	}
+	if largest-smallest > 1 {
+		return tp.PlayerData.Team, nil
+	}
+	tp.PlayerData.Team = team
+	s.scoresChanged = true
+	log.Printf("Player %s ('%s') chose team %d", playerID, tp.PlayerData.Username, team)
+	return team, nil
+}
+
+// assignTeamLocked puts a new player in the smallest team, the lowest
+// numbered on ties. Must be called with the lock held.
+func (s *State) assignTeamLocked(tp *trackedPlayer) {
+	if s.teams == 0 {
+		return
+	}
+	sizes := s.teamSizesLocked()
+	team := int32(1)
+	for t := int32(2); t <= int32(s.teams); t++ {
+		if sizes[t] < sizes[team] {
+			team = t
+		}
+	}
+	tp.PlayerData.Team = team
+}
+
+// teamSizesLocked counts the players of each team, indexed by team number.
+// Must be called with the lock held.
+func (s *State) teamSizesLocked() []int {
+	sizes := make([]int, s.teams+1)
+	for _, tp := range s.players {
+		if t := int(tp.PlayerData.Team); t > 0 && t <= s.teams {
+			sizes[t]++
+		}
+	}
+	return sizes
+}
+
+// teammates reports whether two players are on the same team.
+func teammates(a, b *trackedPlayer) bool {
+	return a.PlayerData.Team != 0 && a.PlayerData.Team == b.PlayerData.Team
+}
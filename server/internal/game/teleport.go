@@ -0,0 +1,66 @@
+package game
+
+import (
+	"log"
+	"math"
+	"time"
+)
+
+// TeleportCooldown is the minimum time between two teleports of the same player.
+const TeleportCooldown = 1 * time.Second
+
+// tileCoord addresses a single map tile.
+type tileCoord struct {
+	X, Y int
+}
+
+// linkTeleportPads pairs pads sharing an ID with each other. IDs used by
+// anything other than exactly two pads are ignored with a warning.
+func linkTeleportPads(pads map[uint8][]tileCoord) map[tileCoord]tileCoord {
+	links := make(map[tileCoord]tileCoord)
+	for id, coords := range pads {
+		if len(coords) != 2 {
+			log.Printf("Warning: Teleporter pair %d has %d pads (need exactly 2), ignoring.", id, len(coords))
+			continue
+		}
+		links[coords[0]] = coords[1]
+		links[coords[1]] = coords[0]
+	}
+	return links
+}
+
+// tileAt returns the tile coordinate containing the given pixel position.
+func (s *State) tileAt(x, y float32) tileCoord {
+	ts := float64(s.tileSize)
+	return tileCoord{X: int(math.Floor(float64(x) / ts)), Y: int(math.Floor(float64(y) / ts))}
+}
+
+// checkTeleportLocked moves a player standing on a teleporter pad to its linked
+// pad. A player must step off the pad they arrived on, and wait out
+// TeleportCooldown, before teleporting again, so pads never bounce players back
+// and forth. Must be called with the lock held.
+func (s *State) checkTeleportLocked(playerID string, tp *trackedPlayer) {
+	here := s.tileAt(tp.PlayerData.XPos, tp.PlayerData.YPos)
+	dest, isPad := s.teleportLinks[here]
+	if !isPad {
+		tp.ArrivedPad = nil
+		return
+	}
+	if tp.ArrivedPad != nil && *tp.ArrivedPad == here {
+		return
+	}
+	now := time.Now()
+	if now.Before(tp.TeleportReadyAt) {
+		return
+	}
+	half := float32(s.tileSize) / 2
+	destX := float32(dest.X*s.tileSize) + half
+	destY := float32(dest.Y*s.tileSize) + half
+	if !s.canOccupy(playerID, destX, destY) {
+		return
+	}
+	s.placePlayerLocked(playerID, tp, destX, destY)
+	tp.ArrivedPad = &dest
+	tp.TeleportReadyAt = now.Add(TeleportCooldown)
+	log.Printf("Player %s teleported from (%d, %d) to (%d, %d)", playerID, here.X, here.Y, dest.X, dest.Y)
+}
@@ -0,0 +1,188 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// Tileset cells of the built-in textures, numbered from 1.
+const (
+	textureFloor int32 = 1
+	textureWall  int32 = 2
+)
+
+// iceFriction is the friction of a tile marked slippery without a friction of
+// its own: players slide on at three quarters of their move speed.
+const iceFriction float32 = 0.25
+
+// TileProperty describes a tile type: how it affects movement and how
+// clients draw it.
+type TileProperty struct {
+	Walkable        bool
+	SpeedMultiplier float32 // Applied to PlayerMoveSpeed while standing on the tile
+	Friction        float32 // 1 stops players at once; below 1 they keep sliding after input stops
+	Damage          int32   // Hit points per second dealt to players standing on the tile
+	TextureID       int32   // Tileset cell, numbered from 1
+	TintRGB         uint32  // 0xRRGGBB multiplied into the texture; 0 for none
+	Points          int32   // Awarded for picking the tile up, which turns it into floor; 0 if it is not a pickup
+}
+
+// slippery reports whether players keep sliding on the tile.
+func (p TileProperty) slippery() bool {
+	return p.Friction < 1
+}
+
+// slideSpeed is how far a player drifts per tick on the tile once input stops.
+func (p TileProperty) slideSpeed(moveSpeed float32) float32 {
+	return moveSpeed * (1 - p.Friction)
+}
+
+// tileProperties is the table of every known tile type, replaceable at
+// startup with LoadTileDefinitions. Unknown tile types fall back to plain
+// walkable floor.
+var tileProperties = map[TileType]TileProperty{
+	TileTypeEmpty:            {Walkable: true, SpeedMultiplier: 1, Friction: 1, TextureID: textureFloor},
+	TileTypeWall:             {Walkable: false, SpeedMultiplier: 1, Friction: 1, TextureID: textureWall},
+	TileTypeSpawn:            {Walkable: true, SpeedMultiplier: 1, Friction: 1, TextureID: textureFloor},
+	TileTypeTeleporter:       {Walkable: true, SpeedMultiplier: 1, Friction: 1, TextureID: textureFloor},
+	TileTypeMud:              {Walkable: true, SpeedMultiplier: 0.5, Friction: 1, TextureID: textureFloor, TintRGB: 0x8B4513},
+	TileTypeIce:              {Walkable: true, SpeedMultiplier: 1.25, Friction: iceFriction, TextureID: textureFloor, TintRGB: 0xADD8E6},
+	TileTypeDoorClosed:       {Walkable: false, SpeedMultiplier: 1, Friction: 1, TextureID: textureFloor, TintRGB: 0x0000A0},
+	TileTypeDoorOpen:         {Walkable: true, SpeedMultiplier: 1, Friction: 1, TextureID: textureFloor, TintRGB: 0x9696FF},
+	TileTypeSwitch:           {Walkable: true, SpeedMultiplier: 1, Friction: 1, TextureID: textureFloor, TintRGB: 0xFFFF00},
+	TileTypeDestructibleWall: {Walkable: false, SpeedMultiplier: 1, Friction: 1, TextureID: textureWall, TintRGB: 0x808080},
+	TileTypeCoin:             {Walkable: true, SpeedMultiplier: 1, Friction: 1, TextureID: textureFloor, TintRGB: 0xFFD700, Points: 1},
+}
+
+var defaultTileProperty = TileProperty{Walkable: true, SpeedMultiplier: 1, Friction: 1, TextureID: textureFloor}
+
+// LoadTileDefinitions reads server-wide tile definitions from a JSON file, a
+// list in the format of a JSON map's "tile_properties", and applies them on
+// top of the built-in table. Maps can still override them. It must be called
+// before any State is created.
+func LoadTileDefinitions(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read tile definitions '%s': %w", path, err)
+	}
+	var defs []jsonTileProperty
+	if err := json.Unmarshal(raw, &defs); err != nil {
+		return fmt.Errorf("invalid tile definitions '%s': %w", path, err)
+	}
+	overrides, err := applyTileProperties(defs)
+	if err != nil {
+		return fmt.Errorf("invalid tile definitions '%s': %w", path, err)
+	}
+	tileProperties = mergeTileProperties(overrides)
+	log.Printf("Loaded %d tile definitions from '%s'.", len(defs), path)
+	return nil
+}
+
+// defaultPropertiesOf returns the built-in properties of a tile type.
+func defaultPropertiesOf(t TileType) TileProperty {
+	if p, ok := tileProperties[t]; ok {
+		return p
+	}
+	return defaultTileProperty
+}
+
+// knownTile reports whether a tile type is defined, either server-wide or by
+// a map's own overrides.
+func knownTile(t TileType, overrides map[TileType]TileProperty) bool {
+	if _, ok := overrides[t]; ok {
+		return true
+	}
+	_, ok := tileProperties[t]
+	return ok
+}
+
+// mergeTileProperties returns the default table with a map's overrides applied.
+func mergeTileProperties(overrides map[TileType]TileProperty) map[TileType]TileProperty {
+	merged := make(map[TileType]TileProperty, len(tileProperties)+len(overrides))
+	for t, p := range tileProperties {
+		merged[t] = p
+	}
+	for t, p := range overrides {
+		merged[t] = p
+	}
+	return merged
+}
+
+// propertiesOf returns the movement properties of a tile type on this map.
+// Must be called with the lock held.
+func (s *State) propertiesOf(t TileType) TileProperty {
+	if p, ok := s.tileProps[t]; ok {
+		return p
+	}
+	return defaultTileProperty
+}
+
+// TileDefinitions returns the map's tile definition table for
+// InitialMapData, ordered by tile ID.
+func (s *State) TileDefinitions() []*pb.TileDefinition {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	table := make([]*pb.TileDefinition, 0, len(s.tileProps))
+	for t, p := range s.tileProps {
+		table = append(table, &pb.TileDefinition{
+			TileId:          int32(t),
+			Walkable:        p.Walkable,
+			SpeedMultiplier: p.SpeedMultiplier,
+			Slippery:        p.slippery(),
+			TextureId:       p.TextureID,
+			TintRgb:         p.TintRGB,
+			Friction:        p.Friction,
+			Damage:          p.Damage,
+			Points:          p.Points,
+		})
+	}
+	sort.Slice(table, func(i, j int) bool { return table[i].TileId < table[j].TileId })
+	return table
+}
+
+// terrainAtLocked returns the properties of the tile under a pixel position.
+// Must be called with the lock held.
+func (s *State) terrainAtLocked(x, y float32) TileProperty {
+	c := s.tileAt(x, y)
+	if c.X < 0 || c.X >= s.mapTileWidth || c.Y < 0 || c.Y >= s.mapTileHeight {
+		return defaultTileProperty
+	}
+	return s.propertiesOf(s.worldMap[c.Y][c.X])
+}
+
+// ApplySlides moves players who are not steering and are standing on slippery tiles one step further in
+// the direction they were last travelling, until they hit something or reach
+// grippy ground. It reports whether any player moved.
+func (s *State) ApplySlides(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("ApplySlides")()
+	changed := false
+	for id, tp := range s.players {
+		if tp.SlideDirection == pb.PlayerInput_UNKNOWN {
+			continue
+		}
+		steering := tp.LastDirection != pb.PlayerInput_UNKNOWN && now.Sub(tp.LastInputTime) <= s.tuning.MovementTimeout
+		if steering {
+			continue
+		}
+		terrain := s.terrainAtLocked(tp.PlayerData.XPos, tp.PlayerData.YPos)
+		if !terrain.slippery() {
+			tp.SlideDirection = pb.PlayerInput_UNKNOWN
+			continue
+		}
+		dx, dy := directionVector(tp.SlideDirection, terrain.slideSpeed(s.tuning.MoveSpeed))
+		if s.tryMoveLocked(id, tp, dx, dy) != nil {
+			tp.SlideDirection = pb.PlayerInput_UNKNOWN
+			continue
+		}
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,611 @@
+package game
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// --- Tiled map loader ---
+//
+// Maps made in the Tiled editor can be loaded from TMX (XML) or TMJ (JSON)
+// exports, with external tilesets in TSX or TSJ. Only orthogonal, finite maps
+// with square tiles are supported. Game tiles come from:
+//
+//   - tile layers: a tile whose tileset entry has a "type" (its class, or a
+//     "type" property) becomes that tile type; in a layer named "collision"
+//     (or with a true "collision" property) untyped tiles are walls;
+//   - tile layers named (or with a "layer" property of) ground, decoration or
+//     overhead, which become visual layers instead;
+//   - object layers: each object's class/type places that tile type on every
+//     tile the object covers.
+//
+// A map property "edges" sets the edge policy: clamp, wrap or fall.
+//
+// Types are wall, empty, spawn, mud, ice, destructible, and the grouped types
+// teleporter, door and switch, which need an integer "group" property (1-254).
+
+// gidMask clears Tiled's flip/rotation flags from a global tile ID.
+const gidMask = 0x1FFFFFFF
+
+// tiledTile is the game-relevant information about one tileset tile.
+type tiledTile struct {
+	typ   string
+	group int
+}
+
+type tiledTileLayer struct {
+	name  string
+	props map[string]string
+	gids  []uint32 // Row-major, width*height entries
+}
+
+type tiledObject struct {
+	typ        string
+	x, y, w, h float64
+	props      map[string]string
+}
+
+// tiledMap is the format-independent form of a TMX or TMJ export.
+type tiledMap struct {
+	width, height         int
+	tileWidth, tileHeight int
+	orientation           string
+	infinite              bool
+	tiles                 map[uint32]tiledTile // Global tile ID -> info
+	tileLayers            []tiledTileLayer
+	objects               []tiledObject
+	props                 map[string]string // Map properties
+}
+
+// loadTiledMap loads a .tmx or .tmj file.
+func loadTiledMap(filePath string) (*mapData, error) {
+	raw, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, &MapError{Path: filePath, Reason: "failed to open", Err: err}
+	}
+	var tm *tiledMap
+	if strings.EqualFold(filepath.Ext(filePath), ".tmx") {
+		tm, err = parseTMX(raw, filepath.Dir(filePath))
+	} else {
+		tm, err = parseTMJ(raw, filepath.Dir(filePath))
+	}
+	if err != nil {
+		return nil, &MapError{Path: filePath, Reason: "invalid Tiled map", Err: err}
+	}
+	loaded, err := tm.build()
+	if err != nil {
+		return nil, &MapError{Path: filePath, Reason: "invalid Tiled map", Err: err}
+	}
+	log.Printf("Loaded Tiled map '%s', dimensions: %d x %d tiles of %dpx.", filePath, loaded.width, loaded.height, loaded.tileSize)
+	return loaded, nil
+}
+
+// build converts the Tiled map into game tiles and visual layers.
+func (tm *tiledMap) build() (*mapData, error) {
+	if tm.orientation != "" && tm.orientation != "orthogonal" {
+		return nil, fmt.Errorf("unsupported orientation %q", tm.orientation)
+	}
+	if tm.infinite {
+		return nil, fmt.Errorf("infinite maps are not supported")
+	}
+	if tm.width <= 0 || tm.height <= 0 {
+		return nil, fmt.Errorf("invalid dimensions (%dx%d)", tm.width, tm.height)
+	}
+	if tm.tileWidth <= 0 || tm.tileWidth != tm.tileHeight {
+		return nil, fmt.Errorf("tiles must be square, got %dx%d", tm.tileWidth, tm.tileHeight)
+	}
+
+	edges, err := ParseEdgePolicy(tm.props["edges"])
+	if err != nil {
+		return nil, err
+	}
+	d := &mapData{
+		tiles:        make([][]TileType, tm.height),
+		width:        tm.width,
+		height:       tm.height,
+		tileSize:     tm.tileWidth,
+		edges:        edges,
+		teleportPads: make(map[uint8][]tileCoord),
+		doorGroups:   make(map[uint8][]tileCoord),
+		switchGroups: make(map[tileCoord]uint8),
+	}
+	for y := range d.tiles {
+		d.tiles[y] = make([]TileType, tm.width)
+	}
+
+	for _, l := range tm.tileLayers {
+		if len(l.gids) != tm.width*tm.height {
+			return nil, fmt.Errorf("layer %q has %d tiles, want %d", l.name, len(l.gids), tm.width*tm.height)
+		}
+		if kind, ok := tiledVisualLayer(l); ok {
+			tiles := make([][]int32, tm.height)
+			for y := range tiles {
+				tiles[y] = make([]int32, tm.width)
+				for x := range tiles[y] {
+					tiles[y][x] = int32(l.gids[y*tm.width+x] & gidMask)
+				}
+			}
+			d.layers = append(d.layers, mapLayer{kind: kind, tiles: tiles})
+			continue
+		}
+		collision := strings.EqualFold(l.name, "collision") || l.props["collision"] == "true"
+		for i, gid := range l.gids {
+			gid &= gidMask
+			if gid == 0 {
+				continue
+			}
+			info := tm.tiles[gid]
+			if info.typ == "" {
+				if !collision {
+					continue
+				}
+				info.typ = "wall"
+			}
+			if err := d.placeTiled(tileCoord{X: i % tm.width, Y: i / tm.width}, info); err != nil {
+				return nil, fmt.Errorf("layer %q: %w", l.name, err)
+			}
+		}
+	}
+
+	ts := float64(tm.tileWidth)
+	for _, o := range tm.objects {
+		if o.typ == "" {
+			continue
+		}
+		group, _ := strconv.Atoi(o.props["group"])
+		info := tiledTile{typ: o.typ, group: group}
+		x0, y0 := int(math.Floor(o.x/ts)), int(math.Floor(o.y/ts))
+		x1, y1 := x0, y0
+		if o.w > 0 && o.h > 0 {
+			x1 = int(math.Ceil((o.x+o.w)/ts)) - 1
+			y1 = int(math.Ceil((o.y+o.h)/ts)) - 1
+		}
+		for y := max(y0, 0); y <= min(y1, tm.height-1); y++ {
+			for x := max(x0, 0); x <= min(x1, tm.width-1); x++ {
+				if err := d.placeTiled(tileCoord{X: x, Y: y}, info); err != nil {
+					return nil, fmt.Errorf("object at (%.0f, %.0f): %w", o.x, o.y, err)
+				}
+			}
+		}
+	}
+	return d, nil
+}
+
+// tiledVisualLayer reports whether a tile layer is a visual layer, and which.
+func tiledVisualLayer(l tiledTileLayer) (pb.MapLayerKind, bool) {
+	name := l.props["layer"]
+	if name == "" {
+		name = l.name
+	}
+	for _, lf := range visualLayerFiles {
+		if strings.EqualFold(name, lf.suffix) {
+			return lf.kind, true
+		}
+	}
+	return 0, false
+}
+
+// placeTiled sets one game tile from a Tiled type name.
+func (d *mapData) placeTiled(c tileCoord, info tiledTile) error {
+	var group uint8
+	switch info.typ {
+	case "teleporter", "door", "switch":
+		if info.group < 1 || info.group > 254 {
+			return fmt.Errorf("%s needs a group between 1 and 254", info.typ)
+		}
+		group = uint8(info.group)
+	}
+	switch info.typ {
+	case "wall":
+		d.tiles[c.Y][c.X] = TileTypeWall
+	case "empty":
+		d.tiles[c.Y][c.X] = TileTypeEmpty
+	case "spawn":
+		d.tiles[c.Y][c.X] = TileTypeSpawn
+	case "mud":
+		d.tiles[c.Y][c.X] = TileTypeMud
+	case "ice":
+		d.tiles[c.Y][c.X] = TileTypeIce
+	case "destructible":
+		d.tiles[c.Y][c.X] = TileTypeDestructibleWall
+	case "teleporter":
+		d.tiles[c.Y][c.X] = TileTypeTeleporter
+		d.teleportPads[group] = append(d.teleportPads[group], c)
+	case "door":
+		d.tiles[c.Y][c.X] = TileTypeDoorClosed
+		d.doorGroups[group] = append(d.doorGroups[group], c)
+	case "switch":
+		d.tiles[c.Y][c.X] = TileTypeSwitch
+		d.switchGroups[c] = group
+	default:
+		log.Printf("Warning: Ignoring unknown Tiled type %q at (%d, %d).", info.typ, c.X, c.Y)
+	}
+	return nil
+}
+
+// addTileset records the typed tiles of a tileset starting at firstGID.
+func (tm *tiledMap) addTileset(firstGID uint32, tiles map[uint32]tiledTile) {
+	for id, info := range tiles {
+		if info.typ != "" {
+			tm.tiles[firstGID+id] = info
+		}
+	}
+}
+
+// tiledTileInfo builds a tiledTile from a tile's class/type and properties.
+func tiledTileInfo(class string, props map[string]string) tiledTile {
+	if class == "" {
+		class = props["type"]
+	}
+	group, _ := strconv.Atoi(props["group"])
+	return tiledTile{typ: strings.ToLower(class), group: group}
+}
+
+// decodeTiledData decodes base64 layer data, optionally compressed, into GIDs.
+func decodeTiledData(data, compression string) ([]uint32, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = bytes.NewReader(raw)
+	switch compression {
+	case "":
+	case "zlib":
+		if r, err = zlib.NewReader(r); err != nil {
+			return nil, err
+		}
+	case "gzip":
+		if r, err = gzip.NewReader(r); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", compression)
+	}
+	raw, err = io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw)%4 != 0 {
+		return nil, fmt.Errorf("layer data is not a whole number of tiles")
+	}
+	gids := make([]uint32, len(raw)/4)
+	for i := range gids {
+		gids[i] = binary.LittleEndian.Uint32(raw[i*4:])
+	}
+	return gids, nil
+}
+
+// --- TMX / TSX (XML) ---
+
+type tmxProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+	Text  string `xml:",chardata"` // Multi-line string properties
+}
+
+type tmxProperties struct {
+	Properties []tmxProperty `xml:"property"`
+}
+
+func (p tmxProperties) toMap() map[string]string {
+	m := make(map[string]string, len(p.Properties))
+	for _, prop := range p.Properties {
+		v := prop.Value
+		if v == "" {
+			v = strings.TrimSpace(prop.Text)
+		}
+		m[prop.Name] = v
+	}
+	return m
+}
+
+type tmxTileset struct {
+	FirstGID uint32 `xml:"firstgid,attr"`
+	Source   string `xml:"source,attr"`
+	Tiles    []struct {
+		ID         uint32        `xml:"id,attr"`
+		Type       string        `xml:"type,attr"`
+		Class      string        `xml:"class,attr"`
+		Properties tmxProperties `xml:"properties"`
+	} `xml:"tile"`
+}
+
+func (ts tmxTileset) tiles() map[uint32]tiledTile {
+	tiles := make(map[uint32]tiledTile)
+	for _, t := range ts.Tiles {
+		class := t.Class
+		if class == "" {
+			class = t.Type
+		}
+		tiles[t.ID] = tiledTileInfo(class, t.Properties.toMap())
+	}
+	return tiles
+}
+
+type tmxObject struct {
+	Type       string        `xml:"type,attr"`
+	Class      string        `xml:"class,attr"`
+	GID        uint32        `xml:"gid,attr"`
+	X          float64       `xml:"x,attr"`
+	Y          float64       `xml:"y,attr"`
+	Width      float64       `xml:"width,attr"`
+	Height     float64       `xml:"height,attr"`
+	Properties tmxProperties `xml:"properties"`
+}
+
+type tmxMap struct {
+	Orientation string        `xml:"orientation,attr"`
+	Width       int           `xml:"width,attr"`
+	Height      int           `xml:"height,attr"`
+	TileWidth   int           `xml:"tilewidth,attr"`
+	TileHeight  int           `xml:"tileheight,attr"`
+	Infinite    int           `xml:"infinite,attr"`
+	Properties  tmxProperties `xml:"properties"`
+	Tilesets    []tmxTileset  `xml:"tileset"`
+	Layers      []struct {
+		Name       string        `xml:"name,attr"`
+		Properties tmxProperties `xml:"properties"`
+		Data       struct {
+			Encoding    string `xml:"encoding,attr"`
+			Compression string `xml:"compression,attr"`
+			Text        string `xml:",chardata"`
+			Tiles       []struct {
+				GID uint32 `xml:"gid,attr"`
+			} `xml:"tile"`
+		} `xml:"data"`
+	} `xml:"layer"`
+	ObjectGroups []struct {
+		Objects []tmxObject `xml:"object"`
+	} `xml:"objectgroup"`
+}
+
+func parseTMX(raw []byte, dir string) (*tiledMap, error) {
+	var m tmxMap
+	if err := xml.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	tm := &tiledMap{
+		width: m.Width, height: m.Height,
+		tileWidth: m.TileWidth, tileHeight: m.TileHeight,
+		orientation: m.Orientation,
+		infinite:    m.Infinite != 0,
+		tiles:       make(map[uint32]tiledTile),
+		props:       m.Properties.toMap(),
+	}
+	for _, ts := range m.Tilesets {
+		tiles, err := tilesetTiles(ts.Source, dir, ts.tiles)
+		if err != nil {
+			return nil, err
+		}
+		tm.addTileset(ts.FirstGID, tiles)
+	}
+	for _, l := range m.Layers {
+		var gids []uint32
+		var err error
+		switch l.Data.Encoding {
+		case "csv":
+			gids, err = parseCSVGIDs(l.Data.Text)
+		case "base64":
+			gids, err = decodeTiledData(l.Data.Text, l.Data.Compression)
+		case "":
+			for _, t := range l.Data.Tiles {
+				gids = append(gids, t.GID)
+			}
+		default:
+			err = fmt.Errorf("unsupported encoding %q", l.Data.Encoding)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("layer %q: %w", l.Name, err)
+		}
+		tm.tileLayers = append(tm.tileLayers, tiledTileLayer{name: l.Name, props: l.Properties.toMap(), gids: gids})
+	}
+	for _, g := range m.ObjectGroups {
+		for _, o := range g.Objects {
+			class := o.Class
+			if class == "" {
+				class = o.Type
+			}
+			y := o.Y
+			if o.GID != 0 {
+				y -= o.Height // Tile objects are anchored at their bottom-left corner
+			}
+			tm.objects = append(tm.objects, tiledObject{
+				typ: strings.ToLower(class), x: o.X, y: y, w: o.Width, h: o.Height,
+				props: o.Properties.toMap(),
+			})
+		}
+	}
+	return tm, nil
+}
+
+func parseCSVGIDs(text string) ([]uint32, error) {
+	fields := strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' || r == ' ' || r == '\t' })
+	gids := make([]uint32, len(fields))
+	for i, f := range fields {
+		v, err := strconv.ParseUint(f, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		gids[i] = uint32(v)
+	}
+	return gids, nil
+}
+
+// tilesetTiles returns the tiles of an inline tileset, or loads the external
+// TSX/TSJ file when source is set.
+func tilesetTiles(source, dir string, inline func() map[uint32]tiledTile) (map[uint32]tiledTile, error) {
+	if source == "" {
+		return inline(), nil
+	}
+	path := filepath.Join(dir, source)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".tsx") {
+		var ts tmxTileset
+		if err := xml.Unmarshal(raw, &ts); err != nil {
+			return nil, fmt.Errorf("tileset '%s': %w", source, err)
+		}
+		return ts.tiles(), nil
+	}
+	var ts tmjTileset
+	if err := json.Unmarshal(raw, &ts); err != nil {
+		return nil, fmt.Errorf("tileset '%s': %w", source, err)
+	}
+	return ts.tiles(), nil
+}
+
+// --- TMJ / TSJ (JSON) ---
+
+type tmjProperty struct {
+	Name  string `json:"name"`
+	Value any    `json:"value"`
+}
+
+func tmjProperties(props []tmjProperty) map[string]string {
+	m := make(map[string]string, len(props))
+	for _, p := range props {
+		m[p.Name] = fmt.Sprint(p.Value)
+	}
+	return m
+}
+
+type tmjTileset struct {
+	FirstGID uint32 `json:"firstgid"`
+	Source   string `json:"source"`
+	Tiles    []struct {
+		ID         uint32        `json:"id"`
+		Type       string        `json:"type"`
+		Class      string        `json:"class"`
+		Properties []tmjProperty `json:"properties"`
+	} `json:"tiles"`
+}
+
+func (ts tmjTileset) tiles() map[uint32]tiledTile {
+	tiles := make(map[uint32]tiledTile)
+	for _, t := range ts.Tiles {
+		class := t.Class
+		if class == "" {
+			class = t.Type
+		}
+		tiles[t.ID] = tiledTileInfo(class, tmjProperties(t.Properties))
+	}
+	return tiles
+}
+
+type tmjLayer struct {
+	Name        string          `json:"name"`
+	Type        string          `json:"type"`
+	Data        json.RawMessage `json:"data"`
+	Encoding    string          `json:"encoding"`
+	Compression string          `json:"compression"`
+	Properties  []tmjProperty   `json:"properties"`
+	Layers      []tmjLayer      `json:"layers"` // Group layers
+	Objects     []struct {
+		Type       string        `json:"type"`
+		Class      string        `json:"class"`
+		GID        uint32        `json:"gid"`
+		X          float64       `json:"x"`
+		Y          float64       `json:"y"`
+		Width      float64       `json:"width"`
+		Height     float64       `json:"height"`
+		Properties []tmjProperty `json:"properties"`
+	} `json:"objects"`
+}
+
+type tmjMap struct {
+	Orientation string        `json:"orientation"`
+	Width       int           `json:"width"`
+	Height      int           `json:"height"`
+	TileWidth   int           `json:"tilewidth"`
+	TileHeight  int           `json:"tileheight"`
+	Infinite    bool          `json:"infinite"`
+	Properties  []tmjProperty `json:"properties"`
+	Tilesets    []tmjTileset  `json:"tilesets"`
+	Layers      []tmjLayer    `json:"layers"`
+}
+
+func parseTMJ(raw []byte, dir string) (*tiledMap, error) {
+	var m tmjMap
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	tm := &tiledMap{
+		width: m.Width, height: m.Height,
+		tileWidth: m.TileWidth, tileHeight: m.TileHeight,
+		orientation: m.Orientation,
+		infinite:    m.Infinite,
+		tiles:       make(map[uint32]tiledTile),
+		props:       tmjProperties(m.Properties),
+	}
+	for _, ts := range m.Tilesets {
+		tiles, err := tilesetTiles(ts.Source, dir, ts.tiles)
+		if err != nil {
+			return nil, err
+		}
+		tm.addTileset(ts.FirstGID, tiles)
+	}
+	if err := tm.addTMJLayers(m.Layers); err != nil {
+		return nil, err
+	}
+	return tm, nil
+}
+
+// addTMJLayers adds tile and object layers, descending into groups.
+func (tm *tiledMap) addTMJLayers(layers []tmjLayer) error {
+	for _, l := range layers {
+		switch l.Type {
+		case "tilelayer":
+			var gids []uint32
+			var err error
+			if l.Encoding == "base64" {
+				var data string
+				if err = json.Unmarshal(l.Data, &data); err == nil {
+					gids, err = decodeTiledData(data, l.Compression)
+				}
+			} else {
+				err = json.Unmarshal(l.Data, &gids)
+			}
+			if err != nil {
+				return fmt.Errorf("layer %q: %w", l.Name, err)
+			}
+			tm.tileLayers = append(tm.tileLayers, tiledTileLayer{name: l.Name, props: tmjProperties(l.Properties), gids: gids})
+		case "objectgroup":
+			for _, o := range l.Objects {
+				class := o.Class
+				if class == "" {
+					class = o.Type
+				}
+				y := o.Y
+				if o.GID != 0 {
+					y -= o.Height // Tile objects are anchored at their bottom-left corner
+				}
+				tm.objects = append(tm.objects, tiledObject{
+					typ: strings.ToLower(class), x: o.X, y: y, w: o.Width, h: o.Height,
+					props: tmjProperties(o.Properties),
+				})
+			}
+		case "group":
+			if err := tm.addTMJLayers(l.Layers); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
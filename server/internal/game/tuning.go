@@ -0,0 +1,87 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Tuning is the gameplay constants an operator may change while the game
+// runs, for balancing without a rebuild. NPCs keep NPCMoveSpeed.
+type Tuning struct {
+	MoveSpeed       float32       // Pixels a player moves per input, before terrain and power-ups
+	HalfWidth       float32       // Half the width of a player's bounding box
+	HalfHeight      float32       // Half its height
+	MovementTimeout time.Duration // A moving player stops after this long without input
+}
+
+// Limits of the tunable values, wide enough for balancing but keeping the
+// simulation sane.
+const (
+	MinMoveSpeed       float32 = 1
+	MaxMoveSpeed       float32 = 128
+	MinHalfSize        float32 = 4
+	MaxHalfSize        float32 = 256
+	MinMovementTimeout         = 50 * time.Millisecond
+	MaxMovementTimeout         = 5 * time.Second
+)
+
+// DefaultTuning returns the built-in values.
+func DefaultTuning() Tuning {
+	return Tuning{
+		MoveSpeed:       PlayerMoveSpeed,
+		HalfWidth:       PlayerHalfWidth,
+		HalfHeight:      PlayerHalfHeight,
+		MovementTimeout: movementTimeout,
+	}
+}
+
+// Validate checks every value is within its limits; the error wraps
+// ErrInvalidTuning.
+func (t Tuning) Validate() error {
+	switch {
+	case t.MoveSpeed < MinMoveSpeed || t.MoveSpeed > MaxMoveSpeed:
+		return fmt.Errorf("%w: move speed must be %v to %v", ErrInvalidTuning, MinMoveSpeed, MaxMoveSpeed)
+	case t.HalfWidth < MinHalfSize || t.HalfWidth > MaxHalfSize || t.HalfHeight < MinHalfSize || t.HalfHeight > MaxHalfSize:
+		return fmt.Errorf("%w: hitbox width and height must be %v to %v", ErrInvalidTuning, 2*MinHalfSize, 2*MaxHalfSize)
+	case t.MovementTimeout < MinMovementTimeout || t.MovementTimeout > MaxMovementTimeout:
+		return fmt.Errorf("%w: movement timeout must be %v to %v", ErrInvalidTuning, MinMovementTimeout, MaxMovementTimeout)
+	}
+	return nil
+}
+
+// Tuning returns the State's current tuning.
+func (s *State) Tuning() Tuning {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tuning
+}
+
+// SetTuning applies new values at once. Players a larger hitbox leaves
+// inside a wall are moved to a spawn point; their IDs are returned.
+func (s *State) SetTuning(t Tuning) (relocated []string, err error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("SetTuning")()
+	grew := t.HalfWidth > s.tuning.HalfWidth || t.HalfHeight > s.tuning.HalfHeight
+	s.tuning = t
+	if !grew {
+		return nil, nil
+	}
+	ids := make([]string, 0, len(s.players))
+	for id := range s.players {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		tp := s.players[id]
+		if s.relocateIfStuckLocked(id, tp, "hitbox change") {
+			relocated = append(relocated, id)
+			s.checkZonesLocked(id, tp)
+		}
+	}
+	return relocated, nil
+}
@@ -0,0 +1,97 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxMapTiles is the largest width or height, in tiles, a map may have.
+const MaxMapTiles = 1024
+
+// maxReportedProblems caps how many problems a validation error lists.
+const maxReportedProblems = 5
+
+// validateMap rejects maps that are too large, have nowhere to stand, or have
+// spawn points players could never leave or reach each other from. Problems
+// are reported by row and column.
+func validateMap(filePath string, d *mapData) error {
+	if d.width > MaxMapTiles || d.height > MaxMapTiles {
+		return &MapError{Path: filePath, Reason: fmt.Sprintf("dimensions %dx%d exceed the limit of %dx%d tiles",
+			d.width, d.height, MaxMapTiles, MaxMapTiles)}
+	}
+	props := mergeTileProperties(d.tileProps)
+	walkable := func(c tileCoord) bool {
+		if d.edges == EdgeWrap {
+			c = tileCoord{X: wrapInt(c.X, d.width), Y: wrapInt(c.Y, d.height)}
+		}
+		if c.X < 0 || c.X >= d.width || c.Y < 0 || c.Y >= d.height {
+			return false
+		}
+		if p, ok := props[d.tiles[c.Y][c.X]]; ok {
+			return p.Walkable
+		}
+		return defaultTileProperty.Walkable
+	}
+
+	var problems []string
+	anyWalkable := false
+	var spawns []tileCoord
+	for y, row := range d.tiles {
+		for x, t := range row {
+			c := tileCoord{X: x, Y: y}
+			if walkable(c) {
+				anyWalkable = true
+			}
+			if t != TileTypeSpawn {
+				continue
+			}
+			if !walkable(c) {
+				problems = append(problems, fmt.Sprintf("row %d, column %d: spawn tile is not walkable", y, x))
+				continue
+			}
+			spawns = append(spawns, c)
+		}
+	}
+	if !anyWalkable {
+		return &MapError{Path: filePath, Reason: "no walkable tiles"}
+	}
+
+	// Every spawn point must share a walkable region with the first one, and
+	// that region must be more than the spawn tile itself.
+	if len(spawns) > 0 {
+		region := map[tileCoord]bool{spawns[0]: true}
+		queue := []tileCoord{spawns[0]}
+		for len(queue) > 0 {
+			c := queue[0]
+			queue = queue[1:]
+			for _, n := range []tileCoord{{c.X + 1, c.Y}, {c.X - 1, c.Y}, {c.X, c.Y + 1}, {c.X, c.Y - 1}} {
+				if d.edges == EdgeWrap {
+					n = tileCoord{X: wrapInt(n.X, d.width), Y: wrapInt(n.Y, d.height)}
+				}
+				if !region[n] && walkable(n) {
+					region[n] = true
+					queue = append(queue, n)
+				}
+			}
+		}
+		first := spawns[0]
+		if len(region) == 1 {
+			problems = append(problems, fmt.Sprintf("row %d, column %d: spawn point is walled in", first.Y, first.X))
+		}
+		for _, sp := range spawns[1:] {
+			if !region[sp] {
+				problems = append(problems, fmt.Sprintf("row %d, column %d: spawn point is unreachable from the spawn point at row %d, column %d",
+					sp.Y, sp.X, first.Y, first.X))
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	reported := problems
+	if len(reported) > maxReportedProblems {
+		reported = append(reported[:maxReportedProblems:maxReportedProblems], fmt.Sprintf("and %d more", len(problems)-maxReportedProblems))
+	}
+	return &MapError{Path: filePath, Reason: "failed validation: " + strings.Join(reported, "; ")}
+}
@@ -0,0 +1,68 @@
+package game
+
+// Toroidal worlds: on a map with wrap enabled, walking off one edge re-enters
+// on the opposite one. Positions are kept within the world bounds, and
+// everything that compares positions or tiles works modulo the world size.
+
+// WrapsAround reports whether the map is toroidal.
+func (s *State) WrapsAround() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.edges == EdgeWrap
+}
+
+// wrapPositionLocked brings a pixel position back into the world.
+// Must be called with the lock held.
+func (s *State) wrapPositionLocked(x, y float32) (float32, float32) {
+	return wrapFloat(x, s.worldMinX, s.worldMaxX), wrapFloat(y, s.worldMinY, s.worldMaxY)
+}
+
+// wrapTileLocked brings a tile coordinate back into the map on wrapping maps,
+// and returns it unchanged otherwise. Must be called with the lock held.
+func (s *State) wrapTileLocked(c tileCoord) tileCoord {
+	if s.edges != EdgeWrap {
+		return c
+	}
+	return tileCoord{X: wrapInt(c.X, s.mapTileWidth), Y: wrapInt(c.Y, s.mapTileHeight)}
+}
+
+// inWorldLocked reports whether a player centered at (x, y) is inside the
+// world. On wrapping maps a player may straddle an edge, so only the center
+// counts. Must be called with the lock held.
+func (s *State) inWorldLocked(x, y float32) bool {
+	if s.edges == EdgeWrap {
+		return x >= s.worldMinX && x < s.worldMaxX && y >= s.worldMinY && y < s.worldMaxY
+	}
+	return x >= s.worldMinX+s.tuning.HalfWidth && x <= s.worldMaxX-s.tuning.HalfWidth &&
+		y >= s.worldMinY+s.tuning.HalfHeight && y <= s.worldMaxY-s.tuning.HalfHeight
+}
+
+// nearestLocked returns the copy of (x, y) closest to (refX, refY), which on
+// wrapping maps may lie outside the world, so distances and overlaps can be
+// computed as on a flat map. Must be called with the lock held.
+func (s *State) nearestLocked(refX, refY, x, y float32) (float32, float32) {
+	if s.edges != EdgeWrap {
+		return x, y
+	}
+	return refX + shortestDelta(x-refX, s.worldMaxX-s.worldMinX), refY + shortestDelta(y-refY, s.worldMaxY-s.worldMinY)
+}
+
+func wrapFloat(v, lo, hi float32) float32 {
+	span := hi - lo
+	for v < lo {
+		v += span
+	}
+	for v >= hi {
+		v -= span
+	}
+	return v
+}
+
+func wrapInt(v, n int) int {
+	return ((v % n) + n) % n
+}
+
+// shortestDelta reduces d to the equivalent offset in [-span/2, span/2).
+func shortestDelta(d, span float32) float32 {
+	return wrapFloat(d, -span/2, span/2)
+}
@@ -0,0 +1,130 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Zone is a rectangular trigger area in tile coordinates (inclusive). A
+// player is inside a zone while the tile under their center is. A zone with
+// points is an objective: each player scores it the first time they enter.
+type Zone struct {
+	ID         string
+	MinX, MinY int
+	MaxX, MaxY int
+	Points     int64
+}
+
+func (z Zone) contains(c tileCoord) bool {
+	return c.X >= z.MinX && c.X <= z.MaxX && c.Y >= z.MinY && c.Y <= z.MaxY
+}
+
+// ZoneEvent reports a player entering or leaving a zone.
+type ZoneEvent struct {
+	PlayerID string
+	ZoneID   string
+	Entered  bool
+}
+
+// AddZone registers a trigger zone, replacing any zone with the same ID.
+// Players already inside it produce an Entered event on their next move.
+func (s *State) AddZone(z Zone) error {
+	if z.ID == "" || z.MinX > z.MaxX || z.MinY > z.MaxY {
+		return fmt.Errorf("invalid zone %+v", z)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("AddZone")()
+	if s.zones == nil {
+		s.zones = make(map[string]Zone)
+	}
+	s.zones[z.ID] = z
+	return nil
+}
+
+// RemoveZone unregisters a zone. Players inside it do not get a Left event.
+func (s *State) RemoveZone(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("RemoveZone")()
+	delete(s.zones, id)
+	for _, tp := range s.players {
+		delete(tp.InZones, id)
+	}
+}
+
+// TakeZoneEvents returns the zone events since the previous call, in the order
+// they happened, and clears the queue.
+func (s *State) TakeZoneEvents() []ZoneEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.auditLocked("TakeZoneEvents")()
+	events := s.zoneEvents
+	s.zoneEvents = nil
+	return events
+}
+
+// checkZonesLocked queues enter/leave events for a player who may have moved.
+// Must be called with the lock held.
+func (s *State) checkZonesLocked(playerID string, tp *trackedPlayer) {
+	if len(s.zones) == 0 && len(tp.InZones) == 0 {
+		return
+	}
+	here := s.tileAt(tp.PlayerData.XPos, tp.PlayerData.YPos)
+	ids := make([]string, 0, len(s.zones))
+	for id := range s.zones {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		inside := s.zones[id].contains(here)
+		if inside == tp.InZones[id] {
+			continue
+		}
+		if inside {
+			if tp.InZones == nil {
+				tp.InZones = make(map[string]bool)
+			}
+			tp.InZones[id] = true
+			s.scoreObjectiveLocked(playerID, tp, s.zones[id])
+		} else {
+			delete(tp.InZones, id)
+		}
+		s.zoneEvents = append(s.zoneEvents, ZoneEvent{PlayerID: playerID, ZoneID: id, Entered: inside})
+	}
+}
+
+// ReachableTile returns the center of a walkable tile at least minSteps tiles
+// (by walking distance) from the given pixel position where a player fits,
+// preferring the closest such tile. It reports false if there is none.
+func (s *State) ReachableTile(x, y float32, minSteps int) (tileX, tileY int, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	start := s.tileAt(x, y)
+	dist := map[tileCoord]int{start: 0}
+	queue := []tileCoord{start}
+	half := float32(s.tileSize) / 2
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		cx, cy := float32(c.X*s.tileSize)+half, float32(c.Y*s.tileSize)+half
+		if dist[c] >= minSteps && !s.checkMapCollision(cx, cy) {
+			return c.X, c.Y, true
+		}
+		for _, n := range []tileCoord{{c.X + 1, c.Y}, {c.X - 1, c.Y}, {c.X, c.Y + 1}, {c.X, c.Y - 1}} {
+			n = s.wrapTileLocked(n)
+			if _, seen := dist[n]; seen {
+				continue
+			}
+			if n.X < 0 || n.X >= s.mapTileWidth || n.Y < 0 || n.Y >= s.mapTileHeight {
+				continue
+			}
+			if !s.propertiesOf(s.worldMap[n.Y][n.X]).Walkable {
+				continue
+			}
+			dist[n] = dist[c] + 1
+			queue = append(queue, n)
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,247 @@
+// Package harness runs a gRPC game server in-process over bufconn and drives
+// it with fake clients, for end-to-end tests of protocol changes. A test
+// starts a Server with the services it needs registered, joins clients and
+// asserts on what they are sent:
+//
+//	srv := harness.Start(t, func(s *grpc.Server) { pb.RegisterGameServiceServer(s, game) })
+//	alice := srv.Join(t, &pb.ClientHello{DesiredUsername: "alice"})
+//	bob := srv.Join(t, &pb.ClientHello{DesiredUsername: "bob"})
+//	alice.Move(t, pb.PlayerInput_RIGHT)
+//	bob.ExpectSequence(t, harness.HasPlayer("alice"), harness.IsChat("hi"))
+//
+// Everything is torn down by the test's Cleanup.
+package harness
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	pb "simple-grpc-game/gen/go/game"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	bufferSize = 1 << 20
+	// DefaultTimeout is how long Expect waits for a matching message.
+	DefaultTimeout = 2 * time.Second
+	inboxSize      = 1024 // Messages a client buffers before the stream blocks
+)
+
+// TB is the part of testing.TB the harness uses.
+type TB interface {
+	Helper()
+	Fatalf(format string, args ...any)
+	Cleanup(func())
+}
+
+// Server is a gRPC server listening on an in-memory connection.
+type Server struct {
+	lis  *bufconn.Listener
+	grpc *grpc.Server
+	conn *grpc.ClientConn
+}
+
+// Start serves the services register adds until the test ends.
+func Start(tb TB, register func(*grpc.Server), opts ...grpc.ServerOption) *Server {
+	tb.Helper()
+	s := &Server{lis: bufconn.Listen(bufferSize), grpc: grpc.NewServer(opts...)}
+	register(s.grpc)
+	go s.grpc.Serve(s.lis)
+	tb.Cleanup(s.grpc.Stop)
+	s.conn = s.Dial(tb)
+	return s
+}
+
+// Dial opens a client connection to the server, closed when the test ends.
+func (s *Server) Dial(tb TB) *grpc.ClientConn {
+	tb.Helper()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return s.lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		tb.Fatalf("dial bufconn: %v", err)
+	}
+	tb.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// Conn is a shared client connection, for unary calls.
+func (s *Server) Conn() *grpc.ClientConn {
+	return s.conn
+}
+
+// Game is a GameService client on the shared connection.
+func (s *Server) Game() pb.GameServiceClient {
+	return pb.NewGameServiceClient(s.conn)
+}
+
+// Client is a fake player on a GameStream of its own connection.
+type Client struct {
+	ID      string // Assigned player ID, from InitialMapData
+	Map     *pb.InitialMapData
+	stream  pb.GameService_GameStreamClient
+	cancel  context.CancelFunc
+	inbox   chan *pb.ServerMessage
+	seq     uint32
+	mu      sync.Mutex
+	err     error // Why the stream ended, once it has
+	history []*pb.ServerMessage
+}
+
+// Join opens a GameStream, sends hello and waits for the map, failing the
+// test if the join is refused.
+func (s *Server) Join(tb TB, hello *pb.ClientHello) *Client {
+	tb.Helper()
+	c, err := s.TryJoin(tb, hello)
+	if err != nil {
+		tb.Fatalf("join as %q: %v", hello.GetDesiredUsername(), err)
+	}
+	return c
+}
+
+// TryJoin is Join returning the refusal instead, for tests of rejected joins.
+func (s *Server) TryJoin(tb TB, hello *pb.ClientHello) (*Client, error) {
+	tb.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	tb.Cleanup(cancel)
+	stream, err := pb.NewGameServiceClient(s.Dial(tb)).GameStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{stream: stream, cancel: cancel, inbox: make(chan *pb.ServerMessage, inboxSize)}
+	if err := c.Send(&pb.ClientMessage{Payload: &pb.ClientMessage_ClientHello{ClientHello: hello}}); err != nil {
+		return nil, err
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if first.GetInitialMapData() == nil {
+		return nil, fmt.Errorf("first message was %T, not InitialMapData", first.GetMessage())
+	}
+	c.Map, c.ID = first.GetInitialMapData(), first.GetInitialMapData().GetAssignedPlayerId()
+	go c.receive()
+	return c, nil
+}
+
+func (c *Client) receive() {
+	defer close(c.inbox)
+	for {
+		msg, err := c.stream.Recv()
+		if err != nil {
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			return
+		}
+		c.inbox <- msg
+	}
+}
+
+// Send sends a raw ClientMessage.
+func (c *Client) Send(msg *pb.ClientMessage) error {
+	return c.stream.Send(msg)
+}
+
+// Move sends a numbered movement input.
+func (c *Client) Move(tb TB, dir pb.PlayerInput_Direction) {
+	tb.Helper()
+	c.seq++
+	if err := c.Send(&pb.ClientMessage{Payload: &pb.ClientMessage_PlayerInput{PlayerInput: &pb.PlayerInput{Direction: dir, Seq: c.seq}}}); err != nil {
+		tb.Fatalf("send input: %v", err)
+	}
+}
+
+// Chat sends a room chat message.
+func (c *Client) Chat(tb TB, text string) {
+	tb.Helper()
+	if err := c.Send(&pb.ClientMessage{Payload: &pb.ClientMessage_SendChatMessage{SendChatMessage: &pb.SendChatMessageRequest{MessageText: text}}}); err != nil {
+		tb.Fatalf("send chat: %v", err)
+	}
+}
+
+// Leave ends the client's stream, as a player closing the game.
+func (c *Client) Leave() {
+	c.stream.CloseSend()
+	c.cancel()
+}
+
+// Next returns the next message, or nil if none arrives within timeout or
+// the stream has ended.
+func (c *Client) Next(timeout time.Duration) *pb.ServerMessage {
+	select {
+	case msg, ok := <-c.inbox:
+		if !ok {
+			return nil
+		}
+		c.mu.Lock()
+		c.history = append(c.history, msg)
+		c.mu.Unlock()
+		return msg
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+// Err returns why the stream ended, or nil while it is open.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// History returns every message taken with Next, Expect or ExpectSequence.
+func (c *Client) History() []*pb.ServerMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*pb.ServerMessage(nil), c.history...)
+}
+
+// Expect skips messages until one matches, failing the test if none does
+// within DefaultTimeout.
+func (c *Client) Expect(tb TB, m Matcher) *pb.ServerMessage {
+	tb.Helper()
+	deadline := time.Now().Add(DefaultTimeout)
+	for {
+		msg := c.Next(time.Until(deadline))
+		if msg == nil {
+			tb.Fatalf("player %s: no message %s within %v (stream error: %v)", c.ID, m.Name, DefaultTimeout, c.Err())
+			return nil
+		}
+		if m.Match(msg) {
+			return msg
+		}
+	}
+}
+
+// ExpectSequence expects messages matching each matcher in order, with any
+// others in between, returning the matching messages.
+func (c *Client) ExpectSequence(tb TB, matchers ...Matcher) []*pb.ServerMessage {
+	tb.Helper()
+	got := make([]*pb.ServerMessage, 0, len(matchers))
+	for _, m := range matchers {
+		got = append(got, c.Expect(tb, m))
+	}
+	return got
+}
+
+// ExpectNone fails the test if a message matching m arrives within d.
+func (c *Client) ExpectNone(tb TB, m Matcher, d time.Duration) {
+	tb.Helper()
+	deadline := time.Now().Add(d)
+	for {
+		msg := c.Next(time.Until(deadline))
+		if msg == nil {
+			return
+		}
+		if m.Match(msg) {
+			tb.Fatalf("player %s: unexpected message %s: %v", c.ID, m.Name, msg)
+		}
+	}
+}
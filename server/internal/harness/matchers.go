@@ -0,0 +1,89 @@
+package harness
+
+import (
+	"fmt"
+	"strings"
+
+	pb "simple-grpc-game/gen/go/game"
+)
+
+// Matcher picks out a server message. Name describes it in failures.
+type Matcher struct {
+	Name  string
+	Match func(*pb.ServerMessage) bool
+}
+
+// Any matches a message that any of ms matches.
+func Any(ms ...Matcher) Matcher {
+	names := make([]string, len(ms))
+	for i, m := range ms {
+		names[i] = m.Name
+	}
+	return Matcher{"any of " + strings.Join(names, ", "), func(msg *pb.ServerMessage) bool {
+		for _, m := range ms {
+			if m.Match(msg) {
+				return true
+			}
+		}
+		return false
+	}}
+}
+
+// IsDelta matches any DeltaUpdate.
+func IsDelta() Matcher {
+	return Matcher{"delta update", func(msg *pb.ServerMessage) bool { return msg.GetDeltaUpdate() != nil }}
+}
+
+// HasPlayer matches a DeltaUpdate adding or updating a player with the
+// display name or ID.
+func HasPlayer(nameOrID string) Matcher {
+	return PlayerWhere(fmt.Sprintf("updating %q", nameOrID), func(p *pb.Player) bool {
+		return p.GetDisplayName() == nameOrID || p.GetId() == nameOrID
+	})
+}
+
+// PlayerWhere matches a DeltaUpdate with an updated player satisfying ok.
+func PlayerWhere(name string, ok func(*pb.Player) bool) Matcher {
+	return Matcher{"delta " + name, func(msg *pb.ServerMessage) bool {
+		for _, p := range msg.GetDeltaUpdate().GetUpdatedPlayers() {
+			if ok(p) {
+				return true
+			}
+		}
+		return false
+	}}
+}
+
+// RemovesPlayer matches a DeltaUpdate removing the player ID.
+func RemovesPlayer(id string) Matcher {
+	return Matcher{fmt.Sprintf("delta removing %q", id), func(msg *pb.ServerMessage) bool {
+		for _, removed := range msg.GetDeltaUpdate().GetRemovedPlayerIds() {
+			if removed == id {
+				return true
+			}
+		}
+		return false
+	}}
+}
+
+// IsChat matches a chat message with the text.
+func IsChat(text string) Matcher {
+	return Matcher{fmt.Sprintf("chat %q", text), func(msg *pb.ServerMessage) bool {
+		return msg.GetChatMessage().GetMessageText() == text
+	}}
+}
+
+// IsDisconnect matches a DisconnectNotice.
+func IsDisconnect() Matcher {
+	return Matcher{"disconnect notice", func(msg *pb.ServerMessage) bool { return msg.GetDisconnectNotice() != nil }}
+}
+
+// Is matches a message whose oneof is set to the field, named as in the
+// proto, such as "scoreboard" or "tile_update".
+func Is(field string) Matcher {
+	return Matcher{field, func(msg *pb.ServerMessage) bool {
+		oneof := msg.ProtoReflect().Descriptor().Oneofs().ByName("message")
+		set := msg.ProtoReflect().WhichOneof(oneof)
+		return set != nil && string(set.Name()) == field
+	}}
+}